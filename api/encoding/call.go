@@ -149,3 +149,11 @@ func (c *Call) RoutingDelegate() string {
 	}
 	return c.md.RoutingDelegate()
 }
+
+// Criticality returns the criticality of this request.
+func (c *Call) Criticality() transport.Criticality {
+	if c == nil {
+		return ""
+	}
+	return c.md.Criticality()
+}
@@ -20,6 +20,8 @@
 
 package encoding
 
+import "go.uber.org/yarpc/api/transport"
+
 // CallOption defines options that may be passed in at call sites to other
 // services.
 //
@@ -55,3 +57,8 @@ func WithRoutingKey(rk string) CallOption {
 func WithRoutingDelegate(rd string) CallOption {
 	return CallOption{func(o *OutboundCall) { o.routingDelegate = &rd }}
 }
+
+// WithCriticality sets the criticality of the request.
+func WithCriticality(c transport.Criticality) CallOption {
+	return CallOption{func(o *OutboundCall) { o.criticality = &c }}
+}
@@ -41,6 +41,7 @@ func TestNilCall(t *testing.T) {
 	assert.Equal(t, "", call.ShardKey())
 	assert.Equal(t, "", call.RoutingKey())
 	assert.Equal(t, "", call.RoutingDelegate())
+	assert.Equal(t, transport.Criticality(""), call.Criticality())
 	assert.Equal(t, "", call.Header("foo"))
 	assert.Empty(t, call.HeaderNames())
 
@@ -58,6 +59,7 @@ func TestReadFromRequest(t *testing.T) {
 		ShardKey:        "sk",
 		RoutingKey:      "rk",
 		RoutingDelegate: "rd",
+		Criticality:     transport.CriticalitySheddable,
 		Headers:         transport.NewHeaders().With("foo", "bar"),
 	})
 	call := CallFromContext(ctx)
@@ -71,6 +73,7 @@ func TestReadFromRequest(t *testing.T) {
 	assert.Equal(t, "sk", call.ShardKey())
 	assert.Equal(t, "rk", call.RoutingKey())
 	assert.Equal(t, "rd", call.RoutingDelegate())
+	assert.Equal(t, transport.CriticalitySheddable, call.Criticality())
 	assert.Equal(t, "bar", call.Header("foo"))
 	assert.Len(t, call.HeaderNames(), 1)
 
@@ -38,6 +38,7 @@ type OutboundCall struct {
 	shardKey        *string
 	routingKey      *string
 	routingDelegate *string
+	criticality     *transport.Criticality
 
 	// If non-nil, response headers should be written here.
 	responseHeaders *map[string]string
@@ -80,6 +81,9 @@ func (c *OutboundCall) WriteToRequest(ctx context.Context, req *transport.Reques
 	if c.routingDelegate != nil {
 		req.RoutingDelegate = *c.routingDelegate
 	}
+	if c.criticality != nil {
+		req.Criticality = *c.criticality
+	}
 
 	// NB(abg): context and error are unused for now but we want to leave room
 	// for CallOptions which can fail or modify the context.
@@ -104,6 +108,9 @@ func (c *OutboundCall) WriteToRequestMeta(ctx context.Context, reqMeta *transpor
 	if c.routingDelegate != nil {
 		reqMeta.RoutingDelegate = *c.routingDelegate
 	}
+	if c.criticality != nil {
+		reqMeta.Criticality = *c.criticality
+	}
 
 	// NB(abg): context and error are unused for now but we want to leave room
 	// for CallOptions which can fail or modify the context.
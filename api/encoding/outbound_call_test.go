@@ -119,6 +119,15 @@ func TestOutboundCallWriteToRequestAndRequestMeta(t *testing.T) {
 				RoutingDelegate: "zzz",
 			},
 		},
+		{
+			desc: "criticality",
+			giveOptions: []CallOption{
+				WithCriticality(transport.CriticalitySheddable),
+			},
+			wantRequest: transport.Request{
+				Criticality: transport.CriticalitySheddable,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+// Criticality indicates how important it is that a request is served when
+// its destination is overloaded. Servers that shed load drop less critical
+// requests first.
+//
+// The empty criticality is treated as CriticalityCritical.
+type Criticality string
+
+const (
+	// CriticalityCriticalPlus is for requests whose failure has the most
+	// visible impact on users. They are shed last.
+	CriticalityCriticalPlus Criticality = "critical_plus"
+
+	// CriticalityCritical is for user-facing requests. This is the default.
+	CriticalityCritical Criticality = "critical"
+
+	// CriticalitySheddablePlus is for requests that may be retried later,
+	// for example, by batch jobs.
+	CriticalitySheddablePlus Criticality = "sheddable_plus"
+
+	// CriticalitySheddable is for requests that may fail without impact,
+	// like speculative or best-effort work. They are shed first.
+	CriticalitySheddable Criticality = "sheddable"
+)
+
+// Rank orders criticalities from the least critical, 0, to the most critical.
+// Unknown criticalities are ranked like CriticalityCritical.
+func (c Criticality) Rank() int {
+	switch c {
+	case CriticalitySheddable:
+		return 0
+	case CriticalitySheddablePlus:
+		return 1
+	case CriticalityCriticalPlus:
+		return 3
+	default:
+		return 2
+	}
+}
@@ -64,6 +64,10 @@ type Request struct {
 	// override the routing key and service.
 	RoutingDelegate string
 
+	// Criticality indicates how important it is that the request is served
+	// when the destined service is overloaded.
+	Criticality Criticality
+
 	// Request payload.
 	Body io.Reader
 
@@ -86,12 +90,14 @@ func (r *Request) ToRequestMeta() *RequestMeta {
 		ShardKey:        r.ShardKey,
 		RoutingKey:      r.RoutingKey,
 		RoutingDelegate: r.RoutingDelegate,
+		Criticality:     r.Criticality,
 	}
 }
 
 // MarshalLogObject implements zap.ObjectMarshaler.
 func (r *Request) MarshalLogObject(enc zapcore.ObjectEncoder) error {
-	// TODO (#788): Include headers once we can omit PII.
+	// Headers are omitted since they may carry PII. The dispatcher logs
+	// them, redacted, when configured to with yarpc.LoggingConfig.Headers.
 	enc.AddString("caller", r.Caller)
 	enc.AddString("service", r.Service)
 	enc.AddString("transport", r.Transport)
@@ -100,6 +106,9 @@ func (r *Request) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	enc.AddString("shardKey", r.ShardKey)
 	enc.AddString("routingKey", r.RoutingKey)
 	enc.AddString("routingDelegate", r.RoutingDelegate)
+	if r.Criticality != "" {
+		enc.AddString("criticality", string(r.Criticality))
+	}
 	return nil
 }
 
@@ -190,6 +199,10 @@ type RequestMeta struct {
 	// for the destined service for routing purposes. The routing delegate may
 	// override the routing key and service.
 	RoutingDelegate string
+
+	// Criticality indicates how important it is that the request is served
+	// when the destined service is overloaded.
+	Criticality Criticality
 }
 
 // ToRequest converts a RequestMeta into a Request.
@@ -207,5 +220,6 @@ func (r *RequestMeta) ToRequest() *Request {
 		ShardKey:        r.ShardKey,
 		RoutingKey:      r.RoutingKey,
 		RoutingDelegate: r.RoutingDelegate,
+		Criticality:     r.Criticality,
 	}
 }
@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package transport
+
+import "net/url"
+
+// RESTRoute binds a unary procedure to a RESTful HTTP method and path
+// template, as described by google.api.http annotations.
+//
+// Transports that support RESTful routing, such as HTTP, translate matching
+// HTTP requests into requests to the procedure. RESTRoutes are typically
+// generated by an encoding, for example by protoc-gen-yarpc-go for
+// annotated protobuf methods.
+type RESTRoute struct {
+	// Procedure is the name of the procedure called by this route.
+	Procedure string
+
+	// Encoding of the request and response bodies exchanged with the
+	// procedure.
+	Encoding Encoding
+
+	// Method is the HTTP method of the route, for example "GET".
+	Method string
+
+	// Pattern is the path template of the route, using the google.api.http
+	// syntax, for example "/v1/{name=shelves/*}/books:list".
+	Pattern string
+
+	// BuildRequestBody builds the body of the procedure request from the
+	// variables bound from the path template, the URL query parameters and
+	// the HTTP request body.
+	BuildRequestBody func(pathVars map[string]string, query url.Values, httpBody []byte) ([]byte, error)
+
+	// BuildResponseBody builds the HTTP response body from the body of the
+	// procedure response. If nil, the procedure response body is used as-is.
+	BuildResponseBody func(body []byte) ([]byte, error)
+}
@@ -115,6 +115,11 @@ func (m RequestMatcher) Matches(got interface{}) bool {
 		return false
 	}
 
+	if l.Criticality != r.Criticality {
+		m.t.Logf("Criticality mismatch: %s != %s", l.Criticality, r.Criticality)
+		return false
+	}
+
 	// len check to handle nil vs empty cases gracefully.
 	if l.Headers.Len() != r.Headers.Len() {
 		if !reflect.DeepEqual(l.Headers, r.Headers) {
@@ -0,0 +1,109 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package auth defines the interfaces for authenticating the callers of
+// YARPC requests.
+//
+// An outbound attaches Credentials to each request it sends, and an inbound
+// verifies them with one or more Authenticators. The verified Principal is
+// available to handlers through yarpc.CallFromContext.
+//
+// Implementations of these interfaces and the middleware that applies them
+// are provided by the go.uber.org/yarpc/x/auth package.
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.uber.org/yarpc/api/transport"
+)
+
+// HeaderKey is the request header that carries credentials. Its value has the
+// form "<scheme> <credentials>".
+const HeaderKey = "authorization"
+
+// ErrNoCredentials is returned by an Authenticator if the request does not
+// carry credentials for its scheme. Other authenticators may then be tried.
+var ErrNoCredentials = errors.New("request has no credentials for this authentication scheme")
+
+// Principal is the verified identity of the caller of a request.
+type Principal struct {
+	// Name identifies the caller, for example the subject of a token or the
+	// identity in a client certificate.
+	Name string
+
+	// Scheme is the authentication scheme that verified the caller.
+	Scheme string
+
+	// Claims holds additional attributes of the caller that were verified
+	// along with its name.
+	Claims map[string]string
+}
+
+// Authenticator verifies the credentials of inbound requests.
+type Authenticator interface {
+	// Authenticate returns the caller of the request.
+	//
+	// ErrNoCredentials is returned if the request does not carry credentials
+	// for this authenticator. Any other error means that the credentials
+	// could not be verified.
+	Authenticate(ctx context.Context, req *transport.RequestMeta) (*Principal, error)
+}
+
+// Credentials provides the credentials attached to outbound requests.
+type Credentials interface {
+	// Scheme is the name of the authentication scheme.
+	Scheme() string
+
+	// Credentials returns the credentials for the request, without the scheme.
+	Credentials(ctx context.Context, req *transport.RequestMeta) (string, error)
+}
+
+// CredentialsFromHeaders returns the credentials for the given scheme from
+// request headers. Schemes are compared case-insensitively. Returns false if
+// the headers carry no credentials for the scheme.
+func CredentialsFromHeaders(headers transport.Headers, scheme string) (string, bool) {
+	v, ok := headers.Get(HeaderKey)
+	if !ok {
+		return "", false
+	}
+	i := strings.IndexByte(v, ' ')
+	if i < 0 || !strings.EqualFold(v[:i], scheme) {
+		return "", false
+	}
+	return strings.TrimSpace(v[i+1:]), true
+}
+
+type principalKey struct{} // context key for the Principal
+
+// WithPrincipal returns a copy of the context that carries the verified
+// principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the verified principal carried by the
+// context, if any.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
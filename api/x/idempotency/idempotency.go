@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package idempotency defines the request header and the response store used
+// to deduplicate YARPC requests by idempotency key.
+//
+// Callers attach a key to requests that must not be executed more than once,
+// like payments, with yarpc.WithIdempotencyKey, and reuse it when retrying.
+// Inbounds store the response to the first request with a key and return it
+// for later requests with the same key.
+//
+// The middleware and an in-memory Store are provided by the
+// go.uber.org/yarpc/x/idempotency package.
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/yarpc/api/transport"
+)
+
+// HeaderKey is the request header that carries the idempotency key.
+const HeaderKey = "idempotency-key"
+
+// Response is a unary response stored for an idempotency key.
+type Response struct {
+	Headers              transport.Headers
+	Body                 []byte
+	ApplicationError     bool
+	ApplicationErrorMeta *transport.ApplicationErrorMeta
+}
+
+// Store stores responses by key.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the response stored for the key, or nil if there is none
+	// or it expired.
+	Get(ctx context.Context, key string) (*Response, error)
+
+	// Set stores the response for the key for the given duration.
+	Set(ctx context.Context, key string, res *Response, ttl time.Duration) error
+}
@@ -36,4 +36,10 @@ type ChooserStatus struct {
 type PeerStatus struct {
 	Identifier string `json:"identifier"`
 	State      string `json:"state"`
+
+	// ConnectionStatus and PendingRequests are the connection status of the
+	// peer and the number of requests pending on it, for tools which read
+	// them without parsing State.
+	ConnectionStatus string `json:"connectionStatus,omitempty"`
+	PendingRequests  int    `json:"pendingRequests"`
 }
@@ -34,6 +34,18 @@ type OutboundStatus struct {
 	Chooser     ChooserStatus `json:"chooser"`
 	Service     string        `json:"service"`
 	OutboundKey string        `json:"outboundkey"`
+
+	// Routes is the routing table of outbounds that send requests to other
+	// outbounds, in order of precedence.
+	Routes []RouteStatus `json:"routes,omitempty"`
+}
+
+// RouteStatus describes a route of an outbound that sends requests to other
+// outbounds.
+type RouteStatus struct {
+	Match    string         `json:"match"`
+	Target   string         `json:"target"`
+	Outbound OutboundStatus `json:"outbound"`
 }
 
 // OutboundStatusNotSupported is returned when not valid OutboundStatus can be
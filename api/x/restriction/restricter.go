@@ -33,8 +33,9 @@ import (
 	"go.uber.org/yarpc/api/transport"
 )
 
-// Checker is used by encoding clients, for example Protobuf and Thrift, to
-// prevent unwanted transport-encoding combinations.
+// Checker is used by encoding clients, for example Protobuf and Thrift, and by
+// the dispatcher (see yarpc.Config.Restriction) to prevent unwanted
+// transport-encoding combinations.
 //
 // Errors indicate whitelisted combinations.
 type Checker interface {
@@ -106,3 +107,25 @@ func (r *checker) Check(encoding transport.Encoding, transportName string) error
 
 	return fmt.Errorf("%q is not a whitelisted combination, available: %q", t.String(), r.availableMsg)
 }
+
+// TransportChecker is implemented by Checkers that can tell whether a
+// transport is allowed at all, regardless of encoding. The dispatcher uses
+// it to reject outbounds over forbidden transports at startup. Combinations
+// of an allowed transport with a forbidden encoding are only rejected when
+// requests are made.
+type TransportChecker interface {
+	CheckTransport(transportName string) error
+}
+
+var _ TransportChecker = (*checker)(nil)
+
+// CheckTransport returns nil if at least one whitelisted combination uses the
+// given transport. Errors indicate whitelisted combinations.
+func (r *checker) CheckTransport(transportName string) error {
+	for t := range r.tuples {
+		if t.Transport == transportName {
+			return nil
+		}
+	}
+	return fmt.Errorf("transport %q is not part of any whitelisted combination, available: %q", transportName, r.availableMsg)
+}
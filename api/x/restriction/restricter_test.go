@@ -57,6 +57,14 @@ func TestRestricter(t *testing.T) {
 			assert.EqualError(t, err,
 				`"trans/enc" is not a whitelisted combination, available: "test-transport/test-encoding"`)
 		})
+
+		t.Run("transport", func(t *testing.T) {
+			tc, ok := r.(TransportChecker)
+			require.True(t, ok, "expected a TransportChecker")
+			assert.NoError(t, tc.CheckTransport(testTransport))
+			assert.EqualError(t, tc.CheckTransport("trans"),
+				`transport "trans" is not part of any whitelisted combination, available: "test-transport/test-encoding"`)
+		})
 	})
 
 	t.Run("invalid tuple", func(t *testing.T) {
@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package yarpc
+
+import (
+	"context"
+
+	"go.uber.org/yarpc/internal/baggage"
+)
+
+// WithBaggage returns a copy of the context carrying the given baggage item,
+// in addition to the baggage it already carries. Keys are case-insensitive,
+// and may only contain letters, digits, "-", "_" and ".". Values must be
+// printable ASCII.
+//
+// Outbound requests made with the context send its baggage to the next
+// service, which receives it in the contexts of its handlers and sends it
+// on in turn. Only baggage whose keys are listed in Config.Baggage crosses
+// hops. Unlike tracer baggage, this does not depend on the tracer in use.
+//
+// 	ctx = yarpc.WithBaggage(ctx, "tenant", "acme")
+// 	res, err := client.Get(ctx, req)
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	return baggage.WithBaggage(ctx, key, value)
+}
+
+// BaggageFromContext returns the baggage carried by the context, with
+// lower-case keys, or nil if it carries none. The returned map may be
+// modified freely.
+//
+// 	func Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+// 		tenant := yarpc.BaggageFromContext(ctx)["tenant"]
+// 		...
+// 	}
+func BaggageFromContext(ctx context.Context) map[string]string {
+	return baggage.FromContext(ctx)
+}
@@ -25,6 +25,7 @@ import (
 
 	"go.uber.org/yarpc/api/encoding"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/x/idempotency"
 )
 
 // CallOption defines options that may be passed in at call sites to other
@@ -81,6 +82,24 @@ func WithRoutingDelegate(rd string) CallOption {
 	return CallOption(encoding.WithRoutingDelegate(rd))
 }
 
+// WithIdempotencyKey sets the idempotency key of the request. Servers that
+// deduplicate requests return the stored response to an earlier request with
+// the same key instead of handling it again. Reuse the key when retrying a
+// request that must not be executed more than once.
+//
+// 	_, err := client.Charge(ctx, req, yarpc.WithIdempotencyKey(chargeID))
+func WithIdempotencyKey(key string) CallOption {
+	return CallOption(encoding.WithHeader(idempotency.HeaderKey, key))
+}
+
+// WithCriticality sets the criticality of the request. Servers that shed
+// load under overload drop less critical requests first.
+//
+// 	_, err := client.Reindex(ctx, req, yarpc.WithCriticality(transport.CriticalitySheddable))
+func WithCriticality(c transport.Criticality) CallOption {
+	return CallOption(encoding.WithCriticality(c))
+}
+
 // Call provides information about the current request inside handlers. An
 // instance of Call for the current request can be obtained by calling
 // CallFromContext on the request context.
@@ -166,6 +185,12 @@ func (c *Call) RoutingDelegate() string {
 	return (*encoding.Call)(c).RoutingDelegate()
 }
 
+// Criticality returns the criticality of this request, or an empty string
+// if the caller did not set it.
+func (c *Call) Criticality() transport.Criticality {
+	return (*encoding.Call)(c).Criticality()
+}
+
 // StreamOption defines options that may be passed in at streaming function
 // call sites.
 //
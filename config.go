@@ -22,13 +22,17 @@ package yarpc
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/uber-go/tally"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/net/metrics"
 	"go.uber.org/net/metrics/tallypush"
 	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/x/restriction"
 	"go.uber.org/yarpc/internal/observability"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -94,6 +98,94 @@ type LoggingConfig struct {
 
 	// Levels configures the levels at which YARPC logs various messages.
 	Levels LogLevelConfig
+
+	// Headers configures which request and response headers are logged.
+	// By default, no headers are logged.
+	Headers HeaderLoggingConfig
+}
+
+// HeaderRedaction specifies how the values of sensitive headers are logged.
+type HeaderRedaction string
+
+const (
+	// RedactMask logs sensitive headers with their values replaced by
+	// "[REDACTED]". This is the default.
+	RedactMask HeaderRedaction = "mask"
+
+	// RedactHash logs a truncated HMAC-SHA256 of the values of sensitive
+	// headers, so that requests carrying the same value may be correlated.
+	// The HMAC is keyed with HashKey, or a random per-process key if unset.
+	RedactHash HeaderRedaction = "hash"
+
+	// RedactDrop omits sensitive headers from logs.
+	RedactDrop HeaderRedaction = "drop"
+)
+
+// HeaderLoggingConfig configures which headers are logged for inbound and
+// outbound requests.
+type HeaderLoggingConfig struct {
+	Inbound, Outbound DirectionalHeaderLoggingConfig
+}
+
+// DirectionalHeaderLoggingConfig configures which headers are logged for
+// requests in one direction.
+//
+// Headers whose names contain "auth", "token", "secret", "passw", "cookie",
+// "credential", "session", "signature", "apikey", "api-key", "api_key" or
+// "private" are always redacted.
+type DirectionalHeaderLoggingConfig struct {
+	// Request and Response enable logging of request and response headers.
+	Request, Response bool
+
+	// Allow, if non-empty, lists the only headers which are logged.
+	Allow []string
+
+	// Deny lists headers which are never logged.
+	Deny []string
+
+	// Redact lists headers whose values are redacted, in addition to those
+	// which look like they carry secrets.
+	Redact []string
+
+	// Redaction specifies how sensitive headers are logged.
+	//
+	// Defaults to RedactMask.
+	Redaction HeaderRedaction
+
+	// HashKey keys the HMAC logged for sensitive headers with RedactHash.
+	// Processes sharing a key log the same hash for the same value.
+	//
+	// Defaults to a random key chosen when the process starts.
+	HashKey []byte
+
+	// Redactor, if set, redacts sensitive headers instead of Redaction. It
+	// returns the value to log, or false to omit the header.
+	Redactor func(key, value string) (redacted string, ok bool)
+}
+
+func (c DirectionalHeaderLoggingConfig) observability() observability.HeadersConfig {
+	redactor := observability.Redactor(c.Redactor)
+	if redactor == nil {
+		switch c.Redaction {
+		case RedactHash:
+			redactor = observability.HashRedactor
+			if len(c.HashKey) > 0 {
+				redactor = observability.NewHashRedactor(c.HashKey)
+			}
+		case RedactDrop:
+			redactor = observability.DropRedactor
+		default:
+			redactor = observability.MaskRedactor
+		}
+	}
+	return observability.HeadersConfig{
+		Request:  c.Request,
+		Response: c.Response,
+		Allow:    c.Allow,
+		Deny:     c.Deny,
+		Redact:   c.Redact,
+		Redactor: redactor,
+	}
 }
 
 func (c LoggingConfig) logger(name string) *zap.Logger {
@@ -114,6 +206,44 @@ func (c LoggingConfig) extractor() observability.ContextExtractor {
 	return observability.ContextExtractor(c.ContextExtractor)
 }
 
+// RequestIDConfig configures request IDs.
+//
+// With request IDs enabled, the context of every inbound request carries a
+// request ID, taken from the request header or newly generated. Outbound
+// requests made with that context send the ID in the same header, and log
+// entries of the dispatcher include it under "requestID".
+//
+// HTTP inbounds receive the header from other YARPC services. To accept it
+// from HTTP clients as a plain X-Request-Id header, list it with the
+// http.GrabHeaders inbound option.
+type RequestIDConfig struct {
+	// Enabled enables request IDs.
+	Enabled bool
+
+	// Header carrying request IDs. Defaults to "x-request-id".
+	Header string
+
+	// Generate returns new request IDs. Defaults to random IDs of 32
+	// hexadecimal digits.
+	Generate func() string
+}
+
+// BaggageConfig configures the propagation of baggage, set with WithBaggage.
+//
+// Baggage crosses hops only if its key is allowed. Inbound baggage which is
+// not allowed is dropped, as are items past the size limit. Outbound requests
+// do not send baggage which is not allowed, and fail if the allowed baggage
+// exceeds the size limit.
+type BaggageConfig struct {
+	// Allow lists the baggage keys which cross hops. Without it, no baggage
+	// is propagated.
+	Allow []string
+
+	// MaxSize limits the total size of the keys and values of the baggage
+	// of a request, in bytes. Defaults to 4096.
+	MaxSize int
+}
+
 // MetricsConfig describes how telemetry should be configured.
 // Scope and Tally are exclusive; choose one.
 // If neither is present, metrics are not recorded, all instrumentation becomes
@@ -122,6 +252,8 @@ func (c LoggingConfig) extractor() observability.ContextExtractor {
 // If a metrics scope is preseent, we use that scope to record metrics and they
 // are not pushed to Tally.
 // If Tally is present, we use its metrics scope and push them periodically.
+// If Prometheus is present and no metrics scope is, metrics are also served
+// in the Prometheus exposition format.
 type MetricsConfig struct {
 	// Metrics is a *"go.uber.org/net/metrics".Scope for recording stats.
 	// YARPC does not push these metrics; pushing metrics from the root is an
@@ -131,12 +263,91 @@ type MetricsConfig struct {
 	// default, metrics are collected in memory but not pushed.
 	// TODO deprecate this option for metrics configuration.
 	Tally tally.Scope
+
+	// Prometheus, if set, serves metrics in the Prometheus exposition format
+	// through Dispatcher.MetricsHandler. It is ignored if Metrics is set;
+	// serve the metrics.Root of that scope instead.
+	Prometheus *PrometheusConfig
+
+	// Inbound and Outbound customize the metrics of inbound and outbound
+	// calls.
+	Inbound, Outbound DirectionalMetricsConfig
+
+	// Tags, if not empty, lists the tags of call metrics which are kept,
+	// among "source", "dest", "transport", "procedure", "encoding",
+	// "routing_key" and "routing_delegate". The "direction" and "rpc_type"
+	// tags are always kept. By default, all tags are kept.
+	Tags []string
+
+	// NormalizeUnknownProcedures records inbound calls to procedures which
+	// are not registered on the dispatcher, such as those served by
+	// RouterMiddleware, with the procedure tag "__unknown_procedure__".
+	// This keeps callers sending arbitrary procedure names from creating
+	// arbitrarily many metrics.
+	NormalizeUnknownProcedures bool
+
+	// MaxEdges, if positive, caps the number of distinct combinations of
+	// tags that call metrics are recorded for. Calls with further
+	// combinations are recorded with all tags but "direction" and
+	// "rpc_type" set to "__overflow__".
+	MaxEdges int
 }
 
-func (c MetricsConfig) scope(name string, logger *zap.Logger) (*metrics.Scope, context.CancelFunc) {
-	// Neither: no-op metrics, not pushed
-	if c.Metrics == nil && c.Tally == nil {
-		return nil, func() {}
+// PrometheusConfig configures serving metrics in the Prometheus exposition
+// format.
+type PrometheusConfig struct {
+	// Path, if set, is the path under which the HTTP inbounds of the
+	// dispatcher serve metrics, alongside YARPC requests.
+	Path string
+}
+
+// DirectionalMetricsConfig customizes the metrics of calls in one
+// direction.
+type DirectionalMetricsConfig struct {
+	// LatencyBuckets are the upper bounds of the buckets of latency
+	// histograms, in increasing order, with millisecond precision. Buckets
+	// must be at least a millisecond, and remain increasing once truncated
+	// to milliseconds.
+	//
+	// Defaults to the RPC latency buckets of
+	// go.uber.org/net/metrics/bucket.
+	LatencyBuckets []time.Duration
+}
+
+// validate returns an error if the metrics configuration is invalid.
+func (c MetricsConfig) validate() error {
+	if err := observability.ValidateTags(c.Tags); err != nil {
+		return err
+	}
+	if _, err := observability.LatencyBucketsMs(c.Inbound.LatencyBuckets); err != nil {
+		return fmt.Errorf("invalid inbound latency buckets: %v", err)
+	}
+	if _, err := observability.LatencyBucketsMs(c.Outbound.LatencyBuckets); err != nil {
+		return fmt.Errorf("invalid outbound latency buckets: %v", err)
+	}
+	return nil
+}
+
+// latencyBucketsMs returns the latency buckets in milliseconds. The
+// configuration must have been validated.
+func (c DirectionalMetricsConfig) latencyBucketsMs() []int64 {
+	buckets, _ := observability.LatencyBucketsMs(c.LatencyBuckets)
+	return buckets
+}
+
+// scope returns the scope for recording metrics of the dispatcher, the root
+// serving them in the Prometheus format, if any, and a function to stop
+// pushing them.
+func (c MetricsConfig) scope(name string, logger *zap.Logger) (*metrics.Scope, *metrics.Root, context.CancelFunc) {
+	if c.Metrics != nil && c.Prometheus != nil {
+		logger.Warn("yarpc.NewDispatcher ignores Metrics.Prometheus when Metrics.Metrics is set. " +
+			"To serve metrics in the Prometheus format, serve the metrics.Root of that scope")
+		c.Prometheus = nil
+	}
+
+	// None: no-op metrics, not pushed
+	if c.Metrics == nil && c.Tally == nil && c.Prometheus == nil {
+		return nil, nil, func() {}
 	}
 
 	// Both: ignore Tally and warn.
@@ -154,28 +365,34 @@ func (c MetricsConfig) scope(name string, logger *zap.Logger) (*metrics.Scope, c
 	if c.Metrics != nil {
 		// root remains nil
 		parent = c.Metrics
-	} else { // c.Tally != nil
+	} else { // c.Tally != nil || c.Prometheus != nil
 		root = metrics.New()
 		parent = root.Scope()
 	}
 
+	// The root is served only if asked to.
+	served := root
+	if c.Prometheus == nil {
+		served = nil
+	}
+
 	meter := parent.Tagged(metrics.Tags{
 		"component":  _packageName,
 		"dispatcher": name,
 	})
 
-	// When we have c.Metrics, we do not push
-	if root == nil {
-		return meter, func() {}
+	// When we have c.Metrics or only c.Prometheus, we do not push
+	if root == nil || c.Tally == nil {
+		return meter, served, func() {}
 	}
 
 	// When we have c.Tally, we measure *and* push
 	stopMeter, err := root.Push(tallypush.New(c.Tally), _tallyPushInterval)
 	if err != nil {
 		logger.Error("Failed to start pushing metrics to Tally.", zap.Error(err))
-		return meter, func() {}
+		return meter, served, func() {}
 	}
-	return meter, stopMeter
+	return meter, served, stopMeter
 }
 
 // Config specifies the parameters of a new Dispatcher constructed via
@@ -209,6 +426,24 @@ type Config struct {
 	// tracer directly on the transports used to build inbounds and outbounds.
 	Tracer opentracing.Tracer
 
+	// TracerProvider, if set, records OpenTelemetry spans for all inbound
+	// and outbound requests. Span context is propagated between services
+	// with the W3C Trace Context headers, traceparent and tracestate.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider, if set, records the duration of all inbound and
+	// outbound requests in the OpenTelemetry rpc.server.duration and
+	// rpc.client.duration value recorders.
+	MeterProvider metric.MeterProvider
+
+	// RequestID configures request IDs, which correlate the logs of a request
+	// across services.
+	RequestID RequestIDConfig
+
+	// Baggage configures which baggage, set with WithBaggage, is propagated
+	// across services.
+	Baggage BaggageConfig
+
 	// RouterMiddleware is middleware to control how requests are routed.
 	RouterMiddleware middleware.Router
 
@@ -224,4 +459,19 @@ type Config struct {
 	// observability middleware is being inserted in the Inbound/Outbound
 	// Middleware.
 	DisableAutoObservabilityMiddleware bool
+
+	// Restriction, if set, limits the transport-encoding combinations that
+	// may be used over the dispatcher's outbounds.
+	//
+	// The restriction is enforced when requests are made, since the
+	// dispatcher does not know which encodings the clients of an outbound
+	// will use. Requests with a forbidden combination, such as Thrift over
+	// gRPC when only Protobuf over gRPC is allowed, fail with an
+	// InvalidArgument error before reaching the transport.
+	//
+	// Start only rejects outbounds whose transport is not allowed for any
+	// encoding, and only if the Checker implements
+	// restriction.TransportChecker, as those built by restriction.NewChecker
+	// do.
+	Restriction restriction.Checker
 }
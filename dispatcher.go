@@ -23,17 +23,23 @@ package yarpc
 import (
 	"context"
 	"fmt"
+	"net/http"
 
 	"go.uber.org/multierr"
 	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/x/restriction"
 	"go.uber.org/yarpc/internal"
+	"go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/internal/firstoutboundmiddleware"
 	"go.uber.org/yarpc/internal/inboundmiddleware"
 	"go.uber.org/yarpc/internal/observability"
+	"go.uber.org/yarpc/internal/opentelemetry"
 	"go.uber.org/yarpc/internal/outboundmiddleware"
 	"go.uber.org/yarpc/internal/request"
+	"go.uber.org/yarpc/internal/requestid"
 	"go.uber.org/yarpc/pkg/lifecycle"
 	"go.uber.org/zap"
 )
@@ -75,37 +81,130 @@ func NewDispatcher(cfg Config) *Dispatcher {
 	if err := internal.ValidateServiceName(cfg.Name); err != nil {
 		panic("yarpc.NewDispatcher expects a valid service name: " + err.Error())
 	}
+	if err := cfg.Metrics.validate(); err != nil {
+		panic("yarpc.NewDispatcher expects a valid metrics configuration: " + err.Error())
+	}
 
 	logger := cfg.Logging.logger(cfg.Name)
 	extractor := cfg.Logging.extractor()
 
-	meter, stopMeter := cfg.Metrics.scope(cfg.Name, logger)
-	cfg = addObservingMiddleware(cfg, meter, logger, extractor)
+	router := NewMapRouter(cfg.Name)
+	meter, metricsRoot, stopMeter := cfg.Metrics.scope(cfg.Name, logger)
+	mountMetricsHandler(cfg, metricsRoot, logger)
+	meterPeerLists(cfg.Outbounds, meter)
+	cfg = addObservingMiddleware(cfg, meter, logger, extractor, router)
+	cfg = addRequestIDMiddleware(cfg)
+	cfg = addBaggageMiddleware(cfg)
+	cfg = addOpenTelemetryMiddleware(cfg, logger)
 	cfg = addFirstOutboundMiddleware(cfg)
 
 	return &Dispatcher{
 		name:              cfg.Name,
-		table:             middleware.ApplyRouteTable(NewMapRouter(cfg.Name), cfg.RouterMiddleware),
+		table:             middleware.ApplyRouteTable(router, cfg.RouterMiddleware),
 		inbounds:          cfg.Inbounds,
-		outbounds:         convertOutbounds(cfg.Outbounds, cfg.OutboundMiddleware),
+		outbounds:         convertOutbounds(cfg.Outbounds, cfg.OutboundMiddleware, cfg.Restriction),
 		transports:        collectTransports(cfg.Inbounds, cfg.Outbounds),
 		inboundMiddleware: cfg.InboundMiddleware,
+		restrictionErr:    checkRestriction(cfg.Outbounds, cfg.Restriction),
 		log:               logger,
 		meter:             meter,
+		metricsRoot:       metricsRoot,
 		stopMeter:         stopMeter,
 		once:              lifecycle.NewOnce(),
 	}
 }
 
-func addObservingMiddleware(cfg Config, meter *metrics.Scope, logger *zap.Logger, extractor observability.ContextExtractor) Config {
+// httpHandlerMounter is implemented by inbounds which serve HTTP handlers
+// alongside YARPC requests, like HTTP inbounds.
+type httpHandlerMounter interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// mountMetricsHandler serves the metrics of the dispatcher under the
+// configured path of its HTTP inbounds.
+func mountMetricsHandler(cfg Config, root *metrics.Root, logger *zap.Logger) {
+	if root == nil || cfg.Metrics.Prometheus.Path == "" {
+		return
+	}
+
+	var mounted bool
+	for _, i := range cfg.Inbounds {
+		if m, ok := i.(httpHandlerMounter); ok {
+			m.Handle(cfg.Metrics.Prometheus.Path, root)
+			mounted = true
+		}
+	}
+	if !mounted {
+		logger.Warn("No inbound can serve metrics in the Prometheus format.",
+			zap.String("path", cfg.Metrics.Prometheus.Path))
+	}
+}
+
+// meteredPeerList is implemented by peer lists which record metrics, like
+// those built on peer/abstractlist.
+type meteredPeerList interface {
+	SetMeter(meter *metrics.Scope)
+}
+
+// meterPeerLists makes the peer lists of the outbounds record metrics in the
+// scope of the dispatcher, tagged with the outbound name.
+func meterPeerLists(outbounds Outbounds, meter *metrics.Scope) {
+	if meter == nil {
+		return
+	}
+
+	seen := make(map[meteredPeerList]struct{})
+	for key, o := range outbounds {
+		for _, out := range []transport.Outbound{o.Unary, o.Oneway, o.Stream} {
+			list, ok := outboundPeerList(out)
+			if !ok {
+				continue
+			}
+			// Outbounds may share a peer list, which can only record its
+			// metrics once.
+			if _, ok := seen[list]; ok {
+				continue
+			}
+			seen[list] = struct{}{}
+			list.SetMeter(meter.Tagged(metrics.Tags{"outbound": key}))
+		}
+	}
+}
+
+func outboundPeerList(out transport.Outbound) (meteredPeerList, bool) {
+	o, ok := out.(interface{ Chooser() peer.Chooser })
+	if !ok {
+		return nil, false
+	}
+	chooser := o.Chooser()
+	// Peer lists bound to updaters, with peer.Bind, are wrapped.
+	if bound, ok := chooser.(interface{ ChooserList() peer.ChooserList }); ok {
+		chooser = bound.ChooserList()
+	}
+	list, ok := chooser.(meteredPeerList)
+	return list, ok
+}
+
+func addObservingMiddleware(cfg Config, meter *metrics.Scope, logger *zap.Logger, extractor observability.ContextExtractor, router MapRouter) Config {
 	if cfg.DisableAutoObservabilityMiddleware {
 		return cfg
 	}
 
+	var knownProcedure func(service, procedure string) bool
+	if cfg.Metrics.NormalizeUnknownProcedures {
+		knownProcedure = router.hasProcedure
+	}
+
+	var extractors []observability.ContextExtractor
+	if cfg.RequestID.Enabled {
+		extractors = append(extractors, requestid.ContextExtractor)
+	}
+
 	observer := observability.NewMiddleware(observability.Config{
-		Logger:           logger,
-		Scope:            meter,
-		ContextExtractor: extractor,
+		Logger:            logger,
+		Scope:             meter,
+		ContextExtractor:  extractor,
+		ContextExtractors: extractors,
 		Levels: observability.LevelsConfig{
 			Default: observability.DirectionalLevelsConfig{
 				Success:          cfg.Logging.Levels.Success,
@@ -123,6 +222,13 @@ func addObservingMiddleware(cfg Config, meter *metrics.Scope, logger *zap.Logger
 				ApplicationError: cfg.Logging.Levels.Outbound.ApplicationError,
 			},
 		},
+		InboundHeaders:         cfg.Logging.Headers.Inbound.observability(),
+		OutboundHeaders:        cfg.Logging.Headers.Outbound.observability(),
+		InboundLatencyBuckets:  cfg.Metrics.Inbound.latencyBucketsMs(),
+		OutboundLatencyBuckets: cfg.Metrics.Outbound.latencyBucketsMs(),
+		Tags:                   cfg.Metrics.Tags,
+		KnownProcedure:         knownProcedure,
+		MaxEdges:               cfg.Metrics.MaxEdges,
 	})
 
 	cfg.InboundMiddleware.Unary = inboundmiddleware.UnaryChain(observer, cfg.InboundMiddleware.Unary)
@@ -136,6 +242,74 @@ func addObservingMiddleware(cfg Config, meter *metrics.Scope, logger *zap.Logger
 	return cfg
 }
 
+// addOpenTelemetryMiddleware wraps the observing middleware so that its logs
+// and metrics are recorded within the request's span.
+func addOpenTelemetryMiddleware(cfg Config, logger *zap.Logger) Config {
+	if cfg.TracerProvider == nil && cfg.MeterProvider == nil {
+		return cfg
+	}
+
+	otel := opentelemetry.NewMiddleware(opentelemetry.Config{
+		TracerProvider: cfg.TracerProvider,
+		MeterProvider:  cfg.MeterProvider,
+		Logger:         logger,
+	})
+
+	cfg.InboundMiddleware.Unary = inboundmiddleware.UnaryChain(otel, cfg.InboundMiddleware.Unary)
+	cfg.InboundMiddleware.Oneway = inboundmiddleware.OnewayChain(otel, cfg.InboundMiddleware.Oneway)
+	cfg.InboundMiddleware.Stream = inboundmiddleware.StreamChain(otel, cfg.InboundMiddleware.Stream)
+
+	cfg.OutboundMiddleware.Unary = outboundmiddleware.UnaryChain(cfg.OutboundMiddleware.Unary, otel)
+	cfg.OutboundMiddleware.Oneway = outboundmiddleware.OnewayChain(cfg.OutboundMiddleware.Oneway, otel)
+	cfg.OutboundMiddleware.Stream = outboundmiddleware.StreamChain(cfg.OutboundMiddleware.Stream, otel)
+
+	return cfg
+}
+
+// addRequestIDMiddleware gives inbound requests a request ID, before the
+// observability middleware logs them, and propagates it to outbound requests.
+func addRequestIDMiddleware(cfg Config) Config {
+	if !cfg.RequestID.Enabled {
+		return cfg
+	}
+
+	mw := requestid.NewMiddleware(requestid.Config{
+		Header:   cfg.RequestID.Header,
+		Generate: cfg.RequestID.Generate,
+	})
+
+	cfg.InboundMiddleware.Unary = inboundmiddleware.UnaryChain(mw, cfg.InboundMiddleware.Unary)
+	cfg.InboundMiddleware.Oneway = inboundmiddleware.OnewayChain(mw, cfg.InboundMiddleware.Oneway)
+	cfg.InboundMiddleware.Stream = inboundmiddleware.StreamChain(mw, cfg.InboundMiddleware.Stream)
+
+	cfg.OutboundMiddleware.Unary = outboundmiddleware.UnaryChain(mw, cfg.OutboundMiddleware.Unary)
+	cfg.OutboundMiddleware.Oneway = outboundmiddleware.OnewayChain(mw, cfg.OutboundMiddleware.Oneway)
+	cfg.OutboundMiddleware.Stream = outboundmiddleware.StreamChain(mw, cfg.OutboundMiddleware.Stream)
+
+	return cfg
+}
+
+// addBaggageMiddleware restricts the baggage propagated by inbound and
+// outbound requests. It is the first inbound middleware, so that handlers and
+// other middleware only see allowed baggage, and the last outbound
+// middleware, so that baggage set by other middleware is restricted too.
+func addBaggageMiddleware(cfg Config) Config {
+	mw := baggage.NewMiddleware(baggage.Config{
+		Allow:   cfg.Baggage.Allow,
+		MaxSize: cfg.Baggage.MaxSize,
+	})
+
+	cfg.InboundMiddleware.Unary = inboundmiddleware.UnaryChain(mw, cfg.InboundMiddleware.Unary)
+	cfg.InboundMiddleware.Oneway = inboundmiddleware.OnewayChain(mw, cfg.InboundMiddleware.Oneway)
+	cfg.InboundMiddleware.Stream = inboundmiddleware.StreamChain(mw, cfg.InboundMiddleware.Stream)
+
+	cfg.OutboundMiddleware.Unary = outboundmiddleware.UnaryChain(cfg.OutboundMiddleware.Unary, mw)
+	cfg.OutboundMiddleware.Oneway = outboundmiddleware.OnewayChain(cfg.OutboundMiddleware.Oneway, mw)
+	cfg.OutboundMiddleware.Stream = outboundmiddleware.StreamChain(cfg.OutboundMiddleware.Stream, mw)
+
+	return cfg
+}
+
 // Add the first outbound middleware, which ensures that `transport.Request`
 // will have appropriate fields.
 func addFirstOutboundMiddleware(cfg Config) Config {
@@ -147,7 +321,7 @@ func addFirstOutboundMiddleware(cfg Config) Config {
 }
 
 // convertOutbounds applies outbound middleware and creates validator outbounds
-func convertOutbounds(outbounds Outbounds, mw OutboundMiddleware) Outbounds {
+func convertOutbounds(outbounds Outbounds, mw OutboundMiddleware, r restriction.Checker) Outbounds {
 	outboundSpecs := make(Outbounds, len(outbounds))
 
 	for outboundKey, outs := range outbounds {
@@ -166,17 +340,17 @@ func convertOutbounds(outbounds Outbounds, mw OutboundMiddleware) Outbounds {
 
 		if outs.Unary != nil {
 			unaryOutbound = middleware.ApplyUnaryOutbound(outs.Unary, mw.Unary)
-			unaryOutbound = request.UnaryValidatorOutbound{UnaryOutbound: unaryOutbound, Namer: namerOrNil(unaryOutbound)}
+			unaryOutbound = request.UnaryValidatorOutbound{UnaryOutbound: unaryOutbound, Namer: namerOrNil(unaryOutbound), Restriction: r}
 		}
 
 		if outs.Oneway != nil {
 			onewayOutbound = middleware.ApplyOnewayOutbound(outs.Oneway, mw.Oneway)
-			onewayOutbound = request.OnewayValidatorOutbound{OnewayOutbound: onewayOutbound, Namer: namerOrNil(onewayOutbound)}
+			onewayOutbound = request.OnewayValidatorOutbound{OnewayOutbound: onewayOutbound, Namer: namerOrNil(onewayOutbound), Restriction: r}
 		}
 
 		if outs.Stream != nil {
 			streamOutbound = middleware.ApplyStreamOutbound(outs.Stream, mw.Stream)
-			streamOutbound = request.StreamValidatorOutbound{StreamOutbound: streamOutbound, Namer: namerOrNil(streamOutbound)}
+			streamOutbound = request.StreamValidatorOutbound{StreamOutbound: streamOutbound, Namer: namerOrNil(streamOutbound), Restriction: r}
 		}
 
 		if outs.ServiceName != "" {
@@ -201,6 +375,32 @@ func namerOrNil(o transport.Outbound) (namer transport.Namer) {
 	return
 }
 
+// checkRestriction verifies that every outbound uses a transport that the
+// restriction allows for at least one encoding. The encodings of requests are
+// only known when they are made, so forbidden combinations over an allowed
+// transport are rejected by the validator outbounds instead.
+func checkRestriction(outbounds Outbounds, r restriction.Checker) error {
+	checker, ok := r.(restriction.TransportChecker)
+	if !ok {
+		return nil
+	}
+
+	var err error
+	for outboundKey, outs := range outbounds {
+		for _, o := range []transport.Outbound{outs.Unary, outs.Oneway, outs.Stream} {
+			namer := namerOrNil(o)
+			if namer == nil {
+				continue
+			}
+			if cerr := checker.CheckTransport(namer.TransportName()); cerr != nil {
+				err = multierr.Append(err, fmt.Errorf("outbound %q is restricted: %v", outboundKey, cerr))
+				break
+			}
+		}
+	}
+	return err
+}
+
 // collectTransports iterates over all inbounds and outbounds and collects all
 // of their unique underlying transports. Multiple inbounds and outbounds may
 // share a transport, and we only want the dispatcher to manage their lifecycle
@@ -247,10 +447,12 @@ type Dispatcher struct {
 	transports []transport.Transport
 
 	inboundMiddleware InboundMiddleware
+	restrictionErr    error // reported by Start
 
-	log       *zap.Logger
-	meter     *metrics.Scope
-	stopMeter context.CancelFunc
+	log         *zap.Logger
+	meter       *metrics.Scope
+	metricsRoot *metrics.Root
+	stopMeter   context.CancelFunc
 
 	once *lifecycle.Once
 }
@@ -265,6 +467,20 @@ func (d *Dispatcher) Inbounds() Inbounds {
 	return inbounds
 }
 
+// MetricsHandler returns an http.Handler serving the metrics of the
+// dispatcher in the Prometheus exposition format, including metrics of calls,
+// stream messages and peer lists.
+//
+// It returns nil unless Config.Metrics.Prometheus is set and
+// Config.Metrics.Metrics is not. The handler may be mounted on the ServeMux
+// of an HTTP inbound given with the Mux option.
+func (d *Dispatcher) MetricsHandler() http.Handler {
+	if d.metricsRoot == nil {
+		return nil
+	}
+	return d.metricsRoot
+}
+
 // Outbounds returns a copy of the list of outbounds for this RPC object.
 func (d *Dispatcher) Outbounds() Outbounds {
 	outbounds := make(Outbounds, len(d.outbounds))
@@ -380,6 +596,9 @@ func (d *Dispatcher) Start() error {
 	}
 	return d.once.Start(func() error {
 		d.log.Info("starting dispatcher")
+		if err := d.restrictionErr; err != nil {
+			return err
+		}
 		starter.setRouters()
 		if err := starter.StartTransports(); err != nil {
 			return err
@@ -411,6 +630,9 @@ func (d *Dispatcher) PhasedStart() (*PhasedStarter, error) {
 	}
 	if err := d.once.Start(func() error {
 		starter.log.Info("beginning phased dispatcher start")
+		if err := d.restrictionErr; err != nil {
+			return err
+		}
 		starter.setRouters()
 		return nil
 	}); err != nil {
@@ -24,18 +24,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	nethttp "net/http"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	. "go.uber.org/yarpc"
+	apipeer "go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/transport/transporttest"
 	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/api/x/restriction"
 	"go.uber.org/yarpc/internal/observability"
+	"go.uber.org/yarpc/peer"
+	"go.uber.org/yarpc/peer/hostport"
+	"go.uber.org/yarpc/peer/roundrobin"
 	"go.uber.org/yarpc/transport/http"
 	"go.uber.org/yarpc/transport/tchannel"
+	"go.uber.org/yarpc/yarpcerrors"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -44,6 +53,7 @@ import (
 	tchannelgo "github.com/uber/tchannel-go"
 	"go.uber.org/atomic"
 	"go.uber.org/multierr"
+	"go.uber.org/net/metrics"
 	thriftrwversion "go.uber.org/thriftrw/version"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -100,6 +110,42 @@ func TestDispatcherNamePanic(t *testing.T) {
 	}
 }
 
+func TestDispatcherInvalidMetricsConfig(t *testing.T) {
+	tests := []struct {
+		desc    string
+		give    MetricsConfig
+		wantErr string
+	}{
+		{
+			desc:    "unknown tag",
+			give:    MetricsConfig{Tags: []string{"shard_key"}},
+			wantErr: `unknown metrics tag "shard_key"`,
+		},
+		{
+			desc: "sub-millisecond bucket",
+			give: MetricsConfig{Inbound: DirectionalMetricsConfig{
+				LatencyBuckets: []time.Duration{500 * time.Microsecond},
+			}},
+			wantErr: "invalid inbound latency buckets: latency buckets must be at least 1ms, got 500µs",
+		},
+		{
+			desc: "buckets equal in milliseconds",
+			give: MetricsConfig{Outbound: DirectionalMetricsConfig{
+				LatencyBuckets: []time.Duration{1200 * time.Microsecond, 1700 * time.Microsecond},
+			}},
+			wantErr: "invalid outbound latency buckets: latency buckets must be increasing at millisecond precision, got 1.7ms after 1.2ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.PanicsWithValue(t, "yarpc.NewDispatcher expects a valid metrics configuration: "+tt.wantErr, func() {
+				NewDispatcher(Config{Name: "test", Metrics: tt.give})
+			})
+		})
+	}
+}
+
 func TestDispatcherRegisterPanic(t *testing.T) {
 	d := basicDispatcher(t)
 
@@ -669,6 +715,51 @@ func TestClientConfigWithOutboundServiceNameOverride(t *testing.T) {
 	assert.Equal(t, "my-real-service", cc.Service())
 }
 
+func TestRestriction(t *testing.T) {
+	newConfig := func(t *testing.T, tuples ...restriction.Tuple) Config {
+		checker, err := restriction.NewChecker(tuples...)
+		require.NoError(t, err)
+		return Config{
+			Name: "test",
+			Outbounds: Outbounds{"my-test-service": {
+				Unary: http.NewTransport().NewSingleOutbound("http://127.0.0.1:1234"),
+			}},
+			Restriction: checker,
+		}
+	}
+
+	t.Run("forbidden encoding", func(t *testing.T) {
+		// The transport is allowed for another encoding, so the dispatcher
+		// starts and only the request fails.
+		dispatcher := NewDispatcher(newConfig(t, restriction.Tuple{Transport: "http", Encoding: "json"}))
+		require.NoError(t, dispatcher.Start())
+		defer dispatcher.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		cc := dispatcher.ClientConfig("my-test-service")
+		_, err := cc.GetUnaryOutbound().Call(ctx, &transport.Request{
+			Service:   "my-test-service",
+			Caller:    "test",
+			Procedure: "hello",
+			Encoding:  "thrift",
+		})
+		require.Error(t, err)
+		assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code())
+		assert.Contains(t, err.Error(), `"http/thrift" is not a whitelisted combination`)
+	})
+
+	t.Run("forbidden transport", func(t *testing.T) {
+		dispatcher := NewDispatcher(newConfig(t, restriction.Tuple{Transport: "grpc", Encoding: "proto"}))
+		err := dispatcher.Start()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `outbound "my-test-service" is restricted: transport "http" is not part of any whitelisted combination`)
+
+		_, err = dispatcher.PhasedStart()
+		assert.Error(t, err)
+	})
+}
+
 func TestEnableObservabilityMiddleware(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -754,6 +845,105 @@ func TestObservabilityMiddlewareApplicationErrorLevel(t *testing.T) {
 
 }
 
+func TestObservabilityMiddlewareHeaderLogging(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req := &transport.Request{
+		Service:   "test",
+		Caller:    "test",
+		Procedure: "test",
+		Encoding:  transport.Encoding("test"),
+		Headers: transport.NewHeaders().
+			With("x-tenant", "foo").
+			With("x-debug", "bar").
+			With("authorization", "baz"),
+	}
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Transports().AnyTimes()
+	out.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	dispatcher := NewDispatcher(Config{
+		Name: "test",
+		Outbounds: Outbounds{
+			"my-test-service": {
+				ServiceName: "my-real-service",
+				Unary:       out,
+			},
+		},
+		Logging: LoggingConfig{
+			Zap: zap.New(core),
+			Headers: HeaderLoggingConfig{
+				Outbound: DirectionalHeaderLoggingConfig{
+					Request:   true,
+					Deny:      []string{"x-debug"},
+					Redaction: RedactDrop,
+				},
+			},
+		},
+	})
+
+	cc := dispatcher.MustOutboundConfig("my-test-service")
+	_, err := cc.Outbounds.Unary.Call(ctx, req)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.TakeAll()[0].ContextMap()["yarpc"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"x-tenant": "foo"}, fields["requestHeaders"])
+}
+
+func TestHeaderLoggingHashKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req := &transport.Request{
+		Service:   "my-real-service",
+		Caller:    "test",
+		Procedure: "test",
+		Encoding:  transport.Encoding("test"),
+		Headers:   transport.NewHeaders().With("authorization", "foo"),
+	}
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Transports().AnyTimes()
+	out.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	dispatcher := NewDispatcher(Config{
+		Name: "test",
+		Outbounds: Outbounds{
+			"my-test-service": {
+				ServiceName: "my-real-service",
+				Unary:       out,
+			},
+		},
+		Logging: LoggingConfig{
+			Zap: zap.New(core),
+			Headers: HeaderLoggingConfig{
+				Outbound: DirectionalHeaderLoggingConfig{
+					Request:   true,
+					Redaction: RedactHash,
+					HashKey:   []byte("secret"),
+				},
+			},
+		},
+	})
+
+	cc := dispatcher.MustOutboundConfig("my-test-service")
+	_, err := cc.Outbounds.Unary.Call(ctx, req)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, logs.Len())
+	fields := logs.TakeAll()[0].ContextMap()["yarpc"].(map[string]interface{})
+	assert.Equal(t,
+		map[string]interface{}{"authorization": "hmac-sha256:773ba44693c7553d"},
+		fields["requestHeaders"])
+}
+
 func TestDisableObservabilityMiddleware(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -793,6 +983,217 @@ func TestDisableObservabilityMiddleware(t *testing.T) {
 	assert.Equal(t, 0, logs.Len())
 }
 
+func TestMetricsHandler(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	httpTransport := http.NewTransport()
+	inbound := httpTransport.NewInbound("127.0.0.1:0")
+	dispatcher := NewDispatcher(Config{
+		Name:     "test",
+		Inbounds: Inbounds{inbound},
+		Metrics: MetricsConfig{
+			Prometheus: &PrometheusConfig{Path: "/metrics"},
+		},
+	})
+	require.NotNil(t, dispatcher.MetricsHandler(), "expected a metrics handler")
+
+	handler := transporttest.NewMockUnaryHandler(mockCtrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	dispatcher.Register([]transport.Procedure{{
+		Name:        "hello",
+		HandlerSpec: transport.NewUnaryHandlerSpec(handler),
+	}})
+	require.NoError(t, dispatcher.Start(), "failed to start dispatcher")
+	defer dispatcher.Stop()
+
+	addr := fmt.Sprintf("http://%v", inbound.Addr())
+	out := httpTransport.NewSingleOutbound(addr)
+	require.NoError(t, out.Start(), "failed to start outbound")
+	defer out.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := out.Call(ctx, &transport.Request{
+		Caller:    "caller",
+		Service:   "test",
+		Procedure: "hello",
+		Encoding:  "raw",
+		Body:      strings.NewReader("body"),
+	})
+	require.NoError(t, err, "call failed")
+	require.NoError(t, res.Body.Close())
+
+	resp, err := nethttp.Get(addr + "/metrics")
+	require.NoError(t, err, "failed to get metrics")
+	defer resp.Body.Close()
+	assert.Equal(t, nethttp.StatusOK, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "failed to read metrics")
+	assert.Contains(t, string(body), `calls{`)
+	assert.Contains(t, string(body), `procedure="hello"`)
+}
+
+func TestMetricsHandlerNotServed(t *testing.T) {
+	tests := []struct {
+		desc string
+		give MetricsConfig
+	}{
+		{desc: "no config"},
+		{desc: "tally", give: MetricsConfig{Tally: tally.NoopScope}},
+		{
+			desc: "external scope",
+			give: MetricsConfig{
+				Metrics:    metrics.New().Scope(),
+				Prometheus: &PrometheusConfig{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			cfg := basicConfig(t)
+			cfg.Metrics = tt.give
+			assert.Nil(t, NewDispatcher(cfg).MetricsHandler())
+		})
+	}
+}
+
+func TestPeerListMetrics(t *testing.T) {
+	httpTransport := http.NewTransport()
+	list := roundrobin.New(httpTransport)
+	require.NoError(t, list.Update(apipeer.ListUpdates{
+		Additions: []apipeer.Identifier{hostport.PeerIdentifier("127.0.0.1:1234")},
+	}))
+	bound := peer.Bind(list, peer.BindPeers(nil))
+
+	root := metrics.New()
+	NewDispatcher(Config{
+		Name: "test",
+		Outbounds: Outbounds{
+			"foo": {
+				Unary:  httpTransport.NewOutbound(bound),
+				Oneway: httpTransport.NewOutbound(bound),
+			},
+			"bar": {
+				Unary: httpTransport.NewSingleOutbound("http://127.0.0.1:1234"),
+			},
+		},
+		Metrics: MetricsConfig{Metrics: root.Scope()},
+	})
+
+	var found bool
+	for _, g := range root.Snapshot().Gauges {
+		if g.Name != "peer_list_unavailable_peers" {
+			continue
+		}
+		found = true
+		assert.Equal(t, metrics.Tags{
+			"component":  "yarpc",
+			"dispatcher": "test",
+			"outbound":   "foo",
+			"peerlist":   "round-robin",
+		}, g.Tags)
+	}
+	assert.True(t, found, "expected peer list metrics")
+}
+
+func TestRequestID(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx = WithRequestID(ctx, "abc")
+
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Transports().AnyTimes()
+	out.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+			id, ok := req.Headers.Get("x-request-id")
+			assert.True(t, ok, "expected request ID header")
+			assert.Equal(t, "abc", id)
+			return &transport.Response{}, nil
+		})
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	dispatcher := NewDispatcher(Config{
+		Name: "test",
+		Outbounds: Outbounds{
+			"my-test-service": {Unary: out},
+		},
+		Logging:   LoggingConfig{Zap: zap.New(core)},
+		RequestID: RequestIDConfig{Enabled: true},
+	})
+
+	cc := dispatcher.MustOutboundConfig("my-test-service")
+	_, err := cc.Outbounds.Unary.Call(ctx, &transport.Request{
+		Service:   "test",
+		Caller:    "test",
+		Procedure: "test",
+		Encoding:  transport.Encoding("test"),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 1, logs.Len())
+	fields, ok := logs.All()[0].ContextMap()["yarpc"].(map[string]interface{})
+	require.True(t, ok, "expected yarpc log fields")
+	assert.Equal(t, "abc", fields["requestID"])
+}
+
+func TestBaggage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	httpTransport := http.NewTransport()
+	inbound := httpTransport.NewInbound("127.0.0.1:0")
+	server := NewDispatcher(Config{
+		Name:     "server",
+		Inbounds: Inbounds{inbound},
+		Baggage:  BaggageConfig{Allow: []string{"tenant"}},
+	})
+
+	handler := transporttest.NewMockUnaryHandler(mockCtrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ *transport.Request, _ transport.ResponseWriter) error {
+			assert.Equal(t, map[string]string{"tenant": "acme"}, BaggageFromContext(ctx))
+			return nil
+		})
+	server.Register([]transport.Procedure{{
+		Name:        "hello",
+		HandlerSpec: transport.NewUnaryHandlerSpec(handler),
+	}})
+	require.NoError(t, server.Start(), "failed to start server")
+	defer server.Stop()
+
+	client := NewDispatcher(Config{
+		Name: "client",
+		Outbounds: Outbounds{
+			"server": {Unary: httpTransport.NewSingleOutbound(fmt.Sprintf("http://%v", inbound.Addr()))},
+		},
+		// The server drops "experiment", and "secret" is never sent.
+		Baggage: BaggageConfig{Allow: []string{"tenant", "experiment"}},
+	})
+	require.NoError(t, client.Start(), "failed to start client")
+	defer client.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx = WithBaggage(ctx, "tenant", "acme")
+	ctx = WithBaggage(ctx, "experiment", "on")
+	ctx = WithBaggage(ctx, "secret", "hunter2")
+
+	res, err := client.ClientConfig("server").GetUnaryOutbound().Call(ctx, &transport.Request{
+		Caller:    "client",
+		Service:   "server",
+		Procedure: "hello",
+		Encoding:  "raw",
+		Body:      strings.NewReader("body"),
+	})
+	require.NoError(t, err, "call failed")
+	require.NoError(t, res.Body.Close())
+}
+
 func TestObservabilityConfig(t *testing.T) {
 	// Validate that we can start a dispatcher with various logging and metrics
 	// configs.
@@ -805,6 +1206,12 @@ func TestObservabilityConfig(t *testing.T) {
 	metricsCfgs := []MetricsConfig{
 		{},
 		{Tally: tally.NewTestScope("" /* prefix */, nil /* tags */)},
+		{
+			Inbound:                    DirectionalMetricsConfig{LatencyBuckets: []time.Duration{time.Millisecond, time.Second}},
+			Tags:                       []string{"procedure"},
+			NormalizeUnknownProcedures: true,
+			MaxEdges:                   100,
+		},
 	}
 
 	for _, l := range logCfgs {
@@ -32,6 +32,8 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/gogo/googleapis/google/api"
+	"github.com/gogo/protobuf/proto"
 	"go.uber.org/yarpc/internal/protoplugin"
 )
 
@@ -211,7 +213,28 @@ func build{{$service.GetName}}YARPCProcedures(params build{{$service.GetName}}YA
 func Build{{$service.GetName}}YARPCProcedures(server {{$service.GetName}}YARPCServer) []transport.Procedure {
 	return build{{$service.GetName}}YARPCProcedures(build{{$service.GetName}}YARPCProceduresParams{Server:server})
 }
-
+{{$restRules := restRules $service}}{{if $restRules}}
+// Build{{$service.GetName}}YARPCRESTRoutes returns the RESTful routes declared by the google.api.http
+// annotations of the {{$service.GetName}} service, for use with the HTTP inbound RESTRoutes option.
+func Build{{$service.GetName}}YARPCRESTRoutes() []transport.RESTRoute {
+	return protobuf.BuildRESTRoutes(
+		protobuf.BuildRESTRoutesParams{
+			ServiceName: "{{trimPrefixPeriod $service.FQSN}}",
+			Rules: []protobuf.BuildRESTRoutesRuleParams{
+			{{range $rule := $restRules}}{
+					MethodName: "{{$rule.MethodName}}",
+					HTTPMethod: {{printf "%q" $rule.HTTPMethod}},
+					Pattern: {{printf "%q" $rule.Pattern}},
+					Body: {{printf "%q" $rule.Body}},
+					ResponseBody: {{printf "%q" $rule.ResponseBody}},
+					NewRequest: new{{$service.GetName}}Service{{$rule.MethodName}}YARPCRequest,
+				},
+			{{end}}
+			},
+		},
+	)
+}
+{{end}}
 // Fx{{$service.GetName}}YARPCClientParams defines the input
 // for NewFx{{$service.GetName}}YARPCClient. It provides the
 // paramaters to get a {{$service.GetName}}YARPCClient in an
@@ -615,6 +638,7 @@ var Runner = protoplugin.NewRunner(
 			"encodedFileDescriptor":        encodedFileDescriptor,
 			"fileDescriptorClosureVarName": fileDescriptorClosureVarName,
 			"trimPrefixPeriod":             trimPrefixPeriod,
+			"restRules":                    restRules,
 		}).Parse(tmpl)),
 	checkTemplateInfo,
 	[]string{
@@ -738,6 +762,64 @@ func encodedFileDescriptor(f *protoplugin.File) (string, error) {
 	return buf.String(), nil
 }
 
+// restRule is a single google.api.http binding of a method.
+type restRule struct {
+	MethodName   string
+	HTTPMethod   string
+	Pattern      string
+	Body         string
+	ResponseBody string
+}
+
+// restRules returns the google.api.http bindings of the unary methods of
+// the service, including additional bindings.
+func restRules(service *protoplugin.Service) ([]*restRule, error) {
+	methods, err := unaryMethods(service)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*restRule
+	for _, method := range methods {
+		if method.GetOptions() == nil || !proto.HasExtension(method.GetOptions(), api.E_Http) {
+			continue
+		}
+		ext, err := proto.GetExtension(method.GetOptions(), api.E_Http)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read google.api.http option of %s: %v", method.GetName(), err)
+		}
+		httpRule, ok := ext.(*api.HttpRule)
+		if !ok {
+			return nil, fmt.Errorf("unexpected google.api.http option type %T of %s", ext, method.GetName())
+		}
+		bindings := append([]*api.HttpRule{httpRule}, httpRule.GetAdditionalBindings()...)
+		for _, binding := range bindings {
+			rule := &restRule{
+				MethodName:   method.GetName(),
+				Body:         binding.GetBody(),
+				ResponseBody: binding.GetResponseBody(),
+			}
+			switch pattern := binding.GetPattern().(type) {
+			case *api.HttpRule_Get:
+				rule.HTTPMethod, rule.Pattern = "GET", pattern.Get
+			case *api.HttpRule_Put:
+				rule.HTTPMethod, rule.Pattern = "PUT", pattern.Put
+			case *api.HttpRule_Post:
+				rule.HTTPMethod, rule.Pattern = "POST", pattern.Post
+			case *api.HttpRule_Delete:
+				rule.HTTPMethod, rule.Pattern = "DELETE", pattern.Delete
+			case *api.HttpRule_Patch:
+				rule.HTTPMethod, rule.Pattern = "PATCH", pattern.Patch
+			case *api.HttpRule_Custom:
+				rule.HTTPMethod, rule.Pattern = pattern.Custom.GetKind(), pattern.Custom.GetPath()
+			default:
+				return nil, fmt.Errorf("google.api.http option of %s has no pattern", method.GetName())
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
 func trimPrefixPeriod(s string) string {
 	return strings.TrimPrefix(s, ".")
 }
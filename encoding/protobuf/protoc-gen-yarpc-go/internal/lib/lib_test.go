@@ -0,0 +1,154 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package lib
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/gogo/googleapis/google/api"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"github.com/gogo/protobuf/protoc-gen-gogo/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRESTRoutesGeneration(t *testing.T) {
+	tests := []struct {
+		msg         string
+		rule        *api.HttpRule
+		wantRoutes  bool
+		wantContain []string
+	}{
+		{
+			msg: "no annotations",
+		},
+		{
+			msg: "get with additional binding",
+			rule: &api.HttpRule{
+				Pattern:      &api.HttpRule_Get{Get: "/v1/{name=items/*}"},
+				ResponseBody: "value",
+				AdditionalBindings: []*api.HttpRule{
+					{
+						Pattern: &api.HttpRule_Post{Post: "/v1/items:get"},
+						Body:    "*",
+					},
+				},
+			},
+			wantRoutes: true,
+			wantContain: []string{
+				`HTTPMethod:   "GET",`,
+				`Pattern:      "/v1/{name=items/*}",`,
+				`ResponseBody: "value",`,
+				`HTTPMethod:   "POST",`,
+				`Pattern:      "/v1/items:get",`,
+				`Body:         "*",`,
+				`NewRequest:   newStoreServiceGetYARPCRequest,`,
+			},
+		},
+		{
+			msg: "custom method",
+			rule: &api.HttpRule{
+				Pattern: &api.HttpRule_Custom{Custom: &api.CustomHttpPattern{Kind: "HEAD", Path: "/v1/items"}},
+			},
+			wantRoutes: true,
+			wantContain: []string{
+				`HTTPMethod:   "HEAD",`,
+				`Pattern:      "/v1/items",`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			content := generate(t, tt.rule)
+			if !tt.wantRoutes {
+				assert.NotContains(t, content, "YARPCRESTRoutes")
+				return
+			}
+			assert.Contains(t, content, "func BuildStoreYARPCRESTRoutes() []transport.RESTRoute {")
+			assert.Contains(t, content, `ServiceName: "test.Store",`)
+			for _, want := range tt.wantContain {
+				assert.Contains(t, content, want)
+			}
+		})
+	}
+}
+
+func generate(t *testing.T, rule *api.HttpRule) string {
+	options := &descriptor.MethodOptions{}
+	if rule != nil {
+		require.NoError(t, proto.SetExtension(options, api.E_Http, rule))
+	}
+	stringField := func(name string) *descriptor.FieldDescriptorProto {
+		return &descriptor.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(1),
+			Label:    descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptor.FieldDescriptorProto_TYPE_STRING.Enum(),
+		}
+	}
+	file := &descriptor.FileDescriptorProto{
+		Name:    proto.String("test/store.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptor.FileOptions{GoPackage: proto.String("go.uber.org/yarpc/test/storepb")},
+		MessageType: []*descriptor.DescriptorProto{
+			{Name: proto.String("GetRequest"), Field: []*descriptor.FieldDescriptorProto{stringField("name")}},
+			{Name: proto.String("GetResponse"), Field: []*descriptor.FieldDescriptorProto{stringField("value")}},
+		},
+		Service: []*descriptor.ServiceDescriptorProto{
+			{
+				Name: proto.String("Store"),
+				Method: []*descriptor.MethodDescriptorProto{
+					{
+						Name:       proto.String("Get"),
+						InputType:  proto.String(".test.GetRequest"),
+						OutputType: proto.String(".test.GetResponse"),
+						Options:    options,
+					},
+				},
+			},
+		},
+	}
+
+	// Round trip the request as protoc would send it.
+	data, err := proto.Marshal(&plugin_go.CodeGeneratorRequest{
+		FileToGenerate: []string{file.GetName()},
+		ProtoFile:      []*descriptor.FileDescriptorProto{file},
+	})
+	require.NoError(t, err)
+	request := &plugin_go.CodeGeneratorRequest{}
+	require.NoError(t, proto.Unmarshal(data, request))
+
+	response := Runner.Run(request)
+	require.Empty(t, response.GetError())
+	require.Len(t, response.File, 1)
+	assert.Equal(t, "test/store.pb.yarpc.go", response.File[0].GetName())
+
+	content := response.File[0].GetContent()
+	_, err = parser.ParseFile(token.NewFileSet(), "store.pb.yarpc.go", content, 0)
+	require.NoError(t, err, "generated code must be valid Go")
+	return content
+}
@@ -0,0 +1,370 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protobuf
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/pkg/procedure"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// ***all below functions should only be called by generated code***
+
+// BuildRESTRoutesParams contains the parameters for BuildRESTRoutes.
+type BuildRESTRoutesParams struct {
+	ServiceName string
+	Rules       []BuildRESTRoutesRuleParams
+}
+
+// BuildRESTRoutesRuleParams contains the parameters for a single
+// google.api.http binding for BuildRESTRoutes.
+type BuildRESTRoutesRuleParams struct {
+	MethodName   string
+	HTTPMethod   string
+	Pattern      string
+	Body         string
+	ResponseBody string
+	NewRequest   func() proto.Message
+}
+
+// BuildRESTRoutes builds the transport.RESTRoutes for the google.api.http
+// annotations of a service.
+//
+// Requests are translated into calls to the JSONEncoding procedure. Path
+// variables and query parameters are bound to the request message fields
+// with the same name, and the HTTP body is bound according to the "body"
+// attribute of the annotation.
+func BuildRESTRoutes(params BuildRESTRoutesParams) []transport.RESTRoute {
+	routes := make([]transport.RESTRoute, 0, len(params.Rules))
+	for _, rule := range params.Rules {
+		binder := &restBinder{
+			body:         rule.Body,
+			responseBody: rule.ResponseBody,
+			requestType:  reflect.TypeOf(rule.NewRequest()),
+		}
+		route := transport.RESTRoute{
+			Procedure:        procedure.ToName(params.ServiceName, rule.MethodName),
+			Encoding:         JSONEncoding,
+			Method:           rule.HTTPMethod,
+			Pattern:          rule.Pattern,
+			BuildRequestBody: binder.buildRequestBody,
+		}
+		if rule.ResponseBody != "" {
+			route.BuildResponseBody = binder.buildResponseBody
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+type restBinder struct {
+	body         string
+	responseBody string
+	requestType  reflect.Type
+}
+
+// restObject is a JSON object under construction. Values are either
+// json.RawMessage or nested restObjects.
+type restObject map[string]interface{}
+
+func (b *restBinder) buildRequestBody(pathVars map[string]string, query url.Values, httpBody []byte) ([]byte, error) {
+	root := make(restObject)
+	switch b.body {
+	case "":
+	case "*":
+		if len(httpBody) > 0 {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(httpBody, &fields); err != nil {
+				return nil, yarpcerrors.InvalidArgumentErrorf("failed to parse request body: %v", err)
+			}
+			for k, v := range fields {
+				root[k] = v
+			}
+		}
+	default:
+		if len(httpBody) > 0 {
+			if err := root.set(strings.Split(b.body, "."), json.RawMessage(httpBody)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Query parameters are only bound to fields that are not bound by the
+	// path or the body.
+	if b.body != "*" {
+		for key, values := range query {
+			if _, ok := pathVars[key]; ok || len(values) == 0 || b.isBodyField(key) {
+				continue
+			}
+			field, ok := b.lookupField(key)
+			if !ok {
+				// Unknown query parameters are ignored so that clients may add
+				// their own, for example to bust caches.
+				continue
+			}
+			value, err := field.toJSON(key, values)
+			if err != nil {
+				return nil, err
+			}
+			if err := root.set(strings.Split(key, "."), value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for key, pathValue := range pathVars {
+		field, ok := b.lookupField(key)
+		if !ok {
+			return nil, yarpcerrors.InternalErrorf("path variable %q does not match a field of %v", key, b.requestType)
+		}
+		value, err := field.toJSON(key, []string{pathValue})
+		if err != nil {
+			return nil, err
+		}
+		if err := root.set(strings.Split(key, "."), value); err != nil {
+			return nil, err
+		}
+	}
+	return root.marshal()
+}
+
+func (b *restBinder) isBodyField(key string) bool {
+	return b.body != "" && (key == b.body || strings.HasPrefix(key, b.body+"."))
+}
+
+func (b *restBinder) buildResponseBody(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, yarpcerrors.InternalErrorf("failed to parse response body: %v", err)
+	}
+	if value, ok := fields[b.responseBody]; ok {
+		return value, nil
+	}
+	if value, ok := fields[jsonCamelCase(b.responseBody)]; ok {
+		return value, nil
+	}
+	// Empty fields are omitted by the marshaler.
+	return []byte("null"), nil
+}
+
+// set sets the value at the given field path, creating nested objects as
+// needed.
+func (o restObject) set(path []string, value json.RawMessage) error {
+	if len(path) == 1 {
+		o[path[0]] = value
+		return nil
+	}
+	child, err := o.child(path[0])
+	if err != nil {
+		return err
+	}
+	return child.set(path[1:], value)
+}
+
+func (o restObject) child(key string) (restObject, error) {
+	switch existing := o[key].(type) {
+	case restObject:
+		return existing, nil
+	case json.RawMessage:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(existing, &fields); err != nil {
+			return nil, yarpcerrors.InvalidArgumentErrorf("field %q must be an object: %v", key, err)
+		}
+		child := make(restObject, len(fields))
+		for k, v := range fields {
+			child[k] = v
+		}
+		o[key] = child
+		return child, nil
+	default:
+		child := make(restObject)
+		o[key] = child
+		return child, nil
+	}
+}
+
+func (o restObject) marshal() ([]byte, error) {
+	fields := make(map[string]json.RawMessage, len(o))
+	for k, v := range o {
+		switch v := v.(type) {
+		case restObject:
+			b, err := v.marshal()
+			if err != nil {
+				return nil, err
+			}
+			fields[k] = b
+		case json.RawMessage:
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// restField is a request message field that a path variable or query
+// parameter is bound to.
+type restField struct {
+	typ  reflect.Type
+	prop *proto.Properties
+}
+
+// lookupField finds the field for a dotted field path, matching either the
+// proto or the JSON name of each field.
+func (b *restBinder) lookupField(path string) (restField, bool) {
+	typ := b.requestType
+	var field restField
+	for _, name := range strings.Split(path, ".") {
+		if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+			return restField{}, false
+		}
+		var ok bool
+		field, ok = lookupStructField(typ.Elem(), name)
+		if !ok {
+			return restField{}, false
+		}
+		typ = field.typ
+	}
+	return field, true
+}
+
+func lookupStructField(typ reflect.Type, name string) (restField, bool) {
+	props := proto.GetProperties(typ)
+	for i, prop := range props.Prop {
+		if prop.OrigName == name || prop.JSONName == name {
+			return restField{typ: typ.Field(i).Type, prop: prop}, true
+		}
+	}
+	for _, oneof := range props.OneofTypes {
+		if oneof.Prop.OrigName == name || oneof.Prop.JSONName == name {
+			return restField{typ: oneof.Type.Elem().Field(0).Type, prop: oneof.Prop}, true
+		}
+	}
+	return restField{}, false
+}
+
+// toJSON converts path or query values into a JSON value that jsonpb
+// accepts for the field.
+func (f restField) toJSON(name string, values []string) (json.RawMessage, error) {
+	if f.typ.Kind() == reflect.Slice && f.typ.Elem().Kind() != reflect.Uint8 {
+		elems := make([]json.RawMessage, 0, len(values))
+		for _, value := range values {
+			elem, err := scalarToJSON(name, f.typ.Elem(), f.prop, value)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+		}
+		return json.Marshal(elems)
+	}
+	if len(values) > 1 {
+		return nil, yarpcerrors.InvalidArgumentErrorf("field %q is not repeated but got %d values", name, len(values))
+	}
+	return scalarToJSON(name, f.typ, f.prop, values[0])
+}
+
+var _wrapperTypes = map[string]struct{}{
+	"DoubleValue": {},
+	"FloatValue":  {},
+	"Int64Value":  {},
+	"UInt64Value": {},
+	"Int32Value":  {},
+	"UInt32Value": {},
+	"BoolValue":   {},
+	"StringValue": {},
+	"BytesValue":  {},
+}
+
+type wellKnownType interface {
+	XXX_WellKnownType() string
+}
+
+func scalarToJSON(name string, typ reflect.Type, prop *proto.Properties, value string) (json.RawMessage, error) {
+	if prop != nil && prop.Enum != "" {
+		if _, err := strconv.ParseInt(value, 10, 32); err == nil {
+			return json.RawMessage(value), nil
+		}
+		return json.Marshal(value)
+	}
+
+	var err error
+	switch typ.Kind() {
+	case reflect.String:
+		return json.Marshal(value)
+	case reflect.Slice: // bytes, base64 encoded
+		return json.Marshal(value)
+	case reflect.Bool:
+		var v bool
+		if v, err = strconv.ParseBool(value); err == nil {
+			return json.Marshal(v)
+		}
+	case reflect.Int32, reflect.Int64:
+		_, err = strconv.ParseInt(value, 10, typ.Bits())
+	case reflect.Uint32, reflect.Uint64:
+		_, err = strconv.ParseUint(value, 10, typ.Bits())
+	case reflect.Float32, reflect.Float64:
+		_, err = strconv.ParseFloat(value, typ.Bits())
+	case reflect.Ptr:
+		if wkt, ok := reflect.New(typ.Elem()).Interface().(wellKnownType); ok {
+			kind := wkt.XXX_WellKnownType()
+			if _, ok := _wrapperTypes[kind]; ok {
+				return scalarToJSON(name, typ.Elem().Field(0).Type, nil, value)
+			}
+			switch kind {
+			case "Timestamp", "Duration", "FieldMask":
+				return json.Marshal(value)
+			}
+		}
+		return nil, yarpcerrors.InvalidArgumentErrorf("field %q is a message and cannot be bound from a path or query parameter", name)
+	default:
+		return nil, yarpcerrors.InvalidArgumentErrorf("field %q of type %v cannot be bound from a path or query parameter", name, typ)
+	}
+	if err != nil {
+		return nil, yarpcerrors.InvalidArgumentErrorf("invalid value %q for field %q: %v", value, name, err)
+	}
+	// Numbers are quoted, which jsonpb accepts for all numeric types.
+	return json.Marshal(value)
+}
+
+// jsonCamelCase converts a proto field name to its JSON name, mirroring
+// protoc's conversion.
+func jsonCamelCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protobuf
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestBuildRESTRoutes(t *testing.T) {
+	routes := BuildRESTRoutes(BuildRESTRoutesParams{
+		ServiceName: "google.protobuf.TypeService",
+		Rules: []BuildRESTRoutesRuleParams{
+			{
+				MethodName: "GetType",
+				HTTPMethod: "GET",
+				Pattern:    "/v1/types/{name}",
+				NewRequest: func() proto.Message { return &types.Type{} },
+			},
+			{
+				MethodName:   "GetField",
+				HTTPMethod:   "POST",
+				Pattern:      "/v1/fields",
+				Body:         "*",
+				ResponseBody: "json_name",
+				NewRequest:   func() proto.Message { return &types.Field{} },
+			},
+		},
+	})
+	require.Len(t, routes, 2)
+
+	assert.Equal(t, "google.protobuf.TypeService::GetType", routes[0].Procedure)
+	assert.Equal(t, JSONEncoding, routes[0].Encoding)
+	assert.Equal(t, "GET", routes[0].Method)
+	assert.Equal(t, "/v1/types/{name}", routes[0].Pattern)
+	assert.NotNil(t, routes[0].BuildRequestBody)
+	assert.Nil(t, routes[0].BuildResponseBody)
+
+	assert.Equal(t, "google.protobuf.TypeService::GetField", routes[1].Procedure)
+	assert.Equal(t, "POST", routes[1].Method)
+	assert.NotNil(t, routes[1].BuildResponseBody)
+}
+
+func TestRESTBuildRequestBody(t *testing.T) {
+	tests := []struct {
+		msg      string
+		body     string
+		newMsg   func() proto.Message
+		pathVars map[string]string
+		query    url.Values
+		httpBody string
+		want     proto.Message
+		wantCode yarpcerrors.Code
+	}{
+		{
+			msg:      "path variables and query parameters",
+			newMsg:   func() proto.Message { return &types.Type{} },
+			pathVars: map[string]string{"name": "foo/bar", "source_context.file_name": "foo.proto"},
+			query: url.Values{
+				"oneofs": {"a", "b"},
+				"syntax": {"SYNTAX_PROTO3"},
+				"name":   {"ignored"},
+				"cache":  {"unknown"},
+			},
+			want: &types.Type{
+				Name:          "foo/bar",
+				Oneofs:        []string{"a", "b"},
+				Syntax:        types.Syntax_SYNTAX_PROTO3,
+				SourceContext: &types.SourceContext{FileName: "foo.proto"},
+			},
+		},
+		{
+			msg:    "scalar query parameters",
+			newMsg: func() proto.Message { return &types.Field{} },
+			query: url.Values{
+				"number":      {"42"},
+				"oneofIndex":  {"-1"},
+				"packed":      {"true"},
+				"kind":        {"9"},
+				"cardinality": {"CARDINALITY_REPEATED"},
+			},
+			want: &types.Field{
+				Number:      42,
+				OneofIndex:  -1,
+				Packed:      true,
+				Kind:        types.Field_TYPE_STRING,
+				Cardinality: types.Field_CARDINALITY_REPEATED,
+			},
+		},
+		{
+			msg:      "whole body",
+			body:     "*",
+			newMsg:   func() proto.Message { return &types.Field{} },
+			pathVars: map[string]string{"name": "foo"},
+			query:    url.Values{"number": {"42"}},
+			httpBody: `{"name": "bar", "jsonName": "baz"}`,
+			want:     &types.Field{Name: "foo", JsonName: "baz"},
+		},
+		{
+			msg:      "field body",
+			body:     "source_context",
+			newMsg:   func() proto.Message { return &types.Type{} },
+			pathVars: map[string]string{"name": "foo"},
+			query:    url.Values{"source_context.file_name": {"ignored"}},
+			httpBody: `{"fileName": "foo.proto"}`,
+			want:     &types.Type{Name: "foo", SourceContext: &types.SourceContext{FileName: "foo.proto"}},
+		},
+		{
+			msg:      "invalid number",
+			newMsg:   func() proto.Message { return &types.Field{} },
+			query:    url.Values{"number": {"forty-two"}},
+			wantCode: yarpcerrors.CodeInvalidArgument,
+		},
+		{
+			msg:      "invalid bool",
+			newMsg:   func() proto.Message { return &types.Field{} },
+			query:    url.Values{"packed": {"maybe"}},
+			wantCode: yarpcerrors.CodeInvalidArgument,
+		},
+		{
+			msg:      "repeated values for singular field",
+			newMsg:   func() proto.Message { return &types.Field{} },
+			query:    url.Values{"name": {"a", "b"}},
+			wantCode: yarpcerrors.CodeInvalidArgument,
+		},
+		{
+			msg:      "message from query parameter",
+			newMsg:   func() proto.Message { return &types.Type{} },
+			query:    url.Values{"source_context": {"foo"}},
+			wantCode: yarpcerrors.CodeInvalidArgument,
+		},
+		{
+			msg:      "malformed body",
+			body:     "*",
+			newMsg:   func() proto.Message { return &types.Field{} },
+			httpBody: `{`,
+			wantCode: yarpcerrors.CodeInvalidArgument,
+		},
+		{
+			msg:      "unknown path variable",
+			newMsg:   func() proto.Message { return &types.Field{} },
+			pathVars: map[string]string{"unknown": "foo"},
+			wantCode: yarpcerrors.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			routes := BuildRESTRoutes(BuildRESTRoutesParams{
+				ServiceName: "test",
+				Rules: []BuildRESTRoutesRuleParams{
+					{MethodName: "Test", Body: tt.body, NewRequest: tt.newMsg},
+				},
+			})
+			require.Len(t, routes, 1)
+
+			body, err := routes[0].BuildRequestBody(tt.pathVars, tt.query, []byte(tt.httpBody))
+			if tt.wantCode != yarpcerrors.CodeOK {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantCode, yarpcerrors.FromError(err).Code())
+				return
+			}
+			require.NoError(t, err)
+
+			got := tt.newMsg()
+			require.NoError(t, jsonpb.Unmarshal(bytes.NewReader(body), got), string(body))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRESTBuildResponseBody(t *testing.T) {
+	routes := BuildRESTRoutes(BuildRESTRoutesParams{
+		ServiceName: "test",
+		Rules: []BuildRESTRoutesRuleParams{
+			{
+				MethodName:   "Test",
+				ResponseBody: "source_context",
+				NewRequest:   func() proto.Message { return &types.Type{} },
+			},
+		},
+	})
+	require.Len(t, routes, 1)
+	build := routes[0].BuildResponseBody
+
+	body, err := build([]byte(`{"name": "foo", "sourceContext": {"fileName": "foo.proto"}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"fileName": "foo.proto"}`, string(body))
+
+	body, err = build([]byte(`{"source_context": {"fileName": "foo.proto"}}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"fileName": "foo.proto"}`, string(body))
+
+	body, err = build([]byte(`{"name": "foo"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "null", string(body))
+
+	_, err = build([]byte(`[]`))
+	assert.Equal(t, yarpcerrors.CodeInternal, yarpcerrors.FromError(err).Code())
+}
@@ -14,7 +14,6 @@ require (
 	github.com/gogo/status v1.1.0
 	github.com/golang/mock v1.4.0
 	github.com/golang/snappy v0.0.1
-	github.com/google/go-cmp v0.4.0 // indirect
 	github.com/kisielk/errcheck v1.2.0
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
 	github.com/kr/pretty v0.2.0 // indirect
@@ -29,7 +28,7 @@ require (
 	github.com/samuel/go-thrift v0.0.0-20191111193933-5165175b40af // indirect
 	github.com/streadway/quantile v0.0.0-20150917103942-b0c588724d25 // indirect
 	github.com/stretchr/objx v0.2.0 // indirect
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.6.1
 	github.com/uber-common/bark v1.2.1 // indirect
 	github.com/uber-go/mapdecode v1.0.0
 	github.com/uber-go/tally v3.3.15+incompatible
@@ -37,6 +36,7 @@ require (
 	github.com/uber/jaeger-lib v2.2.0+incompatible // indirect
 	github.com/uber/ringpop-go v0.8.5
 	github.com/uber/tchannel-go v1.16.0
+	go.opentelemetry.io/otel v0.16.0
 	go.uber.org/atomic v1.5.1
 	go.uber.org/fx v1.10.0
 	go.uber.org/goleak v1.0.0 // indirect
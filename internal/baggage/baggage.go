@@ -0,0 +1,122 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package baggage carries application key/value pairs across hops,
+// independent of any tracer.
+//
+// Baggage is carried by the context. Transports send the baggage of outbound
+// requests in reserved headers, and decode it into the contexts of inbound
+// requests. Middleware built with NewMiddleware restricts what is accepted
+// and sent to an allowlist of keys, within a size limit.
+package baggage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxSize is the default limit on the total size of the keys and
+// values of the baggage of a request, in bytes.
+const DefaultMaxSize = 4096
+
+type contextKey struct{}
+
+// WithBaggage returns a copy of the context carrying the given baggage item,
+// in addition to the baggage it already carries. Keys are case-insensitive.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	current := items(ctx)
+	next := make(map[string]string, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[CanonicalizeKey(key)] = value
+	return context.WithValue(ctx, contextKey{}, next)
+}
+
+// WithItems returns a copy of the context carrying exactly the given baggage
+// items, replacing any baggage it already carries. The map must not be
+// modified afterwards.
+func WithItems(ctx context.Context, baggage map[string]string) context.Context {
+	if len(baggage) == 0 && len(items(ctx)) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, baggage)
+}
+
+// FromContext returns a copy of the baggage carried by the context, or nil if
+// it carries none.
+func FromContext(ctx context.Context) map[string]string {
+	current := items(ctx)
+	if len(current) == 0 {
+		return nil
+	}
+	baggage := make(map[string]string, len(current))
+	for k, v := range current {
+		baggage[k] = v
+	}
+	return baggage
+}
+
+// Range calls f for every baggage item carried by the context, without
+// copying the baggage.
+func Range(ctx context.Context, f func(key, value string)) {
+	for k, v := range items(ctx) {
+		f(k, v)
+	}
+}
+
+// CanonicalizeKey returns the canonical form of a baggage key.
+func CanonicalizeKey(key string) string {
+	return strings.ToLower(key)
+}
+
+// ValidateKey returns an error if the given key cannot be sent in headers by
+// all transports. Keys may contain only letters, digits, "-", "_" and ".".
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("baggage key must not be empty")
+	}
+	for _, r := range key {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return fmt.Errorf("baggage key %q may only contain letters, digits, %q, %q and %q", key, "-", "_", ".")
+		}
+	}
+	return nil
+}
+
+// validValue reports whether the value can be sent in headers by all
+// transports, which requires printable ASCII.
+func validValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func items(ctx context.Context) map[string]string {
+	items, _ := ctx.Value(contextKey{}).(map[string]string)
+	return items
+}
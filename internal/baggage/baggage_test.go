@@ -0,0 +1,62 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package baggage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithBaggage(t *testing.T) {
+	assert.Nil(t, FromContext(context.Background()))
+
+	ctx := WithBaggage(context.Background(), "Tenant", "acme")
+	child := WithBaggage(ctx, "experiment", "on")
+	assert.Equal(t, map[string]string{"tenant": "acme"}, FromContext(ctx),
+		"parent context must not be modified")
+	assert.Equal(t, map[string]string{"tenant": "acme", "experiment": "on"}, FromContext(child))
+
+	items := FromContext(child)
+	items["tenant"] = "other"
+	assert.Equal(t, "acme", FromContext(child)["tenant"], "returned baggage must be a copy")
+}
+
+func TestWithItems(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, WithItems(ctx, nil), "expected the same context without baggage")
+
+	ctx = WithItems(ctx, map[string]string{"tenant": "acme"})
+	assert.Equal(t, map[string]string{"tenant": "acme"}, FromContext(ctx))
+
+	ctx = WithItems(ctx, nil)
+	assert.Nil(t, FromContext(ctx), "expected baggage to be removed")
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, k := range []string{"tenant", "Tenant-ID", "a.b_c", "0"} {
+		assert.NoError(t, ValidateKey(k), "key %q", k)
+	}
+	for _, k := range []string{"", "a b", "a:b", "ключ"} {
+		assert.Error(t, ValidateKey(k), "key %q", k)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package baggage
+
+import (
+	"context"
+	"sort"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/streamctx"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*Middleware)(nil)
+	_ middleware.UnaryOutbound  = (*Middleware)(nil)
+	_ middleware.OnewayInbound  = (*Middleware)(nil)
+	_ middleware.OnewayOutbound = (*Middleware)(nil)
+	_ middleware.StreamInbound  = (*Middleware)(nil)
+	_ middleware.StreamOutbound = (*Middleware)(nil)
+)
+
+// Config configures the baggage middleware.
+type Config struct {
+	// Allow lists the baggage keys accepted from inbound requests and sent
+	// with outbound requests. Other baggage does not cross hops.
+	Allow []string
+
+	// MaxSize limits the total size of the keys and values of the baggage
+	// of a request, in bytes. Defaults to DefaultMaxSize.
+	MaxSize int
+}
+
+// Middleware restricts the baggage accepted from inbound requests and sent
+// with outbound requests.
+//
+// Inbound baggage which is not allowed is dropped, as are items past the size
+// limit, in key order. Outbound baggage which is not allowed is not sent, and
+// outbound requests fail if the allowed baggage exceeds the size limit.
+type Middleware struct {
+	allow   map[string]struct{}
+	maxSize int
+}
+
+// NewMiddleware builds a baggage middleware.
+func NewMiddleware(cfg Config) *Middleware {
+	m := &Middleware{
+		allow:   make(map[string]struct{}, len(cfg.Allow)),
+		maxSize: cfg.MaxSize,
+	}
+	for _, k := range cfg.Allow {
+		m.allow[CanonicalizeKey(k)] = struct{}{}
+	}
+	if m.maxSize <= 0 {
+		m.maxSize = DefaultMaxSize
+	}
+	return m
+}
+
+// Handle implements middleware.UnaryInbound.
+func (m *Middleware) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	return h.Handle(m.inboundContext(ctx), req, resw)
+}
+
+// Call implements middleware.UnaryOutbound.
+func (m *Middleware) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	ctx, err := m.outboundContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return out.Call(ctx, req)
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (m *Middleware) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	return h.HandleOneway(m.inboundContext(ctx), req)
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (m *Middleware) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	ctx, err := m.outboundContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return out.CallOneway(ctx, req)
+}
+
+// HandleStream implements middleware.StreamInbound.
+func (m *Middleware) HandleStream(s *transport.ServerStream, h transport.StreamHandler) error {
+	ctx := m.inboundContext(s.Context())
+	if ctx == s.Context() {
+		return h.HandleStream(s)
+	}
+	return h.HandleStream(streamctx.WithContext(s, ctx))
+}
+
+// CallStream implements middleware.StreamOutbound.
+func (m *Middleware) CallStream(ctx context.Context, req *transport.StreamRequest, out transport.StreamOutbound) (*transport.ClientStream, error) {
+	ctx, err := m.outboundContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return out.CallStream(ctx, req)
+}
+
+// inboundContext returns a copy of the context carrying only the allowed
+// baggage, up to the size limit.
+func (m *Middleware) inboundContext(ctx context.Context) context.Context {
+	current := items(ctx)
+	if len(current) == 0 {
+		return ctx
+	}
+
+	keys := make([]string, 0, len(current))
+	for k := range current {
+		if _, ok := m.allow[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	baggage := make(map[string]string, len(keys))
+	size := 0
+	for _, k := range keys {
+		v := current[k]
+		size += len(k) + len(v)
+		if size > m.maxSize {
+			break
+		}
+		baggage[k] = v
+	}
+	if len(baggage) == len(current) {
+		return ctx
+	}
+	return WithItems(ctx, baggage)
+}
+
+// outboundContext returns a copy of the context carrying only the allowed
+// baggage, or an error if it cannot be sent.
+func (m *Middleware) outboundContext(ctx context.Context) (context.Context, error) {
+	current := items(ctx)
+	if len(current) == 0 {
+		return ctx, nil
+	}
+
+	baggage := make(map[string]string, len(current))
+	size := 0
+	for k, v := range current {
+		if _, ok := m.allow[k]; !ok {
+			continue
+		}
+		if !validValue(v) {
+			return ctx, yarpcerrors.InvalidArgumentErrorf(
+				"baggage %q must only contain printable ASCII characters", k)
+		}
+		size += len(k) + len(v)
+		baggage[k] = v
+	}
+	if size > m.maxSize {
+		return ctx, yarpcerrors.InvalidArgumentErrorf(
+			"baggage of %d bytes exceeds the limit of %d bytes", size, m.maxSize)
+	}
+	if len(baggage) == len(current) {
+		return ctx, nil
+	}
+	return WithItems(ctx, baggage), nil
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package baggage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestInbound(t *testing.T) {
+	tests := []struct {
+		desc string
+		cfg  Config
+		give map[string]string
+		want map[string]string
+	}{
+		{
+			desc: "no baggage",
+			cfg:  Config{Allow: []string{"tenant"}},
+		},
+		{
+			desc: "nothing allowed",
+			give: map[string]string{"tenant": "acme"},
+		},
+		{
+			desc: "allowed",
+			cfg:  Config{Allow: []string{"Tenant"}},
+			give: map[string]string{"tenant": "acme", "secret": "hunter2"},
+			want: map[string]string{"tenant": "acme"},
+		},
+		{
+			desc: "size limit",
+			cfg:  Config{Allow: []string{"a", "b", "c"}, MaxSize: 4},
+			give: map[string]string{"a": "1", "b": "2", "c": "3"},
+			want: map[string]string{"a": "1", "b": "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			m := NewMiddleware(tt.cfg)
+			ctx := WithItems(context.Background(), tt.give)
+			req := &transport.Request{}
+
+			unary := transporttest.NewMockUnaryHandler(mockCtrl)
+			unary.EXPECT().Handle(gomock.Any(), req, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request, _ transport.ResponseWriter) error {
+					assert.Equal(t, tt.want, FromContext(ctx))
+					return nil
+				})
+			require.NoError(t, m.Handle(ctx, req, &transporttest.FakeResponseWriter{}, unary))
+
+			oneway := transporttest.NewMockOnewayHandler(mockCtrl)
+			oneway.EXPECT().HandleOneway(gomock.Any(), req).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request) error {
+					assert.Equal(t, tt.want, FromContext(ctx))
+					return nil
+				})
+			require.NoError(t, m.HandleOneway(ctx, req, oneway))
+
+			streamReq := &transport.StreamRequest{Meta: &transport.RequestMeta{}}
+			serverStream, err := transport.NewServerStream(&fakeStream{ctx: ctx, req: streamReq})
+			require.NoError(t, err)
+			stream := transporttest.NewMockStreamHandler(mockCtrl)
+			stream.EXPECT().HandleStream(gomock.Any()).DoAndReturn(
+				func(s *transport.ServerStream) error {
+					assert.Equal(t, tt.want, FromContext(s.Context()))
+					assert.Equal(t, streamReq, s.Request(), "request must be preserved")
+					return nil
+				})
+			require.NoError(t, m.HandleStream(serverStream, stream))
+		})
+	}
+}
+
+func TestOutbound(t *testing.T) {
+	tests := []struct {
+		desc    string
+		cfg     Config
+		give    map[string]string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			desc: "no baggage",
+			cfg:  Config{Allow: []string{"tenant"}},
+		},
+		{
+			desc: "allowed",
+			cfg:  Config{Allow: []string{"tenant"}},
+			give: map[string]string{"tenant": "acme", "secret": "hunter2"},
+			want: map[string]string{"tenant": "acme"},
+		},
+		{
+			desc:    "size limit",
+			cfg:     Config{Allow: []string{"tenant"}, MaxSize: 8},
+			give:    map[string]string{"tenant": "acme"},
+			wantErr: "baggage of 10 bytes exceeds the limit of 8 bytes",
+		},
+		{
+			desc:    "default size limit",
+			cfg:     Config{Allow: []string{"tenant"}},
+			give:    map[string]string{"tenant": strings.Repeat("a", DefaultMaxSize)},
+			wantErr: "baggage of 4102 bytes exceeds the limit of 4096 bytes",
+		},
+		{
+			desc:    "invalid value",
+			cfg:     Config{Allow: []string{"tenant"}},
+			give:    map[string]string{"tenant": "acme\r\n"},
+			wantErr: `baggage "tenant" must only contain printable ASCII characters`,
+		},
+		{
+			desc: "invalid value not allowed",
+			cfg:  Config{Allow: []string{"tenant"}},
+			give: map[string]string{"tenant": "acme", "secret": "\n"},
+			want: map[string]string{"tenant": "acme"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			m := NewMiddleware(tt.cfg)
+			ctx := WithItems(context.Background(), tt.give)
+			req := &transport.Request{}
+			streamReq := &transport.StreamRequest{Meta: &transport.RequestMeta{}}
+
+			unary := transporttest.NewMockUnaryOutbound(mockCtrl)
+			oneway := transporttest.NewMockOnewayOutbound(mockCtrl)
+			stream := transporttest.NewMockStreamOutbound(mockCtrl)
+
+			if tt.wantErr != "" {
+				wantErr := yarpcerrors.InvalidArgumentErrorf(tt.wantErr)
+
+				_, err := m.Call(ctx, req, unary)
+				assert.Equal(t, wantErr, err)
+				_, err = m.CallOneway(ctx, req, oneway)
+				assert.Equal(t, wantErr, err)
+				_, err = m.CallStream(ctx, streamReq, stream)
+				assert.Equal(t, wantErr, err)
+				return
+			}
+
+			unary.EXPECT().Call(gomock.Any(), req).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request) (*transport.Response, error) {
+					assert.Equal(t, tt.want, FromContext(ctx))
+					return &transport.Response{}, nil
+				})
+			_, err := m.Call(ctx, req, unary)
+			require.NoError(t, err)
+
+			oneway.EXPECT().CallOneway(gomock.Any(), req).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request) (transport.Ack, error) {
+					assert.Equal(t, tt.want, FromContext(ctx))
+					return nil, nil
+				})
+			_, err = m.CallOneway(ctx, req, oneway)
+			require.NoError(t, err)
+
+			stream.EXPECT().CallStream(gomock.Any(), streamReq).DoAndReturn(
+				func(ctx context.Context, r *transport.StreamRequest) (*transport.ClientStream, error) {
+					assert.Equal(t, tt.want, FromContext(ctx))
+					return transport.NewClientStream(&fakeStream{ctx: ctx, req: r})
+				})
+			_, err = m.CallStream(ctx, streamReq, stream)
+			require.NoError(t, err)
+		})
+	}
+}
+
+type fakeStream struct {
+	ctx context.Context
+	req *transport.StreamRequest
+}
+
+func (s *fakeStream) Context() context.Context                                    { return s.ctx }
+func (s *fakeStream) Request() *transport.StreamRequest                           { return s.req }
+func (s *fakeStream) Close(context.Context) error                                 { return nil }
+func (s *fakeStream) SendMessage(context.Context, *transport.StreamMessage) error { return nil }
+
+func (s *fakeStream) ReceiveMessage(context.Context) (*transport.StreamMessage, error) {
+	return nil, io.EOF
+}
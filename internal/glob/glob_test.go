@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package glob
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"KeyValue::GetValue", "KeyValue::GetValue", true},
+		{"KeyValue::GetValue", "KeyValue::SetValue", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"KeyValue::*", "KeyValue::GetValue", true},
+		{"KeyValue::*", "Other::GetValue", false},
+		{"*::Get*", "KeyValue::GetValue", true},
+		{"*::Get*", "KeyValue::SetValue", false},
+		{"*Value", "KeyValue::GetValue", true},
+		{"a*b*a", "aba", true},
+		{"a*a", "a", false},
+		{"a**b", "ab", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Match(tt.pattern, tt.s), "Match(%q, %q)", tt.pattern, tt.s)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	assert.True(t, MatchAny(nil, "anything"), "no patterns must match")
+	assert.True(t, MatchAny([]string{"put", "get*"}, "getValue"))
+	assert.False(t, MatchAny([]string{"put", "get*"}, "delete"))
+}
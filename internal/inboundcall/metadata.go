@@ -41,6 +41,7 @@ type Metadata interface {
 	ShardKey() string
 	RoutingKey() string
 	RoutingDelegate() string
+	Criticality() transport.Criticality
 }
 
 type metadataKey struct{} // context key for Metadata
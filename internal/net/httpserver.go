@@ -96,6 +96,29 @@ func (h *HTTPServer) ListenAndServe() error {
 	return nil
 }
 
+// Serve starts the given HTTP server up in the background, accepting
+// connections from the given listener, and returns immediately. The server
+// takes ownership of the listener.
+//
+// An error is returned if the server was already listening, or if the server
+// was stopped with Stop().
+func (h *HTTPServer) Serve(listener net.Listener) error {
+	if h.stopped.Load() {
+		return errServerStopped
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.listener != nil {
+		return errAlreadyListening
+	}
+
+	h.listener = listener
+	go h.serve(h.listener)
+	return nil
+}
+
 func (h *HTTPServer) serve(listener net.Listener) {
 	// Serve always returns a non-nil error. For us, it's an error only if
 	// we didn't call Stop().
@@ -51,6 +51,26 @@ func TestStartAndShutdown(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestServeListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := NewHTTPServer(&http.Server{})
+	require.NoError(t, server.Serve(listener))
+	assert.Equal(t, listener, server.Listener())
+	assert.Equal(t, errAlreadyListening, server.Serve(listener))
+
+	addr := yarpctest.ZeroAddrToHostPort(listener.Addr())
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	require.NoError(t, server.Shutdown(context.Background()))
+	assert.Equal(t, errServerStopped, server.Serve(listener))
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+}
+
 func TestStartAddrInUse(t *testing.T) {
 	s1 := NewHTTPServer(&http.Server{Addr: "127.0.0.1:0"})
 	require.NoError(t, s1.ListenAndServe())
@@ -62,9 +62,10 @@ const (
 // To prevent allocating on the heap on the request path, it's a value instead
 // of a pointer.
 type call struct {
-	edge    *edge
-	extract ContextExtractor
-	fields  [9]zapcore.Field
+	edge       *edge
+	extract    ContextExtractor
+	extractors []ContextExtractor
+	fields     [20]zapcore.Field
 
 	started   time.Time
 	ctx       context.Context
@@ -72,7 +73,8 @@ type call struct {
 	rpcType   transport.Type
 	direction directionName
 
-	levels *levels
+	levels  *levels
+	headers *headerLogger
 }
 
 type callResult struct {
@@ -84,6 +86,8 @@ type callResult struct {
 
 	requestSize  int
 	responseSize int
+
+	responseHeaders transport.Headers
 }
 
 type levels struct {
@@ -129,7 +133,7 @@ func (c call) endWithAppError(
 	res callResult,
 	extraLogFields ...zap.Field) {
 	elapsed := _timeNow().Sub(c.started)
-	c.endLogs(elapsed, res.err, res.isApplicationError, res.applicationErrorMeta, extraLogFields...)
+	c.endLogs(elapsed, res.err, res.isApplicationError, res.applicationErrorMeta, res.responseHeaders, extraLogFields...)
 	c.endStats(elapsed, res)
 }
 
@@ -144,6 +148,7 @@ func (c call) endLogs(
 	err error,
 	isApplicationError bool,
 	applicationErrorMeta *transport.ApplicationErrorMeta,
+	responseHeaders transport.Headers,
 	extraLogFields ...zap.Field) {
 	appErrBitWithNoError := isApplicationError && err == nil // ie Thrift exception
 
@@ -187,11 +192,13 @@ func (c call) endLogs(
 		return
 	}
 
-	fields := c.fields[:0]
+	fields := c.requestFields(c.fields[:0])
 	fields = append(fields, zap.String("rpcType", c.rpcType.String()))
 	fields = append(fields, zap.Duration("latency", elapsed))
 	fields = append(fields, zap.Bool("successful", err == nil && !isApplicationError))
-	fields = append(fields, c.extract(c.ctx))
+	fields = c.contextFields(fields)
+	fields = c.headers.requestFields(fields, c.req.Headers)
+	fields = c.headers.responseFields(fields, responseHeaders)
 
 	if appErrBitWithNoError { // Thrift exception
 		fields = append(fields, zap.String(_error, "application_error"))
@@ -340,7 +347,7 @@ func (c call) EndStreamHandshake() {
 // EndStreamHandshakeWithError should be invoked immediately after attempting to
 // create a stream.
 func (c call) EndStreamHandshakeWithError(err error) {
-	c.logStreamEvent(err, err == nil, _successStreamOpen, _errorStreamOpen)
+	c.logStreamEvent(err, err == nil, _successStreamOpen, _errorStreamOpen, c.headers.requestFields(nil, c.req.Headers)...)
 
 	c.edge.calls.Inc()
 	if err == nil {
@@ -437,17 +444,47 @@ func (c call) logStreamEvent(err error, success bool, succMsg, errMsg string, ex
 		ce = c.edge.logger.Check(c.levels.failure, errMsg)
 	}
 
-	fields := []zap.Field{
+	fields := c.requestFields(nil)
+	fields = append(fields,
 		zap.String("rpcType", c.rpcType.String()),
 		zap.Bool("successful", success),
-		c.extract(c.ctx),
+	)
+	fields = c.contextFields(fields)
+	fields = append(fields,
 		zap.Error(err), // no-op if err == nil
-	}
+	)
 	fields = append(fields, extraFields...)
 
 	ce.Write(fields...)
 }
 
+// contextFields appends the fields pulled from the context of the call.
+func (c call) contextFields(fields []zapcore.Field) []zapcore.Field {
+	fields = append(fields, c.extract(c.ctx))
+	for _, extract := range c.extractors {
+		fields = append(fields, extract(c.ctx))
+	}
+	return fields
+}
+
+// requestFields appends the fields of the request which the logger of the
+// edge does not hold, because the edge is shared with other requests.
+func (c call) requestFields(fields []zapcore.Field) []zapcore.Field {
+	if c.edge.exact {
+		return fields
+	}
+	return append(fields,
+		zap.String("source", c.req.Caller),
+		zap.String("dest", c.req.Service),
+		zap.String("transport", unknownIfEmpty(c.req.Transport)),
+		zap.String("procedure", c.req.Procedure),
+		zap.String("encoding", string(c.req.Encoding)),
+		zap.String("routingKey", c.req.RoutingKey),
+		zap.String("routingDelegate", c.req.RoutingDelegate),
+		zap.String("direction", string(c.direction)),
+	)
+}
+
 // inteded for metric tags, this returns the yarpcerrors.Status error code name
 // or "unknown_internal_yarpc"
 func errToMetricString(err error) string {
@@ -22,6 +22,7 @@ package observability
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -36,14 +37,73 @@ import (
 var (
 	_timeNow          = time.Now // for tests
 	_defaultGraphSize = 128
-	// Latency buckets for histograms. At some point, we may want to make these
-	// configurable.
+	// Default latency buckets for histograms.
 	_bucketsMs = bucket.NewRPCLatency()
 	// Bytes buckets for payload size histograms, containing exponential buckets
 	// in range of 0B, 1B, 2B, ... 4MB
 	_bucketsBytes = append([]int64{0}, bucket.NewExponential(1, 2, 23)...)
 )
 
+// Names of the tags of call metrics which may be dropped with
+// Config.Tags.
+const (
+	TagSource          = "source"
+	TagDest            = "dest"
+	TagTransport       = "transport"
+	TagProcedure       = "procedure"
+	TagEncoding        = "encoding"
+	TagRoutingKey      = "routing_key"
+	TagRoutingDelegate = "routing_delegate"
+)
+
+var _tags = map[string]struct{}{
+	TagSource:          {},
+	TagDest:            {},
+	TagTransport:       {},
+	TagProcedure:       {},
+	TagEncoding:        {},
+	TagRoutingKey:      {},
+	TagRoutingDelegate: {},
+}
+
+// ValidateTags returns an error if any of the tags may not be listed in
+// Config.Tags.
+func ValidateTags(tags []string) error {
+	for _, tag := range tags {
+		if _, ok := _tags[tag]; !ok {
+			return fmt.Errorf("unknown metrics tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// LatencyBucketsMs converts the upper bounds of latency buckets to
+// milliseconds, as expected by Config. It returns an error if the buckets
+// are not increasing at millisecond precision.
+func LatencyBucketsMs(buckets []time.Duration) ([]int64, error) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+	ms := make([]int64, len(buckets))
+	for i, b := range buckets {
+		ms[i] = int64(b / time.Millisecond)
+		if ms[i] < 1 {
+			return nil, fmt.Errorf("latency buckets must be at least 1ms, got %v", b)
+		}
+		if i > 0 && ms[i] <= ms[i-1] {
+			return nil, fmt.Errorf("latency buckets must be increasing at millisecond precision, got %v after %v", b, buckets[i-1])
+		}
+	}
+	return ms, nil
+}
+
+const (
+	// Procedure tag of inbound calls to procedures which are not known.
+	_unknownProcedure = "__unknown_procedure__"
+	// Value of the tags of calls along edges beyond Config.MaxEdges.
+	_overflow = "__overflow__"
+)
+
 type directionName string
 
 const (
@@ -58,18 +118,41 @@ type graph struct {
 	logger  *zap.Logger
 	extract ContextExtractor
 
-	edgesMu sync.RWMutex
-	edges   map[string]*edge
+	// extractors pull further fields from the contexts of calls.
+	extractors []ContextExtractor
+
+	edgesMu       sync.RWMutex
+	edges         map[string]*edge
+	overflowEdges map[string]*edge // by direction and RPC type
+
+	// maxEdges, if positive, caps the number of edges. Calls along further
+	// edges are recorded along an overflow edge.
+	maxEdges int
+
+	// tags are the variable tags of metrics which are kept. All tags are
+	// kept if nil.
+	tags map[string]struct{}
+
+	// knownProcedure, if set, reports whether inbound calls to a procedure
+	// are recorded with their procedure name.
+	knownProcedure func(service, procedure string) bool
+
+	inboundLatencyBuckets, outboundLatencyBuckets []int64
 
 	inboundLevels, outboundLevels levels
+
+	inboundHeaders, outboundHeaders *headerLogger
 }
 
 func newGraph(meter *metrics.Scope, logger *zap.Logger, extract ContextExtractor) graph {
 	return graph{
-		edges:   make(map[string]*edge, _defaultGraphSize),
-		meter:   meter,
-		logger:  logger,
-		extract: extract,
+		edges:                  make(map[string]*edge, _defaultGraphSize),
+		overflowEdges:          make(map[string]*edge),
+		meter:                  meter,
+		logger:                 logger,
+		extract:                extract,
+		inboundLatencyBuckets:  _bucketsMs,
+		outboundLatencyBuckets: _bucketsMs,
 		inboundLevels: levels{
 			success:          zapcore.DebugLevel,
 			failure:          zapcore.ErrorLevel,
@@ -87,41 +170,99 @@ func newGraph(meter *metrics.Scope, logger *zap.Logger, extract ContextExtractor
 func (g *graph) begin(ctx context.Context, rpcType transport.Type, direction directionName, req *transport.Request) call {
 	now := _timeNow()
 
+	v := g.edgeValues(req, direction)
 	d := digester.New()
-	d.Add(req.Caller)
-	d.Add(req.Service)
-	d.Add(req.Transport)
-	d.Add(string(req.Encoding))
-	d.Add(req.Procedure)
-	d.Add(req.RoutingKey)
-	d.Add(req.RoutingDelegate)
+	d.Add(v.source)
+	d.Add(v.dest)
+	d.Add(v.transport)
+	d.Add(v.encoding)
+	d.Add(v.procedure)
+	d.Add(v.routingKey)
+	d.Add(v.routingDelegate)
 	d.Add(string(direction))
 	d.Add(rpcType.String())
-	e := g.getOrCreateEdge(d.Digest(), req, string(direction), rpcType)
+	e := g.getOrCreateEdge(d.Digest(), v, direction, rpcType)
 	d.Free()
 
 	levels := &g.inboundLevels
+	headers := g.inboundHeaders
 	if direction != _directionInbound {
 		levels = &g.outboundLevels
+		headers = g.outboundHeaders
 	}
 
 	return call{
-		edge:      e,
-		extract:   g.extract,
-		started:   now,
-		ctx:       ctx,
-		req:       req,
-		rpcType:   rpcType,
-		direction: direction,
-		levels:    levels,
+		edge:       e,
+		extract:    g.extract,
+		extractors: g.extractors,
+		started:    now,
+		ctx:        ctx,
+		req:        req,
+		rpcType:    rpcType,
+		direction:  direction,
+		levels:     levels,
+		headers:    headers,
+	}
+}
+
+// edgeValues are the values of the tags of an edge.
+type edgeValues struct {
+	source, dest, transport, encoding, procedure, routingKey, routingDelegate string
+
+	// exact is true if the values are those of every request along the
+	// edge.
+	exact bool
+}
+
+// edgeValues returns the values of the tags of the edge of a request, with
+// dropped tags left empty.
+func (g *graph) edgeValues(req *transport.Request, direction directionName) edgeValues {
+	v := edgeValues{
+		source:          req.Caller,
+		dest:            req.Service,
+		transport:       req.Transport,
+		encoding:        string(req.Encoding),
+		procedure:       req.Procedure,
+		routingKey:      req.RoutingKey,
+		routingDelegate: req.RoutingDelegate,
+		exact:           true,
 	}
+	if direction == _directionInbound && g.knownProcedure != nil && !g.knownProcedure(req.Service, req.Procedure) {
+		v.procedure = _unknownProcedure
+		v.exact = false
+	}
+	if g.tags == nil {
+		return v
+	}
+
+	v.exact = false
+	for _, t := range []struct {
+		name  string
+		value *string
+	}{
+		{TagSource, &v.source},
+		{TagDest, &v.dest},
+		{TagTransport, &v.transport},
+		{TagEncoding, &v.encoding},
+		{TagProcedure, &v.procedure},
+		{TagRoutingKey, &v.routingKey},
+		{TagRoutingDelegate, &v.routingDelegate},
+	} {
+		if _, ok := g.tags[t.name]; !ok {
+			*t.value = ""
+		}
+	}
+	return v
 }
 
-func (g *graph) getOrCreateEdge(key []byte, req *transport.Request, direction string, rpcType transport.Type) *edge {
+func (g *graph) getOrCreateEdge(key []byte, v edgeValues, direction directionName, rpcType transport.Type) *edge {
 	if e := g.getEdge(key); e != nil {
 		return e
 	}
-	return g.createEdge(key, req, direction, rpcType)
+	if e := g.getOverflowEdge(direction, rpcType); e != nil {
+		return e
+	}
+	return g.createEdge(key, v, direction, rpcType)
 }
 
 func (g *graph) getEdge(key []byte) *edge {
@@ -131,7 +272,22 @@ func (g *graph) getEdge(key []byte) *edge {
 	return e
 }
 
-func (g *graph) createEdge(key []byte, req *transport.Request, direction string, rpcType transport.Type) *edge {
+// getOverflowEdge returns the overflow edge for calls along new edges, if
+// the graph is full and the overflow edge exists.
+func (g *graph) getOverflowEdge(direction directionName, rpcType transport.Type) *edge {
+	if g.maxEdges <= 0 {
+		return nil
+	}
+	g.edgesMu.RLock()
+	defer g.edgesMu.RUnlock()
+
+	if len(g.edges) < g.maxEdges {
+		return nil
+	}
+	return g.overflowEdges[string(direction)+rpcType.String()]
+}
+
+func (g *graph) createEdge(key []byte, v edgeValues, direction directionName, rpcType transport.Type) *edge {
 	g.edgesMu.Lock()
 	// Since we'll rarely hit this code path, the overhead of defer is acceptable.
 	defer g.edgesMu.Unlock()
@@ -141,15 +297,64 @@ func (g *graph) createEdge(key []byte, req *transport.Request, direction string,
 		return e
 	}
 
-	e := newEdge(g.logger, g.meter, req, direction, rpcType)
+	if g.maxEdges > 0 && len(g.edges) >= g.maxEdges {
+		overflowKey := string(direction) + rpcType.String()
+		if e, ok := g.overflowEdges[overflowKey]; ok {
+			return e
+		}
+		v = edgeValues{
+			source:          _overflow,
+			dest:            _overflow,
+			transport:       _overflow,
+			encoding:        _overflow,
+			procedure:       _overflow,
+			routingKey:      _overflow,
+			routingDelegate: _overflow,
+		}
+		e := newEdge(g.logger, g.meter, g.edgeSpec(v, direction, rpcType))
+		g.overflowEdges[overflowKey] = e
+		return e
+	}
+
+	e := newEdge(g.logger, g.meter, g.edgeSpec(v, direction, rpcType))
 	g.edges[string(key)] = e
 	return e
 }
 
+func (g *graph) edgeSpec(v edgeValues, direction directionName, rpcType transport.Type) edgeSpec {
+	buckets := g.inboundLatencyBuckets
+	if direction != _directionInbound {
+		buckets = g.outboundLatencyBuckets
+	}
+	return edgeSpec{
+		values:         v,
+		direction:      string(direction),
+		rpcType:        rpcType,
+		tags:           g.tags,
+		latencyBuckets: buckets,
+	}
+}
+
+// edgeSpec specifies the metrics of an edge.
+type edgeSpec struct {
+	values    edgeValues
+	direction string
+	rpcType   transport.Type
+
+	// tags are the variable tags of metrics which are kept. All tags are
+	// kept if nil.
+	tags map[string]struct{}
+
+	latencyBuckets []int64
+}
+
 // An edge is a collection of RPC stats for a particular
 // caller-callee-encoding-procedure-sk-rd-rk edge in the service graph.
 type edge struct {
 	logger *zap.Logger
+	// exact is true if the logger holds the fields of every request along
+	// the edge. Otherwise, they are logged with each call.
+	exact bool
 
 	calls          *metrics.Counter
 	successes      *metrics.Counter
@@ -186,18 +391,29 @@ type streamEdge struct {
 
 // newEdge constructs a new edge. Since Registries enforce metric uniqueness,
 // edges should be cached and re-used for each RPC.
-func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, direction string, rpcType transport.Type) *edge {
+func newEdge(logger *zap.Logger, meter *metrics.Scope, spec edgeSpec) *edge {
+	v, direction, rpcType := spec.values, spec.direction, spec.rpcType
 	tags := metrics.Tags{
-		"source":           req.Caller,
-		"dest":             req.Service,
-		"transport":        unknownIfEmpty(req.Transport),
-		"procedure":        req.Procedure,
-		"encoding":         string(req.Encoding),
-		"routing_key":      req.RoutingKey,
-		"routing_delegate": req.RoutingDelegate,
+		TagSource:          v.source,
+		TagDest:            v.dest,
+		TagTransport:       unknownIfEmpty(v.transport),
+		TagProcedure:       v.procedure,
+		TagEncoding:        v.encoding,
+		TagRoutingKey:      v.routingKey,
+		TagRoutingDelegate: v.routingDelegate,
 		"direction":        direction,
 		"rpc_type":         rpcType.String(),
 	}
+	if spec.tags != nil {
+		for name := range tags {
+			if name == "direction" || name == "rpc_type" {
+				continue
+			}
+			if _, ok := spec.tags[name]; !ok {
+				delete(tags, name)
+			}
+		}
+	}
 
 	// metrics for all RPCs
 	calls, err := meter.Counter(metrics.Spec{
@@ -254,7 +470,7 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 				ConstTags: tags,
 			},
 			Unit:    time.Millisecond,
-			Buckets: _bucketsMs,
+			Buckets: spec.latencyBuckets,
 		})
 		if err != nil {
 			logger.Error("Failed to create success latency distribution.", zap.Error(err))
@@ -266,7 +482,7 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 				ConstTags: tags,
 			},
 			Unit:    time.Millisecond,
-			Buckets: _bucketsMs,
+			Buckets: spec.latencyBuckets,
 		})
 		if err != nil {
 			logger.Error("Failed to create caller failure latency distribution.", zap.Error(err))
@@ -278,7 +494,7 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 				ConstTags: tags,
 			},
 			Unit:    time.Millisecond,
-			Buckets: _bucketsMs,
+			Buckets: spec.latencyBuckets,
 		})
 		if err != nil {
 			logger.Error("Failed to create server failure latency distribution.", zap.Error(err))
@@ -290,7 +506,7 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 				ConstTags: tags,
 			},
 			Unit:    time.Millisecond,
-			Buckets: _bucketsMs,
+			Buckets: spec.latencyBuckets,
 		})
 		if err != nil {
 			logger.Error("Failed to create ttl distribution.", zap.Error(err))
@@ -302,7 +518,7 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 				ConstTags: tags,
 			},
 			Unit:    time.Millisecond,
-			Buckets: _bucketsMs,
+			Buckets: spec.latencyBuckets,
 		})
 		if err != nil {
 			logger.Error("Failed to create timeout ttl distribution.", zap.Error(err))
@@ -398,7 +614,7 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 				ConstTags: tags,
 			},
 			Unit:    time.Millisecond,
-			Buckets: _bucketsMs,
+			Buckets: spec.latencyBuckets,
 		})
 		if err != nil {
 			logger.DPanic("Failed to create stream duration histogram.", zap.Error(err))
@@ -455,18 +671,21 @@ func newEdge(logger *zap.Logger, meter *metrics.Scope, req *transport.Request, d
 		}
 	}
 
-	logger = logger.With(
-		zap.String("source", req.Caller),
-		zap.String("dest", req.Service),
-		zap.String("transport", unknownIfEmpty(req.Transport)),
-		zap.String("procedure", req.Procedure),
-		zap.String("encoding", string(req.Encoding)),
-		zap.String("routingKey", req.RoutingKey),
-		zap.String("routingDelegate", req.RoutingDelegate),
-		zap.String("direction", direction),
-	)
+	if v.exact {
+		logger = logger.With(
+			zap.String("source", v.source),
+			zap.String("dest", v.dest),
+			zap.String("transport", unknownIfEmpty(v.transport)),
+			zap.String("procedure", v.procedure),
+			zap.String("encoding", v.encoding),
+			zap.String("routingKey", v.routingKey),
+			zap.String("routingDelegate", v.routingDelegate),
+			zap.String("direction", direction),
+		)
+	}
 	return &edge{
 		logger:               logger,
+		exact:                v.exact,
 		calls:                calls,
 		successes:            successes,
 		panics:               panics,
@@ -21,12 +21,17 @@
 package observability
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestEdgeNopFallbacks(t *testing.T) {
@@ -47,11 +52,13 @@ func TestEdgeNopFallbacks(t *testing.T) {
 	}
 
 	// Should succeed, covered by middleware tests.
-	_ = newEdge(zap.NewNop(), meter, req, string(_directionOutbound), transport.Unary)
+	g := newGraph(meter, zap.NewNop(), nil)
+	spec := g.edgeSpec(g.edgeValues(req, _directionOutbound), _directionOutbound, transport.Unary)
+	_ = newEdge(zap.NewNop(), meter, spec)
 
 	// Should fall back to no-op metrics.
 	// Usage of nil metrics should not panic, should not observe changes.
-	e := newEdge(zap.NewNop(), meter, req, string(_directionOutbound), transport.Unary)
+	e := newEdge(zap.NewNop(), meter, spec)
 
 	e.calls.Inc()
 	assert.Equal(t, int64(0), e.calls.Load(), "Expected to fall back to no-op metrics.")
@@ -103,3 +110,150 @@ func TestUnknownIfEmpty(t *testing.T) {
 		})
 	}
 }
+
+func handleProcedures(t *testing.T, mw *Middleware, procedures ...string) {
+	for _, p := range procedures {
+		err := mw.Handle(
+			context.Background(),
+			&transport.Request{
+				Caller:    "caller",
+				Service:   "service",
+				Encoding:  "raw",
+				Procedure: p,
+			},
+			&transporttest.FakeResponseWriter{},
+			fakeHandler{},
+		)
+		require.NoError(t, err, "Unexpected transport error.")
+	}
+}
+
+func callsByProcedure(snap *metrics.RootSnapshot) map[string]int64 {
+	calls := make(map[string]int64)
+	for _, c := range snap.Counters {
+		if c.Name == "calls" {
+			calls[c.Tags["procedure"]] += c.Value
+		}
+	}
+	return calls
+}
+
+func TestGraphTags(t *testing.T) {
+	defer stubTime()()
+	root := metrics.New()
+	mw := NewMiddleware(Config{
+		Logger:           zap.NewNop(),
+		Scope:            root.Scope(),
+		ContextExtractor: NewNopContextExtractor(),
+		Tags:             []string{TagProcedure},
+	})
+	handleProcedures(t, mw, "procedure")
+
+	snap := root.Snapshot()
+	require.NotEmpty(t, snap.Counters, "Expected counters.")
+	for _, c := range snap.Counters {
+		assert.Equal(t, metrics.Tags{
+			"direction": "inbound",
+			"procedure": "procedure",
+			"rpc_type":  transport.Unary.String(),
+		}, c.Tags, "Unexpected tags for counter %q.", c.Name)
+	}
+}
+
+func TestGraphUnknownProcedures(t *testing.T) {
+	defer stubTime()()
+	root := metrics.New()
+	mw := NewMiddleware(Config{
+		Logger:           zap.NewNop(),
+		Scope:            root.Scope(),
+		ContextExtractor: NewNopContextExtractor(),
+		KnownProcedure: func(service, procedure string) bool {
+			return service == "service" && procedure == "known"
+		},
+	})
+	handleProcedures(t, mw, "known", "foo", "bar")
+
+	assert.Equal(t, map[string]int64{
+		"known":           1,
+		_unknownProcedure: 2,
+	}, callsByProcedure(root.Snapshot()), "Unexpected calls per procedure.")
+}
+
+func TestGraphMaxEdges(t *testing.T) {
+	defer stubTime()()
+	root := metrics.New()
+	mw := NewMiddleware(Config{
+		Logger:           zap.NewNop(),
+		Scope:            root.Scope(),
+		ContextExtractor: NewNopContextExtractor(),
+		MaxEdges:         2,
+	})
+	handleProcedures(t, mw, "a", "b", "c", "d", "a")
+
+	snap := root.Snapshot()
+	assert.Equal(t, map[string]int64{
+		"a":       2,
+		"b":       1,
+		_overflow: 2,
+	}, callsByProcedure(snap), "Unexpected calls per procedure.")
+
+	for _, c := range snap.Counters {
+		if c.Tags["procedure"] != _overflow {
+			continue
+		}
+		assert.Equal(t, metrics.Tags{
+			"source":           _overflow,
+			"dest":             _overflow,
+			"transport":        _overflow,
+			"encoding":         _overflow,
+			"procedure":        _overflow,
+			"routing_key":      _overflow,
+			"routing_delegate": _overflow,
+			"direction":        "inbound",
+			"rpc_type":         transport.Unary.String(),
+		}, c.Tags, "Unexpected tags for overflow counter %q.", c.Name)
+	}
+}
+
+func TestGraphLatencyBuckets(t *testing.T) {
+	defer stubTime()()
+	root := metrics.New()
+	mw := NewMiddleware(Config{
+		Logger:                zap.NewNop(),
+		Scope:                 root.Scope(),
+		ContextExtractor:      NewNopContextExtractor(),
+		InboundLatencyBuckets: []int64{10, 100},
+	})
+	handleProcedures(t, mw, "procedure")
+
+	var found bool
+	for _, h := range root.Snapshot().Histograms {
+		if h.Name != "success_latency_ms" {
+			continue
+		}
+		found = true
+		// With a stubbed clock, the call takes no time and lands in the
+		// first bucket.
+		assert.Equal(t, []int64{10}, h.Values, "Unexpected latency buckets.")
+	}
+	assert.True(t, found, "Expected a success latency histogram.")
+}
+
+func TestGraphSharedEdgeLogging(t *testing.T) {
+	defer stubTime()()
+	core, logs := observer.New(zapcore.DebugLevel)
+	mw := NewMiddleware(Config{
+		Logger:           zap.New(core),
+		Scope:            metrics.New().Scope(),
+		ContextExtractor: NewNopContextExtractor(),
+		MaxEdges:         1,
+	})
+	handleProcedures(t, mw, "a", "b")
+
+	entries := logs.TakeAll()
+	require.Len(t, entries, 2, "Unexpected number of log entries.")
+	for i, want := range []string{"a", "b"} {
+		assert.Equal(t, want, entries[i].ContextMap()["procedure"],
+			"Expected logs to record the procedure of each call.")
+	}
+}
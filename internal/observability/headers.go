@@ -0,0 +1,206 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package observability
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/redact"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	_requestHeadersLogKey  = "requestHeaders"
+	_responseHeadersLogKey = "responseHeaders"
+
+	_redacted = "[REDACTED]"
+)
+
+// Redactor redacts the value of a sensitive header before it is logged. It
+// returns false if the header should not be logged at all.
+type Redactor func(key, value string) (redacted string, ok bool)
+
+// MaskRedactor replaces header values with a fixed placeholder.
+func MaskRedactor(key, value string) (string, bool) {
+	return _redacted, true
+}
+
+// _hashKey keys HashRedactor. It is chosen when the process starts so that
+// logged hashes cannot be reversed by hashing guessed values.
+var _hashKey = newHashKey()
+
+func newHashKey() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic("failed to generate header hash key: " + err.Error())
+	}
+	return key
+}
+
+// HashRedactor replaces header values with a truncated HMAC-SHA256 keyed
+// with a random per-process key, so that requests carrying the same value may
+// be correlated in the logs of one process.
+func HashRedactor(key, value string) (string, bool) {
+	return hashValue(_hashKey, value), true
+}
+
+// NewHashRedactor builds a Redactor which replaces header values with a
+// truncated HMAC-SHA256 keyed with the given key, so that requests carrying
+// the same value may be correlated across processes sharing the key.
+func NewHashRedactor(hashKey []byte) Redactor {
+	hashKey = append([]byte(nil), hashKey...)
+	return func(key, value string) (string, bool) {
+		return hashValue(hashKey, value), true
+	}
+}
+
+func hashValue(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// DropRedactor omits sensitive headers from logs.
+func DropRedactor(key, value string) (string, bool) {
+	return "", false
+}
+
+// HeadersConfig configures the logging of headers for one direction.
+type HeadersConfig struct {
+	// Request and Response enable logging of request and response headers.
+	Request, Response bool
+
+	// Allow, if non-empty, lists the only headers which are logged.
+	Allow []string
+
+	// Deny lists headers which are never logged.
+	Deny []string
+
+	// Redact lists headers whose values are redacted, in addition to
+	// headers which look like they carry secrets.
+	Redact []string
+
+	// Redactor redacts sensitive header values.
+	//
+	// Defaults to MaskRedactor.
+	Redactor Redactor
+}
+
+// headerLogger decides which headers are logged, and how.
+type headerLogger struct {
+	request, response bool
+
+	allow    map[string]struct{}
+	deny     map[string]struct{}
+	redact   map[string]struct{}
+	redactor Redactor
+}
+
+// newHeaderLogger returns nil if no headers should be logged.
+func newHeaderLogger(cfg HeadersConfig) *headerLogger {
+	if !cfg.Request && !cfg.Response {
+		return nil
+	}
+
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = MaskRedactor
+	}
+	return &headerLogger{
+		request:  cfg.Request,
+		response: cfg.Response,
+		allow:    headerSet(cfg.Allow),
+		deny:     headerSet(cfg.Deny),
+		redact:   headerSet(cfg.Redact),
+		redactor: redactor,
+	}
+}
+
+func headerSet(keys []string) map[string]struct{} {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[transport.CanonicalizeHeaderKey(k)] = struct{}{}
+	}
+	return set
+}
+
+func (l *headerLogger) requestFields(fields []zap.Field, headers transport.Headers) []zap.Field {
+	if l == nil || !l.request || headers.Len() == 0 {
+		return fields
+	}
+	return append(fields, zap.Object(_requestHeadersLogKey, loggedHeaders{l, headers}))
+}
+
+func (l *headerLogger) responseFields(fields []zap.Field, headers transport.Headers) []zap.Field {
+	if l == nil || !l.response || headers.Len() == 0 {
+		return fields
+	}
+	return append(fields, zap.Object(_responseHeadersLogKey, loggedHeaders{l, headers}))
+}
+
+// value returns the value to log for the given header, and false if it
+// should not be logged.
+func (l *headerLogger) value(key, value string) (string, bool) {
+	if l.allow != nil {
+		if _, ok := l.allow[key]; !ok {
+			return "", false
+		}
+	}
+	if _, ok := l.deny[key]; ok {
+		return "", false
+	}
+	if _, ok := l.redact[key]; ok || redact.IsSecretHeader(key) {
+		return l.redactor(key, value)
+	}
+	return value, true
+}
+
+// loggedHeaders logs headers in a stable order, omitting or redacting them
+// as configured.
+type loggedHeaders struct {
+	logger  *headerLogger
+	headers transport.Headers
+}
+
+func (h loggedHeaders) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	items := h.headers.Items()
+	keys := make([]string, 0, len(items))
+	for k := range items {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if v, ok := h.logger.value(k, items[k]); ok {
+			enc.AddString(k, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package observability
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHeaderLoggerValue(t *testing.T) {
+	tests := []struct {
+		desc   string
+		cfg    HeadersConfig
+		key    string
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{
+			desc:   "plain header",
+			key:    "x-tenant",
+			value:  "foo",
+			want:   "foo",
+			wantOK: true,
+		},
+		{
+			desc:   "secret header masked by default",
+			key:    "authorization",
+			value:  "Bearer foo",
+			want:   "[REDACTED]",
+			wantOK: true,
+		},
+		{
+			desc:   "secret header hashed",
+			cfg:    HeadersConfig{Redactor: NewHashRedactor([]byte("secret"))},
+			key:    "x-session-id",
+			value:  "foo",
+			want:   "hmac-sha256:773ba44693c7553d",
+			wantOK: true,
+		},
+		{
+			desc:  "secret header dropped",
+			cfg:   HeadersConfig{Redactor: DropRedactor},
+			key:   "x-api-key",
+			value: "foo",
+		},
+		{
+			desc:   "redacted header",
+			cfg:    HeadersConfig{Redact: []string{"X-Tenant"}},
+			key:    "x-tenant",
+			value:  "foo",
+			want:   "[REDACTED]",
+			wantOK: true,
+		},
+		{
+			desc:  "denied header",
+			cfg:   HeadersConfig{Deny: []string{"X-Tenant"}},
+			key:   "x-tenant",
+			value: "foo",
+		},
+		{
+			desc:  "header not allowed",
+			cfg:   HeadersConfig{Allow: []string{"x-routing"}},
+			key:   "x-tenant",
+			value: "foo",
+		},
+		{
+			desc:   "allowed secret header is still redacted",
+			cfg:    HeadersConfig{Allow: []string{"cookie"}},
+			key:    "cookie",
+			value:  "foo",
+			want:   "[REDACTED]",
+			wantOK: true,
+		},
+		{
+			desc: "custom redactor",
+			cfg: HeadersConfig{Redactor: func(key, value string) (string, bool) {
+				return key + ":" + value[:1], true
+			}},
+			key:    "x-auth-token",
+			value:  "foo",
+			want:   "x-auth-token:f",
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.cfg.Request = true
+			got, ok := newHeaderLogger(tt.cfg).value(tt.key, tt.value)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHashRedactor(t *testing.T) {
+	foo, ok := HashRedactor("x-session-id", "foo")
+	require.True(t, ok)
+	again, _ := HashRedactor("x-session-id", "foo")
+	bar, _ := HashRedactor("x-session-id", "bar")
+	keyed, _ := NewHashRedactor([]byte("secret"))("x-session-id", "foo")
+
+	assert.Equal(t, foo, again, "same value must hash the same")
+	assert.NotEqual(t, foo, bar, "different values must hash differently")
+	assert.NotEqual(t, foo, keyed, "per-process key must differ from a configured key")
+	assert.NotEqual(t, "sha256:2c26b46b68ffc68f", foo, "hash must be keyed")
+}
+
+func TestNewHeaderLoggerDisabled(t *testing.T) {
+	assert.Nil(t, newHeaderLogger(HeadersConfig{Allow: []string{"foo"}}))
+}
+
+type headersHandler struct {
+	headers transport.Headers
+}
+
+func (h headersHandler) Handle(_ context.Context, _ *transport.Request, rw transport.ResponseWriter) error {
+	rw.AddHeaders(h.headers)
+	return nil
+}
+
+type headersOutbound struct {
+	transport.Outbound
+
+	headers transport.Headers
+}
+
+func (o headersOutbound) Call(context.Context, *transport.Request) (*transport.Response, error) {
+	return &transport.Response{Headers: o.headers}, nil
+}
+
+func (o headersOutbound) CallStream(ctx context.Context, req *transport.StreamRequest) (*transport.ClientStream, error) {
+	return transport.NewClientStream(&fakeStream{ctx: ctx, request: req})
+}
+
+func TestMiddlewareLogsHeaders(t *testing.T) {
+	newRequest := func() *transport.Request {
+		return &transport.Request{
+			Caller:    "caller",
+			Service:   "service",
+			Encoding:  "raw",
+			Procedure: "procedure",
+			Headers: transport.NewHeaders().
+				With("x-tenant", "foo").
+				With("x-auth-token", "secret"),
+		}
+	}
+	wantRequestHeaders := map[string]interface{}{
+		"x-tenant":     "foo",
+		"x-auth-token": "[REDACTED]",
+	}
+	responseHeaders := transport.NewHeaders().With("x-served-by", "bar")
+	wantResponseHeaders := map[string]interface{}{"x-served-by": "bar"}
+
+	newMiddleware := func(inbound, outbound HeadersConfig) (*Middleware, *observer.ObservedLogs) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		return NewMiddleware(Config{
+			Logger:           zap.New(core),
+			ContextExtractor: NewNopContextExtractor(),
+			InboundHeaders:   inbound,
+			OutboundHeaders:  outbound,
+		}), logs
+	}
+
+	t.Run("inbound", func(t *testing.T) {
+		mw, logs := newMiddleware(HeadersConfig{Request: true, Response: true}, HeadersConfig{})
+		err := mw.Handle(context.Background(), newRequest(), new(transporttest.FakeResponseWriter), headersHandler{responseHeaders})
+		require.NoError(t, err)
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, wantRequestHeaders, fields[_requestHeadersLogKey])
+		assert.Equal(t, wantResponseHeaders, fields[_responseHeadersLogKey])
+	})
+
+	t.Run("outbound", func(t *testing.T) {
+		mw, logs := newMiddleware(HeadersConfig{}, HeadersConfig{Response: true})
+		_, err := mw.Call(context.Background(), newRequest(), headersOutbound{headers: responseHeaders})
+		require.NoError(t, err)
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.NotContains(t, fields, _requestHeadersLogKey)
+		assert.Equal(t, wantResponseHeaders, fields[_responseHeadersLogKey])
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		mw, logs := newMiddleware(HeadersConfig{}, HeadersConfig{})
+		err := mw.Handle(context.Background(), newRequest(), new(transporttest.FakeResponseWriter), headersHandler{responseHeaders})
+		require.NoError(t, err)
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		assert.NotContains(t, entries[0].ContextMap(), _requestHeadersLogKey)
+		assert.NotContains(t, entries[0].ContextMap(), _responseHeadersLogKey)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		mw, logs := newMiddleware(HeadersConfig{}, HeadersConfig{Request: true})
+		_, err := mw.CallStream(context.Background(), &transport.StreamRequest{Meta: newRequest().ToRequestMeta()}, headersOutbound{})
+		require.NoError(t, err)
+
+		entries := logs.FilterMessage(_successStreamOpen).TakeAll()
+		require.Len(t, entries, 1)
+		assert.Equal(t, wantRequestHeaders, entries[0].ContextMap()[_requestHeadersLogKey])
+	})
+}
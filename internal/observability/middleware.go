@@ -45,6 +45,9 @@ type writer struct {
 	applicationErrorMeta *transport.ApplicationErrorMeta
 
 	responseSize int
+
+	captureHeaders bool
+	headers        transport.Headers
 }
 
 func newWriter(rw transport.ResponseWriter) *writer {
@@ -69,6 +72,15 @@ func (w *writer) SetApplicationErrorMeta(applicationErrorMeta *transport.Applica
 	}
 }
 
+func (w *writer) AddHeaders(h transport.Headers) {
+	if w.captureHeaders {
+		for k, v := range h.OriginalItems() {
+			w.headers = w.headers.With(k, v)
+		}
+	}
+	w.ResponseWriter.AddHeaders(h)
+}
+
 func (w *writer) Write(p []byte) (n int, err error) {
 	w.responseSize += len(p)
 	return w.ResponseWriter.Write(p)
@@ -94,8 +106,37 @@ type Config struct {
 	// Extracts request-scoped information from the context for logging.
 	ContextExtractor ContextExtractor
 
+	// ContextExtractors extract further request-scoped information from the
+	// context, each adding a field to log entries.
+	ContextExtractors []ContextExtractor
+
 	// Levels specify log levels for various classes of requests.
 	Levels LevelsConfig
+
+	// InboundHeaders and OutboundHeaders specify which headers are logged
+	// for inbound and outbound requests. By default, no headers are logged.
+	InboundHeaders, OutboundHeaders HeadersConfig
+
+	// InboundLatencyBuckets and OutboundLatencyBuckets are the upper bounds,
+	// in milliseconds, of the buckets of latency histograms of inbound and
+	// outbound calls. Defaults to the RPC latency buckets of net/metrics.
+	InboundLatencyBuckets, OutboundLatencyBuckets []int64
+
+	// Tags, if not empty, lists the tags of call metrics which are kept,
+	// among TagSource, TagDest, TagTransport, TagProcedure, TagEncoding,
+	// TagRoutingKey and TagRoutingDelegate. The direction and rpc_type tags
+	// are always kept. By default, all tags are kept.
+	Tags []string
+
+	// KnownProcedure, if set, reports whether a procedure is served. Inbound
+	// calls to other procedures are recorded with a placeholder procedure
+	// tag, so that unknown procedure names do not create new metrics.
+	KnownProcedure func(service, procedure string) bool
+
+	// MaxEdges, if positive, caps the number of distinct combinations of
+	// tags that metrics are recorded for. Calls with further combinations
+	// are recorded with placeholder tags.
+	MaxEdges int
 }
 
 // LevelsConfig specifies log level overrides for inbound traffic, outbound
@@ -139,6 +180,25 @@ func NewMiddleware(cfg Config) *Middleware {
 	applyLogLevelsConfig(&m.graph.inboundLevels, &cfg.Levels.Inbound)
 	applyLogLevelsConfig(&m.graph.outboundLevels, &cfg.Levels.Outbound)
 
+	m.graph.inboundHeaders = newHeaderLogger(cfg.InboundHeaders)
+	m.graph.outboundHeaders = newHeaderLogger(cfg.OutboundHeaders)
+
+	if len(cfg.InboundLatencyBuckets) > 0 {
+		m.graph.inboundLatencyBuckets = cfg.InboundLatencyBuckets
+	}
+	if len(cfg.OutboundLatencyBuckets) > 0 {
+		m.graph.outboundLatencyBuckets = cfg.OutboundLatencyBuckets
+	}
+	if len(cfg.Tags) > 0 {
+		m.graph.tags = make(map[string]struct{}, len(cfg.Tags))
+		for _, t := range cfg.Tags {
+			m.graph.tags[t] = struct{}{}
+		}
+	}
+	m.graph.knownProcedure = cfg.KnownProcedure
+	m.graph.extractors = cfg.ContextExtractors
+	m.graph.maxEdges = cfg.MaxEdges
+
 	return m
 }
 
@@ -160,6 +220,7 @@ func (m *Middleware) Handle(ctx context.Context, req *transport.Request, w trans
 	defer m.handlePanicForCall(call, transport.Unary)
 
 	wrappedWriter := newWriter(w)
+	wrappedWriter.captureHeaders = call.headers != nil && call.headers.response
 	err := h.Handle(ctx, req, wrappedWriter)
 	ctxErr := ctxErrOverride(ctx, req)
 
@@ -171,6 +232,7 @@ func (m *Middleware) Handle(ctx context.Context, req *transport.Request, w trans
 			applicationErrorMeta: wrappedWriter.applicationErrorMeta,
 			requestSize:          req.BodySize,
 			responseSize:         wrappedWriter.responseSize,
+			responseHeaders:      wrappedWriter.headers,
 		})
 
 	if ctxErr != nil {
@@ -188,10 +250,12 @@ func (m *Middleware) Call(ctx context.Context, req *transport.Request, out trans
 	isApplicationError := false
 	var applicationErrorMeta *transport.ApplicationErrorMeta
 	var responseSize int
+	var responseHeaders transport.Headers
 	if res != nil {
 		isApplicationError = res.ApplicationError
 		applicationErrorMeta = res.ApplicationErrorMeta
 		responseSize = res.BodySize
+		responseHeaders = res.Headers
 	}
 	callRes := callResult{
 		err:                  err,
@@ -199,6 +263,7 @@ func (m *Middleware) Call(ctx context.Context, req *transport.Request, out trans
 		applicationErrorMeta: applicationErrorMeta,
 		requestSize:          req.BodySize,
 		responseSize:         responseSize,
+		responseHeaders:      responseHeaders,
 	}
 	call.EndCallWithAppError(callRes)
 	return res, err
@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opentelemetry
+
+import (
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/semconv"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+const _rpcSystem = "yarpc"
+
+// Attributes specific to YARPC. These follow the rpc.<system>.* naming
+// convention of the RPC semantic conventions.
+const (
+	_callerKey           = label.Key("rpc.yarpc.caller")
+	_encodingKey         = label.Key("rpc.yarpc.encoding")
+	_transportKey        = label.Key("rpc.yarpc.transport")
+	_codeKey             = label.Key("rpc.yarpc.code")
+	_applicationErrorKey = label.Key("rpc.yarpc.application_error")
+)
+
+func requestAttributes(req *transport.Request) []label.KeyValue {
+	return []label.KeyValue{
+		semconv.RPCSystemKey.String(_rpcSystem),
+		semconv.RPCServiceKey.String(req.Service),
+		semconv.RPCMethodKey.String(req.Procedure),
+		_callerKey.String(req.Caller),
+		_encodingKey.String(string(req.Encoding)),
+		_transportKey.String(req.Transport),
+	}
+}
+
+// isServerFault reports whether the error code indicates that the server,
+// rather than the caller, is at fault.
+func isServerFault(code yarpcerrors.Code) bool {
+	switch code {
+	case yarpcerrors.CodeUnknown,
+		yarpcerrors.CodeDeadlineExceeded,
+		yarpcerrors.CodeInternal,
+		yarpcerrors.CodeUnavailable,
+		yarpcerrors.CodeDataLoss,
+		yarpcerrors.CodeUnimplemented:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opentelemetry_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/encoding/raw"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/yarpc/transport/http"
+	"go.uber.org/yarpc/transport/tchannel"
+)
+
+const (
+	_clientName = "caller"
+	_serverName = "callee"
+)
+
+type streamHandler func(*transport.ServerStream) error
+
+func (f streamHandler) HandleStream(s *transport.ServerStream) error { return f(s) }
+
+func TestDispatcherPropagation(t *testing.T) {
+	tests := []struct {
+		transport string
+		streaming bool
+	}{
+		{transport: http.TransportName},
+		{transport: tchannel.TransportName},
+		{transport: grpc.TransportName, streaming: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transport, func(t *testing.T) {
+			spans := new(oteltest.StandardSpanRecorder)
+			tp := oteltest.NewTracerProvider(oteltest.WithSpanRecorder(spans))
+
+			var handlerSpan trace.SpanContext
+			server, addr := newServer(t, tt.transport, tp)
+			server.Register(raw.Procedure("echo", func(ctx context.Context, body []byte) ([]byte, error) {
+				handlerSpan = trace.SpanContextFromContext(ctx)
+				return body, nil
+			}))
+			server.Register([]transport.Procedure{{
+				Name:     "stream",
+				Encoding: raw.Encoding,
+				HandlerSpec: transport.NewStreamHandlerSpec(streamHandler(func(s *transport.ServerStream) error {
+					handlerSpan = trace.SpanContextFromContext(s.Context())
+					return nil
+				})),
+			}})
+			require.NoError(t, server.Start())
+			defer func() { assert.NoError(t, server.Stop()) }()
+
+			client := newClient(t, tt.transport, *addr, tp)
+			require.NoError(t, client.Start())
+			defer func() { assert.NoError(t, client.Stop()) }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			_, err := raw.New(client.ClientConfig(_serverName)).Call(ctx, "echo", []byte("hello"))
+			require.NoError(t, err)
+			assertPropagated(t, spans.Completed(), handlerSpan, tt.transport)
+
+			if !tt.streaming {
+				return
+			}
+
+			stream, err := client.MustOutboundConfig(_serverName).Outbounds.Stream.CallStream(ctx, &transport.StreamRequest{
+				Meta: &transport.RequestMeta{
+					Caller:    _clientName,
+					Service:   _serverName,
+					Procedure: "stream",
+					Encoding:  raw.Encoding,
+				},
+			})
+			require.NoError(t, err)
+			_, err = stream.ReceiveMessage(ctx)
+			require.Equal(t, io.EOF, err)
+			require.NoError(t, stream.Close(ctx))
+			// Skip the spans of the unary call.
+			assertPropagated(t, spans.Completed()[2:], handlerSpan, tt.transport)
+		})
+	}
+}
+
+func assertPropagated(t *testing.T, spans []*oteltest.Span, handlerSpan trace.SpanContext, transportName string) {
+	require.Len(t, spans, 2)
+
+	var client, server *oteltest.Span
+	for _, span := range spans {
+		switch span.SpanKind() {
+		case trace.SpanKindClient:
+			client = span
+		case trace.SpanKindServer:
+			server = span
+		}
+	}
+	require.NotNil(t, client, "client span must be recorded")
+	require.NotNil(t, server, "server span must be recorded")
+
+	assert.Equal(t, client.SpanContext().TraceID, server.SpanContext().TraceID)
+	assert.Equal(t, client.SpanContext().SpanID, server.ParentSpanID())
+	assert.Equal(t, server.SpanContext(), handlerSpan)
+
+	for _, span := range spans {
+		assert.Equal(t, transportName, span.Attributes()["rpc.yarpc.transport"].AsString())
+	}
+}
+
+// newServer builds a server dispatcher. The returned address is only valid
+// after the dispatcher has started.
+func newServer(t *testing.T, transportName string, tp trace.TracerProvider) (*yarpc.Dispatcher, *string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+
+	var inbound transport.Inbound
+	switch transportName {
+	case http.TransportName:
+		require.NoError(t, listener.Close())
+		inbound = http.NewTransport().NewInbound(addr)
+		addr = "http://" + addr
+	case tchannel.TransportName:
+		trans, err := tchannel.NewTransport(tchannel.ServiceName(_serverName), tchannel.Listener(listener))
+		require.NoError(t, err)
+		inbound = trans.NewInbound()
+	case grpc.TransportName:
+		inbound = grpc.NewTransport().NewInbound(listener)
+	}
+
+	return yarpc.NewDispatcher(yarpc.Config{
+		Name:           _serverName,
+		Inbounds:       yarpc.Inbounds{inbound},
+		TracerProvider: tp,
+	}), &addr
+}
+
+func newClient(t *testing.T, transportName, addr string, tp trace.TracerProvider) *yarpc.Dispatcher {
+	outbounds := transport.Outbounds{ServiceName: _serverName}
+	switch transportName {
+	case http.TransportName:
+		outbounds.Unary = http.NewTransport().NewSingleOutbound(addr)
+	case tchannel.TransportName:
+		trans, err := tchannel.NewTransport(tchannel.ServiceName(_clientName))
+		require.NoError(t, err)
+		outbounds.Unary = trans.NewSingleOutbound(addr)
+	case grpc.TransportName:
+		out := grpc.NewTransport().NewSingleOutbound(addr)
+		outbounds.Unary = out
+		outbounds.Stream = out
+	}
+
+	return yarpc.NewDispatcher(yarpc.Config{
+		Name:           _clientName,
+		Outbounds:      yarpc.Outbounds{_serverName: outbounds},
+		TracerProvider: tp,
+	})
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opentelemetry
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/unit"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/headerutil"
+	"go.uber.org/yarpc/internal/streamctx"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	_instrumentationName = "go.uber.org/yarpc"
+
+	_serverDuration = "rpc.server.duration"
+	_clientDuration = "rpc.client.duration"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*Middleware)(nil)
+	_ middleware.UnaryOutbound  = (*Middleware)(nil)
+	_ middleware.OnewayInbound  = (*Middleware)(nil)
+	_ middleware.OnewayOutbound = (*Middleware)(nil)
+	_ middleware.StreamInbound  = (*Middleware)(nil)
+	_ middleware.StreamOutbound = (*Middleware)(nil)
+)
+
+// Config configures the OpenTelemetry middleware.
+type Config struct {
+	// TracerProvider creates the tracer used to record spans. Spans are not
+	// recorded if this is nil.
+	TracerProvider trace.TracerProvider
+
+	// MeterProvider creates the meter used to record request durations.
+	// Durations are not recorded if this is nil.
+	MeterProvider metric.MeterProvider
+
+	// Propagator injects and extracts span context in request headers.
+	//
+	// Defaults to the W3C Trace Context propagator.
+	Propagator propagation.TextMapPropagator
+
+	// Logger to which instrument creation failures are logged.
+	Logger *zap.Logger
+}
+
+// Middleware is OpenTelemetry tracing and metrics middleware for all RPC
+// types.
+type Middleware struct {
+	tracer         trace.Tracer
+	propagator     propagation.TextMapPropagator
+	serverDuration metric.Float64ValueRecorder
+	clientDuration metric.Float64ValueRecorder
+}
+
+// NewMiddleware builds a new OpenTelemetry middleware.
+func NewMiddleware(cfg Config) *Middleware {
+	tp := cfg.TracerProvider
+	if tp == nil {
+		tp = trace.NewNoopTracerProvider()
+	}
+	mp := cfg.MeterProvider
+	if mp == nil {
+		mp = metric.NoopMeterProvider{}
+	}
+	propagator := cfg.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	meter := mp.Meter(_instrumentationName)
+	return &Middleware{
+		tracer:         tp.Tracer(_instrumentationName),
+		propagator:     propagator,
+		serverDuration: newDuration(meter, logger, _serverDuration, "Measures the duration of inbound RPCs."),
+		clientDuration: newDuration(meter, logger, _clientDuration, "Measures the duration of outbound RPCs."),
+	}
+}
+
+func newDuration(meter metric.Meter, logger *zap.Logger, name, description string) metric.Float64ValueRecorder {
+	r, err := meter.NewFloat64ValueRecorder(name, metric.WithUnit(unit.Milliseconds), metric.WithDescription(description))
+	if err != nil {
+		logger.Error("failed to create OpenTelemetry value recorder, durations will not be recorded",
+			zap.String("name", name), zap.Error(err))
+		// The zero Meter records nothing.
+		r, _ = metric.Meter{}.NewFloat64ValueRecorder(name)
+	}
+	return r
+}
+
+// Handle implements middleware.UnaryInbound.
+func (m *Middleware) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	call := m.beginInbound(ctx, req)
+	w := &writer{ResponseWriter: resw}
+	err := h.Handle(call.ctx, req, w)
+	call.end(err, w.isApplicationError)
+	return err
+}
+
+// Call implements middleware.UnaryOutbound.
+func (m *Middleware) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	call, headers := m.beginOutbound(ctx, req)
+	r := *req
+	r.Headers = headers
+	res, err := out.Call(call.ctx, &r)
+	call.end(err, res != nil && res.ApplicationError)
+	return res, err
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (m *Middleware) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	call := m.beginInbound(ctx, req)
+	err := h.HandleOneway(call.ctx, req)
+	call.end(err, false)
+	return err
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (m *Middleware) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	call, headers := m.beginOutbound(ctx, req)
+	r := *req
+	r.Headers = headers
+	ack, err := out.CallOneway(call.ctx, &r)
+	call.end(err, false)
+	return ack, err
+}
+
+// HandleStream implements middleware.StreamInbound.
+func (m *Middleware) HandleStream(serverStream *transport.ServerStream, h transport.StreamHandler) error {
+	call := m.beginInbound(serverStream.Context(), serverStream.Request().Meta.ToRequest())
+	err := h.HandleStream(streamctx.WithContext(serverStream, call.ctx))
+	call.end(err, false)
+	return err
+}
+
+// CallStream implements middleware.StreamOutbound.
+func (m *Middleware) CallStream(ctx context.Context, req *transport.StreamRequest, out transport.StreamOutbound) (*transport.ClientStream, error) {
+	call, headers := m.beginOutbound(ctx, req.Meta.ToRequest())
+	meta := *req.Meta
+	meta.Headers = headers
+	clientStream, err := out.CallStream(call.ctx, &transport.StreamRequest{Meta: &meta})
+	if err != nil {
+		call.end(err, false)
+		return nil, err
+	}
+	return call.wrapClientStream(clientStream), nil
+}
+
+func (m *Middleware) beginInbound(ctx context.Context, req *transport.Request) call {
+	ctx = m.propagator.Extract(ctx, headersCarrier{&req.Headers})
+	return m.begin(ctx, req, trace.SpanKindServer, m.serverDuration)
+}
+
+// beginOutbound starts a client span and returns a copy of the request
+// headers carrying its context.
+func (m *Middleware) beginOutbound(ctx context.Context, req *transport.Request) (call, transport.Headers) {
+	call := m.begin(ctx, req, trace.SpanKindClient, m.clientDuration)
+	// Copy the headers so that injecting trace context does not modify the
+	// caller's request.
+	headers := headerutil.Copy(req.Headers, 2)
+	m.propagator.Inject(call.ctx, headersCarrier{&headers})
+	return call, headers
+}
+
+func (m *Middleware) begin(ctx context.Context, req *transport.Request, kind trace.SpanKind, duration metric.Float64ValueRecorder) call {
+	attrs := requestAttributes(req)
+	ctx, span := m.tracer.Start(ctx, req.Service+"/"+req.Procedure,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(attrs...))
+	return call{
+		ctx:      ctx,
+		span:     span,
+		kind:     kind,
+		attrs:    attrs,
+		started:  time.Now(),
+		duration: duration,
+	}
+}
+
+// call holds the state of a single instrumented request.
+type call struct {
+	ctx      context.Context
+	span     trace.Span
+	kind     trace.SpanKind
+	attrs    []label.KeyValue
+	started  time.Time
+	duration metric.Float64ValueRecorder
+}
+
+// end finishes the span and records the duration of the request.
+func (c call) end(err error, isApplicationError bool) {
+	elapsed := float64(time.Since(c.started)) / float64(time.Millisecond)
+
+	attrs := c.attrs
+	if err != nil {
+		code := yarpcerrors.FromError(err).Code()
+		attrs = append(attrs, _codeKey.String(code.String()))
+
+		c.span.RecordError(err)
+		// Callers see every error as a failure, but servers are only at
+		// fault for some of them. RecordError marks the span as failed, so
+		// the status is always set explicitly.
+		if c.kind == trace.SpanKindClient || isServerFault(code) {
+			c.span.SetStatus(codes.Error, err.Error())
+		} else {
+			c.span.SetStatus(codes.Unset, "")
+		}
+	} else if isApplicationError {
+		attrs = append(attrs, _applicationErrorKey.Bool(true))
+	}
+	c.span.SetAttributes(attrs[len(c.attrs):]...)
+	c.span.End()
+
+	c.duration.Record(c.ctx, elapsed, attrs...)
+}
+
+// writer wraps a transport.ResponseWriter to detect application errors.
+type writer struct {
+	transport.ResponseWriter
+
+	isApplicationError bool
+}
+
+func (w *writer) SetApplicationError() {
+	w.isApplicationError = true
+	w.ResponseWriter.SetApplicationError()
+}
+
+func (w *writer) SetApplicationErrorMeta(meta *transport.ApplicationErrorMeta) {
+	if setter, ok := w.ResponseWriter.(transport.ApplicationErrorMetaSetter); ok {
+		setter.SetApplicationErrorMeta(meta)
+	}
+}
@@ -0,0 +1,393 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/oteltest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/unit"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fixture struct {
+	spans  *oteltest.StandardSpanRecorder
+	meter  *oteltest.MeterImpl
+	client *Middleware
+	server *Middleware
+}
+
+func newFixture() *fixture {
+	spans := new(oteltest.StandardSpanRecorder)
+	meter, mp := oteltest.NewMeterProvider()
+	cfg := Config{
+		TracerProvider: oteltest.NewTracerProvider(oteltest.WithSpanRecorder(spans)),
+		MeterProvider:  mp,
+	}
+	return &fixture{
+		spans:  spans,
+		meter:  meter,
+		client: NewMiddleware(cfg),
+		server: NewMiddleware(cfg),
+	}
+}
+
+func (f *fixture) span(t *testing.T, kind trace.SpanKind) *oteltest.Span {
+	for _, span := range f.spans.Completed() {
+		if span.SpanKind() == kind {
+			return span
+		}
+	}
+	require.FailNow(t, "span not found", "no %v span was ended", kind)
+	return nil
+}
+
+type measurement struct {
+	unit   unit.Unit
+	labels map[label.Key]label.Value
+}
+
+// measurements returns everything recorded by the named instrument.
+func (f *fixture) measurements(name string) []measurement {
+	var ms []measurement
+	for _, batch := range f.meter.MeasurementBatches {
+		for _, m := range batch.Measurements {
+			desc := m.Instrument.Descriptor()
+			if desc.Name() == name {
+				ms = append(ms, measurement{
+					unit:   desc.Unit(),
+					labels: oteltest.LabelsToMap(batch.Labels...),
+				})
+			}
+		}
+	}
+	return ms
+}
+
+func newRequest() *transport.Request {
+	return &transport.Request{
+		Caller:    "caller",
+		Service:   "service",
+		Procedure: "procedure",
+		Encoding:  "raw",
+		Transport: "http",
+		Headers:   transport.NewHeaders().With("foo", "bar"),
+		Body:      bytes.NewReader([]byte("body")),
+	}
+}
+
+func TestUnaryPropagation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	f := newFixture()
+	req := newRequest()
+
+	var serverCtx context.Context
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, r *transport.Request) (*transport.Response, error) {
+			traceparent, ok := r.Headers.Get("traceparent")
+			assert.True(t, ok, "traceparent must be sent")
+			assert.NotEmpty(t, traceparent)
+
+			// Cross the wire: the server sees only the headers.
+			handler := transporttest.NewMockUnaryHandler(mockCtrl)
+			handler.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request, _ transport.ResponseWriter) error {
+					serverCtx = ctx
+					return nil
+				})
+			err := f.server.Handle(context.Background(), r, new(transporttest.FakeResponseWriter), handler)
+			return &transport.Response{}, err
+		})
+
+	_, err := f.client.Call(context.Background(), req, out)
+	require.NoError(t, err)
+
+	_, ok := req.Headers.Get("traceparent")
+	assert.False(t, ok, "caller's headers must not be modified")
+
+	client := f.span(t, trace.SpanKindClient)
+	server := f.span(t, trace.SpanKindServer)
+	assert.Equal(t, "service/procedure", client.Name())
+	assert.Equal(t, client.SpanContext().TraceID, server.SpanContext().TraceID)
+	assert.Equal(t, client.SpanContext().SpanID, server.ParentSpanID())
+	assert.Equal(t, server.SpanContext(), trace.SpanContextFromContext(serverCtx),
+		"handler must run within the server span")
+
+	assert.Equal(t, map[label.Key]label.Value{
+		"rpc.system":          label.StringValue("yarpc"),
+		"rpc.service":         label.StringValue("service"),
+		"rpc.method":          label.StringValue("procedure"),
+		"rpc.yarpc.caller":    label.StringValue("caller"),
+		"rpc.yarpc.encoding":  label.StringValue("raw"),
+		"rpc.yarpc.transport": label.StringValue("http"),
+	}, server.Attributes())
+	assert.Equal(t, codes.Unset, server.StatusCode())
+
+	for _, name := range []string{_clientDuration, _serverDuration} {
+		ms := f.measurements(name)
+		require.Len(t, ms, 1, "%q must be recorded once", name)
+		assert.Equal(t, unit.Milliseconds, ms[0].unit)
+		assert.Equal(t, label.StringValue("procedure"), ms[0].labels["rpc.method"])
+	}
+}
+
+func TestUnaryErrors(t *testing.T) {
+	tests := []struct {
+		desc             string
+		err              error
+		applicationError bool
+		wantClientStatus codes.Code
+		wantServerStatus codes.Code
+		wantCode         string
+	}{
+		{
+			desc:             "server fault",
+			err:              yarpcerrors.InternalErrorf("great sadness"),
+			wantClientStatus: codes.Error,
+			wantServerStatus: codes.Error,
+			wantCode:         "internal",
+		},
+		{
+			desc:             "client fault",
+			err:              yarpcerrors.InvalidArgumentErrorf("bad request"),
+			wantClientStatus: codes.Error,
+			wantServerStatus: codes.Unset,
+			wantCode:         "invalid-argument",
+		},
+		{
+			desc:             "unknown error",
+			err:              errors.New("great sadness"),
+			wantClientStatus: codes.Error,
+			wantServerStatus: codes.Error,
+			wantCode:         "unknown",
+		},
+		{
+			desc:             "application error",
+			applicationError: true,
+			wantClientStatus: codes.Unset,
+			wantServerStatus: codes.Unset,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			f := newFixture()
+
+			out := transporttest.NewMockUnaryOutbound(mockCtrl)
+			out.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(ctx context.Context, r *transport.Request) (*transport.Response, error) {
+					handler := transporttest.NewMockUnaryHandler(mockCtrl)
+					handler.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+						func(_ context.Context, _ *transport.Request, rw transport.ResponseWriter) error {
+							if tt.applicationError {
+								rw.SetApplicationError()
+							}
+							return tt.err
+						})
+					rw := new(transporttest.FakeResponseWriter)
+					err := f.server.Handle(context.Background(), r, rw, handler)
+					return &transport.Response{ApplicationError: rw.IsApplicationError}, err
+				})
+
+			_, err := f.client.Call(context.Background(), newRequest(), out)
+			assert.Equal(t, tt.err, err)
+
+			for _, s := range []struct {
+				kind       trace.SpanKind
+				wantStatus codes.Code
+			}{
+				{trace.SpanKindClient, tt.wantClientStatus},
+				{trace.SpanKindServer, tt.wantServerStatus},
+			} {
+				span := f.span(t, s.kind)
+				assert.Equal(t, s.wantStatus, span.StatusCode(), "unexpected %v span status", s.kind)
+
+				attrs := span.Attributes()
+				if tt.wantCode != "" {
+					assert.Equal(t, label.StringValue(tt.wantCode), attrs["rpc.yarpc.code"])
+					assert.Len(t, span.Events(), 1, "error must be recorded")
+				} else {
+					assert.NotContains(t, attrs, label.Key("rpc.yarpc.code"))
+				}
+				if tt.applicationError {
+					assert.Equal(t, label.BoolValue(true), attrs["rpc.yarpc.application_error"])
+				}
+			}
+		})
+	}
+}
+
+func TestOneway(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	f := newFixture()
+
+	out := transporttest.NewMockOnewayOutbound(mockCtrl)
+	out.EXPECT().CallOneway(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, r *transport.Request) (transport.Ack, error) {
+			handler := transporttest.NewMockOnewayHandler(mockCtrl)
+			handler.EXPECT().HandleOneway(gomock.Any(), gomock.Any()).Return(nil)
+			return nil, f.server.HandleOneway(context.Background(), r, handler)
+		})
+
+	_, err := f.client.CallOneway(context.Background(), newRequest(), out)
+	require.NoError(t, err)
+
+	client := f.span(t, trace.SpanKindClient)
+	server := f.span(t, trace.SpanKindServer)
+	assert.Equal(t, client.SpanContext().SpanID, server.ParentSpanID())
+}
+
+type fakeStream struct {
+	ctx      context.Context
+	req      *transport.StreamRequest
+	messages []*transport.StreamMessage
+}
+
+func (s *fakeStream) Context() context.Context                                    { return s.ctx }
+func (s *fakeStream) Request() *transport.StreamRequest                           { return s.req }
+func (s *fakeStream) Close(context.Context) error                                 { return nil }
+func (s *fakeStream) SendMessage(context.Context, *transport.StreamMessage) error { return nil }
+
+func (s *fakeStream) ReceiveMessage(context.Context) (*transport.StreamMessage, error) {
+	if len(s.messages) == 0 {
+		return nil, io.EOF
+	}
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+	return msg, nil
+}
+
+func TestStream(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	f := newFixture()
+	req := &transport.StreamRequest{Meta: newRequest().ToRequestMeta()}
+
+	var serverCtx context.Context
+	out := transporttest.NewMockStreamOutbound(mockCtrl)
+	out.EXPECT().CallStream(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, r *transport.StreamRequest) (*transport.ClientStream, error) {
+			handler := transporttest.NewMockStreamHandler(mockCtrl)
+			handler.EXPECT().HandleStream(gomock.Any()).DoAndReturn(
+				func(s *transport.ServerStream) error {
+					serverCtx = s.Context()
+					assert.Equal(t, r, s.Request(), "request must be preserved")
+					return nil
+				})
+			serverStream, err := transport.NewServerStream(&fakeStream{ctx: context.Background(), req: r})
+			require.NoError(t, err)
+			require.NoError(t, f.server.HandleStream(serverStream, handler))
+
+			return transport.NewClientStream(&fakeStream{
+				ctx:      ctx,
+				req:      r,
+				messages: []*transport.StreamMessage{{}},
+			})
+		})
+
+	clientStream, err := f.client.CallStream(context.Background(), req, out)
+	require.NoError(t, err)
+
+	server := f.span(t, trace.SpanKindServer)
+	assert.Equal(t, server.SpanContext(), trace.SpanContextFromContext(serverCtx),
+		"handler must run within the server span")
+
+	_, err = clientStream.ReceiveMessage(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, f.spans.Completed(), 1, "client span must not end while the stream is open")
+
+	_, err = clientStream.ReceiveMessage(context.Background())
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, clientStream.Close(context.Background()))
+
+	require.Len(t, f.spans.Completed(), 2, "client span must end exactly once")
+	client := f.span(t, trace.SpanKindClient)
+	assert.Equal(t, client.SpanContext().SpanID, server.ParentSpanID())
+	assert.Equal(t, codes.Unset, client.StatusCode())
+}
+
+func TestStreamCallError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	f := newFixture()
+	req := &transport.StreamRequest{Meta: newRequest().ToRequestMeta()}
+
+	out := transporttest.NewMockStreamOutbound(mockCtrl)
+	out.EXPECT().CallStream(gomock.Any(), gomock.Any()).
+		Return(nil, yarpcerrors.UnavailableErrorf("no peers"))
+
+	_, err := f.client.CallStream(context.Background(), req, out)
+	require.Error(t, err)
+
+	client := f.span(t, trace.SpanKindClient)
+	assert.Equal(t, codes.Error, client.StatusCode())
+}
+
+func TestInstrumentCreationFailure(t *testing.T) {
+	core, logs := observer.New(zapcore.ErrorLevel)
+	_, mp := oteltest.NewMeterProvider()
+
+	// Registering the same names as a different kind of instrument makes
+	// the middleware's registrations conflict.
+	meter := mp.Meter(_instrumentationName)
+	for _, name := range []string{_serverDuration, _clientDuration} {
+		_, err := meter.NewInt64Counter(name)
+		require.NoError(t, err)
+	}
+
+	m := NewMiddleware(Config{
+		MeterProvider: mp,
+		Logger:        zap.New(core),
+	})
+	assert.Equal(t, 2, logs.Len())
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	handler := transporttest.NewMockUnaryHandler(mockCtrl)
+	handler.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	assert.NoError(t, m.Handle(context.Background(), newRequest(), new(transporttest.FakeResponseWriter), handler))
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package opentelemetry
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"go.uber.org/yarpc/api/transport"
+)
+
+var _ transport.StreamHeadersReader = (*clientStream)(nil)
+
+// clientStream ends the client span when the stream is closed or the server
+// ends it.
+type clientStream struct {
+	*transport.ClientStream
+
+	call call
+	once sync.Once
+}
+
+func (c call) wrapClientStream(stream *transport.ClientStream) *transport.ClientStream {
+	wrapped, err := transport.NewClientStream(&clientStream{ClientStream: stream, call: c})
+	if err != nil {
+		// transport.NewClientStream only fails for nil streams.
+		c.end(nil, false)
+		return stream
+	}
+	return wrapped
+}
+
+func (s *clientStream) ReceiveMessage(ctx context.Context) (*transport.StreamMessage, error) {
+	msg, err := s.ClientStream.ReceiveMessage(ctx)
+	if err == io.EOF {
+		s.end(nil)
+	} else if err != nil {
+		s.end(err)
+	}
+	return msg, err
+}
+
+func (s *clientStream) Close(ctx context.Context) error {
+	err := s.ClientStream.Close(ctx)
+	s.end(err)
+	return err
+}
+
+func (s *clientStream) end(err error) {
+	s.once.Do(func() { s.call.end(err, false) })
+}
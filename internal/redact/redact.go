@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package redact identifies sensitive data which must not be exposed in logs
+// or debugging tools.
+package redact
+
+import "strings"
+
+// Headers whose names contain any of these substrings look like they carry
+// secrets.
+var _secretHeaderSubstrings = []string{
+	"auth",
+	"token",
+	"secret",
+	"passw",
+	"cookie",
+	"credential",
+	"session",
+	"signature",
+	"apikey",
+	"api-key",
+	"api_key",
+	"private",
+}
+
+// IsSecretHeader reports whether the header with the given canonical
+// (lower-case) name looks like it carries a secret.
+func IsSecretHeader(key string) bool {
+	for _, s := range _secretHeaderSubstrings {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
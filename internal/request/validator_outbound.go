@@ -25,12 +25,18 @@ import (
 
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/api/x/restriction"
+	"go.uber.org/yarpc/yarpcerrors"
 )
 
 // UnaryValidatorOutbound wraps an Outbound to validate all outgoing unary requests.
 type UnaryValidatorOutbound struct {
 	transport.UnaryOutbound
 	transport.Namer
+
+	// Restriction, if set, rejects requests whose encoding is not allowed
+	// over the transport of this outbound.
+	Restriction restriction.Checker
 }
 
 // Call performs the given request, failing early if the request is invalid.
@@ -43,6 +49,10 @@ func (o UnaryValidatorOutbound) Call(ctx context.Context, request *transport.Req
 		return nil, err
 	}
 
+	if err := checkRestriction(o.Restriction, o.Namer, request); err != nil {
+		return nil, err
+	}
+
 	return o.UnaryOutbound.Call(ctx, request)
 }
 
@@ -58,6 +68,10 @@ func (o UnaryValidatorOutbound) Introspect() introspection.OutboundStatus {
 type OnewayValidatorOutbound struct {
 	transport.OnewayOutbound
 	transport.Namer
+
+	// Restriction, if set, rejects requests whose encoding is not allowed
+	// over the transport of this outbound.
+	Restriction restriction.Checker
 }
 
 // CallOneway performs the given request, failing early if the request is invalid.
@@ -70,6 +84,10 @@ func (o OnewayValidatorOutbound) CallOneway(ctx context.Context, request *transp
 		return nil, err
 	}
 
+	if err := checkRestriction(o.Restriction, o.Namer, request); err != nil {
+		return nil, err
+	}
+
 	return o.OnewayOutbound.CallOneway(ctx, request)
 }
 
@@ -85,6 +103,10 @@ func (o OnewayValidatorOutbound) Introspect() introspection.OutboundStatus {
 type StreamValidatorOutbound struct {
 	transport.Namer
 	transport.StreamOutbound
+
+	// Restriction, if set, rejects requests whose encoding is not allowed
+	// over the transport of this outbound.
+	Restriction restriction.Checker
 }
 
 // CallStream performs the given request, failing early if the request is invalid.
@@ -93,6 +115,10 @@ func (o StreamValidatorOutbound) CallStream(ctx context.Context, request *transp
 		return nil, err
 	}
 
+	if err := checkRestriction(o.Restriction, o.Namer, request.Meta.ToRequest()); err != nil {
+		return nil, err
+	}
+
 	return o.StreamOutbound.CallStream(ctx, request)
 }
 
@@ -103,3 +129,16 @@ func (o StreamValidatorOutbound) Introspect() introspection.OutboundStatus {
 	}
 	return introspection.OutboundStatusNotSupported
 }
+
+// checkRestriction verifies that the encoding of the request may be sent over
+// the transport of the outbound.
+func checkRestriction(r restriction.Checker, namer transport.Namer, req *transport.Request) error {
+	if r == nil || namer == nil {
+		return nil
+	}
+	if err := r.Check(req.Encoding, namer.TransportName()); err != nil {
+		return yarpcerrors.InvalidArgumentErrorf(
+			"cannot call procedure %q of service %q: %v", req.Procedure, req.Service, err)
+	}
+	return nil
+}
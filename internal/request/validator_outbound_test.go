@@ -31,6 +31,8 @@ import (
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/transport/transporttest"
 	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/api/x/restriction"
+	"go.uber.org/yarpc/yarpcerrors"
 )
 
 func TestCall(t *testing.T) {
@@ -180,3 +182,78 @@ func TestStreamValidateError(t *testing.T) {
 
 	assert.Error(t, gotErr)
 }
+
+type testNamer string
+
+func (n testNamer) TransportName() string { return string(n) }
+
+func TestCallRestriction(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	checker, err := restriction.NewChecker(restriction.Tuple{Transport: "allowed", Encoding: "encoding"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req := newValidTestRequest()
+	streamReq := &transport.StreamRequest{Meta: &transport.RequestMeta{
+		Service:   "service",
+		Procedure: "procedure",
+		Caller:    "caller",
+		Encoding:  "encoding",
+	}}
+
+	t.Run("allowed", func(t *testing.T) {
+		out := transporttest.NewMockUnaryOutbound(ctrl)
+		out.EXPECT().Call(ctx, req).Return(nil, nil)
+		validatorOut := UnaryValidatorOutbound{UnaryOutbound: out, Namer: testNamer("allowed"), Restriction: checker}
+
+		_, err := validatorOut.Call(ctx, req)
+		require.NoError(t, err)
+	})
+
+	t.Run("unary denied", func(t *testing.T) {
+		validatorOut := UnaryValidatorOutbound{
+			UnaryOutbound: transporttest.NewMockUnaryOutbound(ctrl),
+			Namer:         testNamer("denied"),
+			Restriction:   checker,
+		}
+
+		_, err := validatorOut.Call(ctx, req)
+		assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code())
+		assert.EqualError(t, err, `code:invalid-argument message:cannot call procedure "procedure" of service "service": `+
+			`"denied/encoding" is not a whitelisted combination, available: "allowed/encoding"`)
+	})
+
+	t.Run("oneway denied", func(t *testing.T) {
+		validatorOut := OnewayValidatorOutbound{
+			OnewayOutbound: transporttest.NewMockOnewayOutbound(ctrl),
+			Namer:          testNamer("denied"),
+			Restriction:    checker,
+		}
+
+		_, err := validatorOut.CallOneway(ctx, req)
+		assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("stream denied", func(t *testing.T) {
+		validatorOut := StreamValidatorOutbound{
+			StreamOutbound: transporttest.NewMockStreamOutbound(ctrl),
+			Namer:          testNamer("denied"),
+			Restriction:    checker,
+		}
+
+		_, err := validatorOut.CallStream(ctx, streamReq)
+		assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("unnamed outbound", func(t *testing.T) {
+		out := transporttest.NewMockUnaryOutbound(ctrl)
+		out.EXPECT().Call(ctx, req).Return(nil, nil)
+		validatorOut := UnaryValidatorOutbound{UnaryOutbound: out, Restriction: checker}
+
+		_, err := validatorOut.Call(ctx, req)
+		require.NoError(t, err)
+	})
+}
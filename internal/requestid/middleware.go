@@ -0,0 +1,155 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package requestid
+
+import (
+	"context"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/headerutil"
+	"go.uber.org/yarpc/internal/streamctx"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*Middleware)(nil)
+	_ middleware.UnaryOutbound  = (*Middleware)(nil)
+	_ middleware.OnewayInbound  = (*Middleware)(nil)
+	_ middleware.OnewayOutbound = (*Middleware)(nil)
+	_ middleware.StreamInbound  = (*Middleware)(nil)
+	_ middleware.StreamOutbound = (*Middleware)(nil)
+)
+
+// Config configures the request ID middleware.
+type Config struct {
+	// Header carrying request IDs. Defaults to DefaultHeader.
+	Header string
+
+	// Generate returns new request IDs. Defaults to Generate.
+	Generate func() string
+}
+
+// Middleware gives inbound requests a request ID and propagates it to
+// outbound requests.
+type Middleware struct {
+	header   string
+	generate func() string
+}
+
+// NewMiddleware builds a request ID middleware.
+func NewMiddleware(cfg Config) *Middleware {
+	m := &Middleware{
+		header:   cfg.Header,
+		generate: cfg.Generate,
+	}
+	if m.header == "" {
+		m.header = DefaultHeader
+	}
+	if m.generate == nil {
+		m.generate = Generate
+	}
+	return m
+}
+
+// Handle implements middleware.UnaryInbound.
+func (m *Middleware) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	return h.Handle(m.inboundContext(ctx, req.Headers), req, resw)
+}
+
+// Call implements middleware.UnaryOutbound.
+func (m *Middleware) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	if headers, ok := m.outboundHeaders(ctx, req.Headers); ok {
+		r := *req
+		r.Headers = headers
+		req = &r
+	}
+	return out.Call(ctx, req)
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (m *Middleware) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	return h.HandleOneway(m.inboundContext(ctx, req.Headers), req)
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (m *Middleware) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	if headers, ok := m.outboundHeaders(ctx, req.Headers); ok {
+		r := *req
+		r.Headers = headers
+		req = &r
+	}
+	return out.CallOneway(ctx, req)
+}
+
+// HandleStream implements middleware.StreamInbound.
+func (m *Middleware) HandleStream(s *transport.ServerStream, h transport.StreamHandler) error {
+	ctx := m.inboundContext(s.Context(), s.Request().Meta.Headers)
+	return h.HandleStream(streamctx.WithContext(s, ctx))
+}
+
+// CallStream implements middleware.StreamOutbound.
+func (m *Middleware) CallStream(ctx context.Context, req *transport.StreamRequest, out transport.StreamOutbound) (*transport.ClientStream, error) {
+	if headers, ok := m.outboundHeaders(ctx, req.Meta.Headers); ok {
+		meta := *req.Meta
+		meta.Headers = headers
+		req = &transport.StreamRequest{Meta: &meta}
+	}
+	return out.CallStream(ctx, req)
+}
+
+// inboundContext returns a copy of the context carrying the request ID from
+// the headers or, if it is missing or invalid, a new one.
+func (m *Middleware) inboundContext(ctx context.Context, headers transport.Headers) context.Context {
+	id, ok := headers.Get(m.header)
+	if !ok || !valid(id) {
+		id = m.generate()
+	}
+	return WithRequestID(ctx, id)
+}
+
+// valid reports whether a request ID from a caller may be used. The ID is
+// added to every log entry of the request and sent to every service it
+// calls, so it must be short and printable.
+func valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// outboundHeaders returns a copy of the headers carrying the request ID of
+// the context, if it has one and the headers do not already.
+func (m *Middleware) outboundHeaders(ctx context.Context, headers transport.Headers) (transport.Headers, bool) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return headers, false
+	}
+	if _, ok := headers.Get(m.header); ok {
+		return headers, false
+	}
+
+	return headerutil.Copy(headers, 1).With(m.header, id), true
+}
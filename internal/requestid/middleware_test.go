@@ -0,0 +1,228 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package requestid
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+)
+
+func fixedID() string { return "generated" }
+
+func newRequest(headers transport.Headers) *transport.Request {
+	return &transport.Request{
+		Caller:    "caller",
+		Service:   "service",
+		Procedure: "procedure",
+		Encoding:  "raw",
+		Headers:   headers,
+	}
+}
+
+func TestInbound(t *testing.T) {
+	tests := []struct {
+		desc    string
+		cfg     Config
+		headers transport.Headers
+		want    string
+	}{
+		{
+			desc: "generated",
+			cfg:  Config{Generate: fixedID},
+			want: "generated",
+		},
+		{
+			desc:    "from header",
+			cfg:     Config{Generate: fixedID},
+			headers: transport.NewHeaders().With("X-Request-Id", "abc"),
+			want:    "abc",
+		},
+		{
+			desc:    "empty header",
+			cfg:     Config{Generate: fixedID},
+			headers: transport.NewHeaders().With("x-request-id", ""),
+			want:    "generated",
+		},
+		{
+			desc:    "longest header",
+			cfg:     Config{Generate: fixedID},
+			headers: transport.NewHeaders().With("x-request-id", strings.Repeat("a", 128)),
+			want:    strings.Repeat("a", 128),
+		},
+		{
+			desc:    "header too long",
+			cfg:     Config{Generate: fixedID},
+			headers: transport.NewHeaders().With("x-request-id", strings.Repeat("a", 129)),
+			want:    "generated",
+		},
+		{
+			desc:    "non-printable header",
+			cfg:     Config{Generate: fixedID},
+			headers: transport.NewHeaders().With("x-request-id", "abc\ndef"),
+			want:    "generated",
+		},
+		{
+			desc:    "non-ASCII header",
+			cfg:     Config{Generate: fixedID},
+			headers: transport.NewHeaders().With("x-request-id", "abç"),
+			want:    "generated",
+		},
+		{
+			desc:    "custom header",
+			cfg:     Config{Header: "x-correlation-id", Generate: fixedID},
+			headers: transport.NewHeaders().With("x-correlation-id", "abc"),
+			want:    "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			m := NewMiddleware(tt.cfg)
+			req := newRequest(tt.headers)
+			assertID := func(ctx context.Context) {
+				id, ok := FromContext(ctx)
+				assert.True(t, ok, "expected a request ID")
+				assert.Equal(t, tt.want, id)
+			}
+
+			unary := transporttest.NewMockUnaryHandler(mockCtrl)
+			unary.EXPECT().Handle(gomock.Any(), req, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request, _ transport.ResponseWriter) error {
+					assertID(ctx)
+					return nil
+				})
+			require.NoError(t, m.Handle(context.Background(), req, &transporttest.FakeResponseWriter{}, unary))
+
+			oneway := transporttest.NewMockOnewayHandler(mockCtrl)
+			oneway.EXPECT().HandleOneway(gomock.Any(), req).DoAndReturn(
+				func(ctx context.Context, _ *transport.Request) error {
+					assertID(ctx)
+					return nil
+				})
+			require.NoError(t, m.HandleOneway(context.Background(), req, oneway))
+
+			streamReq := &transport.StreamRequest{Meta: req.ToRequestMeta()}
+			serverStream, err := transport.NewServerStream(&fakeStream{ctx: context.Background(), req: streamReq})
+			require.NoError(t, err)
+			stream := transporttest.NewMockStreamHandler(mockCtrl)
+			stream.EXPECT().HandleStream(gomock.Any()).DoAndReturn(
+				func(s *transport.ServerStream) error {
+					assertID(s.Context())
+					assert.Equal(t, streamReq, s.Request(), "request must be preserved")
+					return nil
+				})
+			require.NoError(t, m.HandleStream(serverStream, stream))
+		})
+	}
+}
+
+func TestOutbound(t *testing.T) {
+	tests := []struct {
+		desc        string
+		ctx         context.Context
+		headers     transport.Headers
+		wantHeaders transport.Headers
+	}{
+		{
+			desc:        "no request ID",
+			ctx:         context.Background(),
+			headers:     transport.NewHeaders().With("foo", "bar"),
+			wantHeaders: transport.NewHeaders().With("foo", "bar"),
+		},
+		{
+			desc:        "propagated",
+			ctx:         WithRequestID(context.Background(), "abc"),
+			headers:     transport.NewHeaders().With("foo", "bar"),
+			wantHeaders: transport.NewHeaders().With("foo", "bar").With("x-request-id", "abc"),
+		},
+		{
+			desc:        "explicit header",
+			ctx:         WithRequestID(context.Background(), "abc"),
+			headers:     transport.NewHeaders().With("x-request-id", "def"),
+			wantHeaders: transport.NewHeaders().With("x-request-id", "def"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			m := NewMiddleware(Config{})
+			req := newRequest(tt.headers)
+			original := req.Headers.Items()
+
+			unary := transporttest.NewMockUnaryOutbound(mockCtrl)
+			unary.EXPECT().Call(tt.ctx, gomock.Any()).DoAndReturn(
+				func(_ context.Context, r *transport.Request) (*transport.Response, error) {
+					assert.Equal(t, tt.wantHeaders.Items(), r.Headers.Items())
+					return &transport.Response{}, nil
+				})
+			_, err := m.Call(tt.ctx, req, unary)
+			require.NoError(t, err)
+
+			oneway := transporttest.NewMockOnewayOutbound(mockCtrl)
+			oneway.EXPECT().CallOneway(tt.ctx, gomock.Any()).DoAndReturn(
+				func(_ context.Context, r *transport.Request) (transport.Ack, error) {
+					assert.Equal(t, tt.wantHeaders.Items(), r.Headers.Items())
+					return nil, nil
+				})
+			_, err = m.CallOneway(tt.ctx, req, oneway)
+			require.NoError(t, err)
+
+			stream := transporttest.NewMockStreamOutbound(mockCtrl)
+			stream.EXPECT().CallStream(tt.ctx, gomock.Any()).DoAndReturn(
+				func(ctx context.Context, r *transport.StreamRequest) (*transport.ClientStream, error) {
+					assert.Equal(t, tt.wantHeaders.Items(), r.Meta.Headers.Items())
+					return transport.NewClientStream(&fakeStream{ctx: ctx, req: r})
+				})
+			_, err = m.CallStream(tt.ctx, &transport.StreamRequest{Meta: req.ToRequestMeta()}, stream)
+			require.NoError(t, err)
+
+			assert.Equal(t, original, req.Headers.Items(), "request headers must not be modified")
+		})
+	}
+}
+
+type fakeStream struct {
+	ctx context.Context
+	req *transport.StreamRequest
+}
+
+func (s *fakeStream) Context() context.Context                                    { return s.ctx }
+func (s *fakeStream) Request() *transport.StreamRequest                           { return s.req }
+func (s *fakeStream) Close(context.Context) error                                 { return nil }
+func (s *fakeStream) SendMessage(context.Context, *transport.StreamMessage) error { return nil }
+
+func (s *fakeStream) ReceiveMessage(context.Context) (*transport.StreamMessage, error) {
+	return nil, io.EOF
+}
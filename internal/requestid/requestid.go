@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package requestid provides middleware which gives every inbound request a
+// request ID, and propagates it to outbound requests.
+//
+// Inbound requests take their ID from a request header or, without it, get a
+// new one. IDs longer than MaxLength bytes or with characters other than
+// printable ASCII are replaced with new ones. The ID is carried by the context of the request, and sent in the
+// same header by outbound requests made with that context, so that the logs
+// of a request may be correlated across services.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// DefaultHeader is the default header carrying request IDs.
+	DefaultHeader = "x-request-id"
+
+	// MaxLength is the maximum length in bytes of request IDs accepted from
+	// callers.
+	MaxLength = 128
+)
+
+type contextKey struct{}
+
+// WithRequestID returns a copy of the context carrying the given request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by the context, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// ContextExtractor adds the request ID carried by the context to log entries
+// under "requestID".
+func ContextExtractor(ctx context.Context) zapcore.Field {
+	if id, ok := FromContext(ctx); ok {
+		return zap.String("requestID", id)
+	}
+	return zap.Skip()
+}
+
+// Generate returns a new random request ID of 32 hexadecimal digits.
+func Generate() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand only fails if the system's source of randomness does.
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
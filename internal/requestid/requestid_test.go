@@ -0,0 +1,54 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package requestid
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok, "expected no request ID")
+
+	_, ok = FromContext(WithRequestID(context.Background(), ""))
+	assert.False(t, ok, "expected empty request IDs to be ignored")
+
+	id, ok := FromContext(WithRequestID(context.Background(), "abc"))
+	assert.True(t, ok, "expected a request ID")
+	assert.Equal(t, "abc", id)
+}
+
+func TestContextExtractor(t *testing.T) {
+	assert.Equal(t, zapcore.SkipType, ContextExtractor(context.Background()).Type)
+	assert.Equal(t, zap.String("requestID", "abc"),
+		ContextExtractor(WithRequestID(context.Background(), "abc")))
+}
+
+func TestGenerate(t *testing.T) {
+	a, b := Generate(), Generate()
+	assert.Len(t, a, 32)
+	assert.NotEqual(t, a, b, "expected unique request IDs")
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+
+// Package streamctx replaces the context of server streams, for inbound
+// middleware that derives a new context for the stream handler.
+package streamctx
+
+import (
+	"context"
+
+	"go.uber.org/yarpc/api/transport"
+)
+
+var _ transport.StreamHeadersSender = (*serverStream)(nil)
+
+// WithContext returns a copy of the stream whose Context is the given
+// context.
+func WithContext(s *transport.ServerStream, ctx context.Context) *transport.ServerStream {
+	wrapped, err := transport.NewServerStream(&serverStream{ServerStream: s, ctx: ctx})
+	if err != nil {
+		// transport.NewServerStream only fails for nil streams.
+		return s
+	}
+	return wrapped
+}
+
+type serverStream struct {
+	*transport.ServerStream
+
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
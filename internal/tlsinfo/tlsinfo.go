@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package tlsinfo carries the TLS state of the connection an inbound request
+// was received on.
+package tlsinfo
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+type connectionStateKey struct{} // context key for the tls.ConnectionState
+
+// WithConnectionState returns a copy of the context that carries the state of
+// the TLS connection the request was received on.
+func WithConnectionState(ctx context.Context, state tls.ConnectionState) context.Context {
+	return context.WithValue(ctx, connectionStateKey{}, state)
+}
+
+// ConnectionState returns the state of the TLS connection the request was
+// received on. Returns false if the request was not received over TLS.
+func ConnectionState(ctx context.Context) (tls.ConnectionState, bool) {
+	state, ok := ctx.Value(connectionStateKey{}).(tls.ConnectionState)
+	return state, ok
+}
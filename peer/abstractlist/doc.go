@@ -48,4 +48,9 @@
 // transport (which sees it as a bank of peer.Subscriber).
 // By taking care of concurrency, the abstract peer list frees the
 // Implementation from the concern of thread safety.
+//
+// The abstract peer list also records metrics about choosing peers and the
+// peers of the list, in a scope given with the Meter option or SetMeter.
+// Dispatchers set the scope of the peer lists of their outbounds, so wrappers
+// like the example should expose SetMeter, as embedding does.
 package abstractlist
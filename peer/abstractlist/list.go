@@ -31,6 +31,7 @@ import (
 
 	"go.uber.org/atomic"
 	"go.uber.org/multierr"
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -80,6 +81,8 @@ type options struct {
 	failFast             bool
 	seed                 int64
 	logger               *zap.Logger
+	meter                *metrics.Scope
+	peerMetrics          bool
 }
 
 var defaultOptions = options{
@@ -114,6 +117,30 @@ func Logger(logger *zap.Logger) Option {
 	})
 }
 
+// Meter specifies a scope in which the list records metrics: the latency of
+// choosing peers, choose timeouts by reason, the number of available and
+// unavailable peers and peer churn. Metrics are tagged with the name of the
+// list under "peerlist".
+//
+// Dispatchers replace this scope with their own through SetMeter.
+func Meter(meter *metrics.Scope) Option {
+	return optionFunc(func(options *options) {
+		options.meter = meter
+	})
+}
+
+// PeerMetrics additionally records the pending requests of each peer, tagged
+// with its identifier under "peer". The gauge of a peer drops to zero once
+// it is removed from the list.
+//
+// Each peer adds a series that outlives it, so this is disabled by default.
+// Only enable it for lists with few, long-lived peers.
+func PeerMetrics() Option {
+	return optionFunc(func(options *options) {
+		options.peerMetrics = true
+	})
+}
+
 // NoShuffle disables the default behavior of shuffling peer list order.
 func NoShuffle() Option {
 	return optionFunc(func(options *options) {
@@ -163,10 +190,16 @@ func New(name string, transport peer.Transport, implementation Implementation, o
 		logger = zap.NewNop()
 	}
 
-	return &List{
+	m := &listMetrics{}
+	if options.meter != nil {
+		m = newListMetrics(options.meter, name, logger, options.peerMetrics)
+	}
+
+	pl := &List{
 		once:               lifecycle.NewOnce(),
 		name:               name,
 		logger:             logger,
+		peerMetrics:        options.peerMetrics,
 		peers:              make(map[string]*peerFacade, options.capacity),
 		offlinePeers:       make(map[string]peer.Identifier, options.capacity),
 		implementation:     implementation,
@@ -176,6 +209,8 @@ func New(name string, transport peer.Transport, implementation Implementation, o
 		randSrc:            rand.NewSource(options.seed),
 		peerAvailableEvent: make(chan struct{}, 1),
 	}
+	pl.metrics.Store(m)
+	return pl
 }
 
 // List is an abstract peer list, backed by an Implementation to
@@ -198,8 +233,10 @@ type List struct {
 	lock sync.RWMutex
 	once *lifecycle.Once
 
-	name   string
-	logger *zap.Logger
+	name        string
+	logger      *zap.Logger
+	metrics     atomic.Value // *listMetrics
+	peerMetrics bool
 
 	peers              map[string]*peerFacade
 	offlinePeers       map[string]peer.Identifier
@@ -221,6 +258,36 @@ func (pl *List) Name() string { return pl.name }
 // Transport returns the underlying transport for retaining and releasing peers.
 func (pl *List) Transport() peer.Transport { return pl.transport }
 
+// SetMeter replaces the scope in which the list records metrics, as with the
+// Meter option.
+//
+// Dispatchers call SetMeter on the peer lists of their outbounds with their
+// metrics scope, tagged with the name of the outbound under "outbound".
+func (pl *List) SetMeter(meter *metrics.Scope) {
+	m := newListMetrics(meter, pl.name, pl.logger, pl.peerMetrics)
+
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	pl.metrics.Store(m)
+	pl.updatePeerGauges()
+	for addr, pf := range pl.peers {
+		m.setPendingRequests(addr, pf.status.PendingRequestCount)
+	}
+}
+
+func (pl *List) meters() *listMetrics {
+	return pl.metrics.Load().(*listMetrics)
+}
+
+// updatePeerGauges must be run under a list lock.
+func (pl *List) updatePeerGauges() {
+	available := pl.numAvailable.Load()
+	m := pl.meters()
+	m.available.Store(int64(available))
+	m.unavailable.Store(int64(pl.numPeers.Load() - available))
+}
+
 // Update applies the additions and removals of peer Identifiers to the list
 // it returns a multi-error result of every failure that happened without
 // circuit breaking due to failures.
@@ -247,6 +314,10 @@ func (pl *List) Update(updates peer.ListUpdates) error {
 	pl.lock.Lock()
 	defer pl.lock.Unlock()
 
+	m := pl.meters()
+	m.peersAdded.Add(int64(len(updates.Additions)))
+	m.peersRemoved.Add(int64(len(updates.Removals)))
+
 	if !pl.once.IsRunning() {
 		return pl.updateOffline(updates)
 	}
@@ -360,6 +431,7 @@ func (pl *List) add(id peer.Identifier) error {
 	pl.peers[addr] = pf
 	pl.numPeers.Inc()
 	pl.notifyStatusChanged(pf)
+	pl.updatePeerGauges()
 
 	return nil
 }
@@ -396,6 +468,11 @@ func (pl *List) remove(id peer.Identifier) error {
 
 	pl.numPeers.Dec()
 	delete(pl.peers, addr)
+	pl.updatePeerGauges()
+	if pf.status.PendingRequestCount != 0 {
+		// The gauge is otherwise already zero, if recorded at all.
+		pl.meters().setPendingRequests(addr, 0)
+	}
 
 	// The transport must not call back before returning.
 	return pl.transport.ReleasePeer(id, pf)
@@ -416,6 +493,10 @@ func (pl *List) removeOffline(id peer.Identifier) error {
 
 // Choose selects the next available peer in the peer list.
 func (pl *List) Choose(ctx context.Context, req *transport.Request) (peer.Peer, func(error), error) {
+	start := time.Now()
+	m := pl.meters()
+	defer func() { m.chooseLatency.Observe(time.Since(start)) }()
+
 	if _, ok := ctx.Deadline(); !ok {
 		// set the default timeout on the chooser so that we do not wait
 		// indefinitely for a peer to become available
@@ -428,6 +509,9 @@ func (pl *List) Choose(ctx context.Context, req *transport.Request) (peer.Peer,
 	// This ensures that the developer sees a meaningful error if they forget
 	// to run the lifecycle methods.
 	if err := pl.once.WaitUntilRunning(ctx); err != nil {
+		if ctx.Err() != nil {
+			m.chooseTimeout(_reasonNotRunning)
+		}
 		return nil, nil, intyarpcerrors.AnnotateWithInfo(yarpcerrors.FromError(err), "%q peer list is not running", pl.name)
 	}
 
@@ -456,6 +540,11 @@ func (pl *List) Choose(ctx context.Context, req *transport.Request) (peer.Peer,
 			return nil, nil, pl.newUnavailableError(nil)
 		}
 		if err := pl.waitForPeerAddedEvent(ctx); err != nil {
+			if pl.numPeers.Load() == 0 {
+				m.chooseTimeout(_reasonNoPeers)
+			} else {
+				m.chooseTimeout(_reasonNoAvailablePeers)
+			}
 			return nil, nil, err
 		}
 	}
@@ -478,6 +567,7 @@ func (pl *List) onStart(pf *peerFacade) {
 	if pf.subscriber != nil {
 		pf.subscriber.UpdatePendingRequestCount(pf.status.PendingRequestCount)
 	}
+	pl.recordPendingRequests(pf)
 }
 
 func (pl *List) onFinish(pf *peerFacade, err error) {
@@ -488,6 +578,19 @@ func (pl *List) onFinish(pf *peerFacade, err error) {
 	if pf.subscriber != nil {
 		pf.subscriber.UpdatePendingRequestCount(pf.status.PendingRequestCount)
 	}
+	pl.recordPendingRequests(pf)
+}
+
+// recordPendingRequests records the pending requests of a peer, unless it
+// was removed from the list while requests were pending.
+//
+// recordPendingRequests must be run under a list lock.
+func (pl *List) recordPendingRequests(pf *peerFacade) {
+	addr := pf.id.Identifier()
+	if pl.peers[addr] != pf {
+		return
+	}
+	pl.meters().setPendingRequests(addr, pf.status.PendingRequestCount)
 }
 
 func (pl *List) onFinishFunc(pf *peerFacade) func(error) {
@@ -531,6 +634,7 @@ func (pl *List) notifyStatusChanged(pf *peerFacade) {
 
 	status := pf.peer.Status().ConnectionStatus
 	if pf.status.ConnectionStatus != status {
+		prev := pf.status.ConnectionStatus
 		pf.status.ConnectionStatus = status
 		switch status {
 		case peer.Available:
@@ -542,7 +646,11 @@ func (pl *List) notifyStatusChanged(pf *peerFacade) {
 			pl.numAvailable.Dec()
 			pf.list.implementation.Remove(pf, pf.id, pf.subscriber)
 			pf.subscriber = nil
+			if prev == peer.Available {
+				pl.meters().peersUnavailable.Inc()
+			}
 		}
+		pl.updatePeerGauges()
 	}
 }
 
@@ -714,6 +822,8 @@ func (pl *List) Introspect() introspection.ChooserStatus {
 			State: fmt.Sprintf("%s, %d pending request(s)",
 				ps.ConnectionStatus.String(),
 				ps.PendingRequestCount),
+			ConnectionStatus: ps.ConnectionStatus.String(),
+			PendingRequests:  ps.PendingRequestCount,
 		}
 	}
 
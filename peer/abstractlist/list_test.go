@@ -28,6 +28,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -251,6 +252,158 @@ func TestPeerList(t *testing.T) {
 	}))
 }
 
+// metricValues returns the values of the gauges and counters of a snapshot,
+// keyed by name and, if present, peer and reason tags. Tag values are
+// scrubbed by net/metrics, so peer addresses use "_" instead of ":".
+func metricValues(snap *metrics.RootSnapshot) map[string]int64 {
+	values := make(map[string]int64)
+	add := func(s metrics.Snapshot) {
+		key := s.Name
+		if p, ok := s.Tags["peer"]; ok {
+			key += "/" + p
+		}
+		if r, ok := s.Tags["reason"]; ok {
+			key += "/" + r
+		}
+		values[key] = s.Value
+	}
+	for _, s := range snap.Gauges {
+		add(s)
+	}
+	for _, s := range snap.Counters {
+		add(s)
+	}
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	fake := yarpctest.NewFakeTransport(yarpctest.InitialConnectionStatus(peer.Unavailable))
+	root := metrics.New()
+	list := New("mra", fake, &mraList{}, Meter(root.Scope()), PeerMetrics())
+
+	id1 := abstractpeer.Identify("1.1.1.1:4040")
+	id2 := abstractpeer.Identify("2.2.2.2:4040")
+	require.NoError(t, list.Update(peer.ListUpdates{
+		Additions: []peer.Identifier{id1, id2},
+	}))
+	require.NoError(t, list.Start())
+	fake.SimulateConnect(id1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testtime.Second)
+	defer cancel()
+	_, onFinish, err := list.Choose(ctx, &transport.Request{})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int64{
+		"peer_list_available_peers":               1,
+		"peer_list_unavailable_peers":             1,
+		"peer_list_pending_requests/1.1.1.1_4040": 1,
+		"peer_list_peers_added":                   2,
+		"peer_list_peers_removed":                 0,
+		"peer_list_peers_unavailable":             0,
+	}, metricValues(root.Snapshot()))
+
+	onFinish(nil)
+	fake.SimulateDisconnect(id1)
+	require.NoError(t, list.Update(peer.ListUpdates{
+		Removals: []peer.Identifier{id2},
+	}))
+
+	// Choose times out with no available peers.
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), testtime.Millisecond)
+	defer shortCancel()
+	_, _, err = list.Choose(shortCtx, &transport.Request{})
+	require.Error(t, err)
+
+	snap := root.Snapshot()
+	assert.Equal(t, map[string]int64{
+		"peer_list_available_peers":                    0,
+		"peer_list_unavailable_peers":                  1,
+		"peer_list_pending_requests/1.1.1.1_4040":      0,
+		"peer_list_peers_added":                        2,
+		"peer_list_peers_removed":                      1,
+		"peer_list_peers_unavailable":                  1,
+		"peer_list_choose_timeouts/no_available_peers": 1,
+	}, metricValues(snap))
+
+	require.Len(t, snap.Histograms, 1)
+	assert.Equal(t, "peer_list_choose_latency_ms", snap.Histograms[0].Name)
+	assert.Len(t, snap.Histograms[0].Values, 2)
+	assert.Equal(t, "mra", snap.Histograms[0].Tags["peerlist"])
+}
+
+func TestPeerMetricsClearedOnRemoval(t *testing.T) {
+	fake := yarpctest.NewFakeTransport(yarpctest.InitialConnectionStatus(peer.Available))
+	root := metrics.New()
+	list := New("mra", fake, &mraList{}, Meter(root.Scope()), PeerMetrics())
+
+	id := abstractpeer.Identify("1.1.1.1:4040")
+	require.NoError(t, list.Update(peer.ListUpdates{Additions: []peer.Identifier{id}}))
+	require.NoError(t, list.Start())
+
+	ctx, cancel := context.WithTimeout(context.Background(), testtime.Second)
+	defer cancel()
+	var finishes []func(error)
+	for i := 0; i < 2; i++ {
+		_, onFinish, err := list.Choose(ctx, &transport.Request{})
+		require.NoError(t, err)
+		finishes = append(finishes, onFinish)
+	}
+	assert.Equal(t, int64(2), metricValues(root.Snapshot())["peer_list_pending_requests/1.1.1.1_4040"])
+
+	require.NoError(t, list.Update(peer.ListUpdates{Removals: []peer.Identifier{id}}))
+	assert.Equal(t, int64(0), metricValues(root.Snapshot())["peer_list_pending_requests/1.1.1.1_4040"])
+
+	// Requests finishing after the peer is removed do not record it again.
+	finishes[0](nil)
+	assert.Equal(t, int64(0), metricValues(root.Snapshot())["peer_list_pending_requests/1.1.1.1_4040"])
+	finishes[1](nil)
+}
+
+func TestSetMeter(t *testing.T) {
+	fake := yarpctest.NewFakeTransport(yarpctest.InitialConnectionStatus(peer.Available))
+	list := New("mra", fake, &mraList{})
+	require.NoError(t, list.Update(peer.ListUpdates{
+		Additions: []peer.Identifier{abstractpeer.Identify("1.1.1.1:4040")},
+	}))
+	require.NoError(t, list.Start())
+
+	// Metrics reflect the state of the list as soon as the meter is set.
+	root := metrics.New()
+	list.SetMeter(root.Scope().Tagged(metrics.Tags{"outbound": "foo"}))
+	snap := root.Snapshot()
+	// Pending requests are not recorded by peer by default.
+	assert.Equal(t, map[string]int64{
+		"peer_list_available_peers":   1,
+		"peer_list_unavailable_peers": 0,
+		"peer_list_peers_added":       0,
+		"peer_list_peers_removed":     0,
+		"peer_list_peers_unavailable": 0,
+	}, metricValues(snap))
+	for _, g := range snap.Gauges {
+		assert.Equal(t, "foo", g.Tags["outbound"])
+		assert.Equal(t, "mra", g.Tags["peerlist"])
+	}
+
+	// Choose times out before the list starts.
+	notStarted := New("mra", fake, &mraList{})
+	notStarted.SetMeter(root.Scope().Tagged(metrics.Tags{"outbound": "bar"}))
+	ctx, cancel := context.WithTimeout(context.Background(), testtime.Millisecond)
+	defer cancel()
+	_, _, err := notStarted.Choose(ctx, &transport.Request{})
+	require.Error(t, err)
+	for _, c := range root.Snapshot().Counters {
+		if c.Name == "peer_list_choose_timeouts" {
+			assert.Equal(t, metrics.Tags{
+				"outbound": "bar",
+				"peerlist": "mra",
+				"reason":   "not_running",
+			}, c.Tags)
+			assert.Equal(t, int64(1), c.Value)
+		}
+	}
+}
+
 func TestFailWait(t *testing.T) {
 	fake := yarpctest.NewFakeTransport(yarpctest.InitialConnectionStatus(peer.Available))
 	impl := &mraList{}
@@ -336,8 +489,10 @@ func TestIntrospect(t *testing.T) {
 		State: "Running (0/1 available)",
 		Peers: []introspection.PeerStatus{
 			{
-				Identifier: "0",
-				State:      "Unavailable, 0 pending request(s)",
+				Identifier:       "0",
+				State:            "Unavailable, 0 pending request(s)",
+				ConnectionStatus: "Unavailable",
+				PendingRequests:  0,
 			},
 		},
 	}, list.Introspect())
@@ -349,8 +504,10 @@ func TestIntrospect(t *testing.T) {
 		State: "Running (1/1 available)",
 		Peers: []introspection.PeerStatus{
 			{
-				Identifier: "0",
-				State:      "Available, 0 pending request(s)",
+				Identifier:       "0",
+				State:            "Available, 0 pending request(s)",
+				ConnectionStatus: "Available",
+				PendingRequests:  0,
 			},
 		},
 	}, list.Introspect())
@@ -367,8 +524,10 @@ func TestIntrospect(t *testing.T) {
 		State: "Running (1/1 available)",
 		Peers: []introspection.PeerStatus{
 			{
-				Identifier: "0",
-				State:      "Available, 1 pending request(s)",
+				Identifier:       "0",
+				State:            "Available, 1 pending request(s)",
+				ConnectionStatus: "Available",
+				PendingRequests:  1,
 			},
 		},
 	}, list.Introspect())
@@ -0,0 +1,126 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package abstractlist
+
+import (
+	"time"
+
+	"go.uber.org/net/metrics"
+	"go.uber.org/net/metrics/bucket"
+	"go.uber.org/zap"
+)
+
+// Reasons for which Choose calls time out, recorded as the "reason" tag of
+// the peer_list_choose_timeouts counter.
+const (
+	_reasonNotRunning       = "not_running"
+	_reasonNoPeers          = "no_peers"
+	_reasonNoAvailablePeers = "no_available_peers"
+)
+
+// listMetrics holds the metrics of a peer list.
+//
+// Metrics which fail to be created, or are disabled, are left nil, which
+// makes them no-ops.
+type listMetrics struct {
+	chooseLatency    *metrics.Histogram
+	chooseTimeouts   *metrics.CounterVector
+	available        *metrics.Gauge
+	unavailable      *metrics.Gauge
+	pendingRequests  *metrics.GaugeVector
+	peersAdded       *metrics.Counter
+	peersRemoved     *metrics.Counter
+	peersUnavailable *metrics.Counter
+}
+
+func newListMetrics(meter *metrics.Scope, name string, logger *zap.Logger, peerMetrics bool) *listMetrics {
+	meter = meter.Tagged(metrics.Tags{"peerlist": name})
+	m := &listMetrics{}
+	var err error
+
+	if m.chooseLatency, err = meter.Histogram(metrics.HistogramSpec{
+		Spec: metrics.Spec{
+			Name: "peer_list_choose_latency_ms",
+			Help: "Latency distribution of choosing peers.",
+		},
+		Unit:    time.Millisecond,
+		Buckets: bucket.NewRPCLatency(),
+	}); err != nil {
+		logger.Error("Failed to create choose latency distribution.", zap.Error(err))
+	}
+	if m.chooseTimeouts, err = meter.CounterVector(metrics.Spec{
+		Name:    "peer_list_choose_timeouts",
+		Help:    "Number of Choose calls which timed out, by reason.",
+		VarTags: []string{"reason"},
+	}); err != nil {
+		logger.Error("Failed to create choose timeouts counter.", zap.Error(err))
+	}
+	if m.available, err = meter.Gauge(metrics.Spec{
+		Name: "peer_list_available_peers",
+		Help: "Number of peers available for requests.",
+	}); err != nil {
+		logger.Error("Failed to create available peers gauge.", zap.Error(err))
+	}
+	if m.unavailable, err = meter.Gauge(metrics.Spec{
+		Name: "peer_list_unavailable_peers",
+		Help: "Number of retained peers unavailable for requests.",
+	}); err != nil {
+		logger.Error("Failed to create unavailable peers gauge.", zap.Error(err))
+	}
+	if peerMetrics {
+		if m.pendingRequests, err = meter.GaugeVector(metrics.Spec{
+			Name:    "peer_list_pending_requests",
+			Help:    "Number of pending requests, by peer.",
+			VarTags: []string{"peer"},
+		}); err != nil {
+			logger.Error("Failed to create pending requests gauge.", zap.Error(err))
+		}
+	}
+	if m.peersAdded, err = meter.Counter(metrics.Spec{
+		Name: "peer_list_peers_added",
+		Help: "Number of peers added to the list.",
+	}); err != nil {
+		logger.Error("Failed to create peers added counter.", zap.Error(err))
+	}
+	if m.peersRemoved, err = meter.Counter(metrics.Spec{
+		Name: "peer_list_peers_removed",
+		Help: "Number of peers removed from the list.",
+	}); err != nil {
+		logger.Error("Failed to create peers removed counter.", zap.Error(err))
+	}
+	if m.peersUnavailable, err = meter.Counter(metrics.Spec{
+		Name: "peer_list_peers_unavailable",
+		Help: "Number of times an available peer became unavailable.",
+	}); err != nil {
+		logger.Error("Failed to create peers unavailable counter.", zap.Error(err))
+	}
+	return m
+}
+
+func (m *listMetrics) chooseTimeout(reason string) {
+	c, _ := m.chooseTimeouts.Get("reason", reason)
+	c.Inc()
+}
+
+func (m *listMetrics) setPendingRequests(peer string, count int) {
+	g, _ := m.pendingRequests.Get("peer", peer)
+	g.Store(int64(count))
+}
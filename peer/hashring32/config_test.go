@@ -21,14 +21,21 @@
 package hashring32
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/internal/whitespace"
 	"go.uber.org/yarpc/peer/hostport"
+	"go.uber.org/yarpc/transport/http"
 	"go.uber.org/yarpc/yarpcconfig"
 	"go.uber.org/yarpc/yarpctest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestPendingHeapConfig(t *testing.T) {
@@ -66,3 +73,25 @@ func TestOffsetGeneratorValueConfig(t *testing.T) {
 	assert.NoError(t, err, "must construct a peer list")
 	pl.Update(peer.ListUpdates{Additions: []peer.Identifier{hostport.PeerIdentifier("127.0.0.1:8080")}})
 }
+
+func TestSpecSharedMeter(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	root := metrics.New()
+
+	cfg := yarpcconfig.New()
+	require.NoError(t, cfg.RegisterTransport(http.TransportSpec()))
+	require.NoError(t, cfg.RegisterPeerList(Spec(zap.New(core), root.Scope())))
+	_, err := cfg.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+		outbounds:
+			bar:
+				http:
+					url: http://bar/yarpc
+					hashring32: {peers: [127.0.0.1:8080]}
+			baz:
+				http:
+					url: http://baz/yarpc
+					hashring32: {peers: [127.0.0.1:8081]}
+	`)))
+	require.NoError(t, err)
+	assert.Empty(t, logs.AllUntimed(), "lists of different outbounds must not share metrics")
+}
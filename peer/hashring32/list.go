@@ -26,6 +26,7 @@ import (
 	"context"
 	"time"
 
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -42,6 +43,8 @@ type options struct {
 	peerRingOptions         []hashring32.Option
 	defaultChooseTimeout    *time.Duration
 	logger                  *zap.Logger
+	meter                   *metrics.Scope
+	peerMetrics             bool
 }
 
 // Option customizes the behavior of hashring32 peer list.
@@ -154,6 +157,23 @@ func (o loggerOption) apply(opts *options) {
 	opts.logger = o.logger
 }
 
+// Meter specifies a scope in which the list records metrics about choosing
+// peers and the peers of the list.
+func Meter(meter *metrics.Scope) Option {
+	return optionFunc(func(options *options) {
+		options.meter = meter
+	})
+}
+
+// PeerMetrics records the pending requests of each peer alongside the other
+// metrics of the list. Each peer adds a series, so this is disabled by
+// default.
+func PeerMetrics() Option {
+	return optionFunc(func(options *options) {
+		options.peerMetrics = true
+	})
+}
+
 // NumReplicas allos client to specify the number of replicas to use for each peer.
 //
 // More replicas produces a more even distribution of entities and slower
@@ -237,6 +257,13 @@ func New(transport peer.Transport, hashFunc hashring32.HashFunc32, opts ...Optio
 		plOpts = append(plOpts, abstractlist.DefaultChooseTimeout(*options.defaultChooseTimeout))
 	}
 
+	if options.meter != nil {
+		plOpts = append(plOpts, abstractlist.Meter(options.meter))
+	}
+	if options.peerMetrics {
+		plOpts = append(plOpts, abstractlist.PeerMetrics())
+	}
+
 	return &List{
 		list: abstractlist.New("hashring32", transport, ring, plOpts...),
 	}
@@ -316,3 +343,16 @@ func (l *List) Introspect() introspection.ChooserStatus {
 func (l *List) Peers() []peer.StatusPeer {
 	return l.list.Peers()
 }
+
+// NumAvailable returns how many peers are available.
+func (l *List) NumAvailable() int {
+	return l.list.NumAvailable()
+}
+
+// SetMeter replaces the scope in which the list records metrics.
+//
+// Dispatchers call SetMeter on the peer lists of their outbounds with their
+// metrics scope.
+func (l *List) SetMeter(meter *metrics.Scope) {
+	l.list.SetMeter(meter)
+}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/peer/hashring32/internal/farmhashring"
@@ -229,3 +230,28 @@ func TestAddRemoveAndChooseWithOffsetGeneratorValue(t *testing.T) {
 	}
 
 }
+
+func TestMeter(t *testing.T) {
+	trans := yarpctest.NewFakeTransport(yarpctest.InitialConnectionStatus(peer.Available))
+	root := metrics.New()
+	pl := New(trans, farmhashring.Fingerprint32, Meter(root.Scope()))
+	require.NoError(t, pl.Start())
+	defer pl.Stop()
+
+	require.NoError(t, pl.Update(peer.ListUpdates{
+		Additions: []peer.Identifier{
+			&FakeShardIdentifier{id: "id1", shard: "shard-1"},
+			&FakeShardIdentifier{id: "id2", shard: "shard-2"},
+		},
+	}))
+
+	var found bool
+	for _, g := range root.Snapshot().Gauges {
+		if g.Name == "peer_list_available_peers" {
+			found = true
+			assert.Equal(t, metrics.Tags{"peerlist": "hashring32"}, g.Tags)
+			assert.Equal(t, int64(2), g.Value)
+		}
+	}
+	assert.True(t, found, "expected available peers gauge")
+}
@@ -592,6 +592,8 @@ func (pl *List) Introspect() introspection.ChooserStatus {
 			State: fmt.Sprintf("%s, %d pending request(s)",
 				ps.ConnectionStatus.String(),
 				ps.PendingRequestCount),
+			ConnectionStatus: ps.ConnectionStatus.String(),
+			PendingRequests:  ps.PendingRequestCount,
 		}
 	}
 
@@ -25,6 +25,7 @@ import (
 	"math/rand"
 	"time"
 
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -39,6 +40,8 @@ type listConfig struct {
 	seed     int64
 	nextRand func(int) int
 	logger   *zap.Logger
+
+	peerMetrics bool
 }
 
 var defaultListConfig = listConfig{
@@ -87,6 +90,15 @@ func FailFast() ListOption {
 	}
 }
 
+// PeerMetrics records the pending requests of each peer alongside the other
+// metrics of the list. Each peer adds a series, so this is disabled by
+// default.
+func PeerMetrics() ListOption {
+	return func(c *listConfig) {
+		c.peerMetrics = true
+	}
+}
+
 // New creates a new pending heap.
 func New(transport peer.Transport, opts ...ListOption) *List {
 	cfg := defaultListConfig
@@ -104,6 +116,9 @@ func New(transport peer.Transport, opts ...ListOption) *List {
 	if cfg.failFast {
 		plOpts = append(plOpts, abstractlist.FailFast())
 	}
+	if cfg.peerMetrics {
+		plOpts = append(plOpts, abstractlist.PeerMetrics())
+	}
 
 	nextRandFn := nextRand(cfg.seed)
 	if cfg.nextRand != nil {
@@ -208,3 +223,16 @@ func (l *List) Introspect() introspection.ChooserStatus {
 func (l *List) Peers() []peer.StatusPeer {
 	return l.list.Peers()
 }
+
+// NumAvailable returns how many peers are available.
+func (l *List) NumAvailable() int {
+	return l.list.NumAvailable()
+}
+
+// SetMeter replaces the scope in which the list records metrics.
+//
+// Dispatchers call SetMeter on the peer lists of their outbounds with their
+// metrics scope.
+func (l *List) SetMeter(meter *metrics.Scope) {
+	l.list.SetMeter(meter)
+}
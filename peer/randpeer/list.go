@@ -25,6 +25,7 @@ import (
 	"math/rand"
 	"time"
 
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -38,6 +39,7 @@ type listOptions struct {
 	failFast             bool
 	defaultChooseTimeout *time.Duration
 	logger               *zap.Logger
+	peerMetrics          bool
 }
 
 var defaultListOptions = listOptions{
@@ -95,6 +97,15 @@ func Logger(logger *zap.Logger) ListOption {
 	})
 }
 
+// PeerMetrics records the pending requests of each peer alongside the other
+// metrics of the list. Each peer adds a series, so this is disabled by
+// default.
+func PeerMetrics() ListOption {
+	return listOptionFunc(func(options *listOptions) {
+		options.peerMetrics = true
+	})
+}
+
 // DefaultChooseTimeout specifies the default timeout to add to 'Choose' calls
 // without context deadlines. This prevents long-lived streams from setting
 // calling deadlines.
@@ -128,6 +139,9 @@ func New(transport peer.Transport, opts ...ListOption) *List {
 	if options.failFast {
 		plOpts = append(plOpts, abstractlist.FailFast())
 	}
+	if options.peerMetrics {
+		plOpts = append(plOpts, abstractlist.PeerMetrics())
+	}
 	if options.defaultChooseTimeout != nil {
 		plOpts = append(plOpts, abstractlist.DefaultChooseTimeout(*options.defaultChooseTimeout))
 	}
@@ -216,3 +230,16 @@ func (l *List) Introspect() introspection.ChooserStatus {
 func (l *List) Peers() []peer.StatusPeer {
 	return l.list.Peers()
 }
+
+// NumAvailable returns how many peers are available.
+func (l *List) NumAvailable() int {
+	return l.list.NumAvailable()
+}
+
+// SetMeter replaces the scope in which the list records metrics.
+//
+// Dispatchers call SetMeter on the peer lists of their outbounds with their
+// metrics scope.
+func (l *List) SetMeter(meter *metrics.Scope) {
+	l.list.SetMeter(meter)
+}
@@ -24,6 +24,7 @@ import (
 	"context"
 	"time"
 
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -38,6 +39,7 @@ type listConfig struct {
 	defaultChooseTimeout *time.Duration
 	seed                 int64
 	logger               *zap.Logger
+	peerMetrics          bool
 }
 
 var defaultListConfig = listConfig{
@@ -77,6 +79,15 @@ func Logger(logger *zap.Logger) ListOption {
 	}
 }
 
+// PeerMetrics records the pending requests of each peer alongside the other
+// metrics of the list. Each peer adds a series, so this is disabled by
+// default.
+func PeerMetrics() ListOption {
+	return func(c *listConfig) {
+		c.peerMetrics = true
+	}
+}
+
 // DefaultChooseTimeout specifies the default timeout to add to 'Choose' calls
 // without context deadlines. This prevents long-lived streams from setting
 // calling deadlines.
@@ -108,6 +119,9 @@ func New(transport peer.Transport, opts ...ListOption) *List {
 	if cfg.failFast {
 		plOpts = append(plOpts, abstractlist.FailFast())
 	}
+	if cfg.peerMetrics {
+		plOpts = append(plOpts, abstractlist.PeerMetrics())
+	}
 	if cfg.defaultChooseTimeout != nil {
 		plOpts = append(plOpts, abstractlist.DefaultChooseTimeout(*cfg.defaultChooseTimeout))
 	}
@@ -200,3 +214,16 @@ func (l *List) Introspect() introspection.ChooserStatus {
 func (l *List) Peers() []peer.StatusPeer {
 	return l.list.Peers()
 }
+
+// NumAvailable returns how many peers are available.
+func (l *List) NumAvailable() int {
+	return l.list.NumAvailable()
+}
+
+// SetMeter replaces the scope in which the list records metrics.
+//
+// Dispatchers call SetMeter on the peer lists of their outbounds with their
+// metrics scope.
+func (l *List) SetMeter(meter *metrics.Scope) {
+	l.list.SetMeter(meter)
+}
@@ -120,6 +120,8 @@ func (s *Single) Introspect() introspection.ChooserStatus {
 		State: fmt.Sprintf("%s, %d pending request(s)",
 			peerStatus.ConnectionStatus.String(),
 			peerStatus.PendingRequestCount),
+		ConnectionStatus: peerStatus.ConnectionStatus.String(),
+		PendingRequests:  peerStatus.PendingRequestCount,
 	}
 
 	return introspection.ChooserStatus{
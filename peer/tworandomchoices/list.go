@@ -25,6 +25,7 @@ import (
 	"math/rand"
 	"time"
 
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/x/introspection"
@@ -37,6 +38,8 @@ type listOptions struct {
 	source   rand.Source
 	failFast bool
 	logger   *zap.Logger
+
+	peerMetrics bool
 }
 
 var defaultListOptions = listOptions{
@@ -95,6 +98,15 @@ func Logger(logger *zap.Logger) ListOption {
 	})
 }
 
+// PeerMetrics records the pending requests of each peer alongside the other
+// metrics of the list. Each peer adds a series, so this is disabled by
+// default.
+func PeerMetrics() ListOption {
+	return listOptionFunc(func(options *listOptions) {
+		options.peerMetrics = true
+	})
+}
+
 // New creates a new fewest pending requests of two random peers peer list.
 func New(transport peer.Transport, opts ...ListOption) *List {
 	options := defaultListOptions
@@ -117,6 +129,9 @@ func New(transport peer.Transport, opts ...ListOption) *List {
 	if options.failFast {
 		plOpts = append(plOpts, abstractlist.FailFast())
 	}
+	if options.peerMetrics {
+		plOpts = append(plOpts, abstractlist.PeerMetrics())
+	}
 
 	return &List{
 		list: abstractlist.New(
@@ -202,3 +217,16 @@ func (l *List) Introspect() introspection.ChooserStatus {
 func (l *List) Peers() []peer.StatusPeer {
 	return l.list.Peers()
 }
+
+// NumAvailable returns how many peers are available.
+func (l *List) NumAvailable() int {
+	return l.list.NumAvailable()
+}
+
+// SetMeter replaces the scope in which the list records metrics.
+//
+// Dispatchers call SetMeter on the peer lists of their outbounds with their
+// metrics scope.
+func (l *List) SetMeter(meter *metrics.Scope) {
+	l.list.SetMeter(meter)
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package yarpc
+
+import (
+	"context"
+
+	"go.uber.org/yarpc/internal/requestid"
+)
+
+// RequestIDFromContext returns the request ID carried by the context, if
+// any. With Config.RequestID enabled, the contexts of all inbound requests
+// carry one.
+//
+// 	func Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+// 		id, _ := yarpc.RequestIDFromContext(ctx)
+// 		...
+// 	}
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	return requestid.FromContext(ctx)
+}
+
+// WithRequestID returns a copy of the context carrying the given request ID.
+// With Config.RequestID enabled, outbound requests made with the context send
+// the ID. This may be used to start a chain of requests outside of a handler,
+// with an ID known to the application.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return requestid.WithRequestID(ctx, id)
+}
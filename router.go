@@ -155,6 +155,20 @@ func (ps sortableProcedures) Swap(i int, j int) {
 	ps[i], ps[j] = ps[j], ps[i]
 }
 
+// hasProcedure reports whether a procedure of the service is registered, in
+// any encoding.
+func (m MapRouter) hasProcedure(service, procedure string) bool {
+	if service == "" {
+		service = m.defaultService
+	}
+	sp := serviceProcedure{service: service, procedure: procedure}
+	if _, ok := m.serviceProcedures[sp]; ok {
+		return true
+	}
+	_, ok := m.supportedEncodings[sp]
+	return ok
+}
+
 // Choose retrives the HandlerSpec for the service, procedure, and encoding
 // noted on the transport request, or returns an unrecognized procedure error
 // (testable with transport.IsUnrecognizedProcedureError(err)).
@@ -331,3 +331,38 @@ func TestUnknownServiceName(t *testing.T) {
 	})
 	assert.Contains(t, err.Error(), `unrecognized service name "wrongService", available services: "service1", "service2"`)
 }
+
+func TestMapRouterHasProcedure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	m := NewMapRouter("myservice")
+	h := transporttest.NewMockUnaryHandler(mockCtrl)
+	m.Register([]transport.Procedure{
+		{
+			Name:        "foo",
+			HandlerSpec: transport.NewUnaryHandlerSpec(h),
+		},
+		{
+			Name:        "bar",
+			Encoding:    "json",
+			HandlerSpec: transport.NewUnaryHandlerSpec(h),
+		},
+	})
+
+	tests := []struct {
+		service, procedure string
+		want               bool
+	}{
+		{"myservice", "foo", true},
+		{"", "foo", true},
+		{"", "bar", true},
+		{"", "baz", false},
+		{"anotherservice", "foo", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, m.hasProcedure(tt.service, tt.procedure),
+			"hasProcedure(%q, %q)", tt.service, tt.procedure)
+	}
+}
@@ -23,13 +23,16 @@ package grpc
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	peerchooser "go.uber.org/yarpc/peer"
 	"go.uber.org/yarpc/peer/hostport"
+	"go.uber.org/yarpc/transport/portmux"
 	"go.uber.org/yarpc/yarpcconfig"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
 // TransportSpec returns a TransportSpec for the gRPC transport.
@@ -65,14 +68,55 @@ func TransportSpec(opts ...Option) yarpcconfig.TransportSpec {
 //          first: 10ms
 //          max: 30s
 //
+// Outbound connections may send keepalive pings to keep idle connections
+// open through L4 load balancers.
+//
+//  transports:
+//    grpc:
+//      clientKeepalive:
+//        time: 30s
+//        timeout: 10s
+//        permitWithoutStream: true
+//
 // All parameters of TransportConfig are optional. This section
 // may be omitted in the transports section.
 type TransportConfig struct {
-	ServerMaxRecvMsgSize int                 `config:"serverMaxRecvMsgSize"`
-	ServerMaxSendMsgSize int                 `config:"serverMaxSendMsgSize"`
-	ClientMaxRecvMsgSize int                 `config:"clientMaxRecvMsgSize"`
-	ClientMaxSendMsgSize int                 `config:"clientMaxSendMsgSize"`
-	Backoff              yarpcconfig.Backoff `config:"backoff"`
+	ServerMaxRecvMsgSize int                   `config:"serverMaxRecvMsgSize"`
+	ServerMaxSendMsgSize int                   `config:"serverMaxSendMsgSize"`
+	ClientMaxRecvMsgSize int                   `config:"clientMaxRecvMsgSize"`
+	ClientMaxSendMsgSize int                   `config:"clientMaxSendMsgSize"`
+	Backoff              yarpcconfig.Backoff   `config:"backoff"`
+	ClientKeepalive      ClientKeepaliveConfig `config:"clientKeepalive"`
+	// Initial HTTP/2 flow control window sizes for outbound connections.
+	ClientInitialWindowSize     int32 `config:"clientInitialWindowSize"`
+	ClientInitialConnWindowSize int32 `config:"clientInitialConnWindowSize"`
+}
+
+// ClientKeepaliveConfig configures keepalive pings for outbound connections.
+// Pings are disabled unless Time is set.
+//
+// See https://godoc.org/google.golang.org/grpc/keepalive#ClientParameters
+// for details.
+type ClientKeepaliveConfig struct {
+	// Time after which a ping is sent if there is no activity on the
+	// connection.
+	Time time.Duration `config:"time"`
+	// Timeout after which the connection is closed if a ping is not
+	// acknowledged.
+	Timeout time.Duration `config:"timeout"`
+	// PermitWithoutStream allows pings even if there are no active streams.
+	PermitWithoutStream bool `config:"permitWithoutStream"`
+}
+
+func (c ClientKeepaliveConfig) transportOptions() []TransportOption {
+	if c == (ClientKeepaliveConfig{}) {
+		return nil
+	}
+	return []TransportOption{ClientKeepaliveParameters(keepalive.ClientParameters{
+		Time:                c.Time,
+		Timeout:             c.Timeout,
+		PermitWithoutStream: c.PermitWithoutStream,
+	})}
 }
 
 // InboundConfig configures a gRPC Inbound.
@@ -90,14 +134,125 @@ type TransportConfig struct {
 //       enabled: true
 //       keyFile: "/path/to/key"
 //       certFile: "/path/to/cert"
+//
+// A gRPC inbound can configure keepalive, connection ages and stream limits.
+// Connections older than maxConnectionAge are gracefully closed so that
+// clients reconnect and rebalance.
+//
+// inbounds:
+//   grpc:
+//     address: ":80"
+//     maxConcurrentStreams: 100
+//     keepalive:
+//       time: 1m
+//       timeout: 20s
+//       maxConnectionAge: 30m
+//       maxConnectionAgeGrace: 1m
+//       enforcement:
+//         minTime: 10s
+//         permitWithoutStream: true
+//
+// A gRPC inbound can share its port with an HTTP inbound configured with the
+// same address. Connections are routed to the gRPC or HTTP inbound depending
+// on their protocol. TLS cannot be enabled on a shared address.
+//
+// inbounds:
+//   grpc:
+//     address: ":80"
+//     shareAddress: true
+//   http:
+//     address: ":80"
+//     shareAddress: true
 type InboundConfig struct {
 	// Address to listen on. This field is required.
-	Address string           `config:"address,interpolate"`
-	TLS     InboundTLSConfig `config:"tls"`
+	Address string `config:"address,interpolate"`
+	// ShareAddress allows an HTTP inbound to listen on the same address.
+	ShareAddress bool                   `config:"shareAddress"`
+	TLS          InboundTLSConfig       `config:"tls"`
+	Keepalive    InboundKeepaliveConfig `config:"keepalive"`
+	// Maximum number of concurrent streams for each connection.
+	MaxConcurrentStreams uint32 `config:"maxConcurrentStreams"`
+	// Initial HTTP/2 flow control window sizes for inbound connections.
+	InitialWindowSize     int32 `config:"initialWindowSize"`
+	InitialConnWindowSize int32 `config:"initialConnWindowSize"`
 }
 
 func (c InboundConfig) inboundOptions() ([]InboundOption, error) {
-	return c.TLS.inboundOptions()
+	opts, err := c.TLS.inboundOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, c.Keepalive.inboundOptions()...)
+	if c.MaxConcurrentStreams > 0 {
+		opts = append(opts, MaxConcurrentStreams(c.MaxConcurrentStreams))
+	}
+	if c.InitialWindowSize > 0 {
+		opts = append(opts, ServerInitialWindowSize(c.InitialWindowSize))
+	}
+	if c.InitialConnWindowSize > 0 {
+		opts = append(opts, ServerInitialConnWindowSize(c.InitialConnWindowSize))
+	}
+	return opts, nil
+}
+
+// InboundKeepaliveConfig configures keepalive pings and connection lifetimes
+// for a gRPC inbound. Unset fields use gRPC defaults.
+//
+// See https://godoc.org/google.golang.org/grpc/keepalive#ServerParameters
+// for details.
+type InboundKeepaliveConfig struct {
+	// Time after which a ping is sent if there is no activity on the
+	// connection.
+	Time time.Duration `config:"time"`
+	// Timeout after which the connection is closed if a ping is not
+	// acknowledged.
+	Timeout time.Duration `config:"timeout"`
+	// MaxConnectionIdle is the duration after which an idle connection is
+	// closed.
+	MaxConnectionIdle time.Duration `config:"maxConnectionIdle"`
+	// MaxConnectionAge is the maximum duration a connection may exist
+	// before it is gracefully closed.
+	MaxConnectionAge time.Duration `config:"maxConnectionAge"`
+	// MaxConnectionAgeGrace is an additive period after MaxConnectionAge
+	// after which the connection is forcibly closed.
+	MaxConnectionAgeGrace time.Duration `config:"maxConnectionAgeGrace"`
+
+	Enforcement KeepaliveEnforcementConfig `config:"enforcement"`
+}
+
+func (c InboundKeepaliveConfig) inboundOptions() []InboundOption {
+	var opts []InboundOption
+	params := keepalive.ServerParameters{
+		Time:                  c.Time,
+		Timeout:               c.Timeout,
+		MaxConnectionIdle:     c.MaxConnectionIdle,
+		MaxConnectionAge:      c.MaxConnectionAge,
+		MaxConnectionAgeGrace: c.MaxConnectionAgeGrace,
+	}
+	if params != (keepalive.ServerParameters{}) {
+		opts = append(opts, ServerKeepaliveParameters(params))
+	}
+	if c.Enforcement != (KeepaliveEnforcementConfig{}) {
+		opts = append(opts, KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             c.Enforcement.MinTime,
+			PermitWithoutStream: c.Enforcement.PermitWithoutStream,
+		}))
+	}
+	return opts
+}
+
+// KeepaliveEnforcementConfig configures how a gRPC inbound treats keepalive
+// pings from clients.
+//
+// See https://godoc.org/google.golang.org/grpc/keepalive#EnforcementPolicy
+// for details.
+type KeepaliveEnforcementConfig struct {
+	// MinTime is the minimum amount of time a client should wait before
+	// sending a ping.
+	MinTime time.Duration `config:"minTime"`
+	// PermitWithoutStream allows clients to ping even if there are no
+	// active streams.
+	PermitWithoutStream bool `config:"permitWithoutStream"`
 }
 
 // InboundTLSConfig specifies the TLS configuration for the gRPC inbound.
@@ -224,6 +379,13 @@ func (t *transportSpec) buildTransport(transportConfig *TransportConfig, _ *yarp
 		return nil, err
 	}
 	options = append(options, BackoffStrategy(backoffStrategy))
+	options = append(options, transportConfig.ClientKeepalive.transportOptions()...)
+	if transportConfig.ClientInitialWindowSize > 0 {
+		options = append(options, ClientInitialWindowSize(transportConfig.ClientInitialWindowSize))
+	}
+	if transportConfig.ClientInitialConnWindowSize > 0 {
+		options = append(options, ClientInitialConnWindowSize(transportConfig.ClientInitialConnWindowSize))
+	}
 	return newTransport(newTransportOptions(options)), nil
 }
 
@@ -235,14 +397,23 @@ func (t *transportSpec) buildInbound(inboundConfig *InboundConfig, tr transport.
 	if inboundConfig.Address == "" {
 		return nil, newRequiredFieldMissingError("address")
 	}
-	listener, err := net.Listen("tcp", inboundConfig.Address)
-	if err != nil {
-		return nil, err
-	}
 	inboundOptions, err := inboundConfig.inboundOptions()
 	if err != nil {
 		return nil, fmt.Errorf("cannot build gRPC inbound from given configuration: %v", err)
 	}
+	var listener net.Listener
+	if inboundConfig.ShareAddress {
+		if inboundConfig.TLS.Enabled {
+			return nil, fmt.Errorf("cannot build gRPC inbound from given configuration: TLS cannot be enabled on a shared address")
+		}
+		sharedListener, err := portmux.Shared(inboundConfig.Address)
+		if err != nil {
+			return nil, err
+		}
+		listener = sharedListener.GRPC()
+	} else if listener, err = net.Listen("tcp", inboundConfig.Address); err != nil {
+		return nil, err
+	}
 	return trans.NewInbound(listener, append(t.InboundOptions, inboundOptions...)...), nil
 }
 
@@ -30,6 +30,7 @@ import (
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/peer"
 	"go.uber.org/yarpc/yarpcconfig"
+	"google.golang.org/grpc/keepalive"
 )
 
 func TestNewTransportSpecOptions(t *testing.T) {
@@ -92,6 +93,11 @@ func TestTransportSpec(t *testing.T) {
 		ClientMaxRecvMsgSize int
 		ClientMaxSendMsgSize int
 		TLS                  bool
+
+		ClientKeepalive            *keepalive.ClientParameters
+		Keepalive                  *keepalive.ServerParameters
+		KeepaliveEnforcementPolicy *keepalive.EnforcementPolicy
+		MaxConcurrentStreams       uint32
 	}
 
 	type wantOutbound struct {
@@ -229,6 +235,49 @@ func TestTransportSpec(t *testing.T) {
 				ClientMaxSendMsgSize: 8192,
 			},
 		},
+		{
+			desc: "inbound and transport with keepalive options",
+			transportCfg: attrs{
+				"clientKeepalive": attrs{
+					"time":                "30s",
+					"timeout":             "10s",
+					"permitWithoutStream": true,
+				},
+			},
+			inboundCfg: attrs{
+				"address":              ":54572",
+				"maxConcurrentStreams": 100,
+				"keepalive": attrs{
+					"time":                  "1m",
+					"timeout":               "20s",
+					"maxConnectionAge":      "30m",
+					"maxConnectionAgeGrace": "1m",
+					"enforcement": attrs{
+						"minTime":             "10s",
+						"permitWithoutStream": true,
+					},
+				},
+			},
+			wantInbound: &wantInbound{
+				Address: ":54572",
+				ClientKeepalive: &keepalive.ClientParameters{
+					Time:                30 * time.Second,
+					Timeout:             10 * time.Second,
+					PermitWithoutStream: true,
+				},
+				Keepalive: &keepalive.ServerParameters{
+					Time:                  time.Minute,
+					Timeout:               20 * time.Second,
+					MaxConnectionAge:      30 * time.Minute,
+					MaxConnectionAgeGrace: time.Minute,
+				},
+				KeepaliveEnforcementPolicy: &keepalive.EnforcementPolicy{
+					MinTime:             10 * time.Second,
+					PermitWithoutStream: true,
+				},
+				MaxConcurrentStreams: 100,
+			},
+		},
 		{
 			desc: "TLS enabled on an inbound",
 			inboundCfg: attrs{
@@ -244,6 +293,19 @@ func TestTransportSpec(t *testing.T) {
 				TLS:     true,
 			},
 		},
+		{
+			desc: "TLS enabled on a shared inbound address",
+			inboundCfg: attrs{
+				"address":      "localhost:54570",
+				"shareAddress": true,
+				"tls": attrs{
+					"enabled":  true,
+					"certFile": "testdata/cert",
+					"keyFile":  "testdata/key",
+				},
+			},
+			wantErrors: []string{`TLS cannot be enabled on a shared address`},
+		},
 		{
 			desc: "TLS enabled on an inbound with invalid config",
 			inboundCfg: attrs{
@@ -333,6 +395,10 @@ func TestTransportSpec(t *testing.T) {
 					assert.Equal(t, defaultClientMaxSendMsgSize, inbound.t.options.clientMaxSendMsgSize)
 				}
 				assert.Equal(t, tt.wantInbound.TLS, inbound.options.creds != nil)
+				assert.Equal(t, tt.wantInbound.ClientKeepalive, inbound.t.options.clientKeepaliveParams)
+				assert.Equal(t, tt.wantInbound.Keepalive, inbound.options.keepaliveParams)
+				assert.Equal(t, tt.wantInbound.KeepaliveEnforcementPolicy, inbound.options.keepaliveEnforcementPolicy)
+				assert.Equal(t, tt.wantInbound.MaxConcurrentStreams, inbound.options.maxConcurrentStreams)
 			} else {
 				assert.Len(t, cfg.Inbounds, 0)
 			}
@@ -29,12 +29,15 @@ import (
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/internal/bufferpool"
 	"go.uber.org/yarpc/internal/grpcerrorcodes"
+	"go.uber.org/yarpc/internal/tlsinfo"
 	"go.uber.org/yarpc/yarpcerrors"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
@@ -58,6 +61,14 @@ func (h *handler) handle(srv interface{}, serverStream grpc.ServerStream) (err e
 
 	start := time.Now()
 	ctx := serverStream.Context()
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			ctx = tlsinfo.WithConnectionState(ctx, info.State)
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = metadataToBaggage(ctx, md)
+	}
 	streamMethod, ok := grpc.MethodFromServerStream(serverStream)
 	if !ok {
 		return errInvalidGRPCStream
@@ -21,10 +21,12 @@
 package grpc
 
 import (
+	"context"
 	"strings"
 
 	"go.uber.org/multierr"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/yarpcerrors"
 	"google.golang.org/grpc/metadata"
 )
@@ -52,6 +54,16 @@ const (
 	// destined service. This corresponds to the Request.RoutingDelegate attribute.
 	// This header is optional.
 	RoutingDelegateHeader = "rpc-routing-delegate"
+	// CriticalityHeader is the header key for how important it is that the
+	// request is served under overload. This corresponds to the
+	// Request.Criticality attribute.
+	// This header is optional.
+	CriticalityHeader = "rpc-criticality"
+	// BaggageHeaderPrefix is the prefix of the header keys carrying the
+	// baggage of the request, one per item. The rest of the key is the
+	// baggage key.
+	// These headers are optional.
+	BaggageHeaderPrefix = "rpc-baggage-"
 	// EncodingHeader is the header key for the encoding used for the request body.
 	// This corresponds to the Request.Encoding attribute.
 	// If this is not set, content-type will attempt to be read for the encoding per
@@ -102,6 +114,7 @@ func transportRequestToMetadata(request *transport.Request) (metadata.MD, error)
 		addToMetadata(md, ShardKeyHeader, request.ShardKey),
 		addToMetadata(md, RoutingKeyHeader, request.RoutingKey),
 		addToMetadata(md, RoutingDelegateHeader, request.RoutingDelegate),
+		addToMetadata(md, CriticalityHeader, string(request.Criticality)),
 		addToMetadata(md, EncodingHeader, string(request.Encoding)),
 	); err != nil {
 		return md, err
@@ -137,6 +150,8 @@ func metadataToTransportRequest(md metadata.MD) (*transport.Request, error) {
 			request.RoutingKey = value
 		case RoutingDelegateHeader:
 			request.RoutingDelegate = value
+		case CriticalityHeader:
+			request.Criticality = transport.Criticality(value)
 		case EncodingHeader:
 			request.Encoding = transport.Encoding(value)
 		case contentTypeHeader:
@@ -146,6 +161,9 @@ func metadataToTransportRequest(md metadata.MD) (*transport.Request, error) {
 				request.Encoding = transport.Encoding(getContentSubtype(value))
 			}
 		default:
+			if strings.HasPrefix(header, BaggageHeaderPrefix) {
+				continue
+			}
 			request.Headers = request.Headers.With(header, value)
 		}
 	}
@@ -213,6 +231,33 @@ func getApplicationHeaders(md metadata.MD) (transport.Headers, error) {
 	return headers, nil
 }
 
+// addBaggageToMetadata adds the baggage carried by the context to md.
+func addBaggageToMetadata(ctx context.Context, md metadata.MD) {
+	baggage.Range(ctx, func(k, v string) {
+		md[BaggageHeaderPrefix+k] = []string{v}
+	})
+}
+
+// metadataToBaggage returns a copy of the context carrying the baggage sent
+// in md.
+func metadataToBaggage(ctx context.Context, md metadata.MD) context.Context {
+	var items map[string]string
+	for header, values := range md {
+		header = transport.CanonicalizeHeaderKey(header)
+		if !strings.HasPrefix(header, BaggageHeaderPrefix) || len(values) != 1 {
+			continue
+		}
+		if items == nil {
+			items = make(map[string]string)
+		}
+		items[header[len(BaggageHeaderPrefix):]] = values[0]
+	}
+	if items == nil {
+		return ctx
+	}
+	return baggage.WithItems(ctx, items)
+}
+
 // add to md
 // return error if key already in md
 func addToMetadata(md metadata.MD, key string, value string) error {
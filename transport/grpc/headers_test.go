@@ -21,11 +21,13 @@
 package grpc
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/yarpcerrors"
 	"google.golang.org/grpc/metadata"
 )
@@ -46,7 +48,9 @@ func TestMetadataToTransportRequest(t *testing.T) {
 				ShardKeyHeader, "example-shard-key",
 				RoutingKeyHeader, "example-routing-key",
 				RoutingDelegateHeader, "example-routing-delegate",
+				CriticalityHeader, "sheddable",
 				EncodingHeader, "example-encoding",
+				BaggageHeaderPrefix+"tenant", "acme",
 				"foo", "bar",
 				"baz", "bat",
 			),
@@ -56,6 +60,7 @@ func TestMetadataToTransportRequest(t *testing.T) {
 				ShardKey:        "example-shard-key",
 				RoutingKey:      "example-routing-key",
 				RoutingDelegate: "example-routing-delegate",
+				Criticality:     transport.CriticalitySheddable,
 				Encoding:        "example-encoding",
 				Headers: transport.HeadersFromMap(map[string]string{
 					"foo": "bar",
@@ -197,10 +202,29 @@ func TestIsReserved(t *testing.T) {
 	assert.True(t, isReserved(ShardKeyHeader))
 	assert.True(t, isReserved(RoutingKeyHeader))
 	assert.True(t, isReserved(RoutingDelegateHeader))
+	assert.True(t, isReserved(CriticalityHeader))
 	assert.True(t, isReserved(EncodingHeader))
+	assert.True(t, isReserved(BaggageHeaderPrefix+"tenant"))
 	assert.True(t, isReserved("rpc-foo"))
 }
 
+func TestBaggageMetadata(t *testing.T) {
+	md := metadata.New(nil)
+	addBaggageToMetadata(baggage.WithBaggage(context.Background(), "tenant", "acme"), md)
+	assert.Equal(t, metadata.Pairs(BaggageHeaderPrefix+"tenant", "acme"), md)
+
+	md = metadata.Pairs(
+		CallerHeader, "example-caller",
+		BaggageHeaderPrefix+"tenant", "acme",
+		"foo", "bar",
+	)
+	ctx := metadataToBaggage(context.Background(), md)
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggage.FromContext(ctx))
+
+	ctx = context.Background()
+	assert.Equal(t, ctx, metadataToBaggage(ctx, metadata.Pairs("foo", "bar")))
+}
+
 func TestMDReadWriterDuplicateKey(t *testing.T) {
 	const key = "uber-trace-id"
 	md := map[string][]string{
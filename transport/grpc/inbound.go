@@ -108,6 +108,12 @@ func (i *Inbound) start() error {
 	if i.router == nil {
 		return errRouterNotSet
 	}
+	// Listeners shared through portmux bind their address once used.
+	if l, ok := i.listener.(interface{ Listen() error }); ok {
+		if err := l.Listen(); err != nil {
+			return err
+		}
+	}
 
 	handler := newHandler(i, i.t.options.logger)
 
@@ -117,10 +123,7 @@ func (i *Inbound) start() error {
 		grpc.MaxRecvMsgSize(i.t.options.serverMaxRecvMsgSize),
 		grpc.MaxSendMsgSize(i.t.options.serverMaxSendMsgSize),
 	}
-
-	if i.options.creds != nil {
-		serverOptions = append(serverOptions, grpc.Creds(i.options.creds))
-	}
+	serverOptions = append(serverOptions, i.options.grpcOptions()...)
 
 	server := grpc.NewServer(serverOptions...)
 
@@ -61,6 +61,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/status"
 )
 
@@ -232,6 +233,41 @@ func TestYARPCMaxMsgSize(t *testing.T) {
 	})
 }
 
+func TestYARPCKeepalive(t *testing.T) {
+	t.Parallel()
+	te := testEnvOptions{
+		TransportOptions: []TransportOption{
+			ClientKeepaliveParameters(keepalive.ClientParameters{
+				Time:                10 * time.Second,
+				Timeout:             time.Second,
+				PermitWithoutStream: true,
+			}),
+			ClientInitialWindowSize(1 << 20),
+			ClientInitialConnWindowSize(1 << 20),
+		},
+		InboundOptions: []InboundOption{
+			ServerKeepaliveParameters(keepalive.ServerParameters{
+				MaxConnectionAge:      time.Minute,
+				MaxConnectionAgeGrace: time.Second,
+			}),
+			KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime:             5 * time.Second,
+				PermitWithoutStream: true,
+			}),
+			MaxConcurrentStreams(10),
+			ServerInitialWindowSize(1 << 20),
+			ServerInitialConnWindowSize(1 << 20),
+		},
+	}
+	te.do(t, func(t *testing.T, e *testEnv) {
+		if assert.NoError(t, e.SetValueYARPC(context.Background(), "foo", "bar")) {
+			getValue, err := e.GetValueYARPC(context.Background(), "foo")
+			assert.NoError(t, err)
+			assert.Equal(t, "bar", getValue)
+		}
+	})
+}
+
 func TestLargeEcho(t *testing.T) {
 	t.Parallel()
 	value := strings.Repeat("a", 32768)
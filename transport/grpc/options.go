@@ -32,6 +32,7 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
 const (
@@ -125,6 +126,39 @@ func ClientMaxSendMsgSize(clientMaxSendMsgSize int) TransportOption {
 	}
 }
 
+// ClientKeepaliveParameters configures keepalive pings sent by outbound
+// connections to detect broken connections and keep idle connections open
+// through proxies and load balancers.
+//
+// See https://godoc.org/google.golang.org/grpc/keepalive#ClientParameters
+// for details. Pings are disabled by default.
+func ClientKeepaliveParameters(params keepalive.ClientParameters) TransportOption {
+	return func(transportOptions *transportOptions) {
+		transportOptions.clientKeepaliveParams = &params
+	}
+}
+
+// ClientInitialWindowSize sets the initial HTTP/2 flow control window size
+// of each stream for outbound connections. Values smaller than 64KB are
+// ignored.
+//
+// The default is 64KB.
+func ClientInitialWindowSize(size int32) TransportOption {
+	return func(transportOptions *transportOptions) {
+		transportOptions.clientInitialWindowSize = size
+	}
+}
+
+// ClientInitialConnWindowSize sets the initial HTTP/2 flow control window
+// size of outbound connections. Values smaller than 64KB are ignored.
+//
+// The default is 64KB.
+func ClientInitialConnWindowSize(size int32) TransportOption {
+	return func(transportOptions *transportOptions) {
+		transportOptions.clientInitialConnWindowSize = size
+	}
+}
+
 // InboundOption is an option for an inbound.
 type InboundOption func(*inboundOptions)
 
@@ -138,6 +172,63 @@ func InboundCredentials(creds credentials.TransportCredentials) InboundOption {
 	}
 }
 
+// ServerKeepaliveParameters configures keepalive pings and connection
+// lifetimes for connections accepted by the inbound. MaxConnectionAge and
+// MaxConnectionAgeGrace may be used to periodically cycle long-lived
+// connections so that clients rebalance across servers.
+//
+// See https://godoc.org/google.golang.org/grpc/keepalive#ServerParameters
+// for details and defaults.
+func ServerKeepaliveParameters(params keepalive.ServerParameters) InboundOption {
+	return func(inboundOptions *inboundOptions) {
+		inboundOptions.keepaliveParams = &params
+	}
+}
+
+// KeepaliveEnforcementPolicy configures how the inbound treats keepalive
+// pings sent by clients. Clients that ping more frequently than the policy
+// allows have their connections closed.
+//
+// See https://godoc.org/google.golang.org/grpc/keepalive#EnforcementPolicy
+// for details and defaults.
+func KeepaliveEnforcementPolicy(policy keepalive.EnforcementPolicy) InboundOption {
+	return func(inboundOptions *inboundOptions) {
+		inboundOptions.keepaliveEnforcementPolicy = &policy
+	}
+}
+
+// MaxConcurrentStreams limits the number of concurrent streams to each
+// connection accepted by the inbound.
+//
+// The default is unlimited.
+func MaxConcurrentStreams(maxConcurrentStreams uint32) InboundOption {
+	return func(inboundOptions *inboundOptions) {
+		inboundOptions.maxConcurrentStreams = maxConcurrentStreams
+	}
+}
+
+// ServerInitialWindowSize sets the initial HTTP/2 flow control window size
+// of each stream for connections accepted by the inbound. Values smaller
+// than 64KB are ignored.
+//
+// The default is 64KB.
+func ServerInitialWindowSize(size int32) InboundOption {
+	return func(inboundOptions *inboundOptions) {
+		inboundOptions.initialWindowSize = size
+	}
+}
+
+// ServerInitialConnWindowSize sets the initial HTTP/2 flow control window
+// size of connections accepted by the inbound. Values smaller than 64KB are
+// ignored.
+//
+// The default is 64KB.
+func ServerInitialConnWindowSize(size int32) InboundOption {
+	return func(inboundOptions *inboundOptions) {
+		inboundOptions.initialConnWindowSize = size
+	}
+}
+
 // OutboundOption is an option for an outbound.
 type OutboundOption func(*outboundOptions)
 
@@ -186,6 +277,10 @@ type transportOptions struct {
 	serverMaxSendMsgSize int
 	clientMaxRecvMsgSize int
 	clientMaxSendMsgSize int
+
+	clientKeepaliveParams       *keepalive.ClientParameters
+	clientInitialWindowSize     int32
+	clientInitialConnWindowSize int32
 }
 
 func newTransportOptions(options []TransportOption) *transportOptions {
@@ -208,8 +303,51 @@ func newTransportOptions(options []TransportOption) *transportOptions {
 	return transportOptions
 }
 
+func (t *transportOptions) grpcDialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+	if t.clientKeepaliveParams != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*t.clientKeepaliveParams))
+	}
+	if t.clientInitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(t.clientInitialWindowSize))
+	}
+	if t.clientInitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(t.clientInitialConnWindowSize))
+	}
+	return opts
+}
+
 type inboundOptions struct {
 	creds credentials.TransportCredentials
+
+	keepaliveParams            *keepalive.ServerParameters
+	keepaliveEnforcementPolicy *keepalive.EnforcementPolicy
+	maxConcurrentStreams       uint32
+	initialWindowSize          int32
+	initialConnWindowSize      int32
+}
+
+func (i *inboundOptions) grpcOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if i.creds != nil {
+		opts = append(opts, grpc.Creds(i.creds))
+	}
+	if i.keepaliveParams != nil {
+		opts = append(opts, grpc.KeepaliveParams(*i.keepaliveParams))
+	}
+	if i.keepaliveEnforcementPolicy != nil {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(*i.keepaliveEnforcementPolicy))
+	}
+	if i.maxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(i.maxConcurrentStreams))
+	}
+	if i.initialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(i.initialWindowSize))
+	}
+	if i.initialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(i.initialConnWindowSize))
+	}
+	return opts
 }
 
 func newInboundOptions(options []InboundOption) *inboundOptions {
@@ -142,6 +142,7 @@ func (o *Outbound) invoke(
 	if err != nil {
 		return err
 	}
+	addBaggageToMetadata(ctx, md)
 
 	bytes, err := ioutil.ReadAll(request.Body)
 	if err != nil {
@@ -275,6 +276,7 @@ func (o *Outbound) stream(
 	if err != nil {
 		return nil, err
 	}
+	addBaggageToMetadata(ctx, md)
 
 	fullMethod, err := procedureNameToFullMethod(req.Meta.Procedure)
 	if err != nil {
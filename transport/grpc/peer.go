@@ -48,7 +48,8 @@ func (t *Transport) newPeer(address string, options *dialOptions) (*grpcPeer, er
 			grpc.MaxCallRecvMsgSize(t.options.clientMaxRecvMsgSize),
 			grpc.MaxCallSendMsgSize(t.options.clientMaxSendMsgSize),
 		),
-	}, options.grpcOptions()...)
+	}, t.options.grpcDialOptions()...)
+	dialOptions = append(dialOptions, options.grpcOptions()...)
 
 	clientConn, err := grpc.Dial(address, dialOptions...)
 	if err != nil {
@@ -0,0 +1,630 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gogostatus "github.com/gogo/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC-Web wire format, see
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+const (
+	webContentType     = "application/grpc-web"
+	webTextContentType = "application/grpc-web-text"
+
+	webFrameHeaderLen = 5
+
+	webFrameCompressedFlag byte = 0x01
+	webFrameTrailerFlag    byte = 0x80
+
+	grpcTimeoutHeader       = "grpc-timeout"
+	grpcStatusHeader        = "grpc-status"
+	grpcMessageHeader       = "grpc-message"
+	grpcStatusDetailsHeader = "grpc-status-details-bin"
+)
+
+// webIgnoredHeaders are HTTP/1.1 and browser headers that are not forwarded
+// to handlers as request metadata.
+var webIgnoredHeaders = map[string]struct{}{
+	"accept":                         {},
+	"accept-encoding":                {},
+	"accept-language":                {},
+	"access-control-request-headers": {},
+	"access-control-request-method":  {},
+	"connection":                     {},
+	"content-length":                 {},
+	"grpc-accept-encoding":           {},
+	"grpc-encoding":                  {},
+	grpcTimeoutHeader:                {},
+	"host":                           {},
+	"origin":                         {},
+	"referer":                        {},
+	"te":                             {},
+	"transfer-encoding":              {},
+	"x-grpc-web":                     {},
+	"x-user-agent":                   {},
+}
+
+// webAllowedHeaders are the request headers that cross-origin gRPC-Web
+// requests may carry by default.
+var webAllowedHeaders = []string{
+	contentTypeHeader,
+	"x-grpc-web",
+	"x-user-agent",
+	grpcTimeoutHeader,
+	CallerHeader,
+	ServiceHeader,
+	EncodingHeader,
+	ShardKeyHeader,
+	RoutingKeyHeader,
+	RoutingDelegateHeader,
+	CriticalityHeader,
+}
+
+// WebOption customizes the behavior of a gRPC-Web handler.
+type WebOption func(*webOptions)
+
+// WebAllowedOrigins specifies the origins that may make cross-origin
+// gRPC-Web requests, for example "https://tools.example.com". The special
+// origin "*" allows requests from any origin, without credentials.
+//
+// By default, only same-origin requests are accepted.
+func WebAllowedOrigins(origins ...string) WebOption {
+	return func(options *webOptions) {
+		for _, origin := range origins {
+			if origin == "*" {
+				options.allowAllOrigins = true
+				continue
+			}
+			options.allowedOrigins[strings.ToLower(origin)] = struct{}{}
+		}
+	}
+}
+
+// WebAllowCredentials allows cross-origin requests from the origins listed
+// in WebAllowedOrigins to include credentials, such as cookies. Requests
+// allowed only by the "*" origin never include credentials.
+func WebAllowCredentials() WebOption {
+	return func(options *webOptions) {
+		options.allowCredentials = true
+	}
+}
+
+// WebAllowedHeaders specifies additional request headers that cross-origin
+// gRPC-Web requests may carry, such as application headers.
+//
+// The content-type, x-grpc-web, x-user-agent and grpc-timeout headers and
+// the YARPC request headers are always allowed.
+func WebAllowedHeaders(headers ...string) WebOption {
+	return func(options *webOptions) {
+		for _, header := range headers {
+			options.allowedHeaders = append(options.allowedHeaders, strings.ToLower(header))
+		}
+	}
+}
+
+// WebCORSMaxAge specifies how long browsers may cache the result of a CORS
+// preflight request.
+//
+// The default is 10 minutes.
+func WebCORSMaxAge(maxAge time.Duration) WebOption {
+	return func(options *webOptions) {
+		options.corsMaxAge = maxAge
+	}
+}
+
+type webOptions struct {
+	allowAllOrigins  bool
+	allowedOrigins   map[string]struct{}
+	allowCredentials bool
+	allowedHeaders   []string
+	corsMaxAge       time.Duration
+}
+
+func newWebOptions(options []WebOption) *webOptions {
+	webOptions := &webOptions{
+		allowedOrigins: make(map[string]struct{}),
+		allowedHeaders: append([]string(nil), webAllowedHeaders...),
+		corsMaxAge:     10 * time.Minute,
+	}
+	for _, option := range options {
+		option(webOptions)
+	}
+	return webOptions
+}
+
+// WebHandler returns an http.Handler that serves gRPC-Web requests from
+// browsers for the procedures registered on this inbound. Both the binary
+// (application/grpc-web) and text (application/grpc-web-text) framings are
+// supported, for unary and server streaming procedures.
+//
+// The handler does not listen on its own; mount it on an HTTP server, for
+// example with the http.Mux option of the HTTP transport's inbound. Requests
+// are routed by their "/package.Service/Method" path, so the handler must be
+// mounted at the root of the server or behind a prefix-stripping handler.
+//
+//  mux := http.NewServeMux()
+//  mux.Handle("/", grpcInbound.WebHandler(grpc.WebAllowedOrigins("https://tools.example.com")))
+//
+// The router is shared with the inbound, so the handler serves requests only
+// after the inbound has been registered with a Dispatcher.
+func (i *Inbound) WebHandler(opts ...WebOption) http.Handler {
+	return &webHandler{
+		i:       i,
+		handler: newHandler(i, i.t.options.logger),
+		options: newWebOptions(opts),
+	}
+}
+
+type webHandler struct {
+	i       *Inbound
+	handler *handler
+	options *webOptions
+}
+
+func (h *webHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !h.handleCORS(w, req) {
+		return
+	}
+	if req.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("gRPC-Web requests must use %s", http.MethodPost), http.StatusMethodNotAllowed)
+		return
+	}
+	contentType := req.Header.Get(contentTypeHeader)
+	text, ok := parseWebContentType(contentType)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported content-type %q", contentType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	stream := newWebServerStream(w, req, text, h.i.t.options.serverMaxRecvMsgSize)
+	h.i.lock.RLock()
+	router := h.i.router
+	h.i.lock.RUnlock()
+	if router == nil {
+		stream.finish(toGRPCError(errRouterNotSet))
+		return
+	}
+
+	ctx := req.Context()
+	if timeout, ok := req.Header[http.CanonicalHeaderKey(grpcTimeoutHeader)]; ok && len(timeout) > 0 {
+		ttl, err := decodeGRPCTimeout(timeout[0])
+		if err != nil {
+			stream.finish(status.Errorf(codes.InvalidArgument, "malformed %s header: %v", grpcTimeoutHeader, err))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ttl)
+		defer cancel()
+	}
+	ctx = metadata.NewIncomingContext(ctx, webRequestMetadata(req.Header))
+	ctx = grpc.NewContextWithServerTransportStream(ctx, webTransportStream{stream})
+	stream.ctx = ctx
+
+	stream.finish(h.handler.handle(nil, stream))
+}
+
+// handleCORS writes CORS response headers and reports whether the request
+// should be processed further.
+func (h *webHandler) handleCORS(w http.ResponseWriter, req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" || isSameOrigin(origin, req.Host) {
+		return true
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if _, ok := h.options.allowedOrigins[strings.ToLower(origin)]; ok {
+		header.Set("Access-Control-Allow-Origin", origin)
+		if h.options.allowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	} else if h.options.allowAllOrigins {
+		// Browsers never send credentials to the wildcard origin.
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		http.Error(w, fmt.Sprintf("origin %q is not allowed", origin), http.StatusForbidden)
+		return false
+	}
+
+	if req.Method == http.MethodOptions {
+		header.Set("Access-Control-Allow-Methods", http.MethodPost)
+		header.Set("Access-Control-Allow-Headers", strings.Join(h.options.allowedHeaders, ", "))
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(h.options.corsMaxAge.Seconds())))
+	}
+	return true
+}
+
+func isSameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+// parseWebContentType reports whether the content type is a gRPC-Web content
+// type and whether it uses the base64 text framing.
+func parseWebContentType(contentType string) (text bool, ok bool) {
+	switch {
+	case strings.HasPrefix(contentType, webTextContentType):
+		return true, isContentTypeSuffix(contentType[len(webTextContentType):])
+	case strings.HasPrefix(contentType, webContentType):
+		return false, isContentTypeSuffix(contentType[len(webContentType):])
+	}
+	return false, false
+}
+
+func isContentTypeSuffix(suffix string) bool {
+	return suffix == "" || suffix[0] == '+' || suffix[0] == ';'
+}
+
+// webRequestMetadata converts HTTP headers of a gRPC-Web request into the
+// metadata that a gRPC request would carry.
+func webRequestMetadata(header http.Header) metadata.MD {
+	md := make(metadata.MD, len(header))
+	for key, values := range header {
+		key = strings.ToLower(key)
+		if _, ok := webIgnoredHeaders[key]; ok || strings.HasPrefix(key, "sec-") {
+			continue
+		}
+		converted := make([]string, len(values))
+		for i, value := range values {
+			switch {
+			case key == contentTypeHeader:
+				// Translate application/grpc-web(-text)+proto into
+				// application/grpc+proto so that the encoding is inferred the
+				// same way as for gRPC requests.
+				prefix := webContentType
+				if text, _ := parseWebContentType(value); text {
+					prefix = webTextContentType
+				}
+				value = baseContentType + strings.TrimPrefix(value, prefix)
+			case strings.HasSuffix(key, "-bin"):
+				if decoded, err := decodeBinHeader(value); err == nil {
+					value = string(decoded)
+				}
+			}
+			converted[i] = value
+		}
+		md[key] = converted
+	}
+	return md
+}
+
+func decodeBinHeader(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
+
+// decodeGRPCTimeout parses a grpc-timeout header value, for example "100m".
+func decodeGRPCTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 {
+		return 0, fmt.Errorf("timeout string is too short: %q", s)
+	}
+	var unit time.Duration
+	switch s[len(s)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, fmt.Errorf("timeout unit is not recognized: %q", s)
+	}
+	t, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t) * unit, nil
+}
+
+// webServerStream adapts a gRPC-Web HTTP request and response to a
+// grpc.ServerStream so that it can be served by the regular gRPC handler.
+type webServerStream struct {
+	ctx        context.Context
+	w          http.ResponseWriter
+	body       io.Reader
+	text       bool
+	maxRecvLen int
+
+	lock        sync.Mutex
+	method      string
+	contentType string
+	header      metadata.MD
+	trailer     metadata.MD
+	headersSent bool
+}
+
+var _ grpc.ServerStream = (*webServerStream)(nil)
+
+func newWebServerStream(w http.ResponseWriter, req *http.Request, text bool, maxRecvLen int) *webServerStream {
+	var body io.Reader = req.Body
+	if text {
+		body = newWebTextReader(req.Body)
+	}
+	return &webServerStream{
+		ctx:         req.Context(),
+		w:           w,
+		body:        body,
+		text:        text,
+		maxRecvLen:  maxRecvLen,
+		method:      req.URL.Path,
+		contentType: req.Header.Get(contentTypeHeader),
+	}
+}
+
+func (s *webServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *webServerStream) SetHeader(md metadata.MD) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.headersSent {
+		return status.Error(codes.Internal, "transport: the stream is done or WriteHeader was already called")
+	}
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *webServerStream) SendHeader(md metadata.MD) error {
+	if err := s.SetHeader(md); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writeHeaders()
+	return nil
+}
+
+func (s *webServerStream) SetTrailer(md metadata.MD) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *webServerStream) SendMsg(m interface{}) error {
+	data, err := customCodec{}.Marshal(m)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writeHeaders()
+	return s.writeFrame(0, data)
+}
+
+func (s *webServerStream) RecvMsg(m interface{}) error {
+	var frameHeader [webFrameHeaderLen]byte
+	if _, err := io.ReadFull(s.body, frameHeader[:]); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return status.Errorf(codes.Internal, "failed to read gRPC-Web frame: %v", err)
+	}
+	if frameHeader[0]&webFrameCompressedFlag != 0 {
+		return status.Error(codes.Unimplemented, "compressed gRPC-Web messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(frameHeader[1:])
+	if int64(length) > int64(s.maxRecvLen) {
+		return status.Errorf(codes.ResourceExhausted, "grpc: received message larger than max (%d vs. %d)", length, s.maxRecvLen)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(s.body, data); err != nil {
+		return status.Errorf(codes.Internal, "failed to read gRPC-Web frame: %v", err)
+	}
+	return customCodec{}.Unmarshal(data, m)
+}
+
+// finish writes the trailer frame with the status of the call.
+func (s *webServerStream) finish(err error) {
+	st := status.Convert(err)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.writeHeaders()
+	trailer := metadata.Join(s.trailer, metadata.Pairs(
+		grpcStatusHeader, strconv.Itoa(int(st.Code())),
+		grpcMessageHeader, encodeGRPCMessage(st.Message()),
+	))
+	if gogoStatus, ok := gogostatus.FromError(err); ok {
+		if details, err := marshalError(gogoStatus); err == nil && len(details) > 0 {
+			trailer.Set(grpcStatusDetailsHeader, string(details))
+		}
+	}
+
+	var buf bytes.Buffer
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			buf.WriteString(key)
+			buf.WriteString(": ")
+			buf.WriteString(encodeWebHeaderValue(key, value))
+			buf.WriteString("\r\n")
+		}
+	}
+	_ = s.writeFrame(webFrameTrailerFlag, buf.Bytes())
+}
+
+// writeHeaders writes the HTTP response headers if they were not yet
+// written. It must be called with the lock held.
+func (s *webServerStream) writeHeaders() {
+	if s.headersSent {
+		return
+	}
+	s.headersSent = true
+
+	header := s.w.Header()
+	header.Set(contentTypeHeader, s.contentType)
+	exposed := []string{grpcStatusHeader, grpcMessageHeader}
+	for key, values := range s.header {
+		for _, value := range values {
+			header.Add(key, encodeWebHeaderValue(key, value))
+		}
+		exposed = append(exposed, key)
+	}
+	if header.Get("Access-Control-Allow-Origin") != "" {
+		sort.Strings(exposed)
+		header.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+	}
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// writeFrame writes a single length-prefixed gRPC-Web frame. It must be
+// called with the lock held.
+func (s *webServerStream) writeFrame(flag byte, data []byte) error {
+	frame := make([]byte, webFrameHeaderLen+len(data))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	copy(frame[webFrameHeaderLen:], data)
+	if s.text {
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(frame)))
+		base64.StdEncoding.Encode(encoded, frame)
+		frame = encoded
+	}
+	if _, err := s.w.Write(frame); err != nil {
+		return status.Errorf(codes.Unavailable, "failed to write gRPC-Web frame: %v", err)
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func encodeWebHeaderValue(key, value string) string {
+	if strings.HasSuffix(key, "-bin") {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return value
+}
+
+// encodeGRPCMessage percent-encodes a status message as required by the
+// gRPC protocol.
+func encodeGRPCMessage(msg string) string {
+	var buf strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// webTransportStream exposes a webServerStream as a
+// grpc.ServerTransportStream, which is used to look up the method name.
+type webTransportStream struct {
+	s *webServerStream
+}
+
+var _ grpc.ServerTransportStream = webTransportStream{}
+
+func (t webTransportStream) Method() string                  { return t.s.method }
+func (t webTransportStream) SetHeader(md metadata.MD) error  { return t.s.SetHeader(md) }
+func (t webTransportStream) SendHeader(md metadata.MD) error { return t.s.SendHeader(md) }
+
+func (t webTransportStream) SetTrailer(md metadata.MD) error {
+	t.s.SetTrailer(md)
+	return nil
+}
+
+// webTextReader decodes the body of application/grpc-web-text requests.
+// Clients may send several independently padded base64 chunks, so the input
+// is decoded one 4-byte quantum at a time.
+type webTextReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newWebTextReader(r io.Reader) *webTextReader {
+	return &webTextReader{r: bufio.NewReader(r)}
+}
+
+func (r *webTextReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		var quantum [4]byte
+		n := 0
+		for n < len(quantum) {
+			c, err := r.r.ReadByte()
+			if err != nil {
+				if err == io.EOF && n > 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			if c == '\r' || c == '\n' || c == ' ' || c == '\t' {
+				continue
+			}
+			quantum[n] = c
+			n++
+		}
+		var decoded [3]byte
+		m, err := base64.StdEncoding.Decode(decoded[:], quantum[:])
+		if err != nil {
+			return 0, err
+		}
+		r.buf = decoded[:m]
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,313 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package grpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/prototest/example"
+	"go.uber.org/yarpc/internal/prototest/examplepb"
+)
+
+const (
+	_webKeyValueService = "/uber.yarpc.internal.examples.protobuf.example.KeyValue/"
+	_webFooService      = "/uber.yarpc.internal.examples.protobuf.example.Foo/"
+)
+
+func newWebTestServer(t *testing.T, opts ...WebOption) (*httptest.Server, func()) {
+	procedures := append(
+		examplepb.BuildKeyValueYARPCProcedures(example.NewKeyValueYARPCServer()),
+		examplepb.BuildFooYARPCProcedures(example.NewFooYARPCServer(transport.Headers{}))...,
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	trans := NewTransport()
+	inbound := trans.NewInbound(listener)
+	inbound.SetRouter(newTestRouter(procedures))
+	require.NoError(t, trans.Start())
+	require.NoError(t, inbound.Start())
+
+	server := httptest.NewServer(inbound.WebHandler(opts...))
+	return server, func() {
+		server.Close()
+		assert.NoError(t, inbound.Stop())
+		assert.NoError(t, trans.Stop())
+	}
+}
+
+func newWebRequest(t *testing.T, url string, text bool, msg proto.Message) *http.Request {
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	body := make([]byte, webFrameHeaderLen+len(data))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(data)))
+	copy(body[webFrameHeaderLen:], data)
+
+	contentType := "application/grpc-web+proto"
+	if text {
+		contentType = "application/grpc-web-text+proto"
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Grpc-Web", "1")
+	req.Header.Set(grpcTimeoutHeader, "1S")
+	req.Header.Set(CallerHeader, "web-client")
+	req.Header.Set(ServiceHeader, "example")
+	return req
+}
+
+type webResponse struct {
+	messages [][]byte
+	trailer  map[string]string
+}
+
+func readWebResponse(t *testing.T, res *http.Response, text bool) webResponse {
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var body io.Reader = res.Body
+	if text {
+		body = newWebTextReader(res.Body)
+	}
+	var result webResponse
+	for {
+		var header [webFrameHeaderLen]byte
+		_, err := io.ReadFull(body, header[:])
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		_, err = io.ReadFull(body, data)
+		require.NoError(t, err)
+		if header[0]&webFrameTrailerFlag == 0 {
+			result.messages = append(result.messages, data)
+			continue
+		}
+		result.trailer = make(map[string]string)
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\r\n") {
+			kv := strings.SplitN(line, ": ", 2)
+			require.Len(t, kv, 2)
+			result.trailer[kv[0]] = kv[1]
+		}
+	}
+	return result
+}
+
+func TestWebUnary(t *testing.T) {
+	server, closeServer := newWebTestServer(t)
+	defer closeServer()
+	for _, text := range []bool{false, true} {
+		res, err := http.DefaultClient.Do(newWebRequest(t, server.URL+_webKeyValueService+"SetValue", text, &examplepb.SetValueRequest{Key: "foo", Value: "bar"}))
+		require.NoError(t, err)
+		assert.Equal(t, "0", readWebResponse(t, res, text).trailer[grpcStatusHeader])
+
+		res, err = http.DefaultClient.Do(newWebRequest(t, server.URL+_webKeyValueService+"GetValue", text, &examplepb.GetValueRequest{Key: "foo"}))
+		require.NoError(t, err)
+		if text {
+			assert.Equal(t, "application/grpc-web-text+proto", res.Header.Get("Content-Type"))
+		} else {
+			assert.Equal(t, "application/grpc-web+proto", res.Header.Get("Content-Type"))
+		}
+		webRes := readWebResponse(t, res, text)
+		assert.Equal(t, "0", webRes.trailer[grpcStatusHeader])
+		require.Len(t, webRes.messages, 1)
+		var getValue examplepb.GetValueResponse
+		require.NoError(t, proto.Unmarshal(webRes.messages[0], &getValue))
+		assert.Equal(t, "bar", getValue.Value)
+	}
+}
+
+func TestWebUnaryError(t *testing.T) {
+	server, closeServer := newWebTestServer(t)
+	defer closeServer()
+	res, err := http.DefaultClient.Do(newWebRequest(t, server.URL+_webKeyValueService+"GetValue", false, &examplepb.GetValueRequest{Key: "missing"}))
+	require.NoError(t, err)
+	trailer := readWebResponse(t, res, false).trailer
+	assert.Equal(t, "5", trailer[grpcStatusHeader]) // codes.NotFound
+	assert.Equal(t, "missing", trailer[grpcMessageHeader])
+}
+
+func TestWebUnknownProcedure(t *testing.T) {
+	server, closeServer := newWebTestServer(t)
+	defer closeServer()
+	res, err := http.DefaultClient.Do(newWebRequest(t, server.URL+_webKeyValueService+"Unknown", false, &examplepb.GetValueRequest{Key: "foo"}))
+	require.NoError(t, err)
+	trailer := readWebResponse(t, res, false).trailer
+	assert.Equal(t, "12", trailer[grpcStatusHeader]) // codes.Unimplemented
+}
+
+func TestWebServerStreaming(t *testing.T) {
+	server, closeServer := newWebTestServer(t)
+	defer closeServer()
+	for _, text := range []bool{false, true} {
+		res, err := http.DefaultClient.Do(newWebRequest(t, server.URL+_webFooService+"EchoIn", text, &examplepb.EchoInRequest{Message: "hello", NumResponses: 3}))
+		require.NoError(t, err)
+		webRes := readWebResponse(t, res, text)
+		assert.Equal(t, "0", webRes.trailer[grpcStatusHeader])
+		require.Len(t, webRes.messages, 3)
+		for _, msg := range webRes.messages {
+			var echo examplepb.EchoInResponse
+			require.NoError(t, proto.Unmarshal(msg, &echo))
+			assert.Equal(t, "hello", echo.Message)
+		}
+	}
+}
+
+func TestWebBadRequests(t *testing.T) {
+	server, closeServer := newWebTestServer(t)
+	defer closeServer()
+
+	res, err := http.Get(server.URL + _webKeyValueService + "GetValue")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	res, err = http.Post(server.URL+_webKeyValueService+"GetValue", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+	req := newWebRequest(t, server.URL+_webKeyValueService+"GetValue", false, &examplepb.GetValueRequest{Key: "foo"})
+	req.Header.Set(grpcTimeoutHeader, "1X")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "3", readWebResponse(t, res, false).trailer[grpcStatusHeader]) // codes.InvalidArgument
+}
+
+// webPreflight sends a CORS preflight request from the origin.
+func webPreflight(t *testing.T, url, origin string) *http.Response {
+	req, err := http.NewRequest(http.MethodOptions, url+_webKeyValueService+"GetValue", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-evil")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	return res
+}
+
+func TestWebCORS(t *testing.T) {
+	server, closeServer := newWebTestServer(t,
+		WebAllowedOrigins("https://tools.example.com"),
+		WebAllowedHeaders("X-Tenant"),
+		WebCORSMaxAge(time.Minute))
+	defer closeServer()
+
+	res := webPreflight(t, server.URL, "https://tools.example.com")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "https://tools.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, http.MethodPost, res.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t,
+		"content-type, x-grpc-web, x-user-agent, grpc-timeout, rpc-caller, rpc-service, rpc-encoding, "+
+			"rpc-shard-key, rpc-routing-key, rpc-routing-delegate, rpc-criticality, x-tenant",
+		res.Header.Get("Access-Control-Allow-Headers"),
+		"requested headers must not be echoed")
+	assert.Equal(t, "60", res.Header.Get("Access-Control-Max-Age"))
+
+	res = webPreflight(t, server.URL, "https://evil.example.com")
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Origin"))
+
+	req := newWebRequest(t, server.URL+_webKeyValueService+"SetValue", false, &examplepb.SetValueRequest{Key: "foo", Value: "bar"})
+	req.Header.Set("Origin", "https://tools.example.com")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "https://tools.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, res.Header.Get("Access-Control-Expose-Headers"), grpcStatusHeader)
+	assert.Equal(t, "0", readWebResponse(t, res, false).trailer[grpcStatusHeader])
+}
+
+func TestWebTextReaderConcatenatedChunks(t *testing.T) {
+	input := base64.StdEncoding.EncodeToString([]byte("ab")) + "\r\n" + base64.StdEncoding.EncodeToString([]byte("cde"))
+	out, err := ioutil.ReadAll(newWebTextReader(strings.NewReader(input)))
+	require.NoError(t, err)
+	assert.Equal(t, "abcde", string(out))
+
+	_, err = ioutil.ReadAll(newWebTextReader(strings.NewReader("YWJ")))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestDecodeGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		give    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{give: "1H", want: time.Hour},
+		{give: "2M", want: 2 * time.Minute},
+		{give: "3S", want: 3 * time.Second},
+		{give: "4m", want: 4 * time.Millisecond},
+		{give: "5u", want: 5 * time.Microsecond},
+		{give: "6n", want: 6 * time.Nanosecond},
+		{give: "1", wantErr: true},
+		{give: "1X", wantErr: true},
+		{give: "aS", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.give, func(t *testing.T) {
+			got, err := decodeGRPCTimeout(tt.give)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWebCORSCredentials(t *testing.T) {
+	server, closeServer := newWebTestServer(t,
+		WebAllowedOrigins("https://tools.example.com", "*"),
+		WebAllowCredentials())
+	defer closeServer()
+
+	res := webPreflight(t, server.URL, "https://tools.example.com")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "https://tools.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", res.Header.Get("Access-Control-Allow-Credentials"))
+
+	res = webPreflight(t, server.URL, "https://other.example.com")
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Equal(t, "*", res.Header.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, res.Header.Get("Access-Control-Allow-Credentials"),
+		"credentials must never be allowed for the wildcard origin")
+}
@@ -26,6 +26,7 @@ import (
 
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/peer/hostport"
+	"go.uber.org/yarpc/transport/portmux"
 	"go.uber.org/yarpc/yarpcconfig"
 )
 
@@ -159,9 +160,23 @@ func (ts *transportSpec) buildTransport(tc *TransportConfig, k *yarpcconfig.Kit)
 //        - x-foo
 //        - x-bar
 //      shutdownTimeout: 5s
+//
+// An HTTP inbound can share its port with a gRPC inbound configured with the
+// same address. Connections are routed to the HTTP or gRPC inbound depending
+// on their protocol.
+//
+//  inbounds:
+//    http:
+//      address: ":80"
+//      shareAddress: true
+//    grpc:
+//      address: ":80"
+//      shareAddress: true
 type InboundConfig struct {
 	// Address to listen on. This field is required.
 	Address string `config:"address,interpolate"`
+	// ShareAddress allows a gRPC inbound to listen on the same address.
+	ShareAddress bool `config:"shareAddress"`
 	// The additional headers, starting with x, that should be
 	// propagated to handlers. This field is optional.
 	GrabHeaders []string `config:"grabHeaders"`
@@ -185,6 +200,14 @@ func (ts *transportSpec) buildInbound(ic *InboundConfig, t transport.Transport,
 		inboundOptions = append(inboundOptions, ShutdownTimeout(*ic.ShutdownTimeout))
 	}
 
+	if ic.ShareAddress {
+		listener, err := portmux.Shared(ic.Address)
+		if err != nil {
+			return nil, err
+		}
+		inboundOptions = append(inboundOptions, Listener(listener.HTTP()))
+	}
+
 	return t.(*Transport).NewInbound(ic.Address, inboundOptions...), nil
 }
 
@@ -69,6 +69,14 @@ const (
 	// Request.RoutingDelegate attribute.
 	RoutingDelegateHeader = "Rpc-Routing-Delegate"
 
+	// How important it is that the request is served under overload. This
+	// corresponds to the Request.Criticality attribute.
+	CriticalityHeader = "Rpc-Criticality"
+
+	// Prefix of the headers carrying the baggage of the request, one per
+	// item. The rest of the header name is the baggage key.
+	BaggageHeaderPrefix = "Rpc-Baggage-"
+
 	// Whether the response body contains an application error.
 	ApplicationStatusHeader = "Rpc-Status"
 
@@ -23,6 +23,7 @@ package http
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -33,8 +34,10 @@ import (
 	opentracinglog "github.com/opentracing/opentracing-go/log"
 	"go.uber.org/yarpc"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/internal/bufferpool"
 	"go.uber.org/yarpc/internal/iopool"
+	"go.uber.org/yarpc/internal/tlsinfo"
 	"go.uber.org/yarpc/pkg/errors"
 	"go.uber.org/yarpc/yarpcerrors"
 	"go.uber.org/zap"
@@ -112,10 +115,12 @@ func (h handler) callHandler(responseWriter *responseWriter, req *http.Request,
 		ShardKey:        popHeader(req.Header, ShardKeyHeader),
 		RoutingKey:      popHeader(req.Header, RoutingKeyHeader),
 		RoutingDelegate: popHeader(req.Header, RoutingDelegateHeader),
+		Criticality:     transport.Criticality(popHeader(req.Header, CriticalityHeader)),
 		Headers:         applicationHeaders.FromHTTPHeaders(req.Header, transport.Headers{}),
 		Body:            req.Body,
 		BodySize:        int(req.ContentLength),
 	}
+	treq.Headers = fromTraceContextHeaders(req.Header, treq.Headers)
 	for header := range h.grabHeaders {
 		if value := req.Header.Get(header); value != "" {
 			treq.Headers = treq.Headers.With(header, value)
@@ -132,7 +137,10 @@ func (h handler) callHandler(responseWriter *responseWriter, req *http.Request,
 		}
 	}()
 
-	ctx := req.Context()
+	ctx := fromBaggageHeaders(req.Context(), req.Header)
+	if req.TLS != nil {
+		ctx = tlsinfo.WithConnectionState(ctx, *req.TLS)
+	}
 	ctx, cancel, parseTTLErr := parseTTL(ctx, treq, popHeader(req.Header, TTLMSHeader))
 	// parseTTLErr != nil is a problem only if the request is unary.
 	defer cancel()
@@ -164,7 +172,7 @@ func (h handler) callHandler(responseWriter *responseWriter, req *http.Request,
 		})
 
 	case transport.Oneway:
-		err = handleOnewayRequest(span, treq, spec.Oneway(), h.logger)
+		err = handleOnewayRequest(ctx, span, req.TLS, treq, spec.Oneway(), h.logger)
 
 	default:
 		err = yarpcerrors.Newf(yarpcerrors.CodeUnimplemented, "transport http does not handle %s handlers", spec.Type().String())
@@ -175,7 +183,9 @@ func (h handler) callHandler(responseWriter *responseWriter, req *http.Request,
 }
 
 func handleOnewayRequest(
+	reqCtx context.Context,
 	span opentracing.Span,
+	tlsState *tls.ConnectionState,
 	treq *transport.Request,
 	onewayHandler transport.OnewayHandler,
 	logger *zap.Logger,
@@ -191,6 +201,10 @@ func handleOnewayRequest(
 	// create a new context for oneway requests since the HTTP handler cancels
 	// http.Request's context when ServeHTTP returns
 	ctx := opentracing.ContextWithSpan(context.Background(), span)
+	ctx = baggage.WithItems(ctx, baggage.FromContext(reqCtx))
+	if tlsState != nil {
+		ctx = tlsinfo.WithConnectionState(ctx, *tlsState)
+	}
 
 	go func() {
 		// ensure the span lasts for length of the handler in case of errors
@@ -21,10 +21,12 @@
 package http
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 )
 
 // headerConverter converts HTTP headers to and from transport headers.
@@ -67,3 +69,60 @@ func (hm headerMapper) FromHTTPHeaders(from http.Header, to transport.Headers) t
 	}
 	return to
 }
+
+// traceContextHeaders lists the W3C Trace Context headers. These are sent
+// without the application header prefix so that HTTP services and proxies
+// which understand Trace Context can take part in the same trace.
+var traceContextHeaders = []string{"traceparent", "tracestate"}
+
+// toTraceContextHeaders moves Trace Context headers found in 'from' out of
+// the application header namespace in 'to'.
+func toTraceContextHeaders(from transport.Headers, to http.Header) {
+	for _, k := range traceContextHeaders {
+		if v, ok := from.Get(k); ok {
+			to.Del(ApplicationHeaderPrefix + k)
+			to.Set(k, v)
+		}
+	}
+}
+
+// fromTraceContextHeaders copies unprefixed Trace Context headers into the
+// application headers, unless they were also sent as application headers.
+func fromTraceContextHeaders(from http.Header, to transport.Headers) transport.Headers {
+	for _, k := range traceContextHeaders {
+		if _, ok := to.Get(k); ok {
+			continue
+		}
+		if v := from.Get(k); v != "" {
+			to = to.With(k, v)
+		}
+	}
+	return to
+}
+
+// toBaggageHeaders adds the baggage carried by the context to the HTTP
+// headers.
+func toBaggageHeaders(ctx context.Context, to http.Header) {
+	baggage.Range(ctx, func(k, v string) {
+		to.Set(BaggageHeaderPrefix+k, v)
+	})
+}
+
+// fromBaggageHeaders returns a copy of the context carrying the baggage sent
+// in the HTTP headers.
+func fromBaggageHeaders(ctx context.Context, from http.Header) context.Context {
+	var items map[string]string
+	for k := range from {
+		if !strings.HasPrefix(k, BaggageHeaderPrefix) {
+			continue
+		}
+		if items == nil {
+			items = make(map[string]string)
+		}
+		items[baggage.CanonicalizeKey(k[len(BaggageHeaderPrefix):])] = from.Get(k)
+	}
+	if items == nil {
+		return ctx
+	}
+	return baggage.WithItems(ctx, items)
+}
@@ -21,11 +21,13 @@
 package http
 
 import (
+	"context"
 	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 )
 
 func TestHTTPHeaders(t *testing.T) {
@@ -59,5 +61,65 @@ func TestHTTPHeaders(t *testing.T) {
 	}
 }
 
+func TestTraceContextHeaders(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	t.Run("outbound", func(t *testing.T) {
+		headers := transport.NewHeaders().
+			With("traceparent", traceparent).
+			With("foo", "bar")
+		h := applicationHeaders.ToHTTPHeaders(headers, nil)
+		toTraceContextHeaders(headers, h)
+
+		assert.Equal(t, http.Header{
+			"Traceparent":    []string{traceparent},
+			"Rpc-Header-Foo": []string{"bar"},
+		}, h)
+	})
+
+	t.Run("inbound", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Traceparent", traceparent)
+		h.Set("Tracestate", "rojo=00f067aa0ba902b7")
+
+		headers := fromTraceContextHeaders(h, transport.Headers{})
+		assert.Equal(t, map[string]string{
+			"traceparent": traceparent,
+			"tracestate":  "rojo=00f067aa0ba902b7",
+		}, headers.Items())
+	})
+
+	t.Run("inbound application header wins", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Traceparent", traceparent)
+
+		headers := fromTraceContextHeaders(h, transport.NewHeaders().With("traceparent", "foo"))
+		assert.Equal(t, map[string]string{"traceparent": "foo"}, headers.Items())
+	})
+}
+
+func TestBaggageHeaders(t *testing.T) {
+	t.Run("outbound", func(t *testing.T) {
+		ctx := baggage.WithBaggage(context.Background(), "tenant", "acme")
+		h := http.Header{}
+		toBaggageHeaders(ctx, h)
+		assert.Equal(t, http.Header{"Rpc-Baggage-Tenant": []string{"acme"}}, h)
+	})
+
+	t.Run("inbound", func(t *testing.T) {
+		h := http.Header{}
+		h.Set("Rpc-Baggage-Tenant", "acme")
+		h.Set("Rpc-Header-Foo", "bar")
+
+		ctx := fromBaggageHeaders(context.Background(), h)
+		assert.Equal(t, map[string]string{"tenant": "acme"}, baggage.FromContext(ctx))
+	})
+
+	t.Run("inbound without baggage", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Equal(t, ctx, fromBaggageHeaders(ctx, http.Header{"Rpc-Header-Foo": []string{"bar"}}))
+	})
+}
+
 // TODO(abg): Test handling of duplicate HTTP headers when
 // https://github.com/yarpc/yarpc/issues/21 is resolved.
@@ -101,6 +101,18 @@ func ShutdownTimeout(timeout time.Duration) InboundOption {
 	}
 }
 
+// Listener specifies a listener that the inbound accepts connections from,
+// instead of listening on its address. The inbound takes ownership of the
+// listener.
+//
+// This may be used with portmux to serve HTTP and gRPC inbounds on the same
+// port.
+func Listener(listener net.Listener) InboundOption {
+	return func(i *Inbound) {
+		i.listener = listener
+	}
+}
+
 // NewInbound builds a new HTTP inbound that listens on the given address and
 // sharing this transport.
 func (t *Transport) NewInbound(addr string, opts ...InboundOption) *Inbound {
@@ -124,6 +136,7 @@ func (t *Transport) NewInbound(addr string, opts ...InboundOption) *Inbound {
 // using the NewInbound method on the Transport.
 type Inbound struct {
 	addr            string
+	listener        net.Listener
 	mux             *http.ServeMux
 	muxPattern      string
 	server          *intnet.HTTPServer
@@ -134,6 +147,8 @@ type Inbound struct {
 	transport       *Transport
 	grabHeaders     map[string]struct{}
 	interceptor     func(http.Handler) http.Handler
+	restRoutes      []transport.RESTRoute
+	handlers        []patternHandler
 
 	once *lifecycle.Once
 
@@ -147,6 +162,22 @@ func (i *Inbound) Tracer(tracer opentracing.Tracer) *Inbound {
 	return i
 }
 
+// Handle serves the given non-YARPC handler under the given pattern of the
+// HTTP server, alongside YARPC requests, as with http.ServeMux. If the
+// inbound was given a ServeMux with the Mux option, the handler is
+// registered on it. Handlers must be registered before the inbound starts.
+//
+// This may be used to serve metrics or debug pages on the port of an
+// inbound.
+func (i *Inbound) Handle(pattern string, handler http.Handler) {
+	i.handlers = append(i.handlers, patternHandler{pattern: pattern, handler: handler})
+}
+
+type patternHandler struct {
+	pattern string
+	handler http.Handler
+}
+
 // SetRouter configures a router to handle incoming requests.
 // This satisfies the transport.Inbound interface, and would be called
 // by a dispatcher when it starts.
@@ -175,13 +206,21 @@ func (i *Inbound) start() error {
 		}
 	}
 
-	var httpHandler http.Handler = handler{
+	yarpcHandler := handler{
 		router:            i.router,
 		tracer:            i.tracer,
 		grabHeaders:       i.grabHeaders,
 		bothResponseError: i.bothResponseError,
 		logger:            i.logger,
 	}
+	var httpHandler http.Handler = yarpcHandler
+	if len(i.restRoutes) > 0 {
+		restHandler, err := newRESTHandler(yarpcHandler, i.restRoutes, httpHandler)
+		if err != nil {
+			return yarpcerrors.Newf(yarpcerrors.CodeInvalidArgument, "%v", err)
+		}
+		httpHandler = restHandler
+	}
 	if i.interceptor != nil {
 		httpHandler = i.interceptor(httpHandler)
 	}
@@ -189,12 +228,33 @@ func (i *Inbound) start() error {
 		i.mux.Handle(i.muxPattern, httpHandler)
 		httpHandler = i.mux
 	}
+	if len(i.handlers) > 0 {
+		mux := i.mux
+		if mux == nil {
+			mux = http.NewServeMux()
+			mux.Handle("/", httpHandler)
+			httpHandler = mux
+		}
+		for _, h := range i.handlers {
+			mux.Handle(h.pattern, h.handler)
+		}
+	}
 
 	i.server = intnet.NewHTTPServer(&http.Server{
 		Addr:    i.addr,
 		Handler: httpHandler,
 	})
-	if err := i.server.ListenAndServe(); err != nil {
+	if i.listener != nil {
+		// Listeners shared through portmux bind their address once used.
+		if l, ok := i.listener.(interface{ Listen() error }); ok {
+			if err := l.Listen(); err != nil {
+				return err
+			}
+		}
+		if err := i.server.Serve(i.listener); err != nil {
+			return err
+		}
+	} else if err := i.server.ListenAndServe(); err != nil {
 		return err
 	}
 
@@ -114,6 +114,68 @@ func TestInboundStopWithoutStarting(t *testing.T) {
 	assert.NoError(t, i.Stop())
 }
 
+func TestInboundHandle(t *testing.T) {
+	health := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("healthy"))
+	})
+
+	tests := []struct {
+		desc string
+		opts []InboundOption
+	}{
+		{desc: "without mux"},
+		{desc: "with mux", opts: []InboundOption{Mux("/", http.NewServeMux())}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			httpTransport := NewTransport()
+			i := httpTransport.NewInbound("127.0.0.1:0", tt.opts...)
+			i.Handle("/health", health)
+
+			h := transporttest.NewMockUnaryHandler(mockCtrl)
+			reg := transporttest.NewMockRouter(mockCtrl)
+			reg.EXPECT().Procedures()
+			reg.EXPECT().Choose(gomock.Any(), routertest.NewMatcher().
+				WithService("bar").
+				WithProcedure("hello"),
+			).Return(transport.NewUnaryHandlerSpec(h), nil)
+			h.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+			i.SetRouter(reg)
+			require.NoError(t, i.Start())
+			defer i.Stop()
+
+			addr := fmt.Sprintf("http://%v/", yarpctest.ZeroAddrToHostPort(i.Addr()))
+			resp, err := http.Get(addr + "health")
+			require.NoError(t, err, "/health failed")
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err, "/health body read error")
+			assert.Equal(t, "healthy", string(body), "/health body mismatch")
+
+			o := httpTransport.NewSingleOutbound(addr)
+			require.NoError(t, o.Start(), "failed to start outbound")
+			defer o.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), testtime.Second)
+			defer cancel()
+			res, err := o.Call(ctx, &transport.Request{
+				Caller:    "foo",
+				Service:   "bar",
+				Procedure: "hello",
+				Encoding:  raw.Encoding,
+				Body:      bytes.NewReader([]byte("derp")),
+			})
+			require.NoError(t, err, "expected YARPC requests to be served")
+			require.NoError(t, res.Body.Close())
+		})
+	}
+}
+
 func TestInboundMux(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -247,6 +247,8 @@ func (o *Outbound) call(ctx context.Context, treq *transport.Request) (*transpor
 		return nil, err
 	}
 	hreq.Header = applicationHeaders.ToHTTPHeaders(treq.Headers, nil)
+	toTraceContextHeaders(treq.Headers, hreq.Header)
+	toBaggageHeaders(ctx, hreq.Header)
 	ctx, hreq, span, err := o.withOpentracingSpan(ctx, hreq, treq, start)
 	if err != nil {
 		return nil, err
@@ -392,6 +394,9 @@ func (o *Outbound) withCoreHeaders(req *http.Request, treq *transport.Request, t
 	if treq.RoutingDelegate != "" {
 		req.Header.Set(RoutingDelegateHeader, treq.RoutingDelegate)
 	}
+	if treq.Criticality != "" {
+		req.Header.Set(CriticalityHeader, string(treq.Criticality))
+	}
 
 	encoding := string(treq.Encoding)
 	if encoding != "" {
@@ -513,8 +518,10 @@ func (o *Outbound) roundTrip(hreq *http.Request, treq *transport.Request, start
 			ShardKey:        hreq.Header.Get(ShardKeyHeader),
 			RoutingKey:      hreq.Header.Get(RoutingKeyHeader),
 			RoutingDelegate: hreq.Header.Get(RoutingDelegateHeader),
+			Criticality:     transport.Criticality(hreq.Header.Get(CriticalityHeader)),
 			Headers:         applicationHeaders.FromHTTPHeaders(hreq.Header, transport.Headers{}),
 		}
+		treq.Headers = fromTraceContextHeaders(hreq.Header, treq.Headers)
 	}
 
 	if err := o.once.WaitUntilRunning(ctx); err != nil {
@@ -456,12 +456,14 @@ func TestWithCoreHeaders(t *testing.T) {
 		ShardKey:        shardKey,
 		RoutingKey:      routingKey,
 		RoutingDelegate: routingDelegate,
+		Criticality:     transport.CriticalitySheddable,
 	}
 	result := out.withCoreHeaders(httpReq, treq, time.Second)
 
 	assert.Equal(t, shardKey, result.Header.Get(ShardKeyHeader))
 	assert.Equal(t, routingKey, result.Header.Get(RoutingKeyHeader))
 	assert.Equal(t, routingDelegate, result.Header.Get(RoutingDelegateHeader))
+	assert.Equal(t, "sheddable", result.Header.Get(CriticalityHeader))
 }
 
 func TestNoRequest(t *testing.T) {
@@ -0,0 +1,515 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+const (
+	// _defaultRESTCaller is the caller name used for RESTful requests that
+	// do not carry a Rpc-Caller header.
+	_defaultRESTCaller = "rest"
+
+	// _defaultRESTTTL is the timeout of RESTful requests that do not carry a
+	// Context-TTL-MS header.
+	_defaultRESTTTL = 10 * time.Second
+)
+
+// RESTRoutes specifies RESTful routes that the inbound serves in addition to
+// YARPC requests. RESTRoutes are typically generated from google.api.http
+// annotations by protoc-gen-yarpc-go:
+//
+//  inbound := httpTransport.NewInbound(":8080",
+//    http.RESTRoutes(examplepb.BuildKeyValueYARPCRESTRoutes()...))
+//
+// An HTTP request that matches the method and path template of a route, and
+// does not carry a Rpc-Procedure header, is translated into a call to the
+// route's procedure. Routes are matched in the order they were given.
+//
+// Rpc-Caller, Rpc-Service, Context-TTL-MS and application headers are honored
+// when present. Otherwise, the caller defaults to "rest", the service is
+// inferred from the registered procedures, and the timeout defaults to 10
+// seconds. As with other google.api.http bindings, errors, including
+// application errors, are returned as a JSON google.rpc.Status with the
+// numeric "code", "message" and "details" of the error, and an HTTP status
+// code matching the error code.
+func RESTRoutes(routes ...transport.RESTRoute) InboundOption {
+	return func(i *Inbound) {
+		i.restRoutes = append(i.restRoutes, routes...)
+	}
+}
+
+// restHandler serves RESTful routes, delegating all other requests to the
+// YARPC handler.
+type restHandler struct {
+	handler
+
+	routes []*restRoute
+	next   http.Handler
+}
+
+type restRoute struct {
+	transport.RESTRoute
+
+	service  string
+	template *pathTemplate
+}
+
+func newRESTHandler(h handler, routes []transport.RESTRoute, next http.Handler) (*restHandler, error) {
+	type procedureKey struct {
+		name     string
+		encoding transport.Encoding
+	}
+	services := make(map[procedureKey]string)
+	for _, p := range h.router.Procedures() {
+		services[procedureKey{p.Name, p.Encoding}] = p.Service
+	}
+
+	restRoutes := make([]*restRoute, 0, len(routes))
+	for _, r := range routes {
+		template, err := parsePathTemplate(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RESTful route %s %q for procedure %q: %v", r.Method, r.Pattern, r.Procedure, err)
+		}
+		restRoutes = append(restRoutes, &restRoute{
+			RESTRoute: r,
+			service:   services[procedureKey{r.Procedure, r.Encoding}],
+			template:  template,
+		})
+	}
+	return &restHandler{handler: h, routes: restRoutes, next: next}, nil
+}
+
+func (h *restHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get(ProcedureHeader) == "" {
+		for _, route := range h.routes {
+			if route.Method != req.Method {
+				continue
+			}
+			if vars, ok := route.template.match(req.URL.EscapedPath()); ok {
+				h.serveRoute(w, req, route, vars)
+				return
+			}
+		}
+	}
+	h.next.ServeHTTP(w, req)
+}
+
+func (h *restHandler) serveRoute(w http.ResponseWriter, req *http.Request, route *restRoute, vars map[string]string) {
+	rw := &restResponseWriter{w: w}
+	if err := h.callRoute(rw, req, route, vars); err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	body := rw.buffer.Bytes()
+	if route.BuildResponseBody != nil {
+		var err error
+		if body, err = route.BuildResponseBody(body); err != nil {
+			writeRESTError(w, err)
+			return
+		}
+	}
+	if contentType := getContentType(route.Encoding); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+func (h *restHandler) callRoute(rw *restResponseWriter, req *http.Request, route *restRoute, vars map[string]string) error {
+	start := time.Now()
+	defer req.Body.Close()
+
+	httpBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return yarpcerrors.InvalidArgumentErrorf("failed to read request body: %v", err)
+	}
+	body, err := route.BuildRequestBody(vars, req.URL.Query(), httpBody)
+	if err != nil {
+		return err
+	}
+
+	treq := &transport.Request{
+		Caller:          popHeader(req.Header, CallerHeader),
+		Service:         popHeader(req.Header, ServiceHeader),
+		Procedure:       route.Procedure,
+		Encoding:        route.Encoding,
+		Transport:       TransportName,
+		ShardKey:        popHeader(req.Header, ShardKeyHeader),
+		RoutingKey:      popHeader(req.Header, RoutingKeyHeader),
+		RoutingDelegate: popHeader(req.Header, RoutingDelegateHeader),
+		Criticality:     transport.Criticality(popHeader(req.Header, CriticalityHeader)),
+		Headers:         applicationHeaders.FromHTTPHeaders(req.Header, transport.Headers{}),
+		Body:            bytes.NewReader(body),
+		BodySize:        len(body),
+	}
+	if treq.Caller == "" {
+		treq.Caller = _defaultRESTCaller
+	}
+	if treq.Service == "" {
+		treq.Service = route.service
+	}
+	treq.Headers = fromTraceContextHeaders(req.Header, treq.Headers)
+	for header := range h.grabHeaders {
+		if value := req.Header.Get(header); value != "" {
+			treq.Headers = treq.Headers.With(header, value)
+		}
+	}
+	if err := transport.ValidateRequest(treq); err != nil {
+		return err
+	}
+
+	ttl := popHeader(req.Header, TTLMSHeader)
+	if ttl == "" {
+		ttl = strconv.FormatInt(int64(_defaultRESTTTL/time.Millisecond), 10)
+	}
+	ctx, cancel, err := parseTTL(fromBaggageHeaders(req.Context(), req.Header), treq, ttl)
+	defer cancel()
+	if err != nil {
+		return err
+	}
+	ctx, span := h.createSpan(ctx, req, treq, start)
+	defer span.Finish()
+
+	spec, err := h.router.Choose(ctx, treq)
+	if err != nil {
+		updateSpanWithErr(span, err)
+		return err
+	}
+	if spec.Type() != transport.Unary {
+		err = yarpcerrors.Newf(yarpcerrors.CodeUnimplemented, "RESTful routes do not support %s handlers", spec.Type().String())
+		updateSpanWithErr(span, err)
+		return err
+	}
+	err = transport.InvokeUnaryHandler(transport.UnaryInvokeRequest{
+		Context:        ctx,
+		StartTime:      start,
+		Request:        treq,
+		Handler:        spec.Unary(),
+		ResponseWriter: rw,
+		Logger:         h.logger,
+	})
+	if err == nil && rw.isApplicationError {
+		err = rw.applicationError()
+	}
+	updateSpanWithErr(span, err)
+	return err
+}
+
+// restError is the JSON form of a google.rpc.Status.
+type restError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+func writeRESTError(w http.ResponseWriter, err error) {
+	status := yarpcerrors.FromError(err)
+	code := status.Code()
+	httpStatusCode, ok := _codeToStatusCode[code]
+	if !ok {
+		code = yarpcerrors.CodeInternal
+		httpStatusCode = http.StatusInternalServerError
+	}
+	body, _ := json.Marshal(restError{
+		Code:    int(code),
+		Message: status.Message(),
+		Details: restErrorDetails(status.Details()),
+	})
+	w.Header().Set(ErrorCodeHeader, code.String())
+	if name := status.Name(); name != "" {
+		w.Header().Set(ErrorNameHeader, name)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusCode)
+	_, _ = w.Write(body)
+}
+
+// restErrorDetails returns the details of a google.rpc.Status in the details
+// of an error, as set by the protobuf encoding of RESTful routes.
+func restErrorDetails(details []byte) json.RawMessage {
+	if len(details) == 0 {
+		return nil
+	}
+	var status struct {
+		Details json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal(details, &status); err != nil {
+		return nil
+	}
+	return status.Details
+}
+
+// restResponseWriter buffers the response of a RESTful route so that it can
+// be transformed before it is written.
+type restResponseWriter struct {
+	w                    http.ResponseWriter
+	buffer               bytes.Buffer
+	isApplicationError   bool
+	applicationErrorMeta *transport.ApplicationErrorMeta
+}
+
+var (
+	_ transport.ResponseWriter             = (*restResponseWriter)(nil)
+	_ transport.ApplicationErrorMetaSetter = (*restResponseWriter)(nil)
+)
+
+func (rw *restResponseWriter) Write(s []byte) (int, error) {
+	return rw.buffer.Write(s)
+}
+
+func (rw *restResponseWriter) AddHeaders(h transport.Headers) {
+	applicationHeaders.ToHTTPHeaders(h, rw.w.Header())
+}
+
+func (rw *restResponseWriter) SetApplicationError() {
+	rw.isApplicationError = true
+}
+
+func (rw *restResponseWriter) SetApplicationErrorMeta(meta *transport.ApplicationErrorMeta) {
+	rw.applicationErrorMeta = meta
+}
+
+// applicationError returns the error for an application error that the
+// handler wrote to the response instead of returning it, with the code and
+// name of its metadata, if any.
+func (rw *restResponseWriter) applicationError() error {
+	code := yarpcerrors.CodeUnknown
+	name, message := "", "application error"
+	if meta := rw.applicationErrorMeta; meta != nil {
+		if meta.Code != nil {
+			code = *meta.Code
+		}
+		name = meta.Name
+		if meta.Details != "" {
+			message = meta.Details
+		}
+	}
+	return yarpcerrors.Newf(code, "%s", message).WithName(name)
+}
+
+// pathTemplate is a compiled google.api.http path template.
+//
+//  Template  = "/" Segments [ Verb ] ;
+//  Segments  = Segment { "/" Segment } ;
+//  Segment   = "*" | "**" | LITERAL | Variable ;
+//  Variable  = "{" FieldPath [ "=" Segments ] "}" ;
+//  FieldPath = IDENT { "." IDENT } ;
+//  Verb      = ":" LITERAL ;
+type pathTemplate struct {
+	segments []pathSegment
+	verb     string
+	// deep is the index of the "**" segment, or -1.
+	deep int
+	vars []pathVariable
+}
+
+type pathSegmentKind int
+
+const (
+	literalSegment pathSegmentKind = iota
+	wildcardSegment
+	deepWildcardSegment
+)
+
+type pathSegment struct {
+	kind    pathSegmentKind
+	literal string
+}
+
+// pathVariable binds the segments [start, end) to a field path.
+type pathVariable struct {
+	fieldPath  string
+	start, end int
+}
+
+func parsePathTemplate(pattern string) (*pathTemplate, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("template must start with /")
+	}
+	t := &pathTemplate{deep: -1}
+	rest := pattern[1:]
+
+	// The verb follows the last ':' that is not inside a variable.
+	if i := strings.LastIndex(rest, ":"); i >= 0 && !strings.Contains(rest[i:], "}") {
+		t.verb = rest[i+1:]
+		rest = rest[:i]
+		if t.verb == "" {
+			return nil, fmt.Errorf("empty verb")
+		}
+	}
+
+	for len(rest) > 0 {
+		var segment string
+		if rest[0] == '{' {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable")
+			}
+			variable := rest[1:end]
+			rest = rest[end+1:]
+			fieldPath, segments := variable, "*"
+			if eq := strings.IndexByte(variable, '='); eq >= 0 {
+				fieldPath, segments = variable[:eq], variable[eq+1:]
+			}
+			if fieldPath == "" || segments == "" {
+				return nil, fmt.Errorf("malformed variable %q", variable)
+			}
+			v := pathVariable{fieldPath: fieldPath, start: len(t.segments)}
+			for _, s := range strings.Split(segments, "/") {
+				if err := t.addSegment(s); err != nil {
+					return nil, err
+				}
+			}
+			v.end = len(t.segments)
+			t.vars = append(t.vars, v)
+		} else {
+			end := strings.IndexByte(rest, '/')
+			if end < 0 {
+				end = len(rest)
+			}
+			segment, rest = rest[:end], rest[end:]
+			if err := t.addSegment(segment); err != nil {
+				return nil, err
+			}
+		}
+		if len(rest) > 0 {
+			if rest[0] != '/' {
+				return nil, fmt.Errorf("unexpected %q", rest)
+			}
+			rest = rest[1:]
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("trailing /")
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t *pathTemplate) addSegment(s string) error {
+	switch {
+	case s == "":
+		return fmt.Errorf("empty segment")
+	case s == "*":
+		t.segments = append(t.segments, pathSegment{kind: wildcardSegment})
+	case s == "**":
+		if t.deep >= 0 {
+			return fmt.Errorf("only one ** is allowed")
+		}
+		t.deep = len(t.segments)
+		t.segments = append(t.segments, pathSegment{kind: deepWildcardSegment})
+	case strings.ContainsAny(s, "{}*="):
+		return fmt.Errorf("malformed segment %q", s)
+	default:
+		t.segments = append(t.segments, pathSegment{kind: literalSegment, literal: s})
+	}
+	return nil
+}
+
+// match matches an escaped URL path against the template, returning the
+// values of the variables.
+func (t *pathTemplate) match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	path = path[1:]
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = path[:len(path)-len(t.verb)-1]
+	}
+	components := strings.Split(path, "/")
+
+	// matched[i] holds the range of components matched by segment i.
+	type span struct{ start, end int }
+	matched := make([]span, len(t.segments))
+	if t.deep < 0 {
+		if len(components) != len(t.segments) {
+			return nil, false
+		}
+		for i := range t.segments {
+			matched[i] = span{i, i + 1}
+		}
+	} else {
+		after := len(t.segments) - t.deep - 1
+		if len(components) < len(t.segments)-1 {
+			return nil, false
+		}
+		for i := 0; i < t.deep; i++ {
+			matched[i] = span{i, i + 1}
+		}
+		deepEnd := len(components) - after
+		matched[t.deep] = span{t.deep, deepEnd}
+		for i := 0; i < after; i++ {
+			matched[t.deep+1+i] = span{deepEnd + i, deepEnd + i + 1}
+		}
+	}
+
+	for i, segment := range t.segments {
+		switch segment.kind {
+		case literalSegment:
+			if components[matched[i].start] != segment.literal {
+				return nil, false
+			}
+		case wildcardSegment:
+			if components[matched[i].start] == "" {
+				return nil, false
+			}
+		}
+	}
+
+	vars := make(map[string]string, len(t.vars))
+	for _, v := range t.vars {
+		start, end := matched[v.start].start, matched[v.end-1].end
+		values := components[start:end]
+		if len(values) == 1 {
+			// Single segment variables may contain escaped slashes.
+			value, err := url.PathUnescape(values[0])
+			if err != nil {
+				return nil, false
+			}
+			vars[v.fieldPath] = value
+			continue
+		}
+		unescaped := make([]string, len(values))
+		for j, value := range values {
+			var err error
+			if unescaped[j], err = url.PathUnescape(value); err != nil {
+				return nil, false
+			}
+		}
+		vars[v.fieldPath] = strings.Join(unescaped, "/")
+	}
+	return vars, true
+}
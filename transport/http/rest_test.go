@@ -0,0 +1,323 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestPathTemplate(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		wantVars map[string]string
+	}{
+		{pattern: "/v1/items", path: "/v1/items", wantVars: map[string]string{}},
+		{pattern: "/v1/items", path: "/v1/items/foo"},
+		{pattern: "/v1/items", path: "/v1/other"},
+		{pattern: "/v1/items/{id}", path: "/v1/items/42", wantVars: map[string]string{"id": "42"}},
+		{pattern: "/v1/items/{id}", path: "/v1/items/a%2Fb", wantVars: map[string]string{"id": "a/b"}},
+		{pattern: "/v1/items/{id}", path: "/v1/items/"},
+		{pattern: "/v1/items/{id}", path: "/v1/items/42/bar"},
+		{pattern: "/v1/*/items", path: "/v1/foo/items", wantVars: map[string]string{}},
+		{
+			pattern:  "/v1/{name=shelves/*/books/*}",
+			path:     "/v1/shelves/1/books/2",
+			wantVars: map[string]string{"name": "shelves/1/books/2"},
+		},
+		{pattern: "/v1/{name=shelves/*/books/*}", path: "/v1/shelves/1/novels/2"},
+		{
+			pattern:  "/v1/{path=**}",
+			path:     "/v1/a/b%20c/d",
+			wantVars: map[string]string{"path": "a/b c/d"},
+		},
+		{
+			pattern:  "/v1/{bucket}/{object=**}:get",
+			path:     "/v1/b/o/p:get",
+			wantVars: map[string]string{"bucket": "b", "object": "o/p"},
+		},
+		{pattern: "/v1/{bucket}/{object=**}:get", path: "/v1/b/o/p"},
+		{
+			pattern:  "/v1/{user.id}/messages/{message_id}",
+			path:     "/v1/7/messages/8",
+			wantVars: map[string]string{"user.id": "7", "message_id": "8"},
+		},
+		{
+			pattern:  "/v1/items:batchGet",
+			path:     "/v1/items:batchGet",
+			wantVars: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			template, err := parsePathTemplate(tt.pattern)
+			require.NoError(t, err)
+			vars, ok := template.match(tt.path)
+			if tt.wantVars == nil {
+				assert.False(t, ok, "expected no match")
+				return
+			}
+			require.True(t, ok, "expected a match")
+			assert.Equal(t, tt.wantVars, vars)
+		})
+	}
+}
+
+func TestPathTemplateErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"",
+		"v1/items",
+		"/v1/items/",
+		"/v1//items",
+		"/v1/{id",
+		"/v1/{}",
+		"/v1/{id=}",
+		"/v1/**/{path=**}",
+		"/v1/items:",
+		"/v1/it{em}s",
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			_, err := parsePathTemplate(pattern)
+			assert.Error(t, err)
+		})
+	}
+}
+
+type restTestHandler func(context.Context, *transport.Request, transport.ResponseWriter) error
+
+func (h restTestHandler) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+	return h(ctx, req, resw)
+}
+
+func TestRESTRoutes(t *testing.T) {
+	echo := restTestHandler(func(ctx context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		deadline, _ := ctx.Deadline()
+		resw.AddHeaders(transport.NewHeaders().With("caller", req.Caller))
+		_, err = fmt.Fprintf(resw, `{"service":%q,"procedure":%q,"encoding":%q,"hasDeadline":%v,"request":%s}`,
+			req.Service, req.Procedure, req.Encoding, !deadline.IsZero(), body)
+		return err
+	})
+	fail := restTestHandler(func(_ context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		switch string(body) {
+		case `{"details":true}`:
+			// The protobuf encoding sets the google.rpc.Status of errors
+			// with details as their details.
+			return yarpcerrors.Newf(yarpcerrors.CodeNotFound, "item not found").WithDetails([]byte(
+				`{"code":5,"message":"item not found","details":[{"@type":"type.googleapis.com/google.protobuf.StringValue","value":"42"}]}`))
+		case `{"written":true}`:
+			code := yarpcerrors.CodeAlreadyExists
+			resw.(transport.ApplicationErrorMetaSetter).SetApplicationErrorMeta(&transport.ApplicationErrorMeta{
+				Code:    &code,
+				Name:    "ItemExists",
+				Details: "item already exists",
+			})
+			resw.SetApplicationError()
+			_, err := resw.Write([]byte(`{"id":"42"}`))
+			return err
+		}
+		return yarpcerrors.Newf(yarpcerrors.CodeNotFound, "item not found")
+	})
+	router := newTestRouter([]transport.Procedure{
+		{Name: "Store::Get", Service: "store", Encoding: "json", HandlerSpec: transport.NewUnaryHandlerSpec(echo)},
+		{Name: "Store::Fail", Service: "store", Encoding: "json", HandlerSpec: transport.NewUnaryHandlerSpec(fail)},
+	})
+
+	routes := []transport.RESTRoute{
+		{
+			Procedure: "Store::Get",
+			Encoding:  "json",
+			Method:    "GET",
+			Pattern:   "/v1/items/{id}",
+			BuildRequestBody: func(pathVars map[string]string, query url.Values, _ []byte) ([]byte, error) {
+				return json.Marshal(map[string]string{"id": pathVars["id"], "q": query.Get("q")})
+			},
+		},
+		{
+			Procedure: "Store::Get",
+			Encoding:  "json",
+			Method:    "POST",
+			Pattern:   "/v1/items",
+			BuildRequestBody: func(_ map[string]string, _ url.Values, body []byte) ([]byte, error) {
+				return body, nil
+			},
+			BuildResponseBody: func(body []byte) ([]byte, error) {
+				var response struct {
+					Request json.RawMessage `json:"request"`
+				}
+				err := json.Unmarshal(body, &response)
+				return response.Request, err
+			},
+		},
+		{
+			Procedure: "Store::Get",
+			Encoding:  "json",
+			Method:    "GET",
+			Pattern:   "/v1/invalid",
+			BuildRequestBody: func(map[string]string, url.Values, []byte) ([]byte, error) {
+				return nil, yarpcerrors.InvalidArgumentErrorf("bad request")
+			},
+		},
+		{
+			Procedure: "Store::Fail",
+			Encoding:  "json",
+			Method:    "GET",
+			Pattern:   "/v1/missing",
+			BuildRequestBody: func(map[string]string, url.Values, []byte) ([]byte, error) {
+				return []byte("{}"), nil
+			},
+		},
+		{
+			Procedure: "Store::Fail",
+			Encoding:  "json",
+			Method:    "POST",
+			Pattern:   "/v1/fail",
+			BuildRequestBody: func(_ map[string]string, _ url.Values, body []byte) ([]byte, error) {
+				return body, nil
+			},
+		},
+	}
+
+	inbound := NewTransport().NewInbound("127.0.0.1:0", RESTRoutes(routes...))
+	inbound.SetRouter(router)
+	require.NoError(t, inbound.Start())
+	defer inbound.Stop()
+	baseURL := fmt.Sprintf("http://%v", inbound.Addr())
+
+	t.Run("get with path and query", func(t *testing.T) {
+		resp, body := doREST(t, "GET", baseURL+"/v1/items/42?q=foo", "", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "rest", resp.Header.Get("Rpc-Header-Caller"))
+		assert.JSONEq(t, `{
+			"service": "store",
+			"procedure": "Store::Get",
+			"encoding": "json",
+			"hasDeadline": true,
+			"request": {"id": "42", "q": "foo"}
+		}`, body)
+	})
+
+	t.Run("post with response body", func(t *testing.T) {
+		resp, body := doREST(t, "POST", baseURL+"/v1/items", `{"id":"42"}`, map[string]string{
+			CallerHeader: "my-caller",
+		})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "my-caller", resp.Header.Get("Rpc-Header-Caller"))
+		assert.JSONEq(t, `{"id":"42"}`, body)
+	})
+
+	t.Run("method mismatch", func(t *testing.T) {
+		resp, _ := doREST(t, "DELETE", baseURL+"/v1/items/42", "", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "must fall through to the YARPC handler")
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		resp, body := doREST(t, "GET", baseURL+"/v1/invalid", "", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.JSONEq(t, `{"code":3,"message":"bad request"}`, body)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		resp, body := doREST(t, "GET", baseURL+"/v1/missing", "", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "not-found", resp.Header.Get(ErrorCodeHeader))
+		assert.JSONEq(t, `{"code":5,"message":"item not found"}`, body)
+	})
+
+	t.Run("handler error with details", func(t *testing.T) {
+		resp, body := doREST(t, "POST", baseURL+"/v1/fail", `{"details":true}`, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.JSONEq(t, `{
+			"code": 5,
+			"message": "item not found",
+			"details": [{"@type": "type.googleapis.com/google.protobuf.StringValue", "value": "42"}]
+		}`, body)
+	})
+
+	t.Run("written application error", func(t *testing.T) {
+		resp, body := doREST(t, "POST", baseURL+"/v1/fail", `{"written":true}`, nil)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "already-exists", resp.Header.Get(ErrorCodeHeader))
+		assert.Equal(t, "ItemExists", resp.Header.Get(ErrorNameHeader))
+		assert.JSONEq(t, `{"code":6,"message":"item already exists"}`, body)
+	})
+
+	t.Run("YARPC request", func(t *testing.T) {
+		resp, body := doREST(t, "POST", baseURL+"/v1/items", `{"id":"42"}`, map[string]string{
+			CallerHeader:    "caller",
+			ServiceHeader:   "store",
+			ProcedureHeader: "Store::Get",
+			EncodingHeader:  "json",
+			TTLMSHeader:     "1000",
+		})
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Contains(t, body, `"request":{"id":"42"}`, "must not apply the response body transformation")
+	})
+}
+
+func TestRESTRoutesInvalidPattern(t *testing.T) {
+	inbound := NewTransport().NewInbound("127.0.0.1:0", RESTRoutes(transport.RESTRoute{
+		Procedure: "Store::Get",
+		Method:    "GET",
+		Pattern:   "v1/items",
+	}))
+	inbound.SetRouter(newTestRouter(nil))
+	err := inbound.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid RESTful route GET "v1/items"`)
+}
+
+func doREST(t *testing.T, method, url, body string, headers map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(respBody)
+}
@@ -0,0 +1,459 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package portmux serves gRPC and HTTP YARPC inbounds on a single port.
+//
+// A Listener accepts connections from a single net.Listener and hands each
+// of them to the gRPC or the HTTP inbound depending on the requests sent by
+// the client. HTTP/2 connections whose first request has a content type of
+// application/grpc are handed to the gRPC inbound, and all other connections
+// are handed to the HTTP inbound.
+//
+// gRPC clients wait for the settings of the server before sending requests,
+// so the Listener sends empty settings on HTTP/2 connections before the
+// gRPC inbound sends its own. Connections may stay idle until their first
+// request.
+//
+//  listener, err := portmux.Listen(":8080")
+//  if err != nil {
+//    log.Fatal(err)
+//  }
+//  grpcInbound := grpc.NewTransport().NewInbound(listener.GRPC())
+//  httpInbound := http.NewTransport().NewInbound(":8080", http.Listener(listener.HTTP()))
+//
+// Protocols are detected from the plaintext of connections, so gRPC inbounds
+// that share a port must not use TLS credentials.
+//
+// With yarpcconfig, the gRPC and HTTP inbounds share a port when both are
+// configured with the same address and the shareAddress attribute.
+//
+//  inbounds:
+//    grpc:
+//      address: ":8080"
+//      shareAddress: true
+//    http:
+//      address: ":8080"
+//      shareAddress: true
+package portmux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// http2Preface is the connection preface that HTTP/2 clients, including
+	// all gRPC clients, send first on a connection.
+	http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	// grpcContentType prefixes the content type of all gRPC requests.
+	grpcContentType = "application/grpc"
+
+	// _defaultSniffTimeout bounds the time a client has to send enough bytes
+	// for its protocol to be detected.
+	_defaultSniffTimeout = 10 * time.Second
+
+	// _hpackTableSize is the initial size of the HPACK dynamic table, in
+	// effect until the server advertises another.
+	_hpackTableSize = 4096
+
+	_maxAcceptBackoff = time.Second
+)
+
+var errListenerClosed = errors.New("portmux: listener closed")
+
+// Listener multiplexes the connections accepted by a net.Listener between a
+// gRPC listener and an HTTP listener.
+//
+// Connections for a protocol whose listener was not requested are closed
+// immediately. The underlying net.Listener is closed once all the listeners
+// obtained from the Listener have been closed, or when the Listener itself
+// is closed.
+type Listener struct {
+	addr         string
+	sniffTimeout time.Duration
+	onClose      func()
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error
+
+	lock     sync.Mutex
+	listener net.Listener // nil until the address is bound
+	grpc     *protocolListener
+	http     *protocolListener
+}
+
+// New builds a Listener that multiplexes the connections accepted by the
+// given listener. The Listener takes ownership of the given listener.
+func New(listener net.Listener) *Listener {
+	return &Listener{
+		addr:         listener.Addr().String(),
+		listener:     listener,
+		sniffTimeout: _defaultSniffTimeout,
+		done:         make(chan struct{}),
+	}
+}
+
+// Listen listens on the given TCP address and returns a Listener
+// multiplexing its connections.
+func Listen(addr string) (*Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(listener), nil
+}
+
+// listen binds the address of the Listener if it is not bound yet.
+func (l *Listener) listen() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.listener != nil {
+		return nil
+	}
+	select {
+	case <-l.done:
+		return errListenerClosed
+	default:
+	}
+	listener, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+	l.listener = listener
+	return nil
+}
+
+// GRPC returns the listener for gRPC connections. It returns the same
+// listener every time it is called.
+func (l *Listener) GRPC() net.Listener {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.grpc == nil {
+		l.grpc = newProtocolListener(l)
+	}
+	return l.grpc
+}
+
+// HTTP returns the listener for HTTP/1.x connections. It returns the same
+// listener every time it is called.
+func (l *Listener) HTTP() net.Listener {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.http == nil {
+		l.http = newProtocolListener(l)
+	}
+	return l.http
+}
+
+// Addr returns the address of the underlying listener, or the configured
+// address if it is not bound yet.
+func (l *Listener) Addr() net.Addr {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.listener == nil {
+		return unboundAddr(l.addr)
+	}
+	return l.listener.Addr()
+}
+
+// Close closes the underlying listener. Connections that were not yet
+// accepted by the gRPC or HTTP listeners are closed.
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		l.lock.Lock()
+		if l.listener != nil {
+			err = l.listener.Close()
+		}
+		close(l.done)
+		l.lock.Unlock()
+		if l.onClose != nil {
+			l.onClose()
+		}
+	})
+	return err
+}
+
+// start starts accepting connections once a listener has been used.
+func (l *Listener) start() {
+	l.startOnce.Do(func() {
+		if err := l.listen(); err != nil {
+			l.fail(err)
+			return
+		}
+		go l.acceptLoop()
+	})
+}
+
+// fail closes the Listener, reporting the error to the listeners.
+func (l *Listener) fail(err error) {
+	l.lock.Lock()
+	l.err = err
+	l.lock.Unlock()
+	l.Close()
+}
+
+func (l *Listener) acceptLoop() {
+	l.lock.Lock()
+	listener := l.listener
+	l.lock.Unlock()
+
+	var backoff time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if backoff == 0 {
+					backoff = 5 * time.Millisecond
+				} else if backoff *= 2; backoff > _maxAcceptBackoff {
+					backoff = _maxAcceptBackoff
+				}
+				time.Sleep(backoff)
+				continue
+			}
+			l.fail(err)
+			return
+		}
+		backoff = 0
+		go l.dispatch(conn)
+	}
+}
+
+// dispatch detects the protocol of the connection and hands it to the
+// listener of that protocol.
+func (l *Listener) dispatch(conn net.Conn) {
+	isGRPC, prefix, err := l.sniff(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	l.lock.Lock()
+	target := l.http
+	if isGRPC {
+		target = l.grpc
+	}
+	l.lock.Unlock()
+	if target == nil {
+		conn.Close()
+		return
+	}
+
+	conn = &sniffedConn{Conn: conn, prefix: prefix}
+	select {
+	case target.conns <- conn:
+	case <-target.done:
+		conn.Close()
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// sniff reads from the connection until it can tell whether the client
+// sends gRPC requests, returning the bytes read.
+func (l *Listener) sniff(conn net.Conn) (isGRPC bool, prefix []byte, err error) {
+	if err := conn.SetReadDeadline(time.Now().Add(l.sniffTimeout)); err != nil {
+		return false, nil, err
+	}
+	buf := make([]byte, len(http2Preface))
+	n := 0
+	for n < len(buf) {
+		read, err := conn.Read(buf[n:])
+		n += read
+		if !bytes.HasPrefix([]byte(http2Preface), buf[:n]) {
+			break
+		}
+		if err != nil {
+			return false, nil, err
+		}
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return false, nil, err
+	}
+	if n < len(buf) || string(buf) != http2Preface {
+		return false, buf[:n], nil
+	}
+
+	recorded := bytes.NewBuffer(buf)
+	isGRPC, err = l.sniffHTTP2(conn, recorded)
+	return isGRPC, recorded.Bytes(), err
+}
+
+// sniffHTTP2 reads the frames sent on an HTTP/2 connection after the
+// preface, recording them, until the headers of the first request tell
+// whether it is a gRPC request.
+func (l *Listener) sniffHTTP2(conn net.Conn, recorded *bytes.Buffer) (bool, error) {
+	// Idle connections wait for their first request until the Listener is
+	// closed.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-l.done:
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	framer := http2.NewFramer(conn, io.TeeReader(conn, recorded))
+	if err := framer.WriteSettings(); err != nil {
+		return false, err
+	}
+
+	var isGRPC bool
+	decoder := hpack.NewDecoder(_hpackTableSize, func(f hpack.HeaderField) {
+		if f.Name == "content-type" && strings.HasPrefix(f.Value, grpcContentType) {
+			isGRPC = true
+		}
+	})
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return false, err
+		}
+		var ended bool
+		switch f := frame.(type) {
+		case *http2.HeadersFrame:
+			_, err = decoder.Write(f.HeaderBlockFragment())
+			ended = f.HeadersEnded()
+		case *http2.ContinuationFrame:
+			_, err = decoder.Write(f.HeaderBlockFragment())
+			ended = f.HeadersEnded()
+		}
+		if err != nil {
+			return false, err
+		}
+		if ended {
+			return isGRPC, nil
+		}
+	}
+}
+
+func (l *Listener) release() {
+	l.lock.Lock()
+	open := (l.grpc != nil && !l.grpc.isClosed()) || (l.http != nil && !l.http.isClosed())
+	l.lock.Unlock()
+	if !open {
+		l.Close()
+	}
+}
+
+func (l *Listener) closedErr() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	return errListenerClosed
+}
+
+// protocolListener is the net.Listener for the connections of a single
+// protocol.
+type protocolListener struct {
+	parent    *Listener
+	conns     chan net.Conn
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+var _ net.Listener = (*protocolListener)(nil)
+
+func newProtocolListener(parent *Listener) *protocolListener {
+	return &protocolListener{
+		parent: parent,
+		conns:  make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+}
+
+func (p *protocolListener) Accept() (net.Conn, error) {
+	p.parent.start()
+	select {
+	case conn := <-p.conns:
+		return conn, nil
+	case <-p.done:
+		return nil, errListenerClosed
+	case <-p.parent.done:
+		return nil, p.parent.closedErr()
+	}
+}
+
+func (p *protocolListener) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.parent.release()
+	})
+	return nil
+}
+
+func (p *protocolListener) isClosed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *protocolListener) Addr() net.Addr {
+	return p.parent.Addr()
+}
+
+// Listen binds the address of the Listener if it is not bound yet. The gRPC
+// and HTTP inbounds call it when they start, so that errors binding the
+// address fail their Start.
+func (p *protocolListener) Listen() error {
+	return p.parent.listen()
+}
+
+// unboundAddr is the address of a Listener which is not bound yet.
+type unboundAddr string
+
+func (unboundAddr) Network() string  { return "tcp" }
+func (a unboundAddr) String() string { return string(a) }
+
+// sniffedConn replays the bytes read while detecting the protocol.
+type sniffedConn struct {
+	net.Conn
+
+	prefix []byte
+}
+
+func (c *sniffedConn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
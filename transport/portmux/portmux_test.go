@@ -0,0 +1,280 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package portmux_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/encoding/raw"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/yarpc/transport/http"
+	"go.uber.org/yarpc/transport/portmux"
+	"go.uber.org/yarpc/yarpcconfig"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestListenerServesGRPCAndHTTP(t *testing.T) {
+	listener, err := portmux.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+
+	server := yarpc.NewDispatcher(yarpc.Config{
+		Name: "server",
+		Inbounds: yarpc.Inbounds{
+			grpc.NewTransport().NewInbound(listener.GRPC()),
+			http.NewTransport().NewInbound(addr, http.Listener(listener.HTTP())),
+		},
+	})
+	server.Register(raw.Procedure("echo", echo))
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	assertEcho(t, addr)
+}
+
+func TestSharedAddressConfig(t *testing.T) {
+	addr := freeAddr(t)
+	configurator := yarpcconfig.New()
+	configurator.MustRegisterTransport(grpc.TransportSpec())
+	configurator.MustRegisterTransport(http.TransportSpec())
+	server, err := configurator.NewDispatcherFromYAML("server", strings.NewReader(fmt.Sprintf(`
+inbounds:
+  grpc:
+    address: %[1]q
+    shareAddress: true
+  http:
+    address: %[1]q
+    shareAddress: true
+`, addr)))
+	require.NoError(t, err)
+	server.Register(raw.Procedure("echo", echo))
+	require.NoError(t, server.Start())
+
+	assertEcho(t, addr)
+
+	require.NoError(t, server.Stop())
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err, "the shared listener must be closed once both inbounds stopped")
+
+	// The address can be shared again once released.
+	listener, err := portmux.Shared(addr)
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+}
+
+func TestShared(t *testing.T) {
+	addr := freeAddr(t)
+	l1, err := portmux.Shared(addr)
+	require.NoError(t, err)
+	l2, err := portmux.Shared(addr)
+	require.NoError(t, err)
+	assert.True(t, l1 == l2, "expected the same listener for the same address")
+	assert.True(t, l1.GRPC() == l1.GRPC(), "expected the same gRPC listener")
+	assert.True(t, l1.HTTP() == l1.HTTP(), "expected the same HTTP listener")
+
+	require.NoError(t, l1.GRPC().Close())
+	_, err = l1.GRPC().Accept()
+	assert.Error(t, err)
+	require.NoError(t, l1.HTTP().Close())
+
+	l3, err := portmux.Shared(addr)
+	require.NoError(t, err)
+	assert.False(t, l1 == l3, "expected a new listener once the previous one is closed")
+	require.NoError(t, l3.Close())
+}
+
+func TestUnclaimedProtocol(t *testing.T) {
+	listener, err := portmux.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	httpListener := listener.HTTP()
+	go func() {
+		conn, err := httpListener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	// gRPC connections are closed right away since there is no gRPC listener.
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	writeHTTP2Request(t, conn, "application/grpc")
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = ioutil.ReadAll(conn)
+	assert.NoError(t, err, "expected the connection to be closed")
+}
+
+func TestShortHTTPRequest(t *testing.T) {
+	listener, err := portmux.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// A request shorter than the HTTP/2 preface must not block detection.
+	request := "GET / HTTP/1.0\r\n\r\n"
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte(request))
+	require.NoError(t, err)
+
+	accepted, err := listener.HTTP().Accept()
+	require.NoError(t, err)
+	defer accepted.Close()
+	require.NoError(t, accepted.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, len(request))
+	_, err = io.ReadFull(accepted, buf)
+	require.NoError(t, err)
+	assert.Equal(t, request, string(buf))
+}
+
+func TestHTTP2ByContentType(t *testing.T) {
+	listener, err := portmux.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tests := []struct {
+		contentType string
+		listener    net.Listener
+	}{
+		{"application/grpc+proto", listener.GRPC()},
+		{"application/json", listener.HTTP()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			writeHTTP2Request(t, conn, tt.contentType)
+
+			accepted, err := tt.listener.Accept()
+			require.NoError(t, err)
+			defer accepted.Close()
+
+			// The connection is replayed from its preface.
+			require.NoError(t, accepted.SetReadDeadline(time.Now().Add(5*time.Second)))
+			buf := make([]byte, len(http2.ClientPreface))
+			_, err = io.ReadFull(accepted, buf)
+			require.NoError(t, err)
+			assert.Equal(t, http2.ClientPreface, string(buf))
+		})
+	}
+}
+
+func TestSharedAddressReleasedOnConfigFailure(t *testing.T) {
+	addr := freeAddr(t)
+	configurator := yarpcconfig.New()
+	configurator.MustRegisterTransport(grpc.TransportSpec())
+	configurator.MustRegisterTransport(http.TransportSpec())
+	_, err := configurator.NewDispatcherFromYAML("server", strings.NewReader(fmt.Sprintf(`
+inbounds:
+  grpc:
+    address: %[1]q
+    shareAddress: true
+  http:
+    address: %[1]q
+    shareAddress: true
+metrics:
+  tags: [shard_key]
+`, addr)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load metrics configuration")
+
+	listener, err := net.Listen("tcp", addr)
+	require.NoError(t, err, "the shared address must not be bound")
+	require.NoError(t, listener.Close())
+}
+
+// writeHTTP2Request starts an HTTP/2 connection with a request of the given
+// content type.
+func writeHTTP2Request(t *testing.T, conn net.Conn, contentType string) {
+	_, err := conn.Write([]byte(http2.ClientPreface))
+	require.NoError(t, err)
+	framer := http2.NewFramer(conn, conn)
+	require.NoError(t, framer.WriteSettings())
+
+	var headers bytes.Buffer
+	encoder := hpack.NewEncoder(&headers)
+	for _, f := range []hpack.HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":path", Value: "/service/procedure"},
+		{Name: ":authority", Value: conn.RemoteAddr().String()},
+		{Name: "content-type", Value: contentType},
+	} {
+		require.NoError(t, encoder.WriteField(f))
+	}
+	require.NoError(t, framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: headers.Bytes(),
+		EndHeaders:    true,
+	}))
+}
+
+func echo(_ context.Context, body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func assertEcho(t *testing.T, addr string) {
+	outbounds := map[string]transport.UnaryOutbound{
+		"grpc": grpc.NewTransport().NewSingleOutbound(addr),
+		"http": http.NewTransport().NewSingleOutbound("http://" + addr),
+	}
+	for name, outbound := range outbounds {
+		t.Run(name, func(t *testing.T) {
+			client := yarpc.NewDispatcher(yarpc.Config{
+				Name: "client",
+				Outbounds: yarpc.Outbounds{
+					"server": {Unary: outbound},
+				},
+			})
+			require.NoError(t, client.Start())
+			defer client.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			body, err := raw.New(client.ClientConfig("server")).Call(ctx, "echo", []byte(name))
+			require.NoError(t, err)
+			assert.Equal(t, name, string(body))
+		})
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
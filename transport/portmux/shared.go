@@ -0,0 +1,60 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package portmux
+
+import "sync"
+
+var _shared = struct {
+	sync.Mutex
+
+	listeners map[string]*Listener
+}{listeners: make(map[string]*Listener)}
+
+// Shared returns the Listener for the given address that is shared within
+// the process, building one if no such Listener is currently open. Inbounds
+// built by yarpcconfig with the shareAddress attribute use shared Listeners.
+//
+// The address is only bound once an inbound using the Listener starts, so
+// that building a configuration that fails, or is never started, does not
+// hold the port. Addresses are compared verbatim, so inbounds sharing a port
+// must be configured with the same address.
+func Shared(addr string) (*Listener, error) {
+	_shared.Lock()
+	defer _shared.Unlock()
+
+	if l, ok := _shared.listeners[addr]; ok {
+		return l, nil
+	}
+	l := &Listener{
+		addr:         addr,
+		sniffTimeout: _defaultSniffTimeout,
+		done:         make(chan struct{}),
+	}
+	l.onClose = func() {
+		_shared.Lock()
+		defer _shared.Unlock()
+		if _shared.listeners[addr] == l {
+			delete(_shared.listeners, addr)
+		}
+	}
+	_shared.listeners[addr] = l
+	return l, nil
+}
@@ -158,6 +158,8 @@ func (o *ChannelOutbound) Call(ctx context.Context, req *transport.Request) (*tr
 	if o.transport.originalHeaders {
 		reqHeaders = req.Headers.OriginalItems()
 	}
+	reqHeaders = mergeHeaders(reqHeaders, criticalityHeaders(req.Criticality))
+	reqHeaders = mergeHeaders(reqHeaders, baggageHeaders(ctx))
 	// baggage headers are transport implementation details that are stripped out (and stored in the context). Users don't interact with it
 	tracingBaggage := tchannel.InjectOutboundSpan(call.Response(), nil)
 	if err := writeHeaders(format, reqHeaders, tracingBaggage, call.Arg2Writer); err != nil {
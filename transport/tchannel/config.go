@@ -67,7 +67,7 @@ type OutboundConfig struct {
 	yarpcconfig.PeerChooser
 }
 
-// TransportSpec returns a TransportSpec for the TChannel unary transport.
+// TransportSpec returns a TransportSpec for the TChannel transport.
 func TransportSpec(opts ...Option) yarpcconfig.TransportSpec {
 	var ts transportSpec
 	for _, o := range opts {
@@ -92,9 +92,10 @@ type transportSpec struct {
 func (ts *transportSpec) Spec() yarpcconfig.TransportSpec {
 	return yarpcconfig.TransportSpec{
 		Name:               TransportName,
-		BuildTransport:     ts.buildTransport,
-		BuildInbound:       ts.buildInbound,
-		BuildUnaryOutbound: ts.buildUnaryOutbound,
+		BuildTransport:      ts.buildTransport,
+		BuildInbound:        ts.buildInbound,
+		BuildUnaryOutbound:  ts.buildUnaryOutbound,
+		BuildStreamOutbound: ts.buildStreamOutbound,
 	}
 }
 
@@ -149,6 +150,14 @@ func (ts *transportSpec) buildInbound(c *InboundConfig, t transport.Transport, k
 }
 
 func (ts *transportSpec) buildUnaryOutbound(oc *OutboundConfig, t transport.Transport, k *yarpcconfig.Kit) (transport.UnaryOutbound, error) {
+	return ts.buildOutbound(oc, t, k)
+}
+
+func (ts *transportSpec) buildStreamOutbound(oc *OutboundConfig, t transport.Transport, k *yarpcconfig.Kit) (transport.StreamOutbound, error) {
+	return ts.buildOutbound(oc, t, k)
+}
+
+func (ts *transportSpec) buildOutbound(oc *OutboundConfig, t transport.Transport, k *yarpcconfig.Kit) (*Outbound, error) {
 	x := t.(*Transport)
 	chooser, err := oc.BuildPeerChooser(x, hostport.Identify, k)
 	if err != nil {
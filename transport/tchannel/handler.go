@@ -119,6 +119,10 @@ func (h handler) handle(ctx context.Context, call inboundCall) {
 	responseWriter.AddHeader(ServiceHeaderKey, call.ServiceName())
 
 	err := h.callHandler(ctx, call, responseWriter)
+	if err == errStreamHandled {
+		// the stream wrote its own response
+		return
+	}
 
 	// black-hole requests on resource exhausted errors
 	if yarpcerrors.FromError(err).Code() == yarpcerrors.CodeResourceExhausted {
@@ -183,12 +187,21 @@ func (h handler) callHandler(ctx context.Context, call inboundCall, responseWrit
 		return errors.RequestHeadersDecodeError(treq, err)
 	}
 	treq.Headers = headers
+	if c, ok := headers.Get(CriticalityHeaderKey); ok {
+		treq.Criticality = transport.Criticality(c)
+		treq.Headers.Del(CriticalityHeaderKey)
+	}
 
 	if tcall, ok := call.(tchannelCall); ok {
 		tracer := h.tracer
 		ctx = tchannel.ExtractInboundSpan(ctx, tcall.InboundCall, headers.Items(), tracer)
 	}
 
+	if _, ok := headers.Get(_streamHeaderKey); ok {
+		treq.Headers.Del(_streamHeaderKey)
+		return h.callStreamHandler(ctx, call, treq)
+	}
+
 	buf := bufferpool.Get()
 	defer bufferpool.Put(buf)
 
@@ -244,6 +257,46 @@ func (h handler) callHandler(ctx context.Context, call inboundCall, responseWrit
 	}
 }
 
+// callStreamHandler runs a stream handler for a streaming call. Errors
+// returned before the stream starts are reported like unary errors; the
+// stream reports later errors itself and errStreamHandled is returned.
+func (h handler) callStreamHandler(ctx context.Context, call inboundCall, treq *transport.Request) error {
+	if err := transport.ValidateRequest(treq); err != nil {
+		return err
+	}
+	spec, err := h.router.Choose(ctx, treq)
+	if err != nil {
+		return err
+	}
+	if spec.Type() != transport.Streaming {
+		return yarpcerrors.Newf(yarpcerrors.CodeUnimplemented, "transport tchannel cannot stream to %s handlers", spec.Type().String())
+	}
+	if err := transport.ValidateRequestContext(ctx); err != nil {
+		return err
+	}
+
+	body, err := call.Arg3Reader()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	stream := newServerStream(ctx, &transport.StreamRequest{Meta: treq.ToRequestMeta()}, call, body, h.headerCase)
+	serverStream, err := transport.NewServerStream(stream)
+	if err != nil {
+		return err
+	}
+	err = transport.InvokeStreamHandler(transport.StreamInvokeRequest{
+		Stream:  serverStream,
+		Handler: spec.Stream(),
+		Logger:  h.logger,
+	})
+	if finishErr := stream.finish(err); finishErr != nil && ctx.Err() == nil {
+		h.logger.Error("failed to finish tchannel stream", zap.Error(finishErr))
+	}
+	return errStreamHandled
+}
+
 type handlerWriter struct {
 	failedWith       error
 	format           tchannel.Format
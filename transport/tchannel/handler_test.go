@@ -173,6 +173,44 @@ func TestHandlerErrors(t *testing.T) {
 	}
 }
 
+func TestHandlerCriticality(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	rpcHandler := transporttest.NewMockUnaryHandler(mockCtrl)
+	router := transporttest.NewMockRouter(mockCtrl)
+	router.EXPECT().Choose(gomock.Any(), gomock.Any()).Return(transport.NewUnaryHandlerSpec(rpcHandler), nil)
+
+	rpcHandler.EXPECT().Handle(
+		gomock.Any(),
+		transporttest.NewRequestMatcher(t,
+			&transport.Request{
+				Caller:      "caller",
+				Service:     "service",
+				Transport:   "tchannel",
+				Headers:     transport.HeadersFromMap(map[string]string{"foo": "bar"}),
+				Encoding:    transport.Encoding(tchannel.JSON),
+				Procedure:   "hello",
+				Criticality: transport.CriticalitySheddable,
+				Body:        bytes.NewReader([]byte("world")),
+			}),
+		gomock.Any(),
+	).Return(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testtime.Second)
+	defer cancel()
+	tchHandler := handler{router: router, logger: zap.NewNop(), newResponseWriter: newHandlerWriter}
+	tchHandler.handle(ctx, &fakeInboundCall{
+		service: "service",
+		caller:  "caller",
+		format:  tchannel.JSON,
+		method:  "hello",
+		arg2:    []byte(`{"foo": "bar", "$rpc$-criticality": "sheddable"}`),
+		arg3:    []byte("world"),
+		resp:    newResponseRecorder(),
+	})
+}
+
 func TestHandlerFailures(t *testing.T) {
 	tests := []struct {
 		desc              string
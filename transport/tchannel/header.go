@@ -28,6 +28,7 @@ import (
 
 	"github.com/uber/tchannel-go"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/transport/tchannel/internal"
 	"go.uber.org/yarpc/yarpcerrors"
 )
@@ -48,6 +49,13 @@ const (
 	ApplicationErrorDetailsHeaderKey = "$rpc$-application-error-details"
 	// ApplicationErrorCodeHeaderKey is the response header key for the application error code.
 	ApplicationErrorCodeHeaderKey = "$rpc$-application-error-code"
+	// CriticalityHeaderKey is the request header key for the criticality of
+	// the request. TChannel has no native field for it.
+	CriticalityHeaderKey = "$rpc$-criticality"
+	// BaggageHeaderKeyPrefix is the prefix of the request header keys
+	// carrying the baggage of the request, one per item. The rest of the key
+	// is the baggage key.
+	BaggageHeaderKeyPrefix = "$rpc$-baggage-"
 )
 
 var _reservedHeaderKeys = map[string]struct{}{
@@ -75,7 +83,7 @@ func readRequestHeaders(
 	if err != nil {
 		return ctx, headers, err
 	}
-	return ctx, headers, nil
+	return extractBaggage(ctx, headers), headers, nil
 }
 
 // readHeaders reads headers using the given function to get the arg reader.
@@ -129,6 +137,48 @@ func writeHeaders(format tchannel.Format, headers map[string]string, tracingBagg
 	return tchannel.NewArgWriter(getWriter()).Write(encodeHeaders(merged))
 }
 
+// criticalityHeaders returns the headers carrying the given criticality, or
+// nil if it is not set.
+func criticalityHeaders(c transport.Criticality) map[string]string {
+	if c == "" {
+		return nil
+	}
+	return map[string]string{CriticalityHeaderKey: string(c)}
+}
+
+// baggageHeaders returns the headers carrying the baggage of the context, or
+// nil if it carries none.
+func baggageHeaders(ctx context.Context) map[string]string {
+	var headers map[string]string
+	baggage.Range(ctx, func(k, v string) {
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[BaggageHeaderKeyPrefix+k] = v
+	})
+	return headers
+}
+
+// extractBaggage returns a copy of the context carrying the baggage sent in
+// the headers, and removes the baggage headers.
+func extractBaggage(ctx context.Context, headers transport.Headers) context.Context {
+	var items map[string]string
+	for k, v := range headers.Items() {
+		if !strings.HasPrefix(k, BaggageHeaderKeyPrefix) {
+			continue
+		}
+		if items == nil {
+			items = make(map[string]string)
+		}
+		items[k[len(BaggageHeaderKeyPrefix):]] = v
+		headers.Del(k)
+	}
+	if items == nil {
+		return ctx
+	}
+	return baggage.WithItems(ctx, items)
+}
+
 // mergeHeaders will keep the last value if the same key appears multiple times
 func mergeHeaders(m1, m2 map[string]string) map[string]string {
 	if len(m1) == 0 {
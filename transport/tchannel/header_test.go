@@ -22,6 +22,7 @@ package tchannel
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io/ioutil"
 	"testing"
@@ -30,6 +31,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/uber/tchannel-go"
 	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/yarpcerrors"
 )
 
@@ -150,6 +152,25 @@ func TestReadAndWriteHeaders(t *testing.T) {
 	}
 }
 
+func TestBaggageHeaders(t *testing.T) {
+	ctx := baggage.WithBaggage(context.Background(), "tenant", "acme")
+	assert.Equal(t, map[string]string{BaggageHeaderKeyPrefix + "tenant": "acme"}, baggageHeaders(ctx))
+	assert.Nil(t, baggageHeaders(context.Background()))
+
+	buffer := newBufferArgWriter()
+	headers := mergeHeaders(map[string]string{"foo": "bar"}, baggageHeaders(ctx))
+	require.NoError(t, writeHeaders(tchannel.Raw, headers, nil, func() (tchannel.ArgWriter, error) {
+		return buffer, nil
+	}))
+
+	ctx, result, err := readRequestHeaders(context.Background(), tchannel.Raw, func() (tchannel.ArgReader, error) {
+		return ioutil.NopCloser(bytes.NewReader(buffer.Bytes())), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar"}, result.Items(), "baggage headers must be removed")
+	assert.Equal(t, map[string]string{"tenant": "acme"}, baggage.FromContext(ctx))
+}
+
 func TestReadHeadersFailure(t *testing.T) {
 	_, err := readHeaders(tchannel.Raw, func() (tchannel.ArgReader, error) {
 		return nil, errors.New("great sadness")
@@ -43,6 +43,7 @@ var (
 	errDoNotUseContextWithHeaders = yarpcerrors.Newf(yarpcerrors.CodeInvalidArgument, "tchannel.ContextWithHeaders is not compatible with YARPC, use yarpc.CallOption instead")
 
 	_ transport.UnaryOutbound              = (*Outbound)(nil)
+	_ transport.StreamOutbound             = (*Outbound)(nil)
 	_ introspection.IntrospectableOutbound = (*Outbound)(nil)
 )
 
@@ -109,6 +110,70 @@ func (p *tchannelPeer) Call(ctx context.Context, req *transport.Request) (*trans
 	return callWithPeer(ctx, req, tp, p.transport.headerCase)
 }
 
+// CallStream starts a stream over this TChannel outbound.
+//
+// The stream is carried by a single TChannel call, so it must be started with
+// a context deadline and ends at the latest when the deadline expires.
+func (o *Outbound) CallStream(ctx context.Context, req *transport.StreamRequest) (*transport.ClientStream, error) {
+	if req == nil || req.Meta == nil {
+		return nil, yarpcerrors.InvalidArgumentErrorf("stream request for tchannel outbound requires a request metadata")
+	}
+	treq := req.Meta.ToRequest()
+	if err := o.once.WaitUntilRunning(ctx); err != nil {
+		return nil, intyarpcerrors.AnnotateWithInfo(yarpcerrors.FromError(err), "error waiting for tchannel outbound to start for service: %s", treq.Service)
+	}
+	if _, ok := ctx.(tchannel.ContextWithHeaders); ok {
+		return nil, errDoNotUseContextWithHeaders
+	}
+	p, onFinish, err := o.getPeerForRequest(ctx, treq)
+	if err != nil {
+		return nil, toYARPCError(treq, err)
+	}
+	stream, err := p.callStream(ctx, req, onFinish)
+	if err != nil {
+		onFinish(err)
+		return nil, toYARPCError(treq, err)
+	}
+	return transport.NewClientStream(stream)
+}
+
+// callStream starts a stream with this specific peer. The release function is
+// called once the stream ends.
+func (p *tchannelPeer) callStream(ctx context.Context, req *transport.StreamRequest, release func(error)) (*clientStream, error) {
+	treq := req.Meta.ToRequest()
+	tp := p.transport.ch.RootPeers().GetOrAdd(p.HostPort())
+
+	format := tchannel.Format(treq.Encoding)
+	call, err := tp.BeginCall(ctx, treq.Service, treq.Procedure, &tchannel.CallOptions{
+		Format:          format,
+		CallerName:      treq.Caller,
+		ShardKey:        treq.ShardKey,
+		RoutingKey:      treq.RoutingKey,
+		RoutingDelegate: treq.RoutingDelegate,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reqHeaders := mergeHeaders(headerMap(treq.Headers, p.transport.headerCase), map[string]string{_streamHeaderKey: "true"})
+	reqHeaders = mergeHeaders(reqHeaders, criticalityHeaders(treq.Criticality))
+	reqHeaders = mergeHeaders(reqHeaders, baggageHeaders(ctx))
+	tracingBaggage := tchannel.InjectOutboundSpan(call.Response(), nil)
+	if err := writeHeaders(format, reqHeaders, tracingBaggage, call.Arg2Writer); err != nil {
+		return nil, errors.RequestHeadersEncodeError(treq, err)
+	}
+	writer, err := call.Arg3Writer()
+	if err != nil {
+		return nil, err
+	}
+	// Flush the headers so that the handler starts even if the caller
+	// receives before it sends.
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return newClientStream(ctx, req, call, writer, release), nil
+}
+
 // callWithPeer sends a request with the chosen peer.
 func callWithPeer(ctx context.Context, req *transport.Request, peer *tchannel.Peer, headerCase headerCase) (*transport.Response, error) {
 	// NB(abg): Under the current API, the local service's name is required
@@ -142,7 +207,8 @@ func callWithPeer(ctx context.Context, req *transport.Request, peer *tchannel.Pe
 	if err != nil {
 		return nil, err
 	}
-	reqHeaders := headerMap(req.Headers, headerCase)
+	reqHeaders := mergeHeaders(headerMap(req.Headers, headerCase), criticalityHeaders(req.Criticality))
+	reqHeaders = mergeHeaders(reqHeaders, baggageHeaders(ctx))
 
 	// baggage headers are transport implementation details that are stripped out (and stored in the context). Users don't interact with it
 	tracingBaggage := tchannel.InjectOutboundSpan(call.Response(), nil)
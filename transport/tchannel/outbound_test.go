@@ -49,6 +49,7 @@ func TestOutboundHeaders(t *testing.T) {
 		name            string
 		originalHeaders bool
 		giveHeaders     map[string]string
+		giveCriticality transport.Criticality
 		wantHeaders     map[string]string
 	}{
 		{
@@ -78,6 +79,15 @@ func TestOutboundHeaders(t *testing.T) {
 				"bar-baz":     "orange",
 			},
 		},
+		{
+			name:            "criticality",
+			giveHeaders:     map[string]string{"foo": "bar"},
+			giveCriticality: transport.CriticalitySheddable,
+			wantHeaders: map[string]string{
+				"foo":               "bar",
+				"$rpc$-criticality": "sheddable",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -121,12 +131,13 @@ func TestOutboundHeaders(t *testing.T) {
 			_, err = out.Call(
 				ctx,
 				&transport.Request{
-					Caller:    "caller",
-					Service:   "service",
-					Encoding:  raw.Encoding,
-					Procedure: "hello",
-					Headers:   transport.HeadersFromMap(tt.giveHeaders),
-					Body:      bytes.NewBufferString("body"),
+					Caller:      "caller",
+					Service:     "service",
+					Encoding:    raw.Encoding,
+					Procedure:   "hello",
+					Headers:     transport.HeadersFromMap(tt.giveHeaders),
+					Criticality: tt.giveCriticality,
+					Body:        bytes.NewBufferString("body"),
 				},
 			)
 
@@ -0,0 +1,434 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/uber/tchannel-go"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/pkg/errors"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// Streams are carried by a single TChannel call. The request headers carry
+// _streamHeaderKey, and arg3 of the request and of the response are sequences
+// of frames:
+//
+//  type:1 size:4 payload:size
+//
+// Message frames carry a single stream message. The response stream ends
+// with a trailer frame, whose payload holds the stream error, if any, as
+// headers encoded like arg2.
+const (
+	_messageFrame byte = 0
+	_trailerFrame byte = 1
+
+	_frameHeaderSize = 5
+
+	// _streamHeaderKey is the request header key marking streaming calls.
+	_streamHeaderKey = "$rpc$-stream"
+
+	// _errorDetailsHeaderKey is the trailer key for the error details.
+	_errorDetailsHeaderKey = "$rpc$-error-details"
+)
+
+var (
+	_ transport.StreamHeadersSender = (*serverStream)(nil)
+	_ transport.StreamHeadersReader = (*clientStream)(nil)
+
+	// errStreamHandled is returned by callHandler once a stream handler
+	// completed and its response, including errors, was written.
+	errStreamHandled = yarpcerrors.InternalErrorf("tchannel stream was handled")
+)
+
+func writeFrame(w tchannel.ArgWriter, frameType byte, payload []byte) error {
+	var header [_frameHeaderSize]byte
+	header[0] = frameType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readFrame reads a single frame. It returns io.EOF if the argument ended
+// between frames.
+//
+// TChannel argument readers block until the given buffer is filled, so
+// frames must be read with exactly sized buffers.
+func readFrame(r io.Reader) (frameType byte, payload []byte, err error) {
+	var header [_frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = yarpcerrors.InternalErrorf("tchannel stream frame header was truncated")
+		}
+		return 0, nil, err
+	}
+	payload = make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = yarpcerrors.InternalErrorf("tchannel stream frame was truncated")
+		}
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+func readMessage(m *transport.StreamMessage) ([]byte, error) {
+	defer m.Body.Close()
+	return ioutil.ReadAll(m.Body)
+}
+
+func newStreamMessage(body []byte) *transport.StreamMessage {
+	return &transport.StreamMessage{
+		Body:     readCloser{bytes.NewReader(body)},
+		BodySize: len(body),
+	}
+}
+
+// encodeTrailer encodes the error ending a stream.
+func encodeTrailer(err error) []byte {
+	if err == nil {
+		return encodeHeaders(nil)
+	}
+	status := yarpcerrors.FromError(err)
+	text, _ := status.Code().MarshalText()
+	trailer := map[string]string{ErrorCodeHeaderKey: string(text)}
+	if status.Name() != "" {
+		trailer[ErrorNameHeaderKey] = status.Name()
+	}
+	if status.Message() != "" {
+		trailer[ErrorMessageHeaderKey] = status.Message()
+	}
+	if len(status.Details()) > 0 {
+		trailer[_errorDetailsHeaderKey] = string(status.Details())
+	}
+	return encodeHeaders(trailer)
+}
+
+// decodeTrailer decodes the error ending a stream.
+func decodeTrailer(payload []byte) error {
+	trailer, err := decodeHeaders(bytes.NewReader(payload))
+	if err != nil {
+		return yarpcerrors.InternalErrorf("failed to decode tchannel stream trailer: %v", err)
+	}
+	err = getResponseError(trailer)
+	if details, ok := trailer.Get(_errorDetailsHeaderKey); ok && err != nil {
+		err = yarpcerrors.FromError(err).WithDetails([]byte(details))
+	}
+	return err
+}
+
+type serverStream struct {
+	ctx        context.Context
+	req        *transport.StreamRequest
+	call       inboundCall
+	headerCase headerCase
+
+	body io.ReadCloser
+
+	lock          sync.Mutex
+	headers       map[string]string
+	headersSent   bool
+	writer        tchannel.ArgWriter
+	receiveClosed bool
+}
+
+func newServerStream(ctx context.Context, req *transport.StreamRequest, call inboundCall, body io.ReadCloser, headerCase headerCase) *serverStream {
+	return &serverStream{
+		ctx:        ctx,
+		req:        req,
+		call:       call,
+		headerCase: headerCase,
+		body:       body,
+		headers:    map[string]string{ServiceHeaderKey: call.ServiceName()},
+	}
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) Request() *transport.StreamRequest {
+	return ss.req
+}
+
+func (ss *serverStream) SendHeaders(headers transport.Headers) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if ss.headersSent {
+		return yarpcerrors.InternalErrorf("stream headers were already sent")
+	}
+	for k, v := range headerMap(headers, ss.headerCase) {
+		if isReservedHeaderKey(k) {
+			return yarpcerrors.InvalidArgumentErrorf("cannot use reserved header key: %s", k)
+		}
+		ss.headers[k] = v
+	}
+	return ss.sendHeaders()
+}
+
+// sendHeaders writes the response headers and begins the response body.
+// It must be called with the lock held.
+func (ss *serverStream) sendHeaders() error {
+	if ss.headersSent {
+		return nil
+	}
+	ss.headersSent = true
+	response := ss.call.Response()
+	if err := writeHeaders(ss.call.Format(), ss.headers, nil, response.Arg2Writer); err != nil {
+		return err
+	}
+	writer, err := response.Arg3Writer()
+	if err != nil {
+		return err
+	}
+	ss.writer = writer
+	return nil
+}
+
+func (ss *serverStream) SendMessage(_ context.Context, m *transport.StreamMessage) error {
+	msg, err := readMessage(m)
+	if err != nil {
+		return err
+	}
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if err := ss.sendHeaders(); err != nil {
+		return toYARPCStreamError(err)
+	}
+	return toYARPCStreamError(writeFrame(ss.writer, _messageFrame, msg))
+}
+
+func (ss *serverStream) ReceiveMessage(_ context.Context) (*transport.StreamMessage, error) {
+	frameType, msg, err := readFrame(ss.body)
+	if err == nil && frameType != _messageFrame {
+		err = yarpcerrors.InternalErrorf("unexpected tchannel stream frame type %d", frameType)
+	}
+	if err != nil {
+		return nil, toYARPCStreamError(err)
+	}
+	return newStreamMessage(msg), nil
+}
+
+// finish ends the stream with the given handler error.
+func (ss *serverStream) finish(err error) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if err != nil {
+		err = errors.WrapHandlerError(err, ss.call.ServiceName(), ss.call.MethodString())
+	}
+	if headersErr := ss.sendHeaders(); headersErr != nil {
+		return headersErr
+	}
+	if writeErr := writeFrame(ss.writer, _trailerFrame, encodeTrailer(err)); writeErr != nil {
+		return writeErr
+	}
+	return ss.writer.Close()
+}
+
+type clientStream struct {
+	ctx     context.Context
+	req     *transport.StreamRequest
+	call    *tchannel.OutboundCall
+	format  tchannel.Format
+	release func(error)
+
+	sendLock sync.Mutex
+	writer   tchannel.ArgWriter
+	sendDone bool
+
+	// headersOnce reads the response headers and begins the response body.
+	headersOnce sync.Once
+	headers     transport.Headers
+	body        tchannel.ArgReader
+	headersErr  error
+
+	receiveLock sync.Mutex
+
+	closeLock sync.Mutex
+	closed    bool
+	err       error
+}
+
+func newClientStream(ctx context.Context, req *transport.StreamRequest, call *tchannel.OutboundCall, writer tchannel.ArgWriter, release func(error)) *clientStream {
+	return &clientStream{
+		ctx:     ctx,
+		req:     req,
+		call:    call,
+		format:  tchannel.Format(req.Meta.Encoding),
+		writer:  writer,
+		release: release,
+	}
+}
+
+func (cs *clientStream) Context() context.Context {
+	return cs.ctx
+}
+
+func (cs *clientStream) Request() *transport.StreamRequest {
+	return cs.req
+}
+
+func (cs *clientStream) SendMessage(_ context.Context, m *transport.StreamMessage) error {
+	msg, err := readMessage(m)
+	if err != nil {
+		return toYARPCStreamError(err)
+	}
+
+	cs.sendLock.Lock()
+	defer cs.sendLock.Unlock()
+	if cs.sendDone || cs.isClosed() {
+		return io.EOF
+	}
+	if err := writeFrame(cs.writer, _messageFrame, msg); err != nil {
+		return toYARPCStreamError(cs.closeWithErr(toYARPCError(cs.req.Meta.ToRequest(), err)))
+	}
+	return nil
+}
+
+func (cs *clientStream) ReceiveMessage(context.Context) (*transport.StreamMessage, error) {
+	if err := cs.readHeaders(); err != nil {
+		return nil, cs.closeWithErr(err)
+	}
+
+	cs.receiveLock.Lock()
+	defer cs.receiveLock.Unlock()
+	if cs.isClosed() {
+		return nil, cs.closeWithErr(nil)
+	}
+
+	frameType, msg, err := readFrame(cs.body)
+	switch {
+	case err == io.EOF:
+		return nil, cs.closeWithErr(yarpcerrors.InternalErrorf("tchannel stream ended without a trailer"))
+	case err != nil:
+		return nil, cs.closeWithErr(cs.toYARPCError(err))
+	case frameType == _messageFrame:
+		return newStreamMessage(msg), nil
+	case frameType == _trailerFrame:
+		if err := decodeTrailer(msg); err != nil {
+			return nil, cs.closeWithErr(err)
+		}
+		return nil, cs.closeWithErr(nil)
+	default:
+		return nil, cs.closeWithErr(yarpcerrors.InternalErrorf("unexpected tchannel stream frame type %d", frameType))
+	}
+}
+
+// Close ends the request stream. Responses may still be received until the
+// server ends the stream.
+func (cs *clientStream) Close(context.Context) error {
+	cs.sendLock.Lock()
+	defer cs.sendLock.Unlock()
+	if cs.sendDone {
+		return nil
+	}
+	cs.sendDone = true
+	if err := cs.writer.Close(); err != nil {
+		return toYARPCStreamError(cs.closeWithErr(cs.toYARPCError(err)))
+	}
+	return nil
+}
+
+func (cs *clientStream) Headers() (transport.Headers, error) {
+	if err := cs.readHeaders(); err != nil {
+		return transport.NewHeaders(), err
+	}
+	return cs.headers, nil
+}
+
+func (cs *clientStream) readHeaders() error {
+	cs.headersOnce.Do(func() {
+		response := cs.call.Response()
+		headers, err := readHeaders(cs.format, response.Arg2Reader)
+		if err != nil {
+			if _, ok := err.(tchannel.SystemError); ok {
+				cs.headersErr = cs.toYARPCError(err)
+			} else {
+				cs.headersErr = errors.ResponseHeadersDecodeError(cs.req.Meta.ToRequest(), err)
+			}
+			return
+		}
+		respService, _ := headers.Get(ServiceHeaderKey)
+		if err := validateServiceName(cs.req.Meta.Service, respService); err != nil {
+			cs.headersErr = err
+			return
+		}
+		deleteReservedHeaders(headers)
+		cs.headers = headers
+
+		if cs.body, err = response.Arg3Reader(); err != nil {
+			cs.headersErr = cs.toYARPCError(err)
+		}
+	})
+	return cs.headersErr
+}
+
+func (cs *clientStream) toYARPCError(err error) error {
+	return toYARPCError(cs.req.Meta.ToRequest(), err)
+}
+
+func (cs *clientStream) isClosed() bool {
+	cs.closeLock.Lock()
+	defer cs.closeLock.Unlock()
+	return cs.closed
+}
+
+// closeWithErr releases the stream once it ended. It returns the error that
+// ended the stream, or io.EOF if the stream ended successfully.
+func (cs *clientStream) closeWithErr(err error) error {
+	cs.closeLock.Lock()
+	defer cs.closeLock.Unlock()
+	if cs.closed {
+		return cs.err
+	}
+	cs.closed = true
+	cs.err = err
+	if cs.err == nil {
+		cs.err = io.EOF
+	}
+	if cs.body != nil {
+		_ = cs.body.Close()
+	}
+	cs.release(err)
+	return cs.err
+}
+
+func toYARPCStreamError(err error) error {
+	if err == nil || err == io.EOF || yarpcerrors.IsStatus(err) {
+		return err
+	}
+	if err, ok := err.(tchannel.SystemError); ok {
+		return fromSystemError(err)
+	}
+	return yarpcerrors.FromError(err)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/encoding/protobuf"
+	"go.uber.org/yarpc/internal/prototest/example"
+	"go.uber.org/yarpc/internal/prototest/examplepb"
+	"go.uber.org/yarpc/transport/tchannel"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestStreaming(t *testing.T) {
+	headers := transport.NewHeaders().With("key", "value")
+	client, closeServer := newStreamingClient(t, example.NewFooYARPCServer(headers))
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	callOptions := []yarpc.CallOption{yarpc.WithHeader("key", "value")}
+
+	t.Run("client streaming", func(t *testing.T) {
+		stream, err := client.EchoOut(ctx, callOptions...)
+		require.NoError(t, err)
+		for _, msg := range []string{"a", "b", "c"} {
+			require.NoError(t, stream.Send(&examplepb.EchoOutRequest{Message: msg}))
+		}
+		response, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c"}, response.AllMessages)
+	})
+
+	t.Run("server streaming", func(t *testing.T) {
+		stream, err := client.EchoIn(ctx, &examplepb.EchoInRequest{Message: "hello", NumResponses: 3}, callOptions...)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			response, err := stream.Recv()
+			require.NoError(t, err)
+			assert.Equal(t, "hello", response.Message)
+		}
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("bidirectional streaming", func(t *testing.T) {
+		stream, err := client.EchoBoth(ctx, callOptions...)
+		require.NoError(t, err)
+		for _, msg := range []string{"a", "b"} {
+			// Each request must be answered before the request stream ends.
+			require.NoError(t, stream.Send(&examplepb.EchoBothRequest{Message: msg, NumResponses: 2}))
+			for i := 0; i < 2; i++ {
+				response, err := stream.Recv()
+				require.NoError(t, err)
+				assert.Equal(t, msg, response.Message)
+			}
+		}
+		require.NoError(t, stream.CloseSend())
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		// Missing headers fail the handler after the stream started.
+		stream, err := client.EchoIn(ctx, &examplepb.EchoInRequest{Message: "hello", NumResponses: 1})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Error(t, err)
+		assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code())
+		assert.Contains(t, yarpcerrors.FromError(err).Message(), "did not receive proper headers")
+	})
+}
+
+func TestStreamingErrorDetails(t *testing.T) {
+	server := &failingFooServer{err: protobuf.NewError(yarpcerrors.CodeNotFound, "not found", protobuf.WithErrorDetails(&examplepb.EchoBothRequest{Message: "details"}))}
+	client, closeServer := newStreamingClient(t, server)
+	defer closeServer()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.EchoBoth(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Error(t, err)
+	assert.Equal(t, yarpcerrors.CodeNotFound, yarpcerrors.FromError(err).Code())
+	assert.Equal(t, "not found", yarpcerrors.FromError(err).Message())
+	assert.Equal(t, []interface{}{&examplepb.EchoBothRequest{Message: "details"}}, protobuf.GetErrorDetails(err))
+}
+
+type failingFooServer struct {
+	examplepb.FooYARPCServer
+
+	err error
+}
+
+func (s *failingFooServer) EchoBoth(examplepb.FooServiceEchoBothYARPCServer) error {
+	return s.err
+}
+
+func newStreamingClient(t *testing.T, server examplepb.FooYARPCServer) (examplepb.FooYARPCClient, func()) {
+	serverTransport, err := tchannel.NewTransport(tchannel.ServiceName("server"), tchannel.ListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	serverDispatcher := yarpc.NewDispatcher(yarpc.Config{
+		Name:     "server",
+		Inbounds: yarpc.Inbounds{serverTransport.NewInbound()},
+	})
+	serverDispatcher.Register(examplepb.BuildFooYARPCProcedures(server))
+	require.NoError(t, serverDispatcher.Start())
+
+	clientTransport, err := tchannel.NewTransport(tchannel.ServiceName("client"))
+	require.NoError(t, err)
+	clientDispatcher := yarpc.NewDispatcher(yarpc.Config{
+		Name: "client",
+		Outbounds: yarpc.Outbounds{
+			"server": {Stream: clientTransport.NewSingleOutbound(serverTransport.ListenAddr())},
+		},
+	})
+	require.NoError(t, clientDispatcher.Start())
+
+	return examplepb.NewFooYARPCClient(clientDispatcher.ClientConfig("server")), func() {
+		assert.NoError(t, clientDispatcher.Stop())
+		assert.NoError(t, serverDispatcher.Stop())
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+	"go.uber.org/yarpc/internal/config"
+	"go.uber.org/yarpc/internal/glob"
+	"go.uber.org/yarpc/yarpcerrors"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	_ middleware.UnaryInbound  = (*Authorizer)(nil)
+	_ middleware.OnewayInbound = (*Authorizer)(nil)
+	_ middleware.StreamInbound = (*Authorizer)(nil)
+)
+
+// Effect is the decision of an authorization rule.
+type Effect string
+
+const (
+	// Allow lets matching requests through.
+	Allow Effect = "allow"
+	// Deny rejects matching requests with CodePermissionDenied.
+	Deny Effect = "deny"
+)
+
+// Rule matches requests to allow or deny them.
+//
+// A request matches a rule if it matches at least one pattern of every
+// non-empty list. Patterns may contain '*' to match any sequence of
+// characters.
+type Rule struct {
+	Effect Effect `config:"effect"`
+
+	// Callers match the name of the verified principal. Rules with callers
+	// never match unauthenticated requests: the caller name a request claims
+	// is not trusted.
+	Callers    []string `config:"callers"`
+	Services   []string `config:"services"`
+	Procedures []string `config:"procedures"`
+	Encodings  []string `config:"encodings"`
+	Transports []string `config:"transports"`
+}
+
+// Policy decides which requests an inbound accepts.
+//
+// Rules are evaluated in order and the first matching rule decides. Requests
+// that match no rule get the default effect, which is to deny them unless
+// specified otherwise.
+//
+// A policy may be loaded from YAML.
+//
+// 	default: deny
+// 	rules:
+// 	  - effect: allow
+// 	    callers: [spiffe://example.com/frontend]
+// 	    procedures: ["KeyValue::Get*"]
+// 	  - effect: allow
+// 	    callers: [admin]
+// 	    encodings: [proto]
+// 	    transports: [grpc]
+type Policy struct {
+	Default Effect `config:"default"`
+	Rules   []Rule `config:"rules"`
+}
+
+// ParsePolicyYAML parses a policy from YAML.
+func ParsePolicyYAML(r io.Reader) (Policy, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Policy{}, err
+	}
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(b, &data); err != nil {
+		return Policy{}, err
+	}
+	var p Policy
+	if err := config.DecodeInto(&p, data); err != nil {
+		return Policy{}, fmt.Errorf("failed to decode authorization policy: %v", err)
+	}
+	return p, nil
+}
+
+// Validate checks that the policy is well-formed.
+func (p Policy) Validate() error {
+	switch p.Default {
+	case "", Allow, Deny:
+	default:
+		return fmt.Errorf("invalid default effect %q, must be %q or %q", p.Default, Allow, Deny)
+	}
+	for i, r := range p.Rules {
+		if r.Effect != Allow && r.Effect != Deny {
+			return fmt.Errorf("invalid effect %q for rule %d, must be %q or %q", r.Effect, i, Allow, Deny)
+		}
+	}
+	return nil
+}
+
+// Authorizer is inbound middleware that allows or denies requests according
+// to a policy. Its policy may be replaced at runtime with Update.
+//
+// Callers are matched by their verified principal, so the Authorizer must run
+// after an InboundMiddleware that authenticates them.
+//
+// 	yarpc.UnaryInboundMiddleware(authenticator, authorizer)
+type Authorizer struct {
+	policy atomic.Value // Policy
+}
+
+// NewAuthorizer builds an Authorizer enforcing the given policy.
+func NewAuthorizer(p Policy) (*Authorizer, error) {
+	a := &Authorizer{}
+	if err := a.Update(p); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Update replaces the policy of the Authorizer. The policy applies to
+// requests received after Update returns. An invalid policy is rejected and
+// the current one is kept.
+func (a *Authorizer) Update(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	a.policy.Store(p)
+	return nil
+}
+
+// Handle implements middleware.UnaryInbound.
+func (a *Authorizer) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	if err := a.authorize(ctx, req.ToRequestMeta()); err != nil {
+		return err
+	}
+	return h.Handle(ctx, req, resw)
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (a *Authorizer) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	if err := a.authorize(ctx, req.ToRequestMeta()); err != nil {
+		return err
+	}
+	return h.HandleOneway(ctx, req)
+}
+
+// HandleStream implements middleware.StreamInbound.
+func (a *Authorizer) HandleStream(s *transport.ServerStream, h transport.StreamHandler) error {
+	if err := a.authorize(s.Context(), s.Request().Meta); err != nil {
+		return err
+	}
+	return h.HandleStream(s)
+}
+
+func (a *Authorizer) authorize(ctx context.Context, req *transport.RequestMeta) error {
+	p := a.policy.Load().(Policy)
+	principal, _ := apiauth.PrincipalFromContext(ctx)
+
+	effect, reason := p.Default, "by default"
+	for i, r := range p.Rules {
+		if r.matches(principal, req) {
+			effect, reason = r.Effect, fmt.Sprintf("by rule %d", i)
+			break
+		}
+	}
+	if effect == Allow {
+		return nil
+	}
+
+	caller := "unauthenticated caller"
+	if principal != nil {
+		caller = fmt.Sprintf("caller %q", principal.Name)
+	}
+	return yarpcerrors.PermissionDeniedErrorf(
+		"%s is not allowed to call procedure %q of service %q over %s/%s: denied %s",
+		caller, req.Procedure, req.Service, req.Transport, req.Encoding, reason)
+}
+
+func (r Rule) matches(principal *apiauth.Principal, req *transport.RequestMeta) bool {
+	if len(r.Callers) > 0 && (principal == nil || !glob.MatchAny(r.Callers, principal.Name)) {
+		return false
+	}
+	return glob.MatchAny(r.Services, req.Service) &&
+		glob.MatchAny(r.Procedures, req.Procedure) &&
+		glob.MatchAny(r.Encodings, string(req.Encoding)) &&
+		glob.MatchAny(r.Transports, req.Transport)
+}
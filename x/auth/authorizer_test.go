@@ -0,0 +1,162 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestAuthorizer(t *testing.T) {
+	policy, err := ParsePolicyYAML(strings.NewReader(`
+default: deny
+rules:
+  - effect: deny
+    procedures: ["KeyValue::Delete*"]
+  - effect: allow
+    callers: [frontend, "spiffe://example.com/*"]
+    services: [keyvalue]
+    encodings: [proto]
+    transports: [grpc, tchannel]
+  - effect: allow
+    procedures: [health]
+`))
+	require.NoError(t, err)
+	authorizer, err := NewAuthorizer(policy)
+	require.NoError(t, err)
+
+	frontend := &apiauth.Principal{Name: "frontend"}
+	tests := []struct {
+		desc      string
+		principal *apiauth.Principal
+		req       transport.RequestMeta
+		wantErr   string
+	}{
+		{
+			desc:      "allowed caller",
+			principal: frontend,
+			req:       transport.RequestMeta{Service: "keyvalue", Procedure: "KeyValue::GetValue", Encoding: "proto", Transport: "grpc"},
+		},
+		{
+			desc:      "allowed caller by glob",
+			principal: &apiauth.Principal{Name: "spiffe://example.com/backend"},
+			req:       transport.RequestMeta{Service: "keyvalue", Procedure: "KeyValue::GetValue", Encoding: "proto", Transport: "tchannel"},
+		},
+		{
+			desc:      "denied procedure",
+			principal: frontend,
+			req:       transport.RequestMeta{Service: "keyvalue", Procedure: "KeyValue::DeleteValue", Encoding: "proto", Transport: "grpc"},
+			wantErr:   `caller "frontend" is not allowed to call procedure "KeyValue::DeleteValue" of service "keyvalue" over grpc/proto: denied by rule 0`,
+		},
+		{
+			desc:      "unknown caller",
+			principal: &apiauth.Principal{Name: "stranger"},
+			req:       transport.RequestMeta{Service: "keyvalue", Procedure: "KeyValue::GetValue", Encoding: "proto", Transport: "grpc"},
+			wantErr:   `caller "stranger" is not allowed to call procedure "KeyValue::GetValue" of service "keyvalue" over grpc/proto: denied by default`,
+		},
+		{
+			desc:    "unauthenticated caller claiming a name",
+			req:     transport.RequestMeta{Caller: "frontend", Service: "keyvalue", Procedure: "KeyValue::GetValue", Encoding: "proto", Transport: "grpc"},
+			wantErr: `unauthenticated caller is not allowed to call procedure "KeyValue::GetValue" of service "keyvalue" over grpc/proto: denied by default`,
+		},
+		{
+			desc:      "wrong encoding",
+			principal: frontend,
+			req:       transport.RequestMeta{Service: "keyvalue", Procedure: "KeyValue::GetValue", Encoding: "json", Transport: "grpc"},
+			wantErr:   `denied by default`,
+		},
+		{
+			desc:      "wrong transport",
+			principal: frontend,
+			req:       transport.RequestMeta{Service: "keyvalue", Procedure: "KeyValue::GetValue", Encoding: "proto", Transport: "http"},
+			wantErr:   `denied by default`,
+		},
+		{
+			desc: "unauthenticated caller allowed",
+			req:  transport.RequestMeta{Service: "keyvalue", Procedure: "health", Encoding: "json", Transport: "http"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = apiauth.WithPrincipal(ctx, tt.principal)
+			}
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			handler := transporttest.NewMockUnaryHandler(mockCtrl)
+			if tt.wantErr == "" {
+				handler.EXPECT().Handle(ctx, tt.req.ToRequest(), nil).Return(nil)
+			}
+
+			err := authorizer.Handle(ctx, tt.req.ToRequest(), nil, handler)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, yarpcerrors.IsPermissionDenied(err), "unexpected error: %v", err)
+			assert.Contains(t, yarpcerrors.FromError(err).Message(), tt.wantErr)
+		})
+	}
+}
+
+func TestAuthorizerUpdate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	authorizer, err := NewAuthorizer(Policy{})
+	require.NoError(t, err)
+	req := &transport.Request{Service: "keyvalue", Procedure: "KeyValue::GetValue"}
+	ctx := context.Background()
+
+	handler := transporttest.NewMockOnewayHandler(mockCtrl)
+	err = authorizer.HandleOneway(ctx, req, handler)
+	assert.True(t, yarpcerrors.IsPermissionDenied(err), "unexpected error: %v", err)
+
+	require.NoError(t, authorizer.Update(Policy{Default: Allow}))
+	handler.EXPECT().HandleOneway(ctx, req).Return(nil)
+	assert.NoError(t, authorizer.HandleOneway(ctx, req, handler))
+
+	err = authorizer.Update(Policy{Default: "maybe"})
+	assert.EqualError(t, err, `invalid default effect "maybe", must be "allow" or "deny"`)
+	handler.EXPECT().HandleOneway(ctx, req).Return(nil)
+	assert.NoError(t, authorizer.HandleOneway(ctx, req, handler), "invalid policy must not replace the current one")
+}
+
+func TestParsePolicyYAMLErrors(t *testing.T) {
+	_, err := ParsePolicyYAML(strings.NewReader("rules: 42"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decode authorization policy")
+
+	_, err = ParsePolicyYAML(strings.NewReader("{"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+// InboundMiddlewareSpec returns a specification that teaches a
+// yarpcconfig.Configurator to build an Authorizer from the 'authorization'
+// section of a configuration.
+//
+// 	cfg := yarpcconfig.New()
+// 	cfg.MustRegisterInboundMiddleware(auth.InboundMiddlewareSpec())
+//
+// 	authorization:
+// 	  default: deny
+// 	  rules:
+// 	    - effect: allow
+// 	      callers: [frontend]
+//
+// A new Authorizer is built for each loaded configuration.
+func InboundMiddlewareSpec() yarpcconfig.InboundMiddlewareSpec {
+	return yarpcconfig.InboundMiddlewareSpec{
+		Name: "authorization",
+		BuildInboundMiddleware: func(p Policy, _ *yarpcconfig.Kit) (yarpc.InboundMiddleware, error) {
+			a, err := NewAuthorizer(p)
+			if err != nil {
+				return yarpc.InboundMiddleware{}, err
+			}
+			return a.inboundMiddleware(), nil
+		},
+	}
+}
+
+// InboundMiddlewareSpec returns a specification that teaches a
+// yarpcconfig.Configurator to load the 'authorization' section of a
+// configuration into this Authorizer, whose policy may then be updated at
+// runtime.
+//
+// 	authorizer, _ := auth.NewAuthorizer(auth.Policy{})
+// 	cfg := yarpcconfig.New()
+// 	cfg.MustRegisterInboundMiddleware(authorizer.InboundMiddlewareSpec())
+// 	...
+// 	err := authorizer.Update(newPolicy)
+func (a *Authorizer) InboundMiddlewareSpec() yarpcconfig.InboundMiddlewareSpec {
+	return yarpcconfig.InboundMiddlewareSpec{
+		Name: "authorization",
+		BuildInboundMiddleware: func(p Policy, _ *yarpcconfig.Kit) (yarpc.InboundMiddleware, error) {
+			if err := a.Update(p); err != nil {
+				return yarpc.InboundMiddleware{}, err
+			}
+			return a.inboundMiddleware(), nil
+		},
+	}
+}
+
+func (a *Authorizer) inboundMiddleware() yarpc.InboundMiddleware {
+	return yarpc.InboundMiddleware{
+		Unary:  a,
+		Oneway: a,
+		Stream: a,
+	}
+}
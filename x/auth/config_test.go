@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/internal/whitespace"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+func TestInboundMiddlewareSpec(t *testing.T) {
+	give := whitespace.Expand(`
+		authorization:
+			default: deny
+			rules:
+				- effect: allow
+				  callers: [frontend]
+				  procedures: ["KeyValue::Get*"]
+	`)
+
+	t.Run("new authorizer", func(t *testing.T) {
+		c := yarpcconfig.New()
+		c.MustRegisterInboundMiddleware(InboundMiddlewareSpec())
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(give))
+		require.NoError(t, err)
+		authorizer, ok := cfg.InboundMiddleware.Unary.(*Authorizer)
+		require.True(t, ok, "expected *Authorizer, got %T", cfg.InboundMiddleware.Unary)
+		assert.Equal(t, authorizer, cfg.InboundMiddleware.Oneway)
+		assert.Equal(t, authorizer, cfg.InboundMiddleware.Stream)
+		assert.Equal(t, Deny, authorizer.policy.Load().(Policy).Default)
+	})
+
+	t.Run("given authorizer", func(t *testing.T) {
+		authorizer, err := NewAuthorizer(Policy{Default: Allow})
+		require.NoError(t, err)
+		c := yarpcconfig.New()
+		c.MustRegisterInboundMiddleware(authorizer.InboundMiddlewareSpec())
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(give))
+		require.NoError(t, err)
+		assert.Equal(t, authorizer, cfg.InboundMiddleware.Unary)
+		assert.Equal(t, Deny, authorizer.policy.Load().(Policy).Default)
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		c := yarpcconfig.New()
+		c.MustRegisterInboundMiddleware(InboundMiddlewareSpec())
+
+		_, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			authorization:
+				rules:
+					- effect: maybe
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to load "authorization" configuration: invalid effect "maybe" for rule 0`)
+	})
+
+	t.Run("no policy", func(t *testing.T) {
+		c := yarpcconfig.New()
+		c.MustRegisterInboundMiddleware(InboundMiddlewareSpec())
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(""))
+		require.NoError(t, err)
+		assert.Nil(t, cfg.InboundMiddleware.Unary)
+	})
+}
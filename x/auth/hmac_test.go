@@ -0,0 +1,160 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+)
+
+func TestHMAC(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	keys := map[string][]byte{"caller": []byte("secret"), "other": []byte("other secret")}
+
+	tests := []struct {
+		desc      string
+		name      string
+		key       []byte
+		signedAt  time.Time
+		procedure string
+		header    string // overrides the signed credentials
+		wantName  string
+		wantErr   string
+		wantNone  bool
+	}{
+		{
+			desc:     "valid",
+			name:     "caller",
+			key:      []byte("secret"),
+			signedAt: now,
+			wantName: "caller",
+		},
+		{
+			desc:     "within skew",
+			name:     "caller",
+			key:      []byte("secret"),
+			signedAt: now.Add(-4 * time.Minute),
+			wantName: "caller",
+		},
+		{
+			desc:     "expired",
+			name:     "caller",
+			key:      []byte("secret"),
+			signedAt: now.Add(-6 * time.Minute),
+			wantErr:  `HMAC token for "caller" is expired`,
+		},
+		{
+			desc:     "wrong key",
+			name:     "caller",
+			key:      []byte("other secret"),
+			signedAt: now,
+			wantErr:  `invalid HMAC token signature for "caller"`,
+		},
+		{
+			desc:     "impersonation",
+			name:     "other",
+			key:      []byte("secret"),
+			signedAt: now,
+			wantErr:  `invalid HMAC token signature for "other"`,
+		},
+		{
+			desc:      "signed for another procedure",
+			name:      "caller",
+			key:       []byte("secret"),
+			signedAt:  now,
+			procedure: "other",
+			wantErr:   `invalid HMAC token signature for "caller"`,
+		},
+		{
+			desc:     "unknown principal",
+			name:     "stranger",
+			key:      []byte("secret"),
+			signedAt: now,
+			wantErr:  `unknown principal "stranger"`,
+		},
+		{
+			desc:    "malformed",
+			header:  "HMAC caller",
+			wantErr: "malformed HMAC token",
+		},
+		{
+			desc:     "other scheme",
+			header:   "Bearer token",
+			wantNone: true,
+		},
+		{
+			desc:     "no credentials",
+			wantNone: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			req := &transport.RequestMeta{Service: "service", Procedure: "procedure", Headers: transport.NewHeaders()}
+			if tt.header != "" {
+				req.Headers = req.Headers.With(apiauth.HeaderKey, tt.header)
+			} else if tt.name != "" {
+				creds := &hmacCredentials{name: tt.name, key: tt.key, now: func() time.Time { return tt.signedAt }}
+				signed := *req
+				if tt.procedure != "" {
+					signed.Procedure = tt.procedure
+				}
+				token, err := creds.Credentials(context.Background(), &signed)
+				require.NoError(t, err)
+				req.Headers = req.Headers.With(apiauth.HeaderKey, creds.Scheme()+" "+token)
+			}
+
+			authenticator := NewHMACAuthenticator(keys).(*hmacAuthenticator)
+			authenticator.now = func() time.Time { return now }
+			principal, err := authenticator.Authenticate(context.Background(), req)
+			switch {
+			case tt.wantNone:
+				assert.Equal(t, apiauth.ErrNoCredentials, err)
+			case tt.wantErr != "":
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, &apiauth.Principal{Name: tt.wantName, Scheme: HMACScheme}, principal)
+			}
+		})
+	}
+}
+
+func TestHMACMaxSkew(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	creds := &hmacCredentials{name: "caller", key: []byte("secret"), now: func() time.Time { return now.Add(-time.Minute) }}
+	req := &transport.RequestMeta{Service: "service", Procedure: "procedure"}
+	token, err := creds.Credentials(context.Background(), req)
+	require.NoError(t, err)
+	req.Headers = transport.NewHeaders().With(apiauth.HeaderKey, "HMAC "+token)
+
+	authenticator := NewHMACAuthenticator(map[string][]byte{"caller": []byte("secret")}, HMACMaxSkew(time.Second)).(*hmacAuthenticator)
+	authenticator.now = func() time.Time { return now }
+	_, err = authenticator.Authenticate(context.Background(), req)
+	assert.EqualError(t, err, `HMAC token for "caller" is expired`)
+}
@@ -0,0 +1,266 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+)
+
+// JWTScheme is the authentication scheme of JSON Web Tokens.
+const JWTScheme = "Bearer"
+
+var errMalformedJWT = errors.New("malformed JWT")
+
+// TokenSource provides the token for an outbound request.
+type TokenSource func(ctx context.Context, req *transport.RequestMeta) (string, error)
+
+// NewJWTCredentials builds credentials that attach JSON Web Tokens from the
+// given source to requests.
+func NewJWTCredentials(source TokenSource) apiauth.Credentials {
+	return jwtCredentials{source: source}
+}
+
+type jwtCredentials struct {
+	source TokenSource
+}
+
+func (jwtCredentials) Scheme() string {
+	return JWTScheme
+}
+
+func (c jwtCredentials) Credentials(ctx context.Context, req *transport.RequestMeta) (string, error) {
+	return c.source(ctx, req)
+}
+
+// JWTOption customizes the behavior of a JWT authenticator.
+type JWTOption func(*jwtAuthenticator)
+
+// JWTIssuer requires tokens to be issued by the given issuer.
+func JWTIssuer(issuer string) JWTOption {
+	return func(a *jwtAuthenticator) {
+		a.issuer = issuer
+	}
+}
+
+// JWTAudience requires tokens to be issued for the given audience.
+func JWTAudience(audience string) JWTOption {
+	return func(a *jwtAuthenticator) {
+		a.audience = audience
+	}
+}
+
+// JWTLeeway specifies how much clock skew is tolerated when checking the
+// expiry and not-before times of tokens.
+//
+// Defaults to 0.
+func JWTLeeway(leeway time.Duration) JWTOption {
+	return func(a *jwtAuthenticator) {
+		a.leeway = leeway
+	}
+}
+
+// NewJWTHMACAuthenticator builds an authenticator that verifies JSON Web
+// Tokens signed with HS256 and the given key.
+//
+// The subject of the token is the name of the principal. Other string claims
+// are exposed as the principal's claims.
+func NewJWTHMACAuthenticator(key []byte, opts ...JWTOption) apiauth.Authenticator {
+	return newJWTAuthenticator("HS256", func(signed, signature []byte) bool {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signed)
+		return hmac.Equal(signature, mac.Sum(nil))
+	}, opts)
+}
+
+// NewJWTRSAAuthenticator builds an authenticator that verifies JSON Web
+// Tokens signed with RS256 by the private key of the given public key.
+//
+// The subject of the token is the name of the principal. Other string claims
+// are exposed as the principal's claims.
+func NewJWTRSAAuthenticator(key *rsa.PublicKey, opts ...JWTOption) apiauth.Authenticator {
+	return newJWTAuthenticator("RS256", func(signed, signature []byte) bool {
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}, opts)
+}
+
+func newJWTAuthenticator(alg string, verify func(signed, signature []byte) bool, opts []JWTOption) *jwtAuthenticator {
+	a := &jwtAuthenticator{
+		alg:    alg,
+		verify: verify,
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+type jwtAuthenticator struct {
+	alg      string
+	verify   func(signed, signature []byte) bool
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+func (a *jwtAuthenticator) Authenticate(_ context.Context, req *transport.RequestMeta) (*apiauth.Principal, error) {
+	token, ok := apiauth.CredentialsFromHeaders(req.Headers, JWTScheme)
+	if !ok {
+		return nil, apiauth.ErrNoCredentials
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedJWT
+	}
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	// The algorithm is fixed by the authenticator, never chosen by the token.
+	if header.Alg != a.alg {
+		return nil, fmt.Errorf("unexpected JWT signing algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformedJWT
+	}
+	if !a.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, errors.New("invalid JWT signature")
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := a.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("JWT has no subject")
+	}
+
+	principal := &apiauth.Principal{
+		Name:   subject,
+		Scheme: JWTScheme,
+		Claims: make(map[string]string, len(claims)),
+	}
+	for k, v := range claims {
+		if s, ok := v.(string); ok {
+			principal.Claims[k] = s
+		}
+	}
+	return principal, nil
+}
+
+func (a *jwtAuthenticator) validateClaims(claims map[string]interface{}) error {
+	now := a.now()
+	exp, hasExp, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if hasExp && now.After(exp.Add(a.leeway)) {
+		return errors.New("JWT is expired")
+	}
+	nbf, hasNbf, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if hasNbf && now.Add(a.leeway).Before(nbf) {
+		return errors.New("JWT is not valid yet")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return fmt.Errorf("JWT was not issued by %q", a.issuer)
+	}
+	if a.audience != "" && !hasAudience(claims["aud"], a.audience) {
+		return fmt.Errorf("JWT was not issued for audience %q", a.audience)
+	}
+	return nil
+}
+
+// numericDate returns the time of the given claim, if present. Claims that
+// are present but are not numbers make the token malformed, rather than
+// disabling the check.
+func numericDate(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	v, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false, errMalformedJWT
+	}
+	t, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, errMalformedJWT
+	}
+	return time.Unix(int64(t), 0), true, nil
+}
+
+// hasAudience reports whether the aud claim, a string or a list of strings,
+// contains the audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errMalformedJWT
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return errMalformedJWT
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+)
+
+var _jwtNow = time.Unix(1600000000, 0)
+
+func encodeJWTPart(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(t *testing.T, key []byte, claims map[string]interface{}) string {
+	signed := encodeJWTPart(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeJWTPart(t, claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	signed := encodeJWTPart(t, map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encodeJWTPart(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func authenticateJWT(t *testing.T, authenticator apiauth.Authenticator, token string) (*apiauth.Principal, error) {
+	authenticator.(*jwtAuthenticator).now = func() time.Time { return _jwtNow }
+	creds := NewJWTCredentials(func(context.Context, *transport.RequestMeta) (string, error) {
+		return token, nil
+	})
+	value, err := creds.Credentials(context.Background(), &transport.RequestMeta{})
+	require.NoError(t, err)
+	return authenticator.Authenticate(context.Background(), &transport.RequestMeta{
+		Headers: transport.NewHeaders().With(apiauth.HeaderKey, creds.Scheme()+" "+value),
+	})
+}
+
+func TestJWTHMAC(t *testing.T) {
+	key := []byte("secret")
+	valid := map[string]interface{}{
+		"sub": "caller",
+		"iss": "issuer",
+		"aud": []string{"service", "other"},
+		"exp": _jwtNow.Add(time.Minute).Unix(),
+		"nbf": _jwtNow.Add(-time.Minute).Unix(),
+	}
+	with := func(k string, v interface{}) map[string]interface{} {
+		claims := make(map[string]interface{}, len(valid))
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+		return claims
+	}
+	opts := []JWTOption{JWTIssuer("issuer"), JWTAudience("service")}
+
+	tests := []struct {
+		desc    string
+		token   string
+		opts    []JWTOption
+		wantErr string
+	}{
+		{desc: "valid", token: signHS256(t, key, valid)},
+		{desc: "single audience", token: signHS256(t, key, with("aud", "service"))},
+		{desc: "expired", token: signHS256(t, key, with("exp", _jwtNow.Add(-time.Second).Unix())), wantErr: "JWT is expired"},
+		{
+			desc:  "expired within leeway",
+			token: signHS256(t, key, with("exp", _jwtNow.Add(-time.Second).Unix())),
+			opts:  []JWTOption{JWTLeeway(time.Minute)},
+		},
+		{desc: "not valid yet", token: signHS256(t, key, with("nbf", _jwtNow.Add(time.Minute).Unix())), wantErr: "JWT is not valid yet"},
+		{desc: "string expiry", token: signHS256(t, key, with("exp", "tomorrow")), wantErr: "malformed JWT"},
+		{desc: "boolean expiry", token: signHS256(t, key, with("exp", true)), wantErr: "malformed JWT"},
+		{desc: "string not before", token: signHS256(t, key, with("nbf", "yesterday")), wantErr: "malformed JWT"},
+		{desc: "wrong issuer", token: signHS256(t, key, with("iss", "other")), wantErr: `JWT was not issued by "issuer"`},
+		{desc: "wrong audience", token: signHS256(t, key, with("aud", "other")), wantErr: `JWT was not issued for audience "service"`},
+		{desc: "no subject", token: signHS256(t, key, with("sub", nil)), wantErr: "JWT has no subject"},
+		{desc: "wrong key", token: signHS256(t, []byte("other"), valid), wantErr: "invalid JWT signature"},
+		{
+			desc:    "unsigned",
+			token:   encodeJWTPart(t, map[string]string{"alg": "none"}) + "." + encodeJWTPart(t, valid) + ".",
+			wantErr: `unexpected JWT signing algorithm "none"`,
+		},
+		{desc: "malformed", token: "not a token", wantErr: "malformed JWT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			principal, err := authenticateJWT(t, NewJWTHMACAuthenticator(key, append(opts, tt.opts...)...), tt.token)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "caller", principal.Name)
+			assert.Equal(t, JWTScheme, principal.Scheme)
+			assert.Equal(t, "issuer", principal.Claims["iss"])
+		})
+	}
+}
+
+func TestJWTRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	claims := map[string]interface{}{"sub": "caller", "exp": _jwtNow.Add(time.Minute).Unix()}
+
+	principal, err := authenticateJWT(t, NewJWTRSAAuthenticator(&key.PublicKey), signRS256(t, key, claims))
+	require.NoError(t, err)
+	assert.Equal(t, &apiauth.Principal{Name: "caller", Scheme: JWTScheme, Claims: map[string]string{"sub": "caller"}}, principal)
+
+	// A token signed with the public key as an HMAC secret must not verify.
+	_, err = authenticateJWT(t, NewJWTRSAAuthenticator(&key.PublicKey), signHS256(t, key.PublicKey.N.Bytes(), claims))
+	assert.EqualError(t, err, `unexpected JWT signing algorithm "HS256"`)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = authenticateJWT(t, NewJWTRSAAuthenticator(&key.PublicKey), signRS256(t, other, claims))
+	assert.EqualError(t, err, "invalid JWT signature")
+}
+
+func TestJWTNoCredentials(t *testing.T) {
+	_, err := NewJWTHMACAuthenticator([]byte("secret")).Authenticate(context.Background(), &transport.RequestMeta{
+		Headers: transport.NewHeaders().With(apiauth.HeaderKey, "HMAC token"),
+	})
+	assert.Equal(t, apiauth.ErrNoCredentials, err)
+}
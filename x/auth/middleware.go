@@ -0,0 +1,229 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package auth provides middleware that authenticates and authorizes the
+// callers of YARPC requests, and authentication schemes to use with it.
+//
+// The caller name a request carries is whatever the client sends. To verify
+// it, configure outbounds with an OutboundMiddleware that attaches
+// credentials, and inbounds with an InboundMiddleware that verifies them.
+//
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{
+// 		Name: "myservice",
+// 		InboundMiddleware: yarpc.InboundMiddleware{
+// 			Unary: auth.NewInboundMiddleware(auth.NewHMACAuthenticator(keys)),
+// 		},
+// 		OutboundMiddleware: yarpc.OutboundMiddleware{
+// 			Unary: auth.NewOutboundMiddleware(auth.NewHMACCredentials("myservice", key)),
+// 		},
+// 		...
+// 	})
+//
+// Handlers find the verified caller in their context.
+//
+// 	principal, ok := apiauth.PrincipalFromContext(ctx)
+//
+// Requests that fail authentication are rejected with
+// yarpcerrors.CodeUnauthenticated.
+//
+// An Authorizer placed after the InboundMiddleware allows or denies
+// authenticated callers according to a Policy.
+package auth
+
+import (
+	"context"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*InboundMiddleware)(nil)
+	_ middleware.OnewayInbound  = (*InboundMiddleware)(nil)
+	_ middleware.StreamInbound  = (*InboundMiddleware)(nil)
+	_ middleware.UnaryOutbound  = (*OutboundMiddleware)(nil)
+	_ middleware.OnewayOutbound = (*OutboundMiddleware)(nil)
+	_ middleware.StreamOutbound = (*OutboundMiddleware)(nil)
+)
+
+// InboundMiddleware authenticates the callers of inbound requests.
+//
+// Authenticators are tried in order until one finds credentials for its
+// scheme in the request. Requests without valid credentials are rejected.
+// The credentials header is removed from requests before they reach the
+// handler.
+type InboundMiddleware struct {
+	authenticators []apiauth.Authenticator
+}
+
+// NewInboundMiddleware builds an InboundMiddleware that verifies callers with
+// the given authenticators.
+func NewInboundMiddleware(authenticators ...apiauth.Authenticator) *InboundMiddleware {
+	return &InboundMiddleware{authenticators: authenticators}
+}
+
+// Handle implements middleware.UnaryInbound.
+func (m *InboundMiddleware) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	ctx, err := m.authenticate(ctx, req.ToRequestMeta())
+	if err != nil {
+		return err
+	}
+	authenticated := *req
+	authenticated.Headers = withoutCredentials(req.Headers)
+	return h.Handle(ctx, &authenticated, resw)
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (m *InboundMiddleware) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	ctx, err := m.authenticate(ctx, req.ToRequestMeta())
+	if err != nil {
+		return err
+	}
+	authenticated := *req
+	authenticated.Headers = withoutCredentials(req.Headers)
+	return h.HandleOneway(ctx, &authenticated)
+}
+
+// HandleStream implements middleware.StreamInbound.
+func (m *InboundMiddleware) HandleStream(s *transport.ServerStream, h transport.StreamHandler) error {
+	meta := s.Request().Meta
+	ctx, err := m.authenticate(s.Context(), meta)
+	if err != nil {
+		return err
+	}
+	authenticated := *meta
+	authenticated.Headers = withoutCredentials(meta.Headers)
+	stream, err := transport.NewServerStream(&authenticatedStream{
+		ServerStream: s,
+		ctx:          ctx,
+		req:          &transport.StreamRequest{Meta: &authenticated},
+	})
+	if err != nil {
+		return err
+	}
+	return h.HandleStream(stream)
+}
+
+func (m *InboundMiddleware) authenticate(ctx context.Context, req *transport.RequestMeta) (context.Context, error) {
+	for _, authenticator := range m.authenticators {
+		principal, err := authenticator.Authenticate(ctx, req)
+		if err == apiauth.ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return ctx, yarpcerrors.UnauthenticatedErrorf(
+				"failed to authenticate caller %q of procedure %q of service %q: %v",
+				req.Caller, req.Procedure, req.Service, err)
+		}
+		return apiauth.WithPrincipal(ctx, principal), nil
+	}
+	return ctx, yarpcerrors.UnauthenticatedErrorf(
+		"request to procedure %q of service %q from caller %q has no credentials",
+		req.Procedure, req.Service, req.Caller)
+}
+
+// authenticatedStream is a server stream with the authenticated context and
+// request.
+type authenticatedStream struct {
+	*transport.ServerStream
+
+	ctx context.Context
+	req *transport.StreamRequest
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authenticatedStream) Request() *transport.StreamRequest {
+	return s.req
+}
+
+// OutboundMiddleware attaches credentials to outbound requests.
+type OutboundMiddleware struct {
+	creds apiauth.Credentials
+}
+
+// NewOutboundMiddleware builds an OutboundMiddleware that attaches the given
+// credentials to requests.
+func NewOutboundMiddleware(creds apiauth.Credentials) *OutboundMiddleware {
+	return &OutboundMiddleware{creds: creds}
+}
+
+// Call implements middleware.UnaryOutbound.
+func (m *OutboundMiddleware) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	headers, err := m.withCredentials(ctx, req.ToRequestMeta())
+	if err != nil {
+		return nil, err
+	}
+	authenticated := *req
+	authenticated.Headers = headers
+	return out.Call(ctx, &authenticated)
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (m *OutboundMiddleware) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	headers, err := m.withCredentials(ctx, req.ToRequestMeta())
+	if err != nil {
+		return nil, err
+	}
+	authenticated := *req
+	authenticated.Headers = headers
+	return out.CallOneway(ctx, &authenticated)
+}
+
+// CallStream implements middleware.StreamOutbound.
+func (m *OutboundMiddleware) CallStream(ctx context.Context, req *transport.StreamRequest, out transport.StreamOutbound) (*transport.ClientStream, error) {
+	headers, err := m.withCredentials(ctx, req.Meta)
+	if err != nil {
+		return nil, err
+	}
+	authenticated := *req.Meta
+	authenticated.Headers = headers
+	return out.CallStream(ctx, &transport.StreamRequest{Meta: &authenticated})
+}
+
+// withCredentials returns a copy of the request headers with credentials.
+func (m *OutboundMiddleware) withCredentials(ctx context.Context, req *transport.RequestMeta) (transport.Headers, error) {
+	creds, err := m.creds.Credentials(ctx, req)
+	if err != nil {
+		return transport.Headers{}, yarpcerrors.UnauthenticatedErrorf(
+			"failed to get %s credentials for procedure %q of service %q: %v",
+			m.creds.Scheme(), req.Procedure, req.Service, err)
+	}
+	headers := transport.HeadersFromMap(req.Headers.OriginalItems())
+	return headers.With(apiauth.HeaderKey, m.creds.Scheme()+" "+creds), nil
+}
+
+// withoutCredentials returns the headers without the credentials header.
+func withoutCredentials(headers transport.Headers) transport.Headers {
+	if _, ok := headers.Get(apiauth.HeaderKey); !ok {
+		return headers
+	}
+	stripped := transport.NewHeadersWithCapacity(headers.Len())
+	for k, v := range headers.OriginalItems() {
+		if transport.CanonicalizeHeaderKey(k) != apiauth.HeaderKey {
+			stripped = stripped.With(k, v)
+		}
+	}
+	return stripped
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+	"go.uber.org/yarpc/encoding/raw"
+	"go.uber.org/yarpc/transport/http"
+	"go.uber.org/yarpc/x/auth"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestMiddleware(t *testing.T) {
+	keys := map[string][]byte{"caller": []byte("secret")}
+	client, stop := newHTTPClient(t, auth.NewInboundMiddleware(auth.NewHMACAuthenticator(keys)), auth.NewHMACCredentials("caller", []byte("secret")))
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := client.Call(ctx, "whoami", nil, yarpc.WithHeader("foo", "bar"))
+	require.NoError(t, err)
+	assert.Equal(t, "caller/HMAC/bar/", string(res))
+}
+
+func TestMiddlewareRejectsCallers(t *testing.T) {
+	keys := map[string][]byte{"caller": []byte("secret")}
+	inbound := auth.NewInboundMiddleware(auth.NewJWTHMACAuthenticator([]byte("secret")), auth.NewHMACAuthenticator(keys))
+
+	tests := []struct {
+		desc    string
+		creds   apiauth.Credentials
+		wantErr string
+	}{
+		{
+			desc:    "no credentials",
+			wantErr: `request to procedure "whoami" of service "server" from caller "client" has no credentials`,
+		},
+		{
+			desc:    "invalid credentials",
+			creds:   auth.NewHMACCredentials("caller", []byte("guess")),
+			wantErr: `failed to authenticate caller "client" of procedure "whoami" of service "server": invalid HMAC token signature for "caller"`,
+		},
+		{
+			desc: "credentials error",
+			creds: auth.NewJWTCredentials(func(context.Context, *transport.RequestMeta) (string, error) {
+				return "", errors.New("no token")
+			}),
+			wantErr: `failed to get Bearer credentials for procedure "whoami" of service "server": no token`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client, stop := newHTTPClient(t, inbound, tt.creds)
+			defer stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := client.Call(ctx, "whoami", nil)
+			require.Error(t, err)
+			assert.True(t, yarpcerrors.IsUnauthenticated(err), "unexpected error: %v", err)
+			assert.Equal(t, tt.wantErr, yarpcerrors.FromError(err).Message())
+		})
+	}
+}
+
+// newHTTPClient starts a server with the given middleware and returns a raw
+// client for it, attaching the given credentials if any.
+func newHTTPClient(t *testing.T, inboundMiddleware *auth.InboundMiddleware, creds apiauth.Credentials) (raw.Client, func()) {
+	trans := http.NewTransport()
+	inbound := trans.NewInbound("127.0.0.1:0")
+	server := yarpc.NewDispatcher(yarpc.Config{
+		Name:              "server",
+		Inbounds:          yarpc.Inbounds{inbound},
+		InboundMiddleware: yarpc.InboundMiddleware{Unary: inboundMiddleware},
+	})
+	server.Register(raw.Procedure("whoami", func(ctx context.Context, _ []byte) ([]byte, error) {
+		call := yarpc.CallFromContext(ctx)
+		principal, _ := apiauth.PrincipalFromContext(ctx)
+		// The credentials must not reach handlers.
+		return []byte(principal.Name + "/" + principal.Scheme + "/" + call.Header("foo") + "/" + call.Header(apiauth.HeaderKey)), nil
+	}))
+	require.NoError(t, server.Start())
+
+	var outboundMiddleware middleware.UnaryOutbound
+	if creds != nil {
+		outboundMiddleware = auth.NewOutboundMiddleware(creds)
+	}
+	client := yarpc.NewDispatcher(yarpc.Config{
+		Name: "client",
+		Outbounds: yarpc.Outbounds{
+			"server": {Unary: trans.NewSingleOutbound("http://" + inbound.Addr().String())},
+		},
+		OutboundMiddleware: yarpc.OutboundMiddleware{Unary: outboundMiddleware},
+	})
+	require.NoError(t, client.Start())
+
+	return raw.New(client.ClientConfig("server")), func() {
+		assert.NoError(t, client.Stop())
+		assert.NoError(t, server.Stop())
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+	"go.uber.org/yarpc/internal/tlsinfo"
+)
+
+// MTLSScheme is the authentication scheme of TLS client certificates.
+const MTLSScheme = "mTLS"
+
+// NewMTLSAuthenticator builds an authenticator that identifies callers by the
+// client certificate they presented to a gRPC or HTTP inbound over TLS.
+//
+// The inbound's TLS configuration must verify client certificates, for
+// example with tls.RequireAndVerifyClientCert. The name of the principal is
+// the first URI SAN of the certificate, such as a SPIFFE ID, or its common
+// name if it has no URI SANs.
+//
+// There are no credentials to attach to outbound requests: the client
+// certificate is presented by the outbound's TLS configuration.
+func NewMTLSAuthenticator() apiauth.Authenticator {
+	return mtlsAuthenticator{}
+}
+
+type mtlsAuthenticator struct{}
+
+func (mtlsAuthenticator) Authenticate(ctx context.Context, _ *transport.RequestMeta) (*apiauth.Principal, error) {
+	state, ok := tlsinfo.ConnectionState(ctx)
+	if !ok || len(state.PeerCertificates) == 0 {
+		return nil, apiauth.ErrNoCredentials
+	}
+	if len(state.VerifiedChains) == 0 {
+		return nil, errors.New("client certificate was not verified by the inbound's TLS configuration")
+	}
+
+	cert := state.PeerCertificates[0]
+	principal := &apiauth.Principal{
+		Name:   cert.Subject.CommonName,
+		Scheme: MTLSScheme,
+		Claims: make(map[string]string),
+	}
+	if cert.Subject.CommonName != "" {
+		principal.Claims["common_name"] = cert.Subject.CommonName
+	}
+	if len(cert.URIs) > 0 {
+		principal.Name = cert.URIs[0].String()
+		principal.Claims["uri"] = principal.Name
+	}
+	if principal.Name == "" {
+		return nil, errors.New("client certificate has no URI SAN or common name")
+	}
+	return principal, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	apiauth "go.uber.org/yarpc/api/x/auth"
+	"go.uber.org/yarpc/internal/prototest/examplepb"
+	"go.uber.org/yarpc/internal/tlsinfo"
+	"go.uber.org/yarpc/peer"
+	"go.uber.org/yarpc/peer/hostport"
+	"go.uber.org/yarpc/transport/grpc"
+	"go.uber.org/yarpc/x/auth"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestMTLSStream(t *testing.T) {
+	ca, caKey := newCertificate(t, "test ca", nil, nil, nil)
+	serverCert, serverKey := newCertificate(t, "server", nil, ca, caKey)
+	clientCert, clientKey := newCertificate(t, "client", &url.URL{Scheme: "spiffe", Host: "example.com", Path: "/client"}, ca, caKey)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	trans := grpc.NewTransport()
+	inboundMiddleware := auth.NewInboundMiddleware(auth.NewMTLSAuthenticator())
+	server := yarpc.NewDispatcher(yarpc.Config{
+		Name: "server",
+		Inbounds: yarpc.Inbounds{trans.NewInbound(listener, grpc.InboundCredentials(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		})))},
+		InboundMiddleware: yarpc.InboundMiddleware{Unary: inboundMiddleware, Stream: inboundMiddleware},
+	})
+	server.Register(examplepb.BuildFooYARPCProcedures(principalFooServer{}))
+	require.NoError(t, server.Start())
+	defer func() { assert.NoError(t, server.Stop()) }()
+
+	dialer := trans.NewDialer(grpc.DialerCredentials(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}},
+		RootCAs:      pool,
+	})))
+	client := yarpc.NewDispatcher(yarpc.Config{
+		Name: "client",
+		Outbounds: yarpc.Outbounds{
+			"server": {Stream: trans.NewOutbound(peer.NewSingle(hostport.Identify(listener.Addr().String()), dialer))},
+		},
+	})
+	require.NoError(t, client.Start())
+	defer func() { assert.NoError(t, client.Stop()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stream, err := examplepb.NewFooYARPCClient(client.ClientConfig("server")).EchoIn(ctx, &examplepb.EchoInRequest{})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://example.com/client", res.Message)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMTLSAuthenticator(t *testing.T) {
+	ca, caKey := newCertificate(t, "test ca", nil, nil, nil)
+	cert, _ := newCertificate(t, "client", nil, ca, caKey)
+	authenticator := auth.NewMTLSAuthenticator()
+
+	t.Run("no TLS", func(t *testing.T) {
+		_, err := authenticator.Authenticate(context.Background(), &transport.RequestMeta{})
+		assert.Equal(t, apiauth.ErrNoCredentials, err)
+	})
+
+	t.Run("unverified", func(t *testing.T) {
+		ctx := tlsinfo.WithConnectionState(context.Background(), tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+		})
+		_, err := authenticator.Authenticate(ctx, &transport.RequestMeta{})
+		assert.EqualError(t, err, "client certificate was not verified by the inbound's TLS configuration")
+	})
+
+	t.Run("common name", func(t *testing.T) {
+		ctx := tlsinfo.WithConnectionState(context.Background(), tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert, ca}},
+		})
+		principal, err := authenticator.Authenticate(ctx, &transport.RequestMeta{})
+		require.NoError(t, err)
+		assert.Equal(t, &apiauth.Principal{
+			Name:   "client",
+			Scheme: auth.MTLSScheme,
+			Claims: map[string]string{"common_name": "client"},
+		}, principal)
+	})
+}
+
+// principalFooServer streams the name of the verified caller back.
+type principalFooServer struct {
+	examplepb.FooYARPCServer
+}
+
+func (principalFooServer) EchoIn(_ *examplepb.EchoInRequest, server examplepb.FooServiceEchoInYARPCServer) error {
+	principal, _ := apiauth.PrincipalFromContext(server.Context())
+	return server.Send(&examplepb.EchoInResponse{Message: principal.Name})
+}
+
+// newCertificate creates a certificate signed by the given CA, or a CA if
+// none is given.
+func newCertificate(t *testing.T, commonName string, uri *url.URL, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	now := time.Now()
+	template := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: commonName},
+		SerialNumber: big.NewInt(now.UnixNano()),
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if uri != nil {
+		template.URIs = []*url.URL{uri}
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.BasicConstraintsValid = true
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca, caKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
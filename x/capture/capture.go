@@ -0,0 +1,559 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package capture records a sample of full inbound and outbound calls in
+// memory, so that they may be inspected while debugging a live service.
+//
+// A Recorder is unary and oneway middleware for both directions. It keeps
+// the most recent calls in a ring buffer: their metadata, headers, bodies
+// up to a size limit, errors and latencies.
+//
+// 	recorder := capture.NewRecorder(
+// 		capture.Percent(1),
+// 		capture.RateLimit(5),
+// 	)
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{
+// 		// ...
+// 		InboundMiddleware: yarpc.InboundMiddleware{
+// 			Unary:  recorder,
+// 			Oneway: recorder,
+// 		},
+// 		OutboundMiddleware: yarpc.OutboundMiddleware{
+// 			Unary:  recorder,
+// 			Oneway: recorder,
+// 		},
+// 	})
+//
+// Captured calls may be browsed on the page served by the x/debug package,
+// with the debug.Captures option. Bodies are decoded for display with the
+// Decoder registered for the call's encoding.
+//
+// Captured calls hold request and response data in memory, which may be
+// sensitive. Headers which look like they carry secrets are masked, and the
+// Redact option may scrub anything else before a call is stored.
+package capture
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/redact"
+)
+
+const (
+	_defaultCapacity    = 100
+	_defaultMaxBodySize = 64 * 1024
+	_defaultRateLimit   = 10
+
+	_redacted = "[REDACTED]"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*Recorder)(nil)
+	_ middleware.UnaryOutbound  = (*Recorder)(nil)
+	_ middleware.OnewayInbound  = (*Recorder)(nil)
+	_ middleware.OnewayOutbound = (*Recorder)(nil)
+)
+
+// Direction is the direction of a captured call.
+type Direction string
+
+const (
+	// Inbound calls were received by this service.
+	Inbound Direction = "inbound"
+
+	// Outbound calls were made by this service.
+	Outbound Direction = "outbound"
+)
+
+// Call is a captured call.
+type Call struct {
+	// ID identifies the call within its Recorder. IDs increase with each
+	// captured call.
+	ID uint64
+
+	Time      time.Time
+	Latency   time.Duration
+	Direction Direction
+	RPCType   transport.Type
+
+	Caller          string
+	Service         string
+	Procedure       string
+	Encoding        transport.Encoding
+	Transport       string
+	ShardKey        string
+	RoutingKey      string
+	RoutingDelegate string
+
+	RequestHeaders map[string]string
+	RequestBody    []byte
+	// RequestTruncated is true if only the beginning of the request body
+	// was captured.
+	RequestTruncated bool
+
+	ResponseHeaders   map[string]string
+	ResponseBody      []byte
+	ResponseTruncated bool
+
+	ApplicationError bool
+	// Error is the message of the error the call failed with, if any.
+	Error string
+}
+
+// Failed reports whether the call failed with an error or an application
+// error.
+func (c *Call) Failed() bool {
+	return c.Error != "" || c.ApplicationError
+}
+
+// Option customizes a Recorder.
+type Option func(*Recorder)
+
+// Capacity specifies the number of calls kept. Once full, the oldest calls
+// are discarded.
+//
+// Defaults to 100.
+func Capacity(capacity int) Option {
+	return func(r *Recorder) {
+		r.capacity = capacity
+	}
+}
+
+// Percent specifies the percentage of calls, between 0 and 100, that are
+// captured.
+//
+// Defaults to 100.
+func Percent(percent float64) Option {
+	return func(r *Recorder) {
+		r.percent = percent
+	}
+}
+
+// RateLimit specifies the maximum number of calls captured per second. Zero
+// means no limit.
+//
+// Defaults to 10.
+func RateLimit(perSecond int) Option {
+	return func(r *Recorder) {
+		r.rateLimit = perSecond
+	}
+}
+
+// MaxBodySize specifies the number of bytes of request and response bodies
+// that are captured. Bodies are not captured if it is zero or negative.
+//
+// Defaults to 64 KiB.
+func MaxBodySize(size int) Option {
+	return func(r *Recorder) {
+		r.maxBodySize = size
+	}
+}
+
+// Procedures limits capturing to calls to the given procedures. All
+// procedures are captured by default.
+func Procedures(procedures ...string) Option {
+	return func(r *Recorder) {
+		for _, p := range procedures {
+			r.procedures[p] = struct{}{}
+		}
+	}
+}
+
+// Redact adds a hook which may scrub sensitive data from calls before they
+// are stored. Hooks run in the order they were added, after headers which
+// look like they carry secrets have been masked.
+func Redact(f func(*Call)) Option {
+	return func(r *Recorder) {
+		r.redactors = append(r.redactors, f)
+	}
+}
+
+// WithDecoder registers the Decoder used to display bodies of the given
+// encoding, replacing the default Decoder for that encoding, if any.
+func WithDecoder(encoding transport.Encoding, d Decoder) Option {
+	return func(r *Recorder) {
+		r.decoders[encoding] = d
+	}
+}
+
+// Recorder is unary and oneway middleware which captures a sample of calls
+// in a ring buffer.
+type Recorder struct {
+	capacity    int
+	percent     float64
+	rateLimit   int
+	maxBodySize int
+	procedures  map[string]struct{}
+	redactors   []func(*Call)
+	decoders    map[transport.Encoding]Decoder
+
+	mu     sync.Mutex
+	calls  []Call // ring buffer
+	next   int    // index of the next call in calls
+	lastID uint64
+
+	window      time.Time // start of the current rate limiting window
+	windowCount int
+
+	// for tests
+	now    func() time.Time
+	random func() float64
+}
+
+// NewRecorder builds a new Recorder.
+func NewRecorder(opts ...Option) *Recorder {
+	r := &Recorder{
+		capacity:    _defaultCapacity,
+		percent:     100,
+		rateLimit:   _defaultRateLimit,
+		maxBodySize: _defaultMaxBodySize,
+		procedures:  make(map[string]struct{}),
+		decoders:    defaultDecoders(),
+		now:         time.Now,
+		random:      rand.Float64,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.capacity < 1 {
+		r.capacity = 1
+	}
+	if r.maxBodySize < 0 {
+		r.maxBodySize = 0
+	}
+	r.calls = make([]Call, 0, r.capacity)
+	return r
+}
+
+// Handle implements middleware.UnaryInbound.
+func (r *Recorder) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	if !r.sample(req) {
+		return h.Handle(ctx, req, resw)
+	}
+
+	call, req, err := r.begin(Inbound, transport.Unary, req)
+	if err != nil {
+		return err
+	}
+	w := &writer{ResponseWriter: resw, maxBodySize: r.maxBodySize}
+	err = h.Handle(ctx, req, w)
+
+	call.ResponseHeaders = w.headers
+	call.ResponseBody = w.body
+	call.ResponseTruncated = w.truncated
+	call.ApplicationError = w.applicationError
+	r.end(call, err)
+	return err
+}
+
+// Call implements middleware.UnaryOutbound.
+func (r *Recorder) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	if !r.sample(req) {
+		return out.Call(ctx, req)
+	}
+
+	call, req, err := r.begin(Outbound, transport.Unary, req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := out.Call(ctx, req)
+	if res != nil {
+		call.ResponseHeaders = copyHeaders(res.Headers)
+		call.ApplicationError = res.ApplicationError
+		if res.Body != nil && err == nil {
+			var body []byte
+			body, err = ioutil.ReadAll(res.Body)
+			if closeErr := res.Body.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				res = nil
+			} else {
+				call.ResponseBody, call.ResponseTruncated = r.truncate(body)
+
+				copied := *res
+				copied.Body = ioutil.NopCloser(bytes.NewReader(body))
+				res = &copied
+			}
+		}
+	}
+	r.end(call, err)
+	return res, err
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (r *Recorder) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	if !r.sample(req) {
+		return h.HandleOneway(ctx, req)
+	}
+
+	call, req, err := r.begin(Inbound, transport.Oneway, req)
+	if err != nil {
+		return err
+	}
+	err = h.HandleOneway(ctx, req)
+	r.end(call, err)
+	return err
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (r *Recorder) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	if !r.sample(req) {
+		return out.CallOneway(ctx, req)
+	}
+
+	call, req, err := r.begin(Outbound, transport.Oneway, req)
+	if err != nil {
+		return nil, err
+	}
+	ack, err := out.CallOneway(ctx, req)
+	r.end(call, err)
+	return ack, err
+}
+
+// sample decides whether to capture the call.
+func (r *Recorder) sample(req *transport.Request) bool {
+	if len(r.procedures) > 0 {
+		if _, ok := r.procedures[req.Procedure]; !ok {
+			return false
+		}
+	}
+	if r.random()*100 >= r.percent {
+		return false
+	}
+	if r.rateLimit <= 0 {
+		return true
+	}
+
+	now := r.now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.window) >= time.Second {
+		r.window = now
+		r.windowCount = 0
+	}
+	if r.windowCount >= r.rateLimit {
+		return false
+	}
+	r.windowCount++
+	return true
+}
+
+// begin captures the request, and returns a copy of it whose body may still
+// be read.
+func (r *Recorder) begin(direction Direction, rpcType transport.Type, req *transport.Request) (*Call, *transport.Request, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, nil, err
+		}
+	}
+	copied := *req
+	copied.Body = bytes.NewReader(body)
+
+	call := &Call{
+		Time:            r.now(),
+		Direction:       direction,
+		RPCType:         rpcType,
+		Caller:          req.Caller,
+		Service:         req.Service,
+		Procedure:       req.Procedure,
+		Encoding:        req.Encoding,
+		Transport:       req.Transport,
+		ShardKey:        req.ShardKey,
+		RoutingKey:      req.RoutingKey,
+		RoutingDelegate: req.RoutingDelegate,
+		RequestHeaders:  copyHeaders(req.Headers),
+	}
+	call.RequestBody, call.RequestTruncated = r.truncate(body)
+	return call, &copied, nil
+}
+
+// end stores the call.
+func (r *Recorder) end(call *Call, err error) {
+	call.Latency = r.now().Sub(call.Time)
+	if err != nil {
+		call.Error = err.Error()
+	}
+
+	maskSecretHeaders(call.RequestHeaders)
+	maskSecretHeaders(call.ResponseHeaders)
+	for _, f := range r.redactors {
+		f(call)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastID++
+	call.ID = r.lastID
+	if len(r.calls) < r.capacity {
+		r.calls = append(r.calls, *call)
+	} else {
+		r.calls[r.next] = *call
+	}
+	r.next = (r.next + 1) % r.capacity
+}
+
+func (r *Recorder) truncate(body []byte) ([]byte, bool) {
+	if len(body) <= r.maxBodySize {
+		return body, false
+	}
+	truncated := make([]byte, r.maxBodySize)
+	copy(truncated, body)
+	return truncated, true
+}
+
+// Filter selects captured calls. Empty fields match all calls.
+type Filter struct {
+	Direction Direction
+	Caller    string
+	Service   string
+	Procedure string
+
+	// FailedOnly selects only calls which failed.
+	FailedOnly bool
+
+	// Limit, if positive, is the maximum number of calls returned.
+	Limit int
+}
+
+func (f Filter) match(c *Call) bool {
+	return (f.Direction == "" || f.Direction == c.Direction) &&
+		(f.Caller == "" || f.Caller == c.Caller) &&
+		(f.Service == "" || f.Service == c.Service) &&
+		(f.Procedure == "" || f.Procedure == c.Procedure) &&
+		(!f.FailedOnly || c.Failed())
+}
+
+// Calls returns the captured calls matching the filter, most recent first.
+func (r *Recorder) Calls(f Filter) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calls []Call
+	for i := 0; i < len(r.calls); i++ {
+		// Walk backwards from the most recent call.
+		c := &r.calls[(r.next-1-i+len(r.calls))%len(r.calls)]
+		if !f.match(c) {
+			continue
+		}
+		calls = append(calls, *c)
+		if f.Limit > 0 && len(calls) == f.Limit {
+			break
+		}
+	}
+	return calls
+}
+
+// Get returns the captured call with the given ID, if it is still kept.
+func (r *Recorder) Get(id uint64) (Call, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.calls {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return Call{}, false
+}
+
+// Reset discards all captured calls.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = r.calls[:0]
+	r.next = 0
+}
+
+func copyHeaders(h transport.Headers) map[string]string {
+	if h.Len() == 0 {
+		return nil
+	}
+	headers := make(map[string]string, h.Len())
+	for k, v := range h.Items() {
+		headers[k] = v
+	}
+	return headers
+}
+
+func maskSecretHeaders(headers map[string]string) {
+	for k := range headers {
+		if redact.IsSecretHeader(k) {
+			headers[k] = _redacted
+		}
+	}
+}
+
+// writer captures the response written by an inbound handler.
+type writer struct {
+	transport.ResponseWriter
+
+	maxBodySize      int
+	headers          map[string]string
+	body             []byte
+	truncated        bool
+	applicationError bool
+}
+
+func (w *writer) AddHeaders(h transport.Headers) {
+	for k, v := range h.Items() {
+		if w.headers == nil {
+			w.headers = make(map[string]string, h.Len())
+		}
+		w.headers[k] = v
+	}
+	w.ResponseWriter.AddHeaders(h)
+}
+
+func (w *writer) SetApplicationError() {
+	w.applicationError = true
+	w.ResponseWriter.SetApplicationError()
+}
+
+func (w *writer) SetApplicationErrorMeta(meta *transport.ApplicationErrorMeta) {
+	if setter, ok := w.ResponseWriter.(transport.ApplicationErrorMetaSetter); ok {
+		setter.SetApplicationErrorMeta(meta)
+	}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if remaining := w.maxBodySize - len(w.body); remaining > 0 {
+		if len(p) > remaining {
+			w.body = append(w.body, p[:remaining]...)
+			w.truncated = true
+		} else {
+			w.body = append(w.body, p...)
+		}
+	} else if len(p) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(p)
+}
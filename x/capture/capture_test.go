@@ -0,0 +1,345 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+)
+
+type handlerFunc func(context.Context, *transport.Request, transport.ResponseWriter) error
+
+func (f handlerFunc) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+	return f(ctx, req, resw)
+}
+
+type onewayHandlerFunc func(context.Context, *transport.Request) error
+
+func (f onewayHandlerFunc) HandleOneway(ctx context.Context, req *transport.Request) error {
+	return f(ctx, req)
+}
+
+func newRequest(procedure, body string) *transport.Request {
+	return &transport.Request{
+		Caller:    "caller",
+		Service:   "service",
+		Procedure: procedure,
+		Encoding:  "raw",
+		Transport: "http",
+		Headers:   transport.NewHeaders().With("foo", "bar").With("Authorization", "Bearer secret"),
+		ShardKey:  "shard",
+		Body:      strings.NewReader(body),
+	}
+}
+
+// newTestRecorder builds a Recorder whose clock advances by a millisecond
+// every time it is read.
+func newTestRecorder(opts ...Option) *Recorder {
+	r := NewRecorder(opts...)
+	now := time.Unix(1500000000, 0)
+	r.now = func() time.Time {
+		now = now.Add(time.Millisecond)
+		return now
+	}
+	return r
+}
+
+func TestInbound(t *testing.T) {
+	r := newTestRecorder()
+
+	resw := new(transporttest.FakeResponseWriter)
+	err := r.Handle(context.Background(), newRequest("echo", "hello"), resw, handlerFunc(
+		func(_ context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			resw.AddHeaders(transport.NewHeaders().With("baz", "qux"))
+			resw.SetApplicationError()
+			_, err = resw.Write(body)
+			return err
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", resw.Body.String(), "response must pass through")
+	assert.True(t, resw.IsApplicationError)
+
+	calls := r.Calls(Filter{})
+	require.Len(t, calls, 1)
+	assert.Equal(t, Call{
+		ID:               1,
+		Time:             time.Unix(1500000000, 0).Add(2 * time.Millisecond),
+		Latency:          time.Millisecond,
+		Direction:        Inbound,
+		RPCType:          transport.Unary,
+		Caller:           "caller",
+		Service:          "service",
+		Procedure:        "echo",
+		Encoding:         "raw",
+		Transport:        "http",
+		ShardKey:         "shard",
+		RequestHeaders:   map[string]string{"foo": "bar", "authorization": "[REDACTED]"},
+		RequestBody:      []byte("hello"),
+		ResponseHeaders:  map[string]string{"baz": "qux"},
+		ResponseBody:     []byte("hello"),
+		ApplicationError: true,
+	}, calls[0])
+	assert.True(t, calls[0].Failed())
+}
+
+func TestInboundError(t *testing.T) {
+	r := newTestRecorder()
+
+	err := r.Handle(context.Background(), newRequest("echo", "hello"), new(transporttest.FakeResponseWriter), handlerFunc(
+		func(context.Context, *transport.Request, transport.ResponseWriter) error {
+			return errors.New("great sadness")
+		}))
+	require.Error(t, err)
+
+	calls := r.Calls(Filter{})
+	require.Len(t, calls, 1)
+	assert.Equal(t, "great sadness", calls[0].Error)
+	assert.True(t, calls[0].Failed())
+}
+
+func TestOutbound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	r := newTestRecorder()
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req *transport.Request) (*transport.Response, error) {
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(body), "request body must pass through")
+			return &transport.Response{
+				Headers: transport.NewHeaders().With("baz", "qux"),
+				Body:    ioutil.NopCloser(bytes.NewReader([]byte("world"))),
+			}, nil
+		})
+
+	res, err := r.Call(context.Background(), newRequest("echo", "hello"), out)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(body), "response body must pass through")
+
+	call, ok := r.Get(1)
+	require.True(t, ok)
+	assert.Equal(t, Outbound, call.Direction)
+	assert.Equal(t, []byte("hello"), call.RequestBody)
+	assert.Equal(t, []byte("world"), call.ResponseBody)
+	assert.Equal(t, map[string]string{"baz": "qux"}, call.ResponseHeaders)
+	assert.False(t, call.Failed())
+
+	_, ok = r.Get(2)
+	assert.False(t, ok)
+}
+
+func TestOneway(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	r := newTestRecorder()
+	require.NoError(t, r.HandleOneway(context.Background(), newRequest("inbound", "hello"), onewayHandlerFunc(
+		func(_ context.Context, req *transport.Request) error {
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(body))
+			return nil
+		})))
+
+	out := transporttest.NewMockOnewayOutbound(mockCtrl)
+	out.EXPECT().CallOneway(gomock.Any(), gomock.Any()).Return(nil, errors.New("great sadness"))
+	_, err := r.CallOneway(context.Background(), newRequest("outbound", "hello"), out)
+	require.Error(t, err)
+
+	calls := r.Calls(Filter{})
+	require.Len(t, calls, 2)
+	assert.Equal(t, "outbound", calls[0].Procedure)
+	assert.Equal(t, Outbound, calls[0].Direction)
+	assert.Equal(t, transport.Oneway, calls[0].RPCType)
+	assert.Equal(t, "great sadness", calls[0].Error)
+	assert.Equal(t, "inbound", calls[1].Procedure)
+	assert.Equal(t, Inbound, calls[1].Direction)
+	assert.Equal(t, []byte("hello"), calls[1].RequestBody)
+}
+
+func handle(t *testing.T, r *Recorder, procedure string) {
+	require.NoError(t, r.Handle(context.Background(), newRequest(procedure, "hello"), new(transporttest.FakeResponseWriter), handlerFunc(
+		func(context.Context, *transport.Request, transport.ResponseWriter) error {
+			return nil
+		})))
+}
+
+func TestRingBuffer(t *testing.T) {
+	r := newTestRecorder(Capacity(3), RateLimit(0))
+	for _, p := range []string{"a", "b", "c", "d", "e"} {
+		handle(t, r, p)
+	}
+
+	var procedures []string
+	for _, c := range r.Calls(Filter{}) {
+		procedures = append(procedures, c.Procedure)
+	}
+	assert.Equal(t, []string{"e", "d", "c"}, procedures)
+
+	_, ok := r.Get(2)
+	assert.False(t, ok, "evicted calls must not be found")
+	c, ok := r.Get(4)
+	require.True(t, ok)
+	assert.Equal(t, "d", c.Procedure)
+
+	r.Reset()
+	assert.Empty(t, r.Calls(Filter{}))
+	handle(t, r, "f")
+	c, ok = r.Get(6)
+	require.True(t, ok, "IDs must keep increasing after a reset")
+	assert.Equal(t, "f", c.Procedure)
+}
+
+func TestSampling(t *testing.T) {
+	r := newTestRecorder(Percent(50), RateLimit(0))
+	for _, v := range []float64{0.1, 0.6, 0.4, 0.9} {
+		v := v
+		r.random = func() float64 { return v }
+		handle(t, r, "p")
+	}
+	assert.Len(t, r.Calls(Filter{}), 2)
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	r := NewRecorder(RateLimit(2))
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		handle(t, r, "p")
+	}
+	assert.Len(t, r.Calls(Filter{}), 2)
+
+	now = now.Add(time.Second)
+	for i := 0; i < 5; i++ {
+		handle(t, r, "p")
+	}
+	assert.Len(t, r.Calls(Filter{}), 4)
+}
+
+func TestProcedures(t *testing.T) {
+	r := newTestRecorder(Procedures("a", "c"))
+	for _, p := range []string{"a", "b", "c"} {
+		handle(t, r, p)
+	}
+	assert.Len(t, r.Calls(Filter{}), 2)
+	assert.Empty(t, r.Calls(Filter{Procedure: "b"}))
+}
+
+func TestMaxBodySize(t *testing.T) {
+	r := newTestRecorder(MaxBodySize(4))
+	resw := new(transporttest.FakeResponseWriter)
+	require.NoError(t, r.Handle(context.Background(), newRequest("p", "hello"), resw, handlerFunc(
+		func(_ context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+			for _, s := range []string{"wo", "rl", "d"} {
+				if _, err := resw.Write([]byte(s)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})))
+	assert.Equal(t, "world", resw.Body.String())
+
+	c, ok := r.Get(1)
+	require.True(t, ok)
+	assert.Equal(t, []byte("hell"), c.RequestBody)
+	assert.True(t, c.RequestTruncated)
+	assert.Equal(t, []byte("worl"), c.ResponseBody)
+	assert.True(t, c.ResponseTruncated)
+}
+
+func TestNegativeMaxBodySize(t *testing.T) {
+	r := newTestRecorder(MaxBodySize(-1))
+	handle(t, r, "p")
+
+	c, ok := r.Get(1)
+	require.True(t, ok)
+	assert.Empty(t, c.RequestBody)
+	assert.True(t, c.RequestTruncated)
+}
+
+func TestRedact(t *testing.T) {
+	r := newTestRecorder(Redact(func(c *Call) {
+		c.RequestBody = nil
+		delete(c.RequestHeaders, "foo")
+	}))
+	handle(t, r, "p")
+
+	c, ok := r.Get(1)
+	require.True(t, ok)
+	assert.Nil(t, c.RequestBody)
+	assert.Equal(t, map[string]string{"authorization": "[REDACTED]"}, c.RequestHeaders)
+}
+
+func TestFilter(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	r := newTestRecorder(RateLimit(0))
+	handle(t, r, "a")
+	handle(t, r, "b")
+
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Call(gomock.Any(), gomock.Any()).Return(nil, errors.New("great sadness"))
+	req := newRequest("a", "hello")
+	req.Caller = "other"
+	_, err := r.Call(context.Background(), req, out)
+	require.Error(t, err)
+
+	tests := []struct {
+		filter Filter
+		want   []uint64
+	}{
+		{filter: Filter{}, want: []uint64{3, 2, 1}},
+		{filter: Filter{Limit: 2}, want: []uint64{3, 2}},
+		{filter: Filter{Direction: Inbound}, want: []uint64{2, 1}},
+		{filter: Filter{Direction: Outbound}, want: []uint64{3}},
+		{filter: Filter{Caller: "other"}, want: []uint64{3}},
+		{filter: Filter{Procedure: "a"}, want: []uint64{3, 1}},
+		{filter: Filter{Service: "service", Procedure: "b"}, want: []uint64{2}},
+		{filter: Filter{Service: "other"}},
+		{filter: Filter{FailedOnly: true}, want: []uint64{3}},
+	}
+	for _, tt := range tests {
+		var ids []uint64
+		for _, c := range r.Calls(tt.filter) {
+			ids = append(ids, c.ID)
+		}
+		assert.Equal(t, tt.want, ids, "filter %+v", tt.filter)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"go.uber.org/thriftrw/protocol"
+	"go.uber.org/thriftrw/wire"
+	"go.uber.org/yarpc/api/transport"
+)
+
+// Names of the encodings decoded by default. These match the encodings of
+// the go.uber.org/yarpc/encoding packages.
+const (
+	_jsonEncoding     transport.Encoding = "json"
+	_thriftEncoding   transport.Encoding = "thrift"
+	_protobufEncoding transport.Encoding = "proto"
+)
+
+// Decoder renders the bodies of calls of one encoding for display.
+type Decoder interface {
+	// Decode renders the request body of a call to the given procedure, or
+	// its response body if response is true.
+	Decode(procedure string, body []byte, response bool) (string, error)
+}
+
+// DecoderFunc is a Decoder implemented by a function.
+type DecoderFunc func(procedure string, body []byte, response bool) (string, error)
+
+// Decode implements Decoder.
+func (f DecoderFunc) Decode(procedure string, body []byte, response bool) (string, error) {
+	return f(procedure, body, response)
+}
+
+func defaultDecoders() map[transport.Encoding]Decoder {
+	return map[transport.Encoding]Decoder{
+		_jsonEncoding:     JSONDecoder(),
+		_thriftEncoding:   ThriftDecoder(),
+		_protobufEncoding: &protobufDecoder{},
+	}
+}
+
+// Decode renders the request and response bodies of the call with the
+// Decoder registered for its encoding. Bodies which cannot be decoded are
+// rendered as text if they are valid UTF-8, or as a hex dump otherwise.
+func (r *Recorder) Decode(c Call) (request, response string) {
+	d := r.decoders[c.Encoding]
+	return decodeBody(d, c.Procedure, c.RequestBody, false), decodeBody(d, c.Procedure, c.ResponseBody, true)
+}
+
+func decodeBody(d Decoder, procedure string, body []byte, response bool) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if d != nil {
+		if s, err := d.Decode(procedure, body, response); err == nil {
+			return s
+		}
+	}
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	return hex.Dump(body)
+}
+
+// JSONDecoder indents JSON bodies.
+func JSONDecoder() Decoder {
+	return DecoderFunc(func(_ string, body []byte, _ bool) (string, error) {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, body, "", "  "); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	})
+}
+
+// ThriftDecoder renders Thrift bodies from their Binary protocol encoding,
+// without the IDL. Struct fields are keyed by their field IDs.
+func ThriftDecoder() Decoder {
+	return DecoderFunc(func(_ string, body []byte, _ bool) (string, error) {
+		v, err := protocol.Binary.Decode(bytes.NewReader(body), wire.TStruct)
+		if err != nil {
+			// Enveloped requests begin with the message name and type.
+			e, envErr := protocol.Binary.DecodeEnveloped(bytes.NewReader(body))
+			if envErr != nil {
+				return "", err
+			}
+			v = e.Value
+		}
+		rendered, err := renderThrift(v)
+		if err != nil {
+			return "", err
+		}
+		return marshalIndent(rendered)
+	})
+}
+
+func renderThrift(v wire.Value) (interface{}, error) {
+	switch v.Type() {
+	case wire.TBool:
+		return v.GetBool(), nil
+	case wire.TI8:
+		return v.GetI8(), nil
+	case wire.TI16:
+		return v.GetI16(), nil
+	case wire.TI32:
+		return v.GetI32(), nil
+	case wire.TI64:
+		return v.GetI64(), nil
+	case wire.TDouble:
+		return v.GetDouble(), nil
+	case wire.TBinary:
+		return renderBytes(v.GetBinary()), nil
+	case wire.TStruct:
+		fields := make(map[string]interface{}, len(v.GetStruct().Fields))
+		for _, f := range v.GetStruct().Fields {
+			rendered, err := renderThrift(f.Value)
+			if err != nil {
+				return nil, err
+			}
+			fields[strconv.Itoa(int(f.ID))] = rendered
+		}
+		return fields, nil
+	case wire.TList:
+		return renderThriftList(v.GetList())
+	case wire.TSet:
+		return renderThriftList(v.GetSet())
+	case wire.TMap:
+		var items []interface{}
+		err := v.GetMap().ForEach(func(item wire.MapItem) error {
+			key, err := renderThrift(item.Key)
+			if err != nil {
+				return err
+			}
+			value, err := renderThrift(item.Value)
+			if err != nil {
+				return err
+			}
+			items = append(items, map[string]interface{}{"key": key, "value": value})
+			return nil
+		})
+		return items, err
+	}
+	return nil, fmt.Errorf("unknown Thrift type %v", v.Type())
+}
+
+func renderThriftList(l wire.ValueList) (interface{}, error) {
+	items := make([]interface{}, 0, l.Size())
+	err := l.ForEach(func(v wire.Value) error {
+		rendered, err := renderThrift(v)
+		if err != nil {
+			return err
+		}
+		items = append(items, rendered)
+		return nil
+	})
+	return items, err
+}
+
+// renderBytes renders binary data as a string if it is valid UTF-8. JSON
+// encodes other byte slices in base64.
+func renderBytes(b []byte) interface{} {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return b
+}
+
+func marshalIndent(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
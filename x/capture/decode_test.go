@@ -0,0 +1,188 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/thriftrw/protocol"
+	"go.uber.org/thriftrw/wire"
+	"go.uber.org/yarpc/internal/prototest/examplepb"
+)
+
+func TestDecodeFallback(t *testing.T) {
+	r := NewRecorder(WithDecoder("custom", DecoderFunc(func(string, []byte, bool) (string, error) {
+		return "", errors.New("great sadness")
+	})))
+
+	req, res := r.Decode(Call{Encoding: "custom", RequestBody: []byte("hello"), ResponseBody: []byte{0xff, 0x00}})
+	assert.Equal(t, "hello", req)
+	assert.Equal(t, hex.Dump([]byte{0xff, 0x00}), res)
+
+	req, res = r.Decode(Call{Encoding: "unknown"})
+	assert.Empty(t, req)
+	assert.Empty(t, res)
+}
+
+func TestDecodeCustom(t *testing.T) {
+	r := NewRecorder(WithDecoder("custom", DecoderFunc(func(procedure string, body []byte, response bool) (string, error) {
+		if response {
+			return procedure + " response: " + string(body), nil
+		}
+		return procedure + " request: " + string(body), nil
+	})))
+
+	req, res := r.Decode(Call{Encoding: "custom", Procedure: "p", RequestBody: []byte("a"), ResponseBody: []byte("b")})
+	assert.Equal(t, "p request: a", req)
+	assert.Equal(t, "p response: b", res)
+}
+
+func TestJSONDecoder(t *testing.T) {
+	got, err := JSONDecoder().Decode("p", []byte(`{"foo":[1,2]}`), false)
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"foo\": [\n    1,\n    2\n  ]\n}", got)
+
+	_, err = JSONDecoder().Decode("p", []byte(`{`), false)
+	assert.Error(t, err)
+}
+
+func TestThriftDecoder(t *testing.T) {
+	items := wire.NewValueList(wire.ValueListFromSlice(wire.TI32, []wire.Value{wire.NewValueI32(1), wire.NewValueI32(2)}))
+	v := wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+		{ID: 1, Value: wire.NewValueString("hello")},
+		{ID: 2, Value: wire.NewValueBool(true)},
+		{ID: 3, Value: items},
+		{ID: 4, Value: wire.NewValueStruct(wire.Struct{Fields: []wire.Field{
+			{ID: 1, Value: wire.NewValueI64(42)},
+		}})},
+	}})
+	var buf bytes.Buffer
+	require.NoError(t, protocol.Binary.Encode(v, &buf))
+
+	got, err := ThriftDecoder().Decode("p", buf.Bytes(), false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"1": "hello", "2": true, "3": [1, 2], "4": {"1": 42}}`, got)
+
+	_, err = ThriftDecoder().Decode("p", []byte("hello"), false)
+	assert.Error(t, err)
+}
+
+func TestProtobufDecoder(t *testing.T) {
+	result := examplepb.NewFxKeyValueYARPCProcedures().(func(examplepb.FxKeyValueYARPCProceduresParams) examplepb.FxKeyValueYARPCProceduresResult)(
+		examplepb.FxKeyValueYARPCProceduresParams{},
+	)
+	d, err := ProtobufDecoder(result.ReflectionMeta)
+	require.NoError(t, err)
+
+	const procedure = "uber.yarpc.internal.examples.protobuf.example.KeyValue::GetValue"
+	body, err := proto.Marshal(&examplepb.GetValueRequest{Key: "foo"})
+	require.NoError(t, err)
+	got, err := d.Decode(procedure, body, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"key": "foo"}`, got)
+
+	body, err = proto.Marshal(&examplepb.GetValueResponse{Value: "bar"})
+	require.NoError(t, err)
+	got, err = d.Decode(procedure, body, true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": "bar"}`, got)
+
+	body, err = proto.Marshal(&examplepb.EchoOutResponse{AllMessages: []string{"a", "b"}})
+	require.NoError(t, err)
+	got, err = d.Decode("uber.yarpc.internal.examples.protobuf.example.Foo::EchoOut", body, true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"all_messages": ["a", "b"]}`, got)
+
+	// Unknown procedures are decoded without descriptors.
+	got, err = d.Decode("unknown", body, true)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"2": "b"}`, got)
+
+	_, err = ProtobufDecoder(result.ReflectionMeta, examplepb.FxKeyValueYARPCProceduresResult{}.ReflectionMeta)
+	require.NoError(t, err)
+	result.ReflectionMeta.FileDescriptors = [][]byte{[]byte("not gzip")}
+	_, err = ProtobufDecoder(result.ReflectionMeta)
+	assert.Error(t, err)
+}
+
+func TestRawProtobuf(t *testing.T) {
+	d := NewRecorder().decoders[_protobufEncoding]
+
+	tests := []struct {
+		desc    string
+		body    []byte
+		want    string
+		wantErr bool
+	}{
+		{
+			desc: "varint",
+			body: []byte{0x08, 0x96, 0x01},
+			want: `{"1": 150}`,
+		},
+		{
+			desc: "fixed",
+			body: []byte{0x0d, 0x01, 0x00, 0x00, 0x00, 0x11, 0x02, 0, 0, 0, 0, 0, 0, 0},
+			want: `{"1": 1, "2": 2}`,
+		},
+		{
+			desc: "string",
+			body: []byte{0x12, 0x02, 'h', 'i'},
+			want: `{"2": "hi"}`,
+		},
+		{
+			desc: "nested message",
+			body: []byte{0x1a, 0x03, 0x08, 0x96, 0x01},
+			want: `{"3": {"1": 150}}`,
+		},
+		{
+			desc: "bytes",
+			body: []byte{0x1a, 0x02, 0xff, 0xff},
+			want: `{"3": "//8="}`,
+		},
+		{
+			desc:    "truncated",
+			body:    []byte{0x12, 0x05, 'h', 'i'},
+			wantErr: true,
+		},
+		{
+			desc:    "group",
+			body:    []byte{0x0b},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			got, err := d.Decode("p", tt.body, false)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package capture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"go.uber.org/yarpc/encoding/protobuf/reflection"
+	"go.uber.org/yarpc/pkg/procedure"
+)
+
+// Protobuf messages nested deeper than this are not decoded.
+const _maxProtobufDepth = 64
+
+var errMalformedProtobuf = errors.New("malformed protobuf message")
+
+// ProtobufDecoder renders Protobuf bodies using the file descriptors of the
+// given services, which protoc-gen-yarpc-go generates alongside their
+// procedures. Fields of messages which are not described are keyed by their
+// field numbers.
+//
+// Without descriptors, the default decoder for the "proto" encoding renders
+// all fields this way.
+func ProtobufDecoder(services ...reflection.ServerMeta) (Decoder, error) {
+	d := &protobufDecoder{
+		messages: make(map[string]*descriptor.DescriptorProto),
+		enums:    make(map[string]map[int32]string),
+		methods:  make(map[string]protobufMethod),
+	}
+	for _, service := range services {
+		for _, compressed := range service.FileDescriptors {
+			fd, err := decompressFileDescriptor(compressed)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read file descriptors of service %q: %v", service.ServiceName, err)
+			}
+			d.addFile(fd)
+		}
+	}
+	return d, nil
+}
+
+func decompressFileDescriptor(compressed []byte) (*descriptor.FileDescriptorProto, error) {
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var fd descriptor.FileDescriptorProto
+	if err := proto.Unmarshal(b, &fd); err != nil {
+		return nil, err
+	}
+	return &fd, nil
+}
+
+type protobufMethod struct {
+	input, output string
+}
+
+// protobufDecoder decodes the Protobuf wire format, naming fields after the
+// descriptors of their messages where known.
+type protobufDecoder struct {
+	messages map[string]*descriptor.DescriptorProto // by fully qualified name
+	enums    map[string]map[int32]string            // by fully qualified name
+	methods  map[string]protobufMethod              // by procedure name
+}
+
+func (d *protobufDecoder) addFile(fd *descriptor.FileDescriptorProto) {
+	prefix := "."
+	if fd.GetPackage() != "" {
+		prefix += fd.GetPackage() + "."
+	}
+	for _, m := range fd.GetMessageType() {
+		d.addMessage(prefix, m)
+	}
+	for _, e := range fd.GetEnumType() {
+		d.addEnum(prefix, e)
+	}
+	for _, s := range fd.GetService() {
+		service := prefix[1:] + s.GetName()
+		for _, m := range s.GetMethod() {
+			d.methods[procedure.ToName(service, m.GetName())] = protobufMethod{
+				input:  m.GetInputType(),
+				output: m.GetOutputType(),
+			}
+		}
+	}
+}
+
+func (d *protobufDecoder) addMessage(prefix string, m *descriptor.DescriptorProto) {
+	name := prefix + m.GetName()
+	d.messages[name] = m
+	for _, nested := range m.GetNestedType() {
+		d.addMessage(name+".", nested)
+	}
+	for _, e := range m.GetEnumType() {
+		d.addEnum(name+".", e)
+	}
+}
+
+func (d *protobufDecoder) addEnum(prefix string, e *descriptor.EnumDescriptorProto) {
+	values := make(map[int32]string, len(e.GetValue()))
+	for _, v := range e.GetValue() {
+		values[v.GetNumber()] = v.GetName()
+	}
+	d.enums[prefix+e.GetName()] = values
+}
+
+// Decode implements Decoder.
+func (d *protobufDecoder) Decode(procedure string, body []byte, response bool) (string, error) {
+	var msg *descriptor.DescriptorProto
+	if m, ok := d.methods[procedure]; ok {
+		if response {
+			msg = d.messages[m.output]
+		} else {
+			msg = d.messages[m.input]
+		}
+	}
+	fields, err := d.decodeMessage(msg, body, 0)
+	if err != nil {
+		return "", err
+	}
+	return marshalIndent(fields)
+}
+
+func (d *protobufDecoder) decodeMessage(msg *descriptor.DescriptorProto, b []byte, depth int) (map[string]interface{}, error) {
+	if depth > _maxProtobufDepth {
+		return nil, errors.New("protobuf message is nested too deeply")
+	}
+
+	fields := make(map[string]interface{})
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 || key>>3 == 0 {
+			return nil, errMalformedProtobuf
+		}
+		b = b[n:]
+
+		var (
+			wireType = key & 7
+			x        uint64
+			data     []byte
+		)
+		switch wireType {
+		case proto.WireVarint:
+			if x, n = binary.Uvarint(b); n <= 0 {
+				return nil, errMalformedProtobuf
+			}
+			b = b[n:]
+		case proto.WireFixed64:
+			if len(b) < 8 {
+				return nil, errMalformedProtobuf
+			}
+			x, b = binary.LittleEndian.Uint64(b), b[8:]
+		case proto.WireFixed32:
+			if len(b) < 4 {
+				return nil, errMalformedProtobuf
+			}
+			x, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case proto.WireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, errMalformedProtobuf
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return nil, fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+
+		field := findField(msg, int32(key>>3))
+		if field == nil {
+			fields[strconv.FormatUint(key>>3, 10)] = d.renderUnknown(wireType, x, data, depth)
+			continue
+		}
+
+		values, err := d.renderField(field, wireType, x, data, depth)
+		if err != nil {
+			return nil, err
+		}
+		if field.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			fields[field.GetName()] = values[0]
+			continue
+		}
+		repeated, _ := fields[field.GetName()].([]interface{})
+		fields[field.GetName()] = append(repeated, values...)
+	}
+	return fields, nil
+}
+
+func findField(msg *descriptor.DescriptorProto, number int32) *descriptor.FieldDescriptorProto {
+	if msg == nil {
+		return nil
+	}
+	for _, f := range msg.GetField() {
+		if f.GetNumber() == number {
+			return f
+		}
+	}
+	return nil
+}
+
+// renderField renders the value of a described field. Packed repeated fields
+// hold several values.
+func (d *protobufDecoder) renderField(field *descriptor.FieldDescriptorProto, wireType, x uint64, data []byte, depth int) ([]interface{}, error) {
+	if wireType != proto.WireBytes {
+		return []interface{}{d.renderScalar(field, x)}, nil
+	}
+
+	switch field.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return []interface{}{string(data)}, nil
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return []interface{}{data}, nil
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		msg, err := d.decodeMessage(d.messages[field.GetTypeName()], data, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{msg}, nil
+	}
+
+	// Packed repeated scalars.
+	var values []interface{}
+	for len(data) > 0 {
+		var x uint64
+		switch packedWireType(field.GetType()) {
+		case proto.WireFixed64:
+			if len(data) < 8 {
+				return nil, errMalformedProtobuf
+			}
+			x, data = binary.LittleEndian.Uint64(data), data[8:]
+		case proto.WireFixed32:
+			if len(data) < 4 {
+				return nil, errMalformedProtobuf
+			}
+			x, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		default:
+			var n int
+			if x, n = binary.Uvarint(data); n <= 0 {
+				return nil, errMalformedProtobuf
+			}
+			data = data[n:]
+		}
+		values = append(values, d.renderScalar(field, x))
+	}
+	return values, nil
+}
+
+func packedWireType(t descriptor.FieldDescriptorProto_Type) int {
+	switch t {
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE,
+		descriptor.FieldDescriptorProto_TYPE_FIXED64,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return proto.WireFixed64
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT,
+		descriptor.FieldDescriptorProto_TYPE_FIXED32,
+		descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return proto.WireFixed32
+	}
+	return proto.WireVarint
+}
+
+func (d *protobufDecoder) renderScalar(field *descriptor.FieldDescriptorProto, x uint64) interface{} {
+	switch field.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_INT64, descriptor.FieldDescriptorProto_TYPE_SFIXED64:
+		return int64(x)
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_SFIXED32:
+		return int32(x)
+	case descriptor.FieldDescriptorProto_TYPE_UINT32, descriptor.FieldDescriptorProto_TYPE_FIXED32:
+		return uint32(x)
+	case descriptor.FieldDescriptorProto_TYPE_SINT32:
+		return int32(uint32(x)>>1) ^ -int32(x&1)
+	case descriptor.FieldDescriptorProto_TYPE_SINT64:
+		return int64(x>>1) ^ -int64(x&1)
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return x != 0
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return math.Float64frombits(x)
+	case descriptor.FieldDescriptorProto_TYPE_FLOAT:
+		return math.Float32frombits(uint32(x))
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		if name, ok := d.enums[field.GetTypeName()][int32(x)]; ok {
+			return name
+		}
+		return int32(x)
+	}
+	return x
+}
+
+// renderUnknown renders a field without a descriptor from its wire type
+// alone. Length-delimited fields are rendered as text, nested messages or
+// bytes, in that order of preference.
+func (d *protobufDecoder) renderUnknown(wireType, x uint64, data []byte, depth int) interface{} {
+	if wireType != proto.WireBytes {
+		return x
+	}
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	if msg, err := d.decodeMessage(nil, data, depth+1); err == nil {
+		return msg
+	}
+	return data
+}
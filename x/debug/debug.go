@@ -21,13 +21,16 @@
 package debug
 
 import (
+	"encoding/json"
 	"html/template"
 	"io"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 
 	"go.uber.org/yarpc"
 	"go.uber.org/yarpc/internal/introspection"
+	"go.uber.org/yarpc/x/capture"
 	"go.uber.org/zap"
 )
 
@@ -77,6 +80,9 @@ var (
 			font-size: small;
 			text-align: right;
 		}
+		pre {
+			margin: 0;
+		}
 	</style>
 	</head>
 	<body>
@@ -169,6 +175,109 @@ var (
 		</tbody>
 		{{end}}
 	</table>
+{{end}}
+{{with .Stats}}
+	<hr />
+	<h2>Procedure Stats</h2>
+	<table>
+		<tr>
+			<th>Direction</th>
+			<th>Service</th>
+			<th>Procedure</th>
+			<th>Calls</th>
+			<th>Rate (/s)</th>
+			<th>p50</th>
+			<th>p90</th>
+			<th>p99</th>
+			<th>Errors</th>
+		</tr>
+		{{range .}}
+		<tr>
+			<td>{{.Direction}}</td>
+			<td>{{.Service}}</td>
+			<td>{{.Procedure}}</td>
+			<td>{{.Calls}}</td>
+			<td>{{printf "%.2f" .Rate}}</td>
+			<td>{{.LatencyP50}}</td>
+			<td>{{.LatencyP90}}</td>
+			<td>{{.LatencyP99}}</td>
+			<td>
+				{{.Errors}}
+				<ul>
+				{{range $code, $count := .ErrorCodes}}
+					<li>{{$code}}: {{$count}}</li>
+				{{end}}
+				</ul>
+			</td>
+		</tr>
+		{{end}}
+	</table>
+{{end}}
+{{with .Captures}}
+	<hr />
+	<h2>Captured Calls</h2>
+	<form method="get">
+		<select name="direction">
+			<option value="">any direction</option>
+			<option value="inbound" {{if eq .Filter.Direction "inbound"}}selected{{end}}>inbound</option>
+			<option value="outbound" {{if eq .Filter.Direction "outbound"}}selected{{end}}>outbound</option>
+		</select>
+		<input type="text" name="caller" placeholder="caller" value="{{.Filter.Caller}}" />
+		<input type="text" name="service" placeholder="service" value="{{.Filter.Service}}" />
+		<input type="text" name="procedure" placeholder="procedure" value="{{.Filter.Procedure}}" />
+		<label><input type="checkbox" name="failed" value="true" {{if .Filter.FailedOnly}}checked{{end}} /> failed only</label>
+		<input type="submit" value="Filter" />
+	</form>
+	<table>
+		<tr>
+			<th>ID</th>
+			<th>Time</th>
+			<th>Direction</th>
+			<th>Caller</th>
+			<th>Service</th>
+			<th>Procedure</th>
+			<th>Encoding</th>
+			<th>Transport</th>
+			<th>Latency</th>
+			<th>Error</th>
+		</tr>
+		{{range .Calls}}
+		<tr>
+			<td>{{.ID}}</td>
+			<td>{{.Time.Format "2006-01-02 15:04:05.000"}}</td>
+			<td>{{.Direction}}</td>
+			<td>{{.Caller}}</td>
+			<td>{{.Service}}</td>
+			<td>{{.Procedure}}</td>
+			<td>{{.Encoding}}</td>
+			<td>{{.Transport}}</td>
+			<td>{{.Latency}}</td>
+			<td>{{if .Error}}{{.Error}}{{else if .ApplicationError}}application error{{end}}</td>
+		</tr>
+		<tr>
+			<td colspan="10">
+				<details>
+					<summary>Request{{if .RequestTruncated}} (truncated){{end}}</summary>
+					<ul>
+					{{range $k, $v := .RequestHeaders}}
+						<li>{{$k}}: {{$v}}</li>
+					{{end}}
+					</ul>
+					<pre>{{.Request}}</pre>
+				</details>
+				<details>
+					<summary>Response{{if .ResponseTruncated}} (truncated){{end}}</summary>
+					<ul>
+					{{range $k, $v := .ResponseHeaders}}
+						<li>{{$k}}: {{$v}}</li>
+					{{end}}
+					</ul>
+					<pre>{{.Response}}</pre>
+				</details>
+			</td>
+		</tr>
+		{{end}}
+	</table>
 {{end}}
 	</body>
 </html>
@@ -180,10 +289,19 @@ func NewHandler(dispatcher *yarpc.Dispatcher, opts ...Option) http.HandlerFunc {
 	return newHandler(dispatcher, opts...).handle
 }
 
+// NewJSONHandler returns a http.HandlerFunc to expose dispatcher status,
+// package versions and, with the Stats option, procedure statistics as
+// JSON, for tools which scrape them.
+func NewJSONHandler(dispatcher *yarpc.Dispatcher, opts ...Option) http.HandlerFunc {
+	return newHandler(dispatcher, opts...).handleJSON
+}
+
 type handler struct {
 	dispatcher *yarpc.Dispatcher
 	logger     *zap.Logger
 	tmpl       templateIface
+	recorder   *capture.Recorder
+	stats      *StatsCollector
 }
 
 func newHandler(dispatcher *yarpc.Dispatcher, options ...Option) *handler {
@@ -192,10 +310,12 @@ func newHandler(dispatcher *yarpc.Dispatcher, options ...Option) *handler {
 		dispatcher: dispatcher,
 		logger:     opts.logger,
 		tmpl:       opts.tmpl,
+		recorder:   opts.recorder,
+		stats:      opts.stats,
 	}
 }
 
-func (h *handler) handle(responseWriter http.ResponseWriter, _ *http.Request) {
+func (h *handler) handle(responseWriter http.ResponseWriter, req *http.Request) {
 	defer func() {
 		if r := recover(); r != nil {
 			responseWriter.WriteHeader(http.StatusInternalServerError)
@@ -203,16 +323,47 @@ func (h *handler) handle(responseWriter http.ResponseWriter, _ *http.Request) {
 		}
 	}()
 	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := h.tmpl.Execute(responseWriter, newTmplData(h.dispatcher.Introspect())); err != nil {
+	data := newTmplData(h.dispatcher.Introspect())
+	if h.stats != nil {
+		data.Stats = h.stats.Procedures()
+	}
+	if h.recorder != nil {
+		data.Captures = newCapturesData(h.recorder, req)
+	}
+	if err := h.tmpl.Execute(responseWriter, data); err != nil {
 		// TODO: does this work, since we already tried a write?
 		responseWriter.WriteHeader(http.StatusInternalServerError)
 		h.logger.Error("yarpc/debug: failed executing template", zap.Error(err))
 	}
 }
 
+func (h *handler) handleJSON(responseWriter http.ResponseWriter, _ *http.Request) {
+	data := jsonData{Dispatcher: h.dispatcher.Introspect()}
+	if h.stats != nil {
+		data.ProcedureStats = h.stats.Procedures()
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+		h.logger.Error("yarpc/debug: failed marshaling status", zap.Error(err))
+		return
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	if _, err := responseWriter.Write(body); err != nil {
+		h.logger.Error("yarpc/debug: failed writing status", zap.Error(err))
+	}
+}
+
+type jsonData struct {
+	Dispatcher     introspection.DispatcherStatus `json:"dispatcher"`
+	ProcedureStats []ProcedureStats               `json:"procedureStats,omitempty"`
+}
+
 type tmplData struct {
 	Dispatchers     []introspection.DispatcherStatus
 	PackageVersions []introspection.PackageVersion
+	Stats           []ProcedureStats
+	Captures        *capturesData
 }
 
 func newTmplData(dispatcherStatus introspection.DispatcherStatus) *tmplData {
@@ -226,6 +377,43 @@ func newTmplData(dispatcherStatus introspection.DispatcherStatus) *tmplData {
 	}
 }
 
+type capturesData struct {
+	Filter capture.Filter
+	Calls  []capturedCall
+}
+
+// capturedCall is a captured call with its bodies decoded for display.
+type capturedCall struct {
+	capture.Call
+
+	Request  string
+	Response string
+}
+
+func newCapturesData(recorder *capture.Recorder, req *http.Request) *capturesData {
+	var filter capture.Filter
+	if req != nil {
+		query := req.URL.Query()
+		filter.Direction = capture.Direction(query.Get("direction"))
+		filter.Caller = query.Get("caller")
+		filter.Service = query.Get("service")
+		filter.Procedure = query.Get("procedure")
+		filter.FailedOnly, _ = strconv.ParseBool(query.Get("failed"))
+		filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	}
+
+	calls := recorder.Calls(filter)
+	data := &capturesData{
+		Filter: filter,
+		Calls:  make([]capturedCall, len(calls)),
+	}
+	for i, c := range calls {
+		data.Calls[i].Call = c
+		data.Calls[i].Request, data.Calls[i].Response = recorder.Decode(c)
+	}
+	return data
+}
+
 // templateIface represents a template created from either the html/template
 // or text/template packages.
 type templateIface interface {
@@ -21,16 +21,22 @@
 package debug
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"text/template"
 
 	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/x/capture"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	yarpchttp "go.uber.org/yarpc/transport/http"
 )
@@ -76,6 +82,113 @@ func TestHandlerError(t *testing.T) {
 	require.Equal(t, http.StatusInternalServerError, responseRecorder.Code)
 }
 
+type handlerFunc func(context.Context, *transport.Request, transport.ResponseWriter) error
+
+func (f handlerFunc) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+	return f(ctx, req, resw)
+}
+
+func TestHandlerCaptures(t *testing.T) {
+	recorder := capture.NewRecorder()
+	for _, procedure := range []string{"first", "second"} {
+		req := &transport.Request{
+			Caller:    "caller",
+			Service:   "service",
+			Procedure: procedure,
+			Encoding:  "json",
+			Body:      strings.NewReader(`{"hello":"world"}`),
+		}
+		err := recorder.Handle(context.Background(), req, new(transporttest.FakeResponseWriter), handlerFunc(
+			func(context.Context, *transport.Request, transport.ResponseWriter) error {
+				return nil
+			}))
+		require.NoError(t, err)
+	}
+	handler := NewHandler(newTestDispatcher(), Captures(recorder))
+
+	responseRecorder := httptest.NewRecorder()
+	handler(responseRecorder, httptest.NewRequest("GET", "/debug/yarpc?procedure=second", nil))
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	body := responseRecorder.Body.String()
+	assert.Contains(t, body, "Captured Calls")
+	assert.Contains(t, body, "<td>second</td>")
+	assert.NotContains(t, body, "<td>first</td>")
+	assert.Contains(t, body, "&#34;hello&#34;: &#34;world&#34;", "request body must be decoded")
+
+	// The handler does not require a request.
+	responseRecorder = httptest.NewRecorder()
+	handler(responseRecorder, nil)
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	body = responseRecorder.Body.String()
+	assert.Contains(t, body, "<td>first</td>")
+	assert.Contains(t, body, "<td>second</td>")
+}
+
+func TestHandlerStats(t *testing.T) {
+	stats := NewStatsCollector()
+	req := &transport.Request{Service: "service", Procedure: "procedure"}
+	err := stats.Handle(context.Background(), req, new(transporttest.FakeResponseWriter), handlerFunc(
+		func(context.Context, *transport.Request, transport.ResponseWriter) error {
+			return errors.New("great sadness")
+		}))
+	require.Error(t, err)
+
+	responseRecorder := httptest.NewRecorder()
+	NewHandler(newTestDispatcher(), Stats(stats))(responseRecorder, nil)
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	body := responseRecorder.Body.String()
+	assert.Contains(t, body, "Procedure Stats")
+	assert.Contains(t, body, "<td>procedure</td>")
+	assert.Contains(t, body, "<li>unknown: 1</li>")
+}
+
+func TestJSONHandler(t *testing.T) {
+	dispatcher := newTestDispatcher()
+	stats := NewStatsCollector()
+	req := &transport.Request{Service: "service", Procedure: "procedure"}
+	require.NoError(t, stats.Handle(context.Background(), req, new(transporttest.FakeResponseWriter), handlerFunc(
+		func(context.Context, *transport.Request, transport.ResponseWriter) error {
+			return nil
+		})))
+
+	responseRecorder := httptest.NewRecorder()
+	NewJSONHandler(dispatcher, Stats(stats))(responseRecorder, nil)
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.Equal(t, "application/json", responseRecorder.Header().Get("Content-Type"))
+
+	var got struct {
+		Dispatcher struct {
+			Name      string `json:"name"`
+			Outbounds []struct {
+				OutboundKey string `json:"outboundkey"`
+				State       string `json:"state"`
+				Chooser     struct {
+					Peers []struct {
+						Identifier       string `json:"identifier"`
+						ConnectionStatus string `json:"connectionStatus"`
+						PendingRequests  int    `json:"pendingRequests"`
+					} `json:"peers"`
+				} `json:"chooser"`
+			} `json:"outbounds"`
+		} `json:"dispatcher"`
+		ProcedureStats []ProcedureStats `json:"procedureStats"`
+	}
+	require.NoError(t, json.Unmarshal(responseRecorder.Body.Bytes(), &got))
+	assert.Equal(t, "test", got.Dispatcher.Name)
+	require.Len(t, got.Dispatcher.Outbounds, 2)
+	assert.Equal(t, "test-client", got.Dispatcher.Outbounds[0].OutboundKey)
+	assert.Equal(t, "Stopped", got.Dispatcher.Outbounds[0].State)
+	require.Len(t, got.ProcedureStats, 1)
+	assert.Equal(t, "procedure", got.ProcedureStats[0].Procedure)
+	assert.Equal(t, int64(1), got.ProcedureStats[0].Calls)
+
+	// Procedure statistics are omitted without the Stats option.
+	responseRecorder = httptest.NewRecorder()
+	NewJSONHandler(dispatcher)(responseRecorder, nil)
+	require.Equal(t, http.StatusOK, responseRecorder.Code)
+	assert.NotContains(t, responseRecorder.Body.String(), "procedureStats")
+}
+
 func newTestDispatcher() *yarpc.Dispatcher {
 	httpTransport := yarpchttp.NewTransport()
 	return yarpc.NewDispatcher(yarpc.Config{
@@ -20,7 +20,10 @@
 
 package debug
 
-import "go.uber.org/zap"
+import (
+	"go.uber.org/yarpc/x/capture"
+	"go.uber.org/zap"
+)
 
 // Option is an interface for customizing debug handlers.
 type Option interface {
@@ -31,8 +34,10 @@ type optionFunc func(*options)
 
 // opts represents the combined options supplied by the user.
 type options struct {
-	logger *zap.Logger
-	tmpl   templateIface
+	logger   *zap.Logger
+	tmpl     templateIface
+	recorder *capture.Recorder
+	stats    *StatsCollector
 }
 
 // Logger specifies the logger that should be used to log.
@@ -43,6 +48,23 @@ func Logger(logger *zap.Logger) Option {
 	})
 }
 
+// Captures lists the calls captured by the given Recorder on the page, with
+// their decoded bodies. The list may be filtered with the direction, caller,
+// service, procedure, failed and limit query parameters.
+func Captures(recorder *capture.Recorder) Option {
+	return optionFunc(func(opts *options) {
+		opts.recorder = recorder
+	})
+}
+
+// Stats shows the per-procedure statistics kept by the given StatsCollector:
+// request rates, latency percentiles and error codes.
+func Stats(stats *StatsCollector) Option {
+	return optionFunc(func(opts *options) {
+		opts.stats = stats
+	})
+}
+
 // tmpl specifies the template to use.
 // It is only used for testing.
 func tmpl(tmpl templateIface) Option {
@@ -25,6 +25,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/x/capture"
 	"go.uber.org/zap"
 )
 
@@ -40,3 +41,15 @@ func TestNilLoggerOption(t *testing.T) {
 	opts := applyOptions()
 	assert.NotNil(t, opts.logger)
 }
+
+func TestCapturesOption(t *testing.T) {
+	recorder := capture.NewRecorder()
+	opts := applyOptions(Captures(recorder))
+	assert.Equal(t, recorder, opts.recorder)
+}
+
+func TestStatsOption(t *testing.T) {
+	stats := NewStatsCollector()
+	opts := applyOptions(Stats(stats))
+	assert.Equal(t, stats, opts.stats)
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package debug
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+const (
+	// Request rates are averaged over this many one-second buckets.
+	_rateWindow = 60
+
+	// Latency percentiles are computed over this many most recent calls of a
+	// procedure.
+	_latencySamples = 1024
+
+	_applicationError = "application-error"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*StatsCollector)(nil)
+	_ middleware.UnaryOutbound  = (*StatsCollector)(nil)
+	_ middleware.OnewayInbound  = (*StatsCollector)(nil)
+	_ middleware.OnewayOutbound = (*StatsCollector)(nil)
+)
+
+// StatsCollector is unary and oneway middleware which keeps live statistics
+// of the calls of each procedure, for display by the debug handlers with
+// the Stats option.
+//
+// 	stats := debug.NewStatsCollector()
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{
+// 		// ...
+// 		InboundMiddleware: yarpc.InboundMiddleware{
+// 			Unary:  stats,
+// 			Oneway: stats,
+// 		},
+// 		OutboundMiddleware: yarpc.OutboundMiddleware{
+// 			Unary:  stats,
+// 			Oneway: stats,
+// 		},
+// 	})
+// 	http.Handle("/debug/yarpc", debug.NewHandler(dispatcher, debug.Stats(stats)))
+type StatsCollector struct {
+	mu         sync.Mutex
+	procedures map[statsKey]*procedureStats
+
+	now func() time.Time // for tests
+}
+
+type statsKey struct {
+	direction string
+	service   string
+	procedure string
+}
+
+type procedureStats struct {
+	calls  int64
+	errors int64
+	codes  map[string]int64
+
+	// Number of calls in each of the last seconds, indexed by Unix time
+	// modulo _rateWindow.
+	buckets     [_rateWindow]int64
+	bucketTimes [_rateWindow]int64
+
+	latencies     [_latencySamples]time.Duration // ring buffer
+	latencyCount  int
+	latencyCursor int
+}
+
+// ProcedureStats are live statistics of the calls of a procedure, in one
+// direction.
+type ProcedureStats struct {
+	// Direction is "inbound" or "outbound".
+	Direction string `json:"direction"`
+	Service   string `json:"service"`
+	Procedure string `json:"procedure"`
+
+	Calls  int64 `json:"calls"`
+	Errors int64 `json:"errors"`
+	// ErrorCodes counts failed calls by their error code. Application
+	// errors are counted under "application-error".
+	ErrorCodes map[string]int64 `json:"errorCodes,omitempty"`
+
+	// Rate is the average number of calls per second over the last minute.
+	Rate float64 `json:"rate"`
+
+	// Latency percentiles over the most recent calls.
+	LatencyP50 time.Duration `json:"latencyP50"`
+	LatencyP90 time.Duration `json:"latencyP90"`
+	LatencyP99 time.Duration `json:"latencyP99"`
+}
+
+// NewStatsCollector builds a new StatsCollector.
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{
+		procedures: make(map[statsKey]*procedureStats),
+		now:        time.Now,
+	}
+}
+
+// Handle implements middleware.UnaryInbound.
+func (c *StatsCollector) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	start := c.now()
+	w := &statsWriter{ResponseWriter: resw}
+	err := h.Handle(ctx, req, w)
+	c.record("inbound", req, start, err, w.applicationError)
+	return err
+}
+
+// Call implements middleware.UnaryOutbound.
+func (c *StatsCollector) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	start := c.now()
+	res, err := out.Call(ctx, req)
+	c.record("outbound", req, start, err, res != nil && res.ApplicationError)
+	return res, err
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (c *StatsCollector) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	start := c.now()
+	err := h.HandleOneway(ctx, req)
+	c.record("inbound", req, start, err, false)
+	return err
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (c *StatsCollector) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	start := c.now()
+	ack, err := out.CallOneway(ctx, req)
+	c.record("outbound", req, start, err, false)
+	return ack, err
+}
+
+func (c *StatsCollector) record(direction string, req *transport.Request, start time.Time, err error, applicationError bool) {
+	end := c.now()
+	key := statsKey{direction: direction, service: req.Service, procedure: req.Procedure}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.procedures[key]
+	if !ok {
+		s = &procedureStats{codes: make(map[string]int64)}
+		c.procedures[key] = s
+	}
+
+	s.calls++
+	switch {
+	case err != nil:
+		s.errors++
+		s.codes[yarpcerrors.FromError(err).Code().String()]++
+	case applicationError:
+		s.errors++
+		s.codes[_applicationError]++
+	}
+
+	sec := end.Unix()
+	i := sec % _rateWindow
+	if s.bucketTimes[i] != sec {
+		s.bucketTimes[i] = sec
+		s.buckets[i] = 0
+	}
+	s.buckets[i]++
+
+	s.latencies[s.latencyCursor] = end.Sub(start)
+	s.latencyCursor = (s.latencyCursor + 1) % _latencySamples
+	if s.latencyCount < _latencySamples {
+		s.latencyCount++
+	}
+}
+
+// Procedures returns the statistics of all procedures called so far,
+// sorted by direction, service and procedure.
+func (c *StatsCollector) Procedures() []ProcedureStats {
+	now := c.now().Unix()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]ProcedureStats, 0, len(c.procedures))
+	for key, s := range c.procedures {
+		ps := ProcedureStats{
+			Direction: key.direction,
+			Service:   key.service,
+			Procedure: key.procedure,
+			Calls:     s.calls,
+			Errors:    s.errors,
+		}
+		if len(s.codes) > 0 {
+			ps.ErrorCodes = make(map[string]int64, len(s.codes))
+			for code, n := range s.codes {
+				ps.ErrorCodes[code] = n
+			}
+		}
+
+		var recent int64
+		for i, t := range s.bucketTimes {
+			if now-t < _rateWindow {
+				recent += s.buckets[i]
+			}
+		}
+		ps.Rate = float64(recent) / _rateWindow
+
+		latencies := make([]time.Duration, s.latencyCount)
+		copy(latencies, s.latencies[:s.latencyCount])
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		ps.LatencyP50 = percentile(latencies, 50)
+		ps.LatencyP90 = percentile(latencies, 90)
+		ps.LatencyP99 = percentile(latencies, 99)
+
+		stats = append(stats, ps)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Direction != stats[j].Direction {
+			return stats[i].Direction < stats[j].Direction
+		}
+		if stats[i].Service != stats[j].Service {
+			return stats[i].Service < stats[j].Service
+		}
+		return stats[i].Procedure < stats[j].Procedure
+	})
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// statsWriter records whether an inbound handler responded with an
+// application error.
+type statsWriter struct {
+	transport.ResponseWriter
+
+	applicationError bool
+}
+
+func (w *statsWriter) SetApplicationError() {
+	w.applicationError = true
+	w.ResponseWriter.SetApplicationError()
+}
+
+func (w *statsWriter) SetApplicationErrorMeta(meta *transport.ApplicationErrorMeta) {
+	if setter, ok := w.ResponseWriter.(transport.ApplicationErrorMetaSetter); ok {
+		setter.SetApplicationErrorMeta(meta)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package debug
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+type onewayHandlerFunc func(context.Context, *transport.Request) error
+
+func (f onewayHandlerFunc) HandleOneway(ctx context.Context, req *transport.Request) error {
+	return f(ctx, req)
+}
+
+// newTestStatsCollector builds a StatsCollector whose calls take as many
+// milliseconds as the values of latencies, in order.
+func newTestStatsCollector(now *time.Time, latencies ...int) *StatsCollector {
+	c := NewStatsCollector()
+	started := false
+	c.now = func() time.Time {
+		if started && len(latencies) > 0 {
+			*now = now.Add(time.Duration(latencies[0]) * time.Millisecond)
+			latencies = latencies[1:]
+		}
+		started = !started
+		return *now
+	}
+	return c
+}
+
+func TestStatsCollector(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	now := time.Unix(1500000000, 0)
+	latencies := make([]int, 0, 100)
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, i)
+	}
+	c := newTestStatsCollector(&now, latencies...)
+	ctx := context.Background()
+	req := &transport.Request{Service: "service", Procedure: "inbound"}
+
+	for i := 0; i < 97; i++ {
+		require.NoError(t, c.Handle(ctx, req, new(transporttest.FakeResponseWriter), handlerFunc(
+			func(context.Context, *transport.Request, transport.ResponseWriter) error {
+				return nil
+			})))
+	}
+	resw := new(transporttest.FakeResponseWriter)
+	require.NoError(t, c.Handle(ctx, req, resw, handlerFunc(
+		func(_ context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+			resw.SetApplicationError()
+			return nil
+		})))
+	assert.True(t, resw.IsApplicationError)
+	for i := 0; i < 2; i++ {
+		err := c.Handle(ctx, req, new(transporttest.FakeResponseWriter), handlerFunc(
+			func(context.Context, *transport.Request, transport.ResponseWriter) error {
+				return yarpcerrors.UnavailableErrorf("great sadness")
+			}))
+		require.Error(t, err)
+	}
+
+	out := transporttest.NewMockUnaryOutbound(mockCtrl)
+	out.EXPECT().Call(gomock.Any(), gomock.Any()).Return(nil, yarpcerrors.DeadlineExceededErrorf("too slow"))
+	_, err := c.Call(ctx, &transport.Request{Service: "other", Procedure: "outbound"}, out)
+	require.Error(t, err)
+
+	oneway := transporttest.NewMockOnewayOutbound(mockCtrl)
+	oneway.EXPECT().CallOneway(gomock.Any(), gomock.Any()).Return(nil, nil)
+	_, err = c.CallOneway(ctx, &transport.Request{Service: "other", Procedure: "oneway"}, oneway)
+	require.NoError(t, err)
+	require.NoError(t, c.HandleOneway(ctx, &transport.Request{Service: "service", Procedure: "oneway"}, onewayHandlerFunc(
+		func(context.Context, *transport.Request) error {
+			return nil
+		})))
+
+	stats := c.Procedures()
+	require.Len(t, stats, 4)
+	assert.Equal(t, ProcedureStats{
+		Direction: "inbound",
+		Service:   "service",
+		Procedure: "inbound",
+		Calls:     100,
+		Errors:    3,
+		ErrorCodes: map[string]int64{
+			"application-error": 1,
+			"unavailable":       2,
+		},
+		LatencyP50: 50 * time.Millisecond,
+		LatencyP90: 90 * time.Millisecond,
+		LatencyP99: 99 * time.Millisecond,
+	}, withoutRate(stats[0]))
+	assert.Equal(t, "oneway", stats[1].Procedure)
+	assert.Equal(t, "inbound", stats[1].Direction)
+	assert.Equal(t, "oneway", stats[2].Procedure)
+	assert.Equal(t, "outbound", stats[2].Direction)
+	assert.Equal(t, ProcedureStats{
+		Direction:  "outbound",
+		Service:    "other",
+		Procedure:  "outbound",
+		Calls:      1,
+		Errors:     1,
+		ErrorCodes: map[string]int64{"deadline-exceeded": 1},
+	}, withoutRate(stats[3]))
+}
+
+func withoutRate(s ProcedureStats) ProcedureStats {
+	s.Rate = 0
+	return s
+}
+
+func TestStatsCollectorRate(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	c := newTestStatsCollector(&now)
+	req := &transport.Request{Service: "service", Procedure: "procedure"}
+	handle := func(n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, c.Handle(context.Background(), req, new(transporttest.FakeResponseWriter), handlerFunc(
+				func(context.Context, *transport.Request, transport.ResponseWriter) error {
+					return nil
+				})))
+		}
+	}
+
+	handle(60)
+	now = now.Add(30 * time.Second)
+	handle(60)
+	assert.Equal(t, 2.0, c.Procedures()[0].Rate)
+
+	// Calls older than a minute no longer count.
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, 1.0, c.Procedures()[0].Rate)
+
+	now = now.Add(time.Minute)
+	stats := c.Procedures()[0]
+	assert.Equal(t, 0.0, stats.Rate)
+	assert.Equal(t, int64(120), stats.Calls)
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+	assert.Equal(t, time.Second, percentile([]time.Duration{time.Second}, 1))
+	assert.Equal(t, 2*time.Second, percentile([]time.Duration{time.Second, 2 * time.Second}, 99))
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package failover
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+// outboundConfig configures an Outbound whose clusters are other outbounds
+// of a configuration.
+type outboundConfig struct {
+	Clusters          []string      `config:"clusters"`
+	MinAvailablePeers int           `config:"minAvailablePeers"`
+	MaxErrorRate      float64       `config:"maxErrorRate"`
+	MinRequests       int           `config:"minRequests"`
+	Window            time.Duration `config:"window"`
+	Cooldown          time.Duration `config:"cooldown"`
+}
+
+// OutboundSpec returns a specification that teaches a
+// yarpcconfig.Configurator to build Outbounds configured with the 'failover'
+// attribute, whose clusters are other outbounds of the configuration in
+// priority order.
+//
+// 	cfg := yarpcconfig.New(yarpcconfig.Logger(logger))
+// 	cfg.MustRegisterCompositeOutbound(failover.OutboundSpec())
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    failover:
+// 	      clusters: [keyvalue-east, keyvalue-west]
+// 	      minAvailablePeers: 2
+// 	      maxErrorRate: 0.5
+// 	      minRequests: 10
+// 	      window: 10s
+// 	      cooldown: 30s
+// 	  keyvalue-east:
+// 	    http: {url: "http://keyvalue-east/yarpc"}
+// 	  keyvalue-west:
+// 	    http: {url: "http://keyvalue-west/yarpc"}
+//
+// Changes of the active cluster are logged with the logger of the
+// Configurator.
+func OutboundSpec() yarpcconfig.CompositeOutboundSpec {
+	return yarpcconfig.CompositeOutboundSpec{
+		Name:           "failover",
+		BuildOutbounds: buildOutbounds,
+	}
+}
+
+func buildOutbounds(c outboundConfig, kit *yarpcconfig.Kit) (transport.Outbounds, error) {
+	cfg := Config{
+		MinAvailablePeers: c.MinAvailablePeers,
+		MaxErrorRate:      c.MaxErrorRate,
+		MinRequests:       c.MinRequests,
+		Window:            c.Window,
+		Cooldown:          c.Cooldown,
+		Logger:            kit.Logger(),
+	}
+	for _, name := range c.Clusters {
+		outs, ok := kit.Outbounds(name)
+		if !ok {
+			return transport.Outbounds{}, fmt.Errorf("unknown outbound %q", name)
+		}
+		cfg.Clusters = append(cfg.Clusters, Cluster{Name: name, Outbounds: outs})
+	}
+
+	out, err := NewOutbound(cfg)
+	if err != nil {
+		return transport.Outbounds{}, err
+	}
+
+	var outs transport.Outbounds
+	for _, c := range cfg.Clusters {
+		if c.Outbounds.Unary != nil {
+			outs.Unary = out
+		}
+		if c.Outbounds.Oneway != nil {
+			outs.Oneway = out
+		}
+		if c.Outbounds.Stream != nil {
+			outs.Stream = out
+		}
+	}
+	return outs, nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package failover
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/internal/whitespace"
+	"go.uber.org/yarpc/yarpcconfig"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestOutboundSpec(t *testing.T) {
+	type fakeOutboundConfig struct {
+		Name string `config:"name"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbounds := make(map[string]*transporttest.MockUnaryOutbound)
+	newConfigurator := func(opts ...yarpcconfig.Option) *yarpcconfig.Configurator {
+		c := yarpcconfig.New(opts...)
+		c.MustRegisterCompositeOutbound(OutboundSpec())
+		require.NoError(t, c.RegisterTransport(yarpcconfig.TransportSpec{
+			Name: "fake",
+			BuildTransport: func(struct{}, *yarpcconfig.Kit) (transport.Transport, error) {
+				return transporttest.NewMockTransport(ctrl), nil
+			},
+			BuildUnaryOutbound: func(cfg fakeOutboundConfig, _ transport.Transport, _ *yarpcconfig.Kit) (transport.UnaryOutbound, error) {
+				o := transporttest.NewMockUnaryOutbound(ctrl)
+				outbounds[cfg.Name] = o
+				return o, nil
+			},
+		}))
+		return c
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		core, logs := observer.New(zapcore.WarnLevel)
+		cfg, err := newConfigurator(yarpcconfig.Logger(zap.New(core))).LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					failover:
+						clusters: [myservice-east, myservice-west]
+						maxErrorRate: 0.5
+						minRequests: 2
+						window: 1m
+						cooldown: 1m
+				myservice-east:
+					fake: {name: east}
+				myservice-west:
+					fake: {name: west}
+		`)))
+		require.NoError(t, err)
+
+		outs := cfg.Outbounds["myservice"]
+		assert.Equal(t, "myservice", outs.ServiceName)
+		assert.Nil(t, outs.Oneway)
+		assert.Nil(t, outs.Stream)
+		require.NotNil(t, outs.Unary)
+
+		ctx := context.Background()
+		req := &transport.Request{Service: "myservice", Procedure: "get"}
+		outbounds["east"].EXPECT().Call(ctx, req).Return(nil, yarpcerrors.UnavailableErrorf("great sadness")).Times(2)
+		for i := 0; i < 2; i++ {
+			_, err := outs.Unary.Call(ctx, req)
+			assert.Error(t, err)
+		}
+
+		outbounds["west"].EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+		_, err = outs.Unary.Call(ctx, req)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, logs.FilterMessage("failing over to another cluster").Len())
+	})
+
+	tests := []struct {
+		desc    string
+		give    string
+		wantErr string
+	}{
+		{
+			desc: "unknown outbound",
+			give: `
+				outbounds:
+					myservice:
+						failover:
+							clusters: [myservice-east]
+			`,
+			wantErr: `failed to configure failover of outbound "myservice": unknown outbound "myservice-east"`,
+		},
+		{
+			desc: "no clusters",
+			give: `
+				outbounds:
+					myservice:
+						failover:
+							maxErrorRate: 0.5
+			`,
+			wantErr: `failed to configure failover of outbound "myservice": at least one cluster is required`,
+		},
+		{
+			desc: "failover outbound with transport",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: east}
+						failover:
+							clusters: [myservice-east]
+			`,
+			wantErr: `too many attributes in failover outbound configuration for "myservice"`,
+		},
+		{
+			desc: "invalid error rate",
+			give: `
+				outbounds:
+					myservice:
+						failover:
+							clusters: [myservice-east]
+							maxErrorRate: 2
+					myservice-east:
+						fake: {name: east}
+			`,
+			wantErr: `failed to configure failover of outbound "myservice": max error rate must be between 0 and 1, got 2`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(tt.give)))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
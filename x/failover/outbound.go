@@ -0,0 +1,450 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package failover provides an outbound that sends requests to the first
+// healthy cluster of a list of clusters in priority order.
+//
+// A cluster is unhealthy if fewer than a minimum number of peers of its peer
+// chooser are available, or if the rate of server failures of its requests
+// exceeds a threshold. A cluster that became unhealthy because of its error
+// rate is skipped for a cooldown period, after which it receives requests
+// again. Clusters that recover are used again automatically.
+//
+// 	out, err := failover.NewOutbound(failover.Config{
+// 		Clusters: []failover.Cluster{
+// 			{Name: "us-east", Outbounds: transport.Outbounds{Unary: east}},
+// 			{Name: "us-west", Outbounds: transport.Outbounds{Unary: west}},
+// 		},
+// 	})
+//
+// If all clusters are unhealthy, requests are sent to the first cluster.
+//
+// The outbound starts and stops the outbounds of its clusters.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/pkg/lifecycle"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	_defaultMinAvailablePeers = 1
+	_defaultMaxErrorRate      = 0.5
+	_defaultMinRequests       = 10
+	_defaultWindow            = 10 * time.Second
+	_defaultCooldown          = 30 * time.Second
+)
+
+var (
+	_ transport.UnaryOutbound              = (*Outbound)(nil)
+	_ transport.OnewayOutbound             = (*Outbound)(nil)
+	_ transport.StreamOutbound             = (*Outbound)(nil)
+	_ introspection.IntrospectableOutbound = (*Outbound)(nil)
+)
+
+// Cluster is a named set of outbounds.
+type Cluster struct {
+	Name      string
+	Outbounds transport.Outbounds
+}
+
+// Config configures an Outbound.
+type Config struct {
+	// Clusters in priority order. At least one cluster is required.
+	Clusters []Cluster
+
+	// MinAvailablePeers is the number of available peers below which a
+	// cluster is unhealthy. Peers are only counted for outbounds whose peer
+	// chooser reports the number of available peers, like the peer lists in
+	// go.uber.org/yarpc/peer.
+	//
+	// Defaults to 1.
+	MinAvailablePeers int
+
+	// MaxErrorRate is the rate of server failures, between 0 and 1, at which
+	// a cluster becomes unhealthy.
+	//
+	// Defaults to 0.5.
+	MaxErrorRate float64
+
+	// MinRequests is the number of requests to a cluster within Window
+	// before its error rate is considered.
+	//
+	// Defaults to 10.
+	MinRequests int
+
+	// Window is the period over which the error rate is measured.
+	//
+	// Defaults to 10 seconds.
+	Window time.Duration
+
+	// Cooldown is the period for which a cluster is skipped after its error
+	// rate made it unhealthy.
+	//
+	// Defaults to 30 seconds.
+	Cooldown time.Duration
+
+	// Logger logs changes of the active cluster.
+	Logger *zap.Logger
+}
+
+// Outbound sends requests to the first healthy cluster.
+type Outbound struct {
+	clusters  []*cluster
+	outbounds []transport.Outbound
+	logger    *zap.Logger
+	once      *lifecycle.Once
+
+	minAvailablePeers int
+	maxErrorRate      float64
+	minRequests       int
+	window            time.Duration
+	cooldown          time.Duration
+
+	activeMu sync.Mutex
+	active   string
+
+	// for tests
+	now func() time.Time
+}
+
+// NewOutbound builds an Outbound from the given configuration.
+func NewOutbound(cfg Config) (*Outbound, error) {
+	if len(cfg.Clusters) == 0 {
+		return nil, errors.New("at least one cluster is required")
+	}
+	if cfg.MaxErrorRate < 0 || cfg.MaxErrorRate > 1 {
+		return nil, fmt.Errorf("max error rate must be between 0 and 1, got %v", cfg.MaxErrorRate)
+	}
+
+	o := &Outbound{
+		logger:            cfg.Logger,
+		once:              lifecycle.NewOnce(),
+		minAvailablePeers: cfg.MinAvailablePeers,
+		maxErrorRate:      cfg.MaxErrorRate,
+		minRequests:       cfg.MinRequests,
+		window:            cfg.Window,
+		cooldown:          cfg.Cooldown,
+		now:               time.Now,
+	}
+	if o.logger == nil {
+		o.logger = zap.NewNop()
+	}
+	if o.minAvailablePeers <= 0 {
+		o.minAvailablePeers = _defaultMinAvailablePeers
+	}
+	if o.maxErrorRate == 0 {
+		o.maxErrorRate = _defaultMaxErrorRate
+	}
+	if o.minRequests <= 0 {
+		o.minRequests = _defaultMinRequests
+	}
+	if o.window <= 0 {
+		o.window = _defaultWindow
+	}
+	if o.cooldown <= 0 {
+		o.cooldown = _defaultCooldown
+	}
+
+	names := make(map[string]struct{}, len(cfg.Clusters))
+	for i, c := range cfg.Clusters {
+		if c.Name == "" {
+			return nil, fmt.Errorf("cluster %d has no name", i)
+		}
+		if _, ok := names[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate cluster %q", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		o.clusters = append(o.clusters, &cluster{Cluster: c, availablePeers: peerCounter(c.Outbounds)})
+		for _, out := range []transport.Outbound{c.Outbounds.Unary, c.Outbounds.Oneway, c.Outbounds.Stream} {
+			if out != nil && !o.hasOutbound(out) {
+				o.outbounds = append(o.outbounds, out)
+			}
+		}
+	}
+	o.active = o.clusters[0].Name
+	return o, nil
+}
+
+func (o *Outbound) hasOutbound(out transport.Outbound) bool {
+	for _, existing := range o.outbounds {
+		if existing == out {
+			return true
+		}
+	}
+	return false
+}
+
+// choose returns the first healthy cluster, or the first cluster if none is
+// healthy.
+func (o *Outbound) choose() *cluster {
+	now := o.now()
+	chosen := o.clusters[0]
+	for _, c := range o.clusters {
+		if c.health(now, o.minAvailablePeers) == "" {
+			chosen = c
+			break
+		}
+	}
+
+	o.activeMu.Lock()
+	defer o.activeMu.Unlock()
+	if chosen.Name != o.active {
+		o.logger.Warn("failing over to another cluster",
+			zap.String("from", o.active), zap.String("to", chosen.Name))
+		o.active = chosen.Name
+	}
+	return chosen
+}
+
+// record records the result of a request to the cluster.
+func (o *Outbound) record(c *cluster, err error) {
+	c.record(o.now(), isServerFailure(err), o)
+}
+
+func unsupportedError(c *cluster, rpcType string, req *transport.RequestMeta) error {
+	return yarpcerrors.UnimplementedErrorf(
+		"cluster %q for procedure %q of service %q does not support %s calls", c.Name, req.Procedure, req.Service, rpcType)
+}
+
+// Call sends a unary request to the first healthy cluster.
+func (o *Outbound) Call(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+	c := o.choose()
+	if c.Outbounds.Unary == nil {
+		return nil, unsupportedError(c, "unary", req.ToRequestMeta())
+	}
+	res, err := c.Outbounds.Unary.Call(ctx, req)
+	o.record(c, err)
+	return res, err
+}
+
+// CallOneway sends a oneway request to the first healthy cluster.
+func (o *Outbound) CallOneway(ctx context.Context, req *transport.Request) (transport.Ack, error) {
+	c := o.choose()
+	if c.Outbounds.Oneway == nil {
+		return nil, unsupportedError(c, "oneway", req.ToRequestMeta())
+	}
+	ack, err := c.Outbounds.Oneway.CallOneway(ctx, req)
+	o.record(c, err)
+	return ack, err
+}
+
+// CallStream opens a stream with the first healthy cluster. Only failures to
+// open streams count towards the error rate.
+func (o *Outbound) CallStream(ctx context.Context, req *transport.StreamRequest) (*transport.ClientStream, error) {
+	c := o.choose()
+	if c.Outbounds.Stream == nil {
+		return nil, unsupportedError(c, "stream", req.Meta)
+	}
+	stream, err := c.Outbounds.Stream.CallStream(ctx, req)
+	o.record(c, err)
+	return stream, err
+}
+
+// Transports returns the transports of all clusters.
+func (o *Outbound) Transports() []transport.Transport {
+	var transports []transport.Transport
+	for _, out := range o.outbounds {
+		transports = append(transports, out.Transports()...)
+	}
+	return transports
+}
+
+// Start starts the outbounds of all clusters.
+func (o *Outbound) Start() error {
+	return o.once.Start(func() error {
+		var err error
+		for _, out := range o.outbounds {
+			err = multierr.Append(err, out.Start())
+		}
+		return err
+	})
+}
+
+// Stop stops the outbounds of all clusters.
+func (o *Outbound) Stop() error {
+	return o.once.Stop(func() error {
+		var err error
+		for _, out := range o.outbounds {
+			err = multierr.Append(err, out.Stop())
+		}
+		return err
+	})
+}
+
+// IsRunning returns whether the outbound is running.
+func (o *Outbound) IsRunning() bool {
+	return o.once.IsRunning()
+}
+
+// Introspect returns the clusters of the outbound and their health.
+func (o *Outbound) Introspect() introspection.OutboundStatus {
+	state := "Stopped"
+	if o.IsRunning() {
+		state = "Running"
+	}
+
+	now := o.now()
+	routes := make([]introspection.RouteStatus, 0, len(o.clusters))
+	for i, c := range o.clusters {
+		health := "healthy"
+		if reason := c.health(now, o.minAvailablePeers); reason != "" {
+			health = "unhealthy: " + reason
+		}
+		routes = append(routes, introspection.RouteStatus{
+			Match:    fmt.Sprintf("priority %d, %s", i+1, health),
+			Target:   c.Name,
+			Outbound: introspectCluster(c.Outbounds),
+		})
+	}
+
+	o.activeMu.Lock()
+	active := o.active
+	o.activeMu.Unlock()
+
+	return introspection.OutboundStatus{
+		Transport: "failover",
+		Endpoint:  active,
+		State:     state,
+		Routes:    routes,
+	}
+}
+
+func introspectCluster(outs transport.Outbounds) introspection.OutboundStatus {
+	for _, out := range []transport.Outbound{outs.Unary, outs.Oneway, outs.Stream} {
+		if i, ok := out.(introspection.IntrospectableOutbound); ok {
+			return i.Introspect()
+		}
+	}
+	return introspection.OutboundStatusNotSupported
+}
+
+// cluster tracks the health of a cluster.
+type cluster struct {
+	Cluster
+
+	// Returns the number of available peers of the cluster. Nil if they
+	// cannot be counted.
+	availablePeers func() int
+
+	mu             sync.Mutex
+	windowStart    time.Time
+	requests       int
+	failures       int
+	unhealthyUntil time.Time
+}
+
+// health returns why the cluster is unhealthy, or an empty string if it is
+// healthy.
+func (c *cluster) health(now time.Time, minAvailablePeers int) string {
+	c.mu.Lock()
+	cooling := now.Before(c.unhealthyUntil)
+	c.mu.Unlock()
+	if cooling {
+		return "error rate exceeded"
+	}
+
+	if c.availablePeers == nil {
+		return ""
+	}
+	if available := c.availablePeers(); available < minAvailablePeers {
+		return fmt.Sprintf("%d available peer(s)", available)
+	}
+	return ""
+}
+
+func (c *cluster) record(now time.Time, failed bool, o *Outbound) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.windowStart) >= o.window {
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+	c.requests++
+	if failed {
+		c.failures++
+	}
+
+	if c.requests >= o.minRequests && float64(c.failures)/float64(c.requests) >= o.maxErrorRate {
+		o.logger.Warn("cluster error rate exceeded",
+			zap.String("cluster", c.Name),
+			zap.Int("requests", c.requests),
+			zap.Int("failures", c.failures),
+			zap.Duration("cooldown", o.cooldown))
+		c.unhealthyUntil = now.Add(o.cooldown)
+		c.windowStart = now
+		c.requests = 0
+		c.failures = 0
+	}
+}
+
+// peerCounter returns a function reporting the number of available peers of
+// the peer chooser of the outbounds, or nil if the chooser does not report
+// it. Peer lists keep count of their available peers as the peers change
+// status, so requests do not need to visit every peer.
+func peerCounter(outs transport.Outbounds) func() int {
+	for _, out := range []transport.Outbound{outs.Unary, outs.Oneway, outs.Stream} {
+		o, ok := out.(interface{ Chooser() peer.Chooser })
+		if !ok {
+			continue
+		}
+
+		var chooser interface{} = o.Chooser()
+		if bound, ok := chooser.(interface{ ChooserList() peer.ChooserList }); ok {
+			chooser = bound.ChooserList()
+		}
+		if counter, ok := chooser.(interface{ NumAvailable() int }); ok {
+			return counter.NumAvailable
+		}
+	}
+	return nil
+}
+
+// isServerFailure reports whether the error is a server failure, matching
+// the failures that YARPC's observability middleware attributes to servers.
+func isServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch yarpcerrors.FromError(err).Code() {
+	case yarpcerrors.CodeUnknown,
+		yarpcerrors.CodeDeadlineExceeded,
+		yarpcerrors.CodeInternal,
+		yarpcerrors.CodeUnavailable,
+		yarpcerrors.CodeDataLoss,
+		yarpcerrors.CodeUnimplemented:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package failover
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apipeer "go.uber.org/yarpc/api/peer"
+	"go.uber.org/yarpc/api/peer/peertest"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/peer"
+	"go.uber.org/yarpc/peer/roundrobin"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/yarpc/yarpctest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// countedPeers is a peer chooser that counts its available peers.
+type countedPeers struct {
+	apipeer.Chooser
+
+	available int
+}
+
+func (c *countedPeers) NumAvailable() int { return c.available }
+
+// chooserOutbound is a unary outbound with a peer chooser.
+type chooserOutbound struct {
+	transport.UnaryOutbound
+
+	chooser apipeer.Chooser
+}
+
+func (o chooserOutbound) Chooser() apipeer.Chooser { return o.chooser }
+
+func TestNewOutboundErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		give    Config
+		wantErr string
+	}{
+		{desc: "no clusters", wantErr: "at least one cluster is required"},
+		{
+			desc:    "no name",
+			give:    Config{Clusters: []Cluster{{}}},
+			wantErr: "cluster 0 has no name",
+		},
+		{
+			desc:    "duplicate",
+			give:    Config{Clusters: []Cluster{{Name: "east"}, {Name: "east"}}},
+			wantErr: `duplicate cluster "east"`,
+		},
+		{
+			desc:    "error rate",
+			give:    Config{Clusters: []Cluster{{Name: "east"}}, MaxErrorRate: 2},
+			wantErr: "max error rate must be between 0 and 1, got 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := NewOutbound(tt.give)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestFailoverOnErrorRate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	east := transporttest.NewMockUnaryOutbound(ctrl)
+	west := transporttest.NewMockUnaryOutbound(ctrl)
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	out, err := NewOutbound(Config{
+		Clusters: []Cluster{
+			{Name: "east", Outbounds: transport.Outbounds{Unary: east}},
+			{Name: "west", Outbounds: transport.Outbounds{Unary: west}},
+		},
+		MinRequests: 4,
+		Cooldown:    time.Minute,
+		Logger:      zap.New(core),
+	})
+	require.NoError(t, err)
+
+	now := time.Unix(1000, 0)
+	out.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	req := &transport.Request{Service: "service", Procedure: "get"}
+
+	// Caller errors do not count towards the error rate.
+	east.EXPECT().Call(ctx, req).Return(nil, yarpcerrors.NotFoundErrorf("no such key")).Times(4)
+	for i := 0; i < 4; i++ {
+		_, err := out.Call(ctx, req)
+		assert.Error(t, err)
+	}
+
+	// Half of the requests in the window fail.
+	east.EXPECT().Call(ctx, req).Return(nil, yarpcerrors.UnavailableErrorf("great sadness")).Times(4)
+	for i := 0; i < 4; i++ {
+		_, _ = out.Call(ctx, req)
+	}
+	assert.Equal(t, 1, logs.FilterMessage("cluster error rate exceeded").Len())
+
+	west.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logs.FilterMessage("failing over to another cluster").Len())
+	assert.Equal(t, "west", out.Introspect().Endpoint)
+
+	// After the cooldown, requests return to the primary cluster.
+	now = now.Add(time.Minute)
+	east.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logs.FilterMessage("failing over to another cluster").Len())
+	assert.Equal(t, "east", out.Introspect().Endpoint)
+}
+
+func TestFailoverOnAvailablePeers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	eastPeers := &countedPeers{available: 1}
+	east := transporttest.NewMockUnaryOutbound(ctrl)
+	west := transporttest.NewMockUnaryOutbound(ctrl)
+
+	out, err := NewOutbound(Config{
+		Clusters: []Cluster{
+			{Name: "east", Outbounds: transport.Outbounds{Unary: chooserOutbound{east, eastPeers}}},
+			{Name: "west", Outbounds: transport.Outbounds{Unary: west}},
+		},
+		MinAvailablePeers: 2,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	req := &transport.Request{Service: "service", Procedure: "get"}
+
+	west.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+
+	status := out.Introspect()
+	require.Len(t, status.Routes, 2)
+	assert.Equal(t, "priority 1, unhealthy: 1 available peer(s)", status.Routes[0].Match)
+	assert.Equal(t, "priority 2, healthy", status.Routes[1].Match)
+
+	// Once peers are available again, requests return to the primary.
+	eastPeers.available = 2
+	east.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+}
+
+func TestFailoverOnPeerListStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	trans := yarpctest.NewFakeTransport(yarpctest.InitialConnectionStatus(apipeer.Available))
+	list := roundrobin.New(trans)
+	chooser := peer.Bind(list, peer.BindPeers([]apipeer.Identifier{
+		peertest.MockPeerIdentifier("east-1"),
+		peertest.MockPeerIdentifier("east-2"),
+	}))
+	require.NoError(t, trans.Start())
+	require.NoError(t, chooser.Start())
+	trans.Flush()
+	defer func() {
+		assert.NoError(t, chooser.Stop())
+		assert.NoError(t, trans.Stop())
+	}()
+
+	east := transporttest.NewMockUnaryOutbound(ctrl)
+	west := transporttest.NewMockUnaryOutbound(ctrl)
+	out, err := NewOutbound(Config{
+		Clusters: []Cluster{
+			{Name: "east", Outbounds: transport.Outbounds{Unary: chooserOutbound{east, chooser}}},
+			{Name: "west", Outbounds: transport.Outbounds{Unary: west}},
+		},
+		MinAvailablePeers: 2,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	req := &transport.Request{Service: "service", Procedure: "get"}
+	east.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+
+	trans.SimulateDisconnect(peertest.MockPeerIdentifier("east-2"))
+	west.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+}
+
+func TestAllClustersUnhealthy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	noPeers := &countedPeers{}
+	east := transporttest.NewMockUnaryOutbound(ctrl)
+	west := transporttest.NewMockUnaryOutbound(ctrl)
+
+	out, err := NewOutbound(Config{Clusters: []Cluster{
+		{Name: "east", Outbounds: transport.Outbounds{Unary: chooserOutbound{east, noPeers}}},
+		{Name: "west", Outbounds: transport.Outbounds{Unary: chooserOutbound{west, noPeers}}},
+	}})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	req := &transport.Request{Service: "service", Procedure: "get"}
+	east.EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+	_, err = out.Call(ctx, req)
+	assert.NoError(t, err)
+}
+
+func TestUnsupportedRPCType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	out, err := NewOutbound(Config{Clusters: []Cluster{
+		{Name: "east", Outbounds: transport.Outbounds{Unary: transporttest.NewMockUnaryOutbound(ctrl)}},
+	}})
+	require.NoError(t, err)
+
+	_, err = out.CallOneway(context.Background(), &transport.Request{Service: "service", Procedure: "log"})
+	assert.Equal(t, yarpcerrors.CodeUnimplemented, yarpcerrors.FromError(err).Code())
+	assert.Equal(t, `cluster "east" for procedure "log" of service "service" does not support oneway calls`,
+		yarpcerrors.FromError(err).Message())
+}
+
+func TestLifecycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	east := transporttest.NewMockUnaryOutbound(ctrl)
+	west := transporttest.NewMockUnaryOutbound(ctrl)
+	out, err := NewOutbound(Config{Clusters: []Cluster{
+		{Name: "east", Outbounds: transport.Outbounds{Unary: east}},
+		{Name: "west", Outbounds: transport.Outbounds{Unary: west}},
+	}})
+	require.NoError(t, err)
+
+	east.EXPECT().Start().Return(nil)
+	west.EXPECT().Start().Return(nil)
+	require.NoError(t, out.Start())
+	assert.True(t, out.IsRunning())
+	assert.Equal(t, "Running", out.Introspect().State)
+
+	east.EXPECT().Stop().Return(nil)
+	west.EXPECT().Stop().Return(nil)
+	require.NoError(t, out.Stop())
+	assert.Equal(t, introspection.OutboundStatusNotSupported, out.Introspect().Routes[0].Outbound)
+}
@@ -0,0 +1,361 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package fault provides middleware that injects faults into YARPC requests
+// for chaos testing.
+//
+// An Injector delays requests, fails them with a specific error code,
+// simulates aborted connections, or drops oneway requests, according to a
+// list of rules that may be changed at runtime. The same Injector may be used
+// as inbound and outbound middleware.
+//
+// 	injector, _ := fault.NewInjector()
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{
+// 		Name: "myservice",
+// 		InboundMiddleware: yarpc.InboundMiddleware{
+// 			Unary:  injector,
+// 			Oneway: injector,
+// 		},
+// 		...
+// 	})
+// 	dispatcher.Register(injector.Procedures())
+//
+// Rules are replaced with Update, or remotely by calling the procedures
+// returned by Procedures. Since these procedures change the behavior of the
+// service, they should be protected, for example with an x/auth Authorizer.
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/glob"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+var (
+	_ middleware.UnaryInbound   = (*Injector)(nil)
+	_ middleware.OnewayInbound  = (*Injector)(nil)
+	_ middleware.StreamInbound  = (*Injector)(nil)
+	_ middleware.UnaryOutbound  = (*Injector)(nil)
+	_ middleware.OnewayOutbound = (*Injector)(nil)
+	_ middleware.StreamOutbound = (*Injector)(nil)
+)
+
+// Rule describes a fault and the requests it is injected into.
+//
+// A rule matches requests whose procedure and caller match one of the given
+// patterns, and which carry all of the given headers. Patterns may use '*' to
+// match any sequence of characters. Rules without procedures or callers
+// match all procedures or callers.
+type Rule struct {
+	Procedures []string          `json:"procedures,omitempty"`
+	Callers    []string          `json:"callers,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+
+	// Percent is the percentage of matching requests, greater than 0 and at
+	// most 100, that the fault is injected into. It is required, so that a
+	// rule which omits it is rejected rather than never injecting its fault.
+	Percent float64 `json:"percent"`
+
+	// Delay delays matching requests. It is encoded in JSON as a string
+	// like "1.5s".
+	Delay time.Duration `json:"-"`
+
+	// Code fails matching requests with an error of this code.
+	Code yarpcerrors.Code `json:"code,omitempty"`
+
+	// Abort simulates a connection aborted after the request was sent:
+	// the request is handled, but the response is discarded and the request
+	// fails with CodeUnavailable.
+	Abort bool `json:"abort,omitempty"`
+
+	// Drop silently drops matching oneway requests. It has no effect on
+	// other requests.
+	Drop bool `json:"drop,omitempty"`
+}
+
+type jsonRule Rule
+
+// MarshalJSON encodes the rule, with the delay as a string.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	var delay string
+	if r.Delay > 0 {
+		delay = r.Delay.String()
+	}
+	return json.Marshal(struct {
+		jsonRule
+		Delay string `json:"delay,omitempty"`
+	}{jsonRule(r), delay})
+}
+
+// UnmarshalJSON decodes the rule, with the delay as a string.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var v struct {
+		jsonRule
+		Delay string `json:"delay"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = Rule(v.jsonRule)
+	if v.Delay != "" {
+		delay, err := time.ParseDuration(v.Delay)
+		if err != nil {
+			return fmt.Errorf("invalid delay %q: %v", v.Delay, err)
+		}
+		r.Delay = delay
+	}
+	return nil
+}
+
+// Validate checks that the rule is well formed.
+func (r Rule) Validate() error {
+	if r.Percent <= 0 || r.Percent > 100 {
+		return fmt.Errorf("percent must be greater than 0 and at most 100, got %v", r.Percent)
+	}
+	if r.Delay < 0 {
+		return fmt.Errorf("delay must not be negative, got %v", r.Delay)
+	}
+	if r.Code != yarpcerrors.CodeOK && r.Abort {
+		return fmt.Errorf("code %q and abort are mutually exclusive", r.Code)
+	}
+	if r.Delay == 0 && r.Code == yarpcerrors.CodeOK && !r.Abort && !r.Drop {
+		return fmt.Errorf("rule injects no fault")
+	}
+	return nil
+}
+
+func (r *Rule) matches(req *transport.RequestMeta) bool {
+	return glob.MatchAny(r.Procedures, req.Procedure) &&
+		glob.MatchAny(r.Callers, req.Caller) &&
+		matchHeaders(r.Headers, req.Headers)
+}
+
+func matchHeaders(want map[string]string, headers transport.Headers) bool {
+	for k, v := range want {
+		if got, ok := headers.Get(k); !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Injector is middleware that injects faults into requests according to a
+// list of rules. For each request, the first matching rule that is sampled
+// decides the fault.
+type Injector struct {
+	rules atomic.Value // []Rule
+
+	// for tests
+	random func() float64
+}
+
+// NewInjector builds an Injector with the given rules.
+func NewInjector(rules ...Rule) (*Injector, error) {
+	i := &Injector{random: rand.Float64}
+	if err := i.Update(rules); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Update replaces the rules of the injector. Requests in progress are not
+// affected.
+func (i *Injector) Update(rules []Rule) error {
+	for idx, r := range rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid fault rule %d: %v", idx, err)
+		}
+	}
+	i.rules.Store(append([]Rule(nil), rules...))
+	return nil
+}
+
+// Rules returns a copy of the current rules of the injector.
+func (i *Injector) Rules() []Rule {
+	return append([]Rule(nil), i.rules.Load().([]Rule)...)
+}
+
+// fault returns the rule to apply to the request, if any.
+func (i *Injector) fault(req *transport.RequestMeta) *Rule {
+	if isAdminProcedure(req.Procedure) {
+		return nil
+	}
+	rules := i.rules.Load().([]Rule)
+	for idx := range rules {
+		r := &rules[idx]
+		if r.matches(req) && i.random()*100 < r.Percent {
+			return r
+		}
+	}
+	return nil
+}
+
+// delay waits for the delay of the rule, failing if the request ends first.
+func (r *Rule) delay(ctx context.Context, req *transport.RequestMeta) error {
+	if r.Delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(r.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return yarpcerrors.DeadlineExceededErrorf(
+				"injected delay of %v exceeded the deadline of procedure %q of service %q", r.Delay, req.Procedure, req.Service)
+		}
+		return yarpcerrors.CancelledErrorf(
+			"procedure %q of service %q was cancelled during an injected delay of %v", req.Procedure, req.Service, r.Delay)
+	}
+}
+
+// before injects the faults that apply before the request is handled or
+// sent.
+func (r *Rule) before(ctx context.Context, req *transport.RequestMeta) error {
+	if err := r.delay(ctx, req); err != nil {
+		return err
+	}
+	if r.Code != yarpcerrors.CodeOK {
+		return yarpcerrors.Newf(r.Code, "injected fault for procedure %q of service %q", req.Procedure, req.Service)
+	}
+	return nil
+}
+
+func abortedError(req *transport.RequestMeta) error {
+	return yarpcerrors.UnavailableErrorf(
+		"injected connection abort for procedure %q of service %q", req.Procedure, req.Service)
+}
+
+// Handle implements middleware.UnaryInbound.
+func (i *Injector) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	r := i.fault(req.ToRequestMeta())
+	if r == nil {
+		return h.Handle(ctx, req, resw)
+	}
+	if err := r.before(ctx, req.ToRequestMeta()); err != nil {
+		return err
+	}
+	if r.Abort {
+		_ = h.Handle(ctx, req, discardResponseWriter{})
+		return abortedError(req.ToRequestMeta())
+	}
+	return h.Handle(ctx, req, resw)
+}
+
+// HandleOneway implements middleware.OnewayInbound.
+func (i *Injector) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	r := i.fault(req.ToRequestMeta())
+	if r == nil {
+		return h.HandleOneway(ctx, req)
+	}
+	if err := r.before(ctx, req.ToRequestMeta()); err != nil {
+		return err
+	}
+	if r.Drop {
+		return nil
+	}
+	if r.Abort {
+		_ = h.HandleOneway(ctx, req)
+		return abortedError(req.ToRequestMeta())
+	}
+	return h.HandleOneway(ctx, req)
+}
+
+// HandleStream implements middleware.StreamInbound. Only delays and errors
+// are injected into streams.
+func (i *Injector) HandleStream(s *transport.ServerStream, h transport.StreamHandler) error {
+	if r := i.fault(s.Request().Meta); r != nil {
+		if err := r.before(s.Context(), s.Request().Meta); err != nil {
+			return err
+		}
+	}
+	return h.HandleStream(s)
+}
+
+// Call implements middleware.UnaryOutbound.
+func (i *Injector) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	r := i.fault(req.ToRequestMeta())
+	if r == nil {
+		return out.Call(ctx, req)
+	}
+	if err := r.before(ctx, req.ToRequestMeta()); err != nil {
+		return nil, err
+	}
+	if r.Abort {
+		if res, err := out.Call(ctx, req); err == nil && res.Body != nil {
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		return nil, abortedError(req.ToRequestMeta())
+	}
+	return out.Call(ctx, req)
+}
+
+// CallOneway implements middleware.OnewayOutbound.
+func (i *Injector) CallOneway(ctx context.Context, req *transport.Request, out transport.OnewayOutbound) (transport.Ack, error) {
+	r := i.fault(req.ToRequestMeta())
+	if r == nil {
+		return out.CallOneway(ctx, req)
+	}
+	if err := r.before(ctx, req.ToRequestMeta()); err != nil {
+		return nil, err
+	}
+	if r.Drop {
+		return droppedAck{}, nil
+	}
+	if r.Abort {
+		_, _ = out.CallOneway(ctx, req)
+		return nil, abortedError(req.ToRequestMeta())
+	}
+	return out.CallOneway(ctx, req)
+}
+
+// CallStream implements middleware.StreamOutbound. Only delays and errors
+// are injected into streams.
+func (i *Injector) CallStream(ctx context.Context, req *transport.StreamRequest, out transport.StreamOutbound) (*transport.ClientStream, error) {
+	if r := i.fault(req.Meta); r != nil {
+		if err := r.before(ctx, req.Meta); err != nil {
+			return nil, err
+		}
+	}
+	return out.CallStream(ctx, req)
+}
+
+type discardResponseWriter struct{}
+
+func (discardResponseWriter) AddHeaders(transport.Headers) {}
+func (discardResponseWriter) SetApplicationError()         {}
+func (discardResponseWriter) Write(p []byte) (int, error)  { return len(p), nil }
+
+// droppedAck is returned for oneway requests dropped by the injector.
+type droppedAck struct{}
+
+func (droppedAck) String() string { return "dropped by fault injection" }
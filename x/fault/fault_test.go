@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package fault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func newRequest(procedure string) *transport.Request {
+	return &transport.Request{
+		Caller:    "caller",
+		Service:   "service",
+		Procedure: procedure,
+		Encoding:  "raw",
+		Headers:   transport.NewHeaders().With("shard", "1"),
+		Body:      bytes.NewReader([]byte("hello")),
+	}
+}
+
+func newInjector(t *testing.T, random float64, rules ...Rule) *Injector {
+	i, err := NewInjector(rules...)
+	require.NoError(t, err)
+	i.random = func() float64 { return random }
+	return i
+}
+
+func TestRuleJSON(t *testing.T) {
+	give := `{"procedures":["get*"],"headers":{"shard":"1"},"percent":10,"delay":"1.5s","code":"unavailable"}`
+
+	var r Rule
+	require.NoError(t, json.Unmarshal([]byte(give), &r))
+	assert.Equal(t, Rule{
+		Procedures: []string{"get*"},
+		Headers:    map[string]string{"shard": "1"},
+		Percent:    10,
+		Delay:      1500 * time.Millisecond,
+		Code:       yarpcerrors.CodeUnavailable,
+	}, r)
+
+	got, err := json.Marshal(r)
+	require.NoError(t, err)
+	assert.JSONEq(t, give, string(got))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"delay":"soon"}`), &r))
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		give    Rule
+		wantErr string
+	}{
+		{desc: "valid", give: Rule{Percent: 100, Code: yarpcerrors.CodeInternal}},
+		{desc: "percent", give: Rule{Percent: 101, Drop: true}, wantErr: "percent must be greater than 0 and at most 100, got 101"},
+		{desc: "no percent", give: Rule{Drop: true}, wantErr: "percent must be greater than 0 and at most 100, got 0"},
+		{desc: "delay", give: Rule{Percent: 100, Delay: -time.Second}, wantErr: "delay must not be negative, got -1s"},
+		{desc: "code and abort", give: Rule{Percent: 100, Code: yarpcerrors.CodeInternal, Abort: true}, wantErr: `code "internal" and abort are mutually exclusive`},
+		{desc: "no fault", give: Rule{Percent: 100}, wantErr: "rule injects no fault"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := tt.give.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := NewInjector(Rule{Percent: 100})
+	assert.EqualError(t, err, "invalid fault rule 0: rule injects no fault")
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		desc   string
+		rule   Rule
+		random float64
+		want   bool
+	}{
+		{desc: "all", rule: Rule{Percent: 100}, want: true},
+		{desc: "procedure", rule: Rule{Percent: 100, Procedures: []string{"put", "get*"}}, want: true},
+		{desc: "other procedure", rule: Rule{Percent: 100, Procedures: []string{"put"}}},
+		{desc: "caller", rule: Rule{Percent: 100, Callers: []string{"caller"}}, want: true},
+		{desc: "other caller", rule: Rule{Percent: 100, Callers: []string{"*-staging"}}},
+		{desc: "header", rule: Rule{Percent: 100, Headers: map[string]string{"Shard": "1"}}, want: true},
+		{desc: "other header", rule: Rule{Percent: 100, Headers: map[string]string{"shard": "2"}}},
+		{desc: "sampled", rule: Rule{Percent: 10}, random: 0.05, want: true},
+		{desc: "not sampled", rule: Rule{Percent: 10}, random: 0.15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			tt.rule.Code = yarpcerrors.CodeInternal
+			i := newInjector(t, tt.random, tt.rule)
+			r := i.fault(newRequest("getValue").ToRequestMeta())
+			assert.Equal(t, tt.want, r != nil)
+		})
+	}
+
+	t.Run("admin procedures", func(t *testing.T) {
+		i := newInjector(t, 0, Rule{Percent: 100, Code: yarpcerrors.CodeInternal})
+		assert.Nil(t, i.fault(newRequest(UpdateProcedure).ToRequestMeta()))
+	})
+
+	t.Run("first rule wins", func(t *testing.T) {
+		i := newInjector(t, 0.5,
+			Rule{Percent: 10, Code: yarpcerrors.CodeInternal},
+			Rule{Percent: 100, Code: yarpcerrors.CodeUnavailable},
+			Rule{Percent: 100, Code: yarpcerrors.CodeNotFound},
+		)
+		r := i.fault(newRequest("get").ToRequestMeta())
+		require.NotNil(t, r)
+		assert.Equal(t, yarpcerrors.CodeUnavailable, r.Code)
+	})
+}
+
+func TestUnaryInbound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	t.Run("no fault", func(t *testing.T) {
+		h := transporttest.NewMockUnaryHandler(ctrl)
+		h.EXPECT().Handle(ctx, gomock.Any(), gomock.Any()).Return(nil)
+		i := newInjector(t, 0, Rule{Percent: 100, Procedures: []string{"put"}, Code: yarpcerrors.CodeInternal})
+		assert.NoError(t, i.Handle(ctx, newRequest("get"), new(transporttest.FakeResponseWriter), h))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		h := transporttest.NewMockUnaryHandler(ctrl)
+		i := newInjector(t, 0, Rule{Percent: 100, Code: yarpcerrors.CodeResourceExhausted})
+		err := i.Handle(ctx, newRequest("get"), new(transporttest.FakeResponseWriter), h)
+		assert.Equal(t, yarpcerrors.CodeResourceExhausted, yarpcerrors.FromError(err).Code())
+		assert.Equal(t, `injected fault for procedure "get" of service "service"`, yarpcerrors.FromError(err).Message())
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		h := transporttest.NewMockUnaryHandler(ctrl)
+		h.EXPECT().Handle(ctx, gomock.Any(), gomock.Any()).Return(nil)
+		i := newInjector(t, 0, Rule{Percent: 100, Delay: 20 * time.Millisecond})
+		start := time.Now()
+		assert.NoError(t, i.Handle(ctx, newRequest("get"), new(transporttest.FakeResponseWriter), h))
+		assert.True(t, time.Since(start) >= 20*time.Millisecond, "request was not delayed")
+	})
+
+	t.Run("delay past deadline", func(t *testing.T) {
+		h := transporttest.NewMockUnaryHandler(ctrl)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		i := newInjector(t, 0, Rule{Percent: 100, Delay: time.Minute})
+		err := i.Handle(ctx, newRequest("get"), new(transporttest.FakeResponseWriter), h)
+		assert.Equal(t, yarpcerrors.CodeDeadlineExceeded, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		h := transporttest.NewMockUnaryHandler(ctrl)
+		h.EXPECT().Handle(ctx, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+				_, err := resw.Write([]byte("lost"))
+				return err
+			})
+		resw := new(transporttest.FakeResponseWriter)
+		i := newInjector(t, 0, Rule{Percent: 100, Abort: true})
+		err := i.Handle(ctx, newRequest("get"), resw, h)
+		assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+		assert.Empty(t, resw.Body.String(), "response must be discarded")
+	})
+}
+
+func TestOnewayInbound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	t.Run("drop", func(t *testing.T) {
+		h := transporttest.NewMockOnewayHandler(ctrl)
+		i := newInjector(t, 0, Rule{Percent: 100, Drop: true})
+		assert.NoError(t, i.HandleOneway(ctx, newRequest("log"), h))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		h := transporttest.NewMockOnewayHandler(ctrl)
+		i := newInjector(t, 0, Rule{Percent: 100, Code: yarpcerrors.CodeInternal})
+		err := i.HandleOneway(ctx, newRequest("log"), h)
+		assert.Equal(t, yarpcerrors.CodeInternal, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		h := transporttest.NewMockOnewayHandler(ctrl)
+		h.EXPECT().HandleOneway(ctx, gomock.Any()).Return(nil)
+		i := newInjector(t, 0, Rule{Percent: 100, Abort: true})
+		err := i.HandleOneway(ctx, newRequest("log"), h)
+		assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+	})
+}
+
+func TestUnaryOutbound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	t.Run("error", func(t *testing.T) {
+		out := transporttest.NewMockUnaryOutbound(ctrl)
+		i := newInjector(t, 0, Rule{Percent: 100, Code: yarpcerrors.CodeUnavailable})
+		_, err := i.Call(ctx, newRequest("get"), out)
+		assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		out := transporttest.NewMockUnaryOutbound(ctrl)
+		out.EXPECT().Call(ctx, gomock.Any()).Return(&transport.Response{
+			Body: ioutil.NopCloser(bytes.NewReader([]byte("lost"))),
+		}, nil)
+		i := newInjector(t, 0, Rule{Percent: 100, Abort: true})
+		res, err := i.Call(ctx, newRequest("get"), out)
+		assert.Nil(t, res)
+		assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("no fault", func(t *testing.T) {
+		out := transporttest.NewMockUnaryOutbound(ctrl)
+		out.EXPECT().Call(ctx, gomock.Any()).Return(&transport.Response{}, nil)
+		i := newInjector(t, 0.5, Rule{Percent: 10, Code: yarpcerrors.CodeUnavailable})
+		_, err := i.Call(ctx, newRequest("get"), out)
+		assert.NoError(t, err)
+	})
+}
+
+func TestOnewayOutbound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	t.Run("drop", func(t *testing.T) {
+		out := transporttest.NewMockOnewayOutbound(ctrl)
+		i := newInjector(t, 0, Rule{Percent: 100, Drop: true})
+		ack, err := i.CallOneway(ctx, newRequest("log"), out)
+		require.NoError(t, err)
+		assert.NotNil(t, ack)
+	})
+
+	t.Run("drop ignored for unary", func(t *testing.T) {
+		out := transporttest.NewMockUnaryOutbound(ctrl)
+		out.EXPECT().Call(ctx, gomock.Any()).Return(&transport.Response{}, nil)
+		i := newInjector(t, 0, Rule{Percent: 100, Drop: true})
+		_, err := i.Call(ctx, newRequest("get"), out)
+		assert.NoError(t, err)
+	})
+}
+
+func TestStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	req := &transport.StreamRequest{Meta: newRequest("chat").ToRequestMeta()}
+	i := newInjector(t, 0, Rule{Percent: 100, Code: yarpcerrors.CodeUnavailable})
+
+	t.Run("outbound", func(t *testing.T) {
+		_, err := i.CallStream(ctx, req, transporttest.NewMockStreamOutbound(ctrl))
+		assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+	})
+
+	t.Run("inbound", func(t *testing.T) {
+		stream := transporttest.NewMockStream(ctrl)
+		stream.EXPECT().Context().Return(ctx).AnyTimes()
+		stream.EXPECT().Request().Return(req).AnyTimes()
+		serverStream, err := transport.NewServerStream(stream)
+		require.NoError(t, err)
+
+		err = i.HandleStream(serverStream, transporttest.NewMockStreamHandler(ctrl))
+		assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+	})
+}
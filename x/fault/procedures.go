@@ -0,0 +1,75 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package fault
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/encoding/json"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+const (
+	_adminPrefix = "yarpc::fault::"
+
+	// RulesProcedure is the name of the JSON procedure that returns the
+	// current rules of an Injector as a RuleSet.
+	RulesProcedure = _adminPrefix + "rules"
+
+	// UpdateProcedure is the name of the JSON procedure that replaces the
+	// rules of an Injector with the given RuleSet.
+	UpdateProcedure = _adminPrefix + "update"
+)
+
+// RuleSet is the body of requests and responses of the admin procedures.
+type RuleSet struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Procedures returns the admin procedures that read and replace the rules of
+// the injector, to register with a dispatcher. Faults are never injected
+// into these procedures.
+//
+// 	yab -p localhost:8080 -s myservice --procedure yarpc::fault::update \
+// 		-r '{"rules": [{"procedures": ["get"], "percent": 10, "code": "unavailable"}]}'
+func (i *Injector) Procedures() []transport.Procedure {
+	return append(
+		json.Procedure(RulesProcedure, i.handleRules),
+		json.Procedure(UpdateProcedure, i.handleUpdate)...,
+	)
+}
+
+func (i *Injector) handleRules(context.Context, *struct{}) (*RuleSet, error) {
+	return &RuleSet{Rules: i.Rules()}, nil
+}
+
+func (i *Injector) handleUpdate(_ context.Context, set *RuleSet) (*RuleSet, error) {
+	if err := i.Update(set.Rules); err != nil {
+		return nil, yarpcerrors.InvalidArgumentErrorf("%v", err)
+	}
+	return &RuleSet{Rules: i.Rules()}, nil
+}
+
+func isAdminProcedure(procedure string) bool {
+	return strings.HasPrefix(procedure, _adminPrefix)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package fault_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/encoding/json"
+	"go.uber.org/yarpc/transport/http"
+	"go.uber.org/yarpc/x/fault"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestProcedures(t *testing.T) {
+	injector, err := fault.NewInjector()
+	require.NoError(t, err)
+
+	trans := http.NewTransport()
+	inbound := trans.NewInbound("127.0.0.1:0")
+	server := yarpc.NewDispatcher(yarpc.Config{
+		Name:              "server",
+		Inbounds:          yarpc.Inbounds{inbound},
+		InboundMiddleware: yarpc.InboundMiddleware{Unary: injector},
+	})
+	server.Register(injector.Procedures())
+	server.Register(json.Procedure("echo", func(_ context.Context, body map[string]interface{}) (map[string]interface{}, error) {
+		return body, nil
+	}))
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	client := yarpc.NewDispatcher(yarpc.Config{
+		Name: "client",
+		Outbounds: yarpc.Outbounds{
+			"server": {Unary: trans.NewSingleOutbound("http://" + inbound.Addr().String())},
+		},
+	})
+	require.NoError(t, client.Start())
+	defer client.Stop()
+	jsonClient := json.New(client.ClientConfig("server"))
+
+	call := func(procedure string, req, res interface{}) error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return jsonClient.Call(ctx, procedure, req, res)
+	}
+
+	var echo map[string]interface{}
+	require.NoError(t, call("echo", map[string]interface{}{}, &echo))
+
+	var set fault.RuleSet
+	err = call(fault.UpdateProcedure, map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{"percent": 100, "code": "unavailable", "delay": "5ms"}},
+	}, &set)
+	require.NoError(t, err)
+	require.Len(t, set.Rules, 1)
+	assert.Equal(t, 5*time.Millisecond, set.Rules[0].Delay)
+
+	err = call("echo", map[string]interface{}{}, &echo)
+	assert.Equal(t, yarpcerrors.CodeUnavailable, yarpcerrors.FromError(err).Code())
+
+	require.NoError(t, call(fault.RulesProcedure, struct{}{}, &set), "admin procedures must not be faulted")
+	assert.Len(t, set.Rules, 1)
+
+	err = call(fault.UpdateProcedure, map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{"percent": 100}},
+	}, &set)
+	assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code())
+
+	require.NoError(t, call(fault.UpdateProcedure, fault.RuleSet{}, &set))
+	require.NoError(t, call("echo", map[string]interface{}{}, &echo))
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package idempotency provides inbound middleware that deduplicates unary
+// requests by idempotency key.
+//
+// The response to the first request with a key is stored for a window, and
+// returned to later requests with the same key, caller, service and
+// procedure without calling the handler again. Duplicates that arrive while
+// the first request is being handled wait for its response.
+//
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{
+// 		Name:     "payments",
+// 		Inbounds: inbounds,
+// 		InboundMiddleware: yarpc.InboundMiddleware{
+// 			Unary: idempotency.NewInboundMiddleware(idempotency.Window(time.Hour)),
+// 		},
+// 	})
+//
+// Callers set the key with yarpc.WithIdempotencyKey.
+//
+// 	res, err := client.Charge(ctx, req, yarpc.WithIdempotencyKey(chargeID))
+//
+// Responses, including application errors, are stored. Requests that fail
+// with an error are not, so that they may be retried. Duplicates waiting for
+// a request that fails are handled in its place.
+//
+// Responses are stored in memory by default. Use the Store option to share
+// them between the instances of a service.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/x/idempotency"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	_defaultWindow    = time.Hour
+	_defaultStoreSize = 10000
+)
+
+var _ middleware.UnaryInbound = (*InboundMiddleware)(nil)
+
+// Option customizes an InboundMiddleware.
+type Option func(*InboundMiddleware)
+
+// Window specifies how long responses are stored.
+//
+// Defaults to one hour.
+func Window(window time.Duration) Option {
+	return func(m *InboundMiddleware) {
+		m.window = window
+	}
+}
+
+// Store specifies where responses are stored.
+//
+// Defaults to an LRUStore holding 10000 responses.
+func Store(store idempotency.Store) Option {
+	return func(m *InboundMiddleware) {
+		m.store = store
+	}
+}
+
+// Logger specifies the logger for the middleware.
+func Logger(logger *zap.Logger) Option {
+	return func(m *InboundMiddleware) {
+		m.logger = logger
+	}
+}
+
+// InboundMiddleware is a unary inbound middleware that deduplicates requests
+// by idempotency key.
+type InboundMiddleware struct {
+	window time.Duration
+	store  idempotency.Store
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	inflight map[string]*inflightCall
+}
+
+// inflightCall is a request whose response is not stored yet. If the
+// request fails, res is nil.
+type inflightCall struct {
+	done chan struct{}
+	res  *idempotency.Response
+}
+
+// NewInboundMiddleware builds a middleware that deduplicates requests.
+func NewInboundMiddleware(opts ...Option) *InboundMiddleware {
+	m := &InboundMiddleware{
+		window:   _defaultWindow,
+		logger:   zap.NewNop(),
+		inflight: make(map[string]*inflightCall),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.store == nil {
+		m.store = NewLRUStore(_defaultStoreSize)
+	}
+	return m
+}
+
+// Handle returns the stored response for the idempotency key of the request,
+// if any, or calls the handler and stores its response.
+func (m *InboundMiddleware) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	idempotencyKey, ok := req.Headers.Get(idempotency.HeaderKey)
+	if !ok || idempotencyKey == "" {
+		return h.Handle(ctx, req, resw)
+	}
+	key := fmt.Sprintf("%q %q %q %q", req.Service, req.Procedure, req.Caller, idempotencyKey)
+
+	for {
+		res, err := m.lookup(ctx, req, key)
+		if err != nil {
+			return err
+		}
+		if res != nil {
+			return replay(res, resw)
+		}
+
+		m.mu.Lock()
+		if call, ok := m.inflight[key]; ok {
+			m.mu.Unlock()
+			if err := wait(ctx, req, call); err != nil {
+				return err
+			}
+			if call.res != nil {
+				return replay(call.res, resw)
+			}
+			// The request failed, possibly because its caller gave up, and
+			// its failure is not ours to return. Handle this request
+			// instead, unless another waiter got there first.
+			continue
+		}
+
+		// A request with the same key may have stored its response and left
+		// since the lookup above. In-flight requests are only removed after
+		// their response is stored, so checking again while holding the lock
+		// guarantees that the handler is not called twice.
+		res, err = m.lookup(ctx, req, key)
+		if err != nil || res != nil {
+			m.mu.Unlock()
+			if err != nil {
+				return err
+			}
+			return replay(res, resw)
+		}
+		call := &inflightCall{done: make(chan struct{})}
+		m.inflight[key] = call
+		m.mu.Unlock()
+		return m.handle(ctx, req, resw, h, key, call)
+	}
+}
+
+// wait waits for an in-flight request with the same key to finish.
+func wait(ctx context.Context, req *transport.Request, call *inflightCall) error {
+	select {
+	case <-call.done:
+		return nil
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return yarpcerrors.DeadlineExceededErrorf(
+				"request to procedure %q of service %q expired while waiting for a request with the same idempotency key",
+				req.Procedure, req.Service)
+		}
+		return yarpcerrors.CancelledErrorf(
+			"request to procedure %q of service %q was cancelled while waiting for a request with the same idempotency key",
+			req.Procedure, req.Service)
+	}
+}
+
+// handle calls the handler for an in-flight request and stores its response.
+func (m *InboundMiddleware) handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler, key string, call *inflightCall) error {
+	// Deferred so that the response is stored first.
+	defer m.finish(key, call)
+
+	rec := &recorder{}
+	if err := h.Handle(ctx, req, rec); err != nil {
+		return err
+	}
+	res := &idempotency.Response{
+		Headers:              rec.headers,
+		Body:                 rec.body.Bytes(),
+		ApplicationError:     rec.applicationError,
+		ApplicationErrorMeta: rec.applicationErrorMeta,
+	}
+	if err := m.store.Set(ctx, key, res, m.window); err != nil {
+		m.logger.Error("Failed to store response for idempotency key.",
+			zap.String("procedure", req.Procedure),
+			zap.String("caller", req.Caller),
+			zap.Error(err))
+	}
+	call.res = res
+	return replay(res, resw)
+}
+
+// lookup returns the stored response for the key, or nil if there is none.
+func (m *InboundMiddleware) lookup(ctx context.Context, req *transport.Request, key string) (*idempotency.Response, error) {
+	res, err := m.store.Get(ctx, key)
+	if err != nil {
+		return nil, yarpcerrors.UnavailableErrorf(
+			"failed to look up response to procedure %q of service %q for idempotency key: %v",
+			req.Procedure, req.Service, err)
+	}
+	return res, nil
+}
+
+// finish removes an in-flight request and releases the requests waiting for
+// it, which replay its response or, if it failed, handle their own request.
+// Successful requests must be stored before they finish.
+func (m *InboundMiddleware) finish(key string, call *inflightCall) {
+	m.mu.Lock()
+	delete(m.inflight, key)
+	m.mu.Unlock()
+	close(call.done)
+}
+
+// replay writes a stored response.
+func replay(res *idempotency.Response, resw transport.ResponseWriter) error {
+	resw.AddHeaders(res.Headers)
+	if res.ApplicationError {
+		resw.SetApplicationError()
+		if setter, ok := resw.(transport.ApplicationErrorMetaSetter); ok && res.ApplicationErrorMeta != nil {
+			setter.SetApplicationErrorMeta(res.ApplicationErrorMeta)
+		}
+	}
+	_, err := resw.Write(res.Body)
+	return err
+}
+
+// recorder is a transport.ResponseWriter that records the response.
+type recorder struct {
+	headers              transport.Headers
+	body                 bytes.Buffer
+	applicationError     bool
+	applicationErrorMeta *transport.ApplicationErrorMeta
+}
+
+var (
+	_ transport.ResponseWriter             = (*recorder)(nil)
+	_ transport.ApplicationErrorMetaSetter = (*recorder)(nil)
+)
+
+func (r *recorder) AddHeaders(h transport.Headers) {
+	for k, v := range h.OriginalItems() {
+		r.headers = r.headers.With(k, v)
+	}
+}
+
+func (r *recorder) SetApplicationError() {
+	r.applicationError = true
+}
+
+func (r *recorder) SetApplicationErrorMeta(meta *transport.ApplicationErrorMeta) {
+	r.applicationErrorMeta = meta
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	return r.body.Write(p)
+}
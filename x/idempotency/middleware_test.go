@@ -0,0 +1,323 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	apiidempotency "go.uber.org/yarpc/api/x/idempotency"
+	"go.uber.org/yarpc/encoding/raw"
+	"go.uber.org/yarpc/transport/http"
+	"go.uber.org/yarpc/x/idempotency"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// countingHandler counts calls and responds with the given function.
+type countingHandler struct {
+	calls atomic.Int32
+	fn    func(context.Context, *transport.Request, transport.ResponseWriter) error
+}
+
+func (h *countingHandler) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter) error {
+	h.calls.Inc()
+	return h.fn(ctx, req, resw)
+}
+
+func newRequest(procedure, key string) *transport.Request {
+	req := &transport.Request{Caller: "caller", Service: "service", Procedure: procedure}
+	if key != "" {
+		req.Headers = transport.NewHeaders().With(apiidempotency.HeaderKey, key)
+	}
+	return req
+}
+
+func TestDuplicateRequests(t *testing.T) {
+	code := yarpcerrors.CodeAlreadyExists
+	h := &countingHandler{fn: func(_ context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+		resw.AddHeaders(transport.NewHeaders().With("charge", "1"))
+		resw.SetApplicationError()
+		resw.(transport.ApplicationErrorMetaSetter).SetApplicationErrorMeta(&transport.ApplicationErrorMeta{Name: "Declined", Code: &code})
+		_, err := resw.Write([]byte("declined"))
+		return err
+	}}
+	m := idempotency.NewInboundMiddleware()
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		resw := new(transporttest.FakeResponseWriter)
+		require.NoError(t, m.Handle(ctx, newRequest("charge", "key"), resw, h))
+		assert.Equal(t, "declined", resw.Body.String())
+		assert.Equal(t, map[string]string{"charge": "1"}, resw.Headers.Items())
+		assert.True(t, resw.IsApplicationError)
+		assert.Equal(t, &transport.ApplicationErrorMeta{Name: "Declined", Code: &code}, resw.ApplicationErrorMeta)
+	}
+	assert.Equal(t, int32(1), h.calls.Load())
+
+	// Keys are scoped by procedure and caller.
+	require.NoError(t, m.Handle(ctx, newRequest("refund", "key"), new(transporttest.FakeResponseWriter), h))
+	otherCaller := newRequest("charge", "key")
+	otherCaller.Caller = "other"
+	require.NoError(t, m.Handle(ctx, otherCaller, new(transporttest.FakeResponseWriter), h))
+	assert.Equal(t, int32(3), h.calls.Load())
+
+	// Requests without a key are always handled.
+	for i := 0; i < 2; i++ {
+		require.NoError(t, m.Handle(ctx, newRequest("charge", ""), new(transporttest.FakeResponseWriter), h))
+	}
+	assert.Equal(t, int32(5), h.calls.Load())
+}
+
+func TestErrorsAreNotStored(t *testing.T) {
+	h := &countingHandler{fn: func(context.Context, *transport.Request, transport.ResponseWriter) error {
+		return yarpcerrors.UnavailableErrorf("great sadness")
+	}}
+	m := idempotency.NewInboundMiddleware()
+
+	for i := 0; i < 2; i++ {
+		err := m.Handle(context.Background(), newRequest("charge", "key"), new(transporttest.FakeResponseWriter), h)
+		assert.True(t, yarpcerrors.IsUnavailable(err), "unexpected error: %v", err)
+	}
+	assert.Equal(t, int32(2), h.calls.Load())
+}
+
+func TestConcurrentDuplicates(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	h := &countingHandler{fn: func(_ context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+		close(started)
+		<-unblock
+		_, err := resw.Write([]byte("charged"))
+		return err
+	}}
+	m := idempotency.NewInboundMiddleware()
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 3)
+	for i := range bodies {
+		if i == 1 {
+			<-started
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resw := new(transporttest.FakeResponseWriter)
+			assert.NoError(t, m.Handle(context.Background(), newRequest("charge", "key"), resw, h))
+			bodies[i] = resw.Body.String()
+		}(i)
+	}
+	close(unblock)
+	wg.Wait()
+
+	assert.Equal(t, []string{"charged", "charged", "charged"}, bodies)
+	assert.Equal(t, int32(1), h.calls.Load())
+}
+
+func TestDuplicateExpiresWhileWaiting(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	h := &countingHandler{fn: func(context.Context, *transport.Request, transport.ResponseWriter) error {
+		close(started)
+		<-unblock
+		return nil
+	}}
+	m := idempotency.NewInboundMiddleware()
+
+	first := make(chan error, 1)
+	go func() {
+		first <- m.Handle(context.Background(), newRequest("charge", "key"), new(transporttest.FakeResponseWriter), h)
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := m.Handle(ctx, newRequest("charge", "key"), new(transporttest.FakeResponseWriter), h)
+	assert.True(t, yarpcerrors.IsDeadlineExceeded(err), "unexpected error: %v", err)
+
+	close(unblock)
+	assert.NoError(t, <-first)
+}
+
+// lookupStore reports lookups on a channel.
+type lookupStore struct {
+	apiidempotency.Store
+
+	lookups chan struct{}
+}
+
+func (s *lookupStore) Get(ctx context.Context, key string) (*apiidempotency.Response, error) {
+	res, err := s.Store.Get(ctx, key)
+	s.lookups <- struct{}{}
+	return res, err
+}
+
+func TestDuplicateHandledWhenFirstCancelled(t *testing.T) {
+	h := &countingHandler{fn: func(ctx context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+		if ctx.Value(cancelledKey{}) != nil {
+			<-ctx.Done()
+			return yarpcerrors.CancelledErrorf("first caller gave up")
+		}
+		_, err := resw.Write([]byte("charged"))
+		return err
+	}}
+	store := &lookupStore{Store: idempotency.NewLRUStore(10), lookups: make(chan struct{}, 10)}
+	m := idempotency.NewInboundMiddleware(idempotency.Store(store))
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), cancelledKey{}, true))
+	first := make(chan error, 1)
+	go func() {
+		first <- m.Handle(ctx, newRequest("charge", "key"), new(transporttest.FakeResponseWriter), h)
+	}()
+	// The first request looks up the key twice before it is in flight.
+	<-store.lookups
+	<-store.lookups
+
+	second := make(chan *transporttest.FakeResponseWriter, 1)
+	go func() {
+		resw := new(transporttest.FakeResponseWriter)
+		assert.NoError(t, m.Handle(context.Background(), newRequest("charge", "key"), resw, h))
+		second <- resw
+	}()
+	<-store.lookups
+	cancel()
+
+	err := <-first
+	assert.True(t, yarpcerrors.IsCancelled(err), "unexpected error: %v", err)
+	assert.Equal(t, "charged", (<-second).Body.String())
+	assert.Equal(t, int32(2), h.calls.Load())
+}
+
+type cancelledKey struct{}
+
+// pausingStore pauses after the first lookup until resume is closed.
+type pausingStore struct {
+	apiidempotency.Store
+
+	calls  atomic.Int32
+	paused chan struct{}
+	resume chan struct{}
+}
+
+func (s *pausingStore) Get(ctx context.Context, key string) (*apiidempotency.Response, error) {
+	res, err := s.Store.Get(ctx, key)
+	if s.calls.Inc() == 1 {
+		close(s.paused)
+		<-s.resume
+	}
+	return res, err
+}
+
+func TestDuplicateFinishesDuringLookup(t *testing.T) {
+	h := &countingHandler{fn: func(_ context.Context, _ *transport.Request, resw transport.ResponseWriter) error {
+		_, err := resw.Write([]byte("charged"))
+		return err
+	}}
+	store := &pausingStore{
+		Store:  idempotency.NewLRUStore(10),
+		paused: make(chan struct{}),
+		resume: make(chan struct{}),
+	}
+	m := idempotency.NewInboundMiddleware(idempotency.Store(store))
+
+	first := make(chan string)
+	go func() {
+		resw := new(transporttest.FakeResponseWriter)
+		assert.NoError(t, m.Handle(context.Background(), newRequest("charge", "key"), resw, h))
+		first <- resw.Body.String()
+	}()
+
+	// The second request is handled and stored while the first one is
+	// between its lookup and registering as in flight.
+	<-store.paused
+	resw := new(transporttest.FakeResponseWriter)
+	require.NoError(t, m.Handle(context.Background(), newRequest("charge", "key"), resw, h))
+	assert.Equal(t, "charged", resw.Body.String())
+	close(store.resume)
+
+	assert.Equal(t, "charged", <-first)
+	assert.Equal(t, int32(1), h.calls.Load())
+}
+
+type failingStore struct{ apiidempotency.Store }
+
+func (failingStore) Get(context.Context, string) (*apiidempotency.Response, error) {
+	return nil, errors.New("store unreachable")
+}
+
+func TestStoreError(t *testing.T) {
+	h := &countingHandler{fn: func(context.Context, *transport.Request, transport.ResponseWriter) error {
+		return nil
+	}}
+	m := idempotency.NewInboundMiddleware(idempotency.Store(failingStore{}))
+
+	err := m.Handle(context.Background(), newRequest("charge", "key"), new(transporttest.FakeResponseWriter), h)
+	require.Error(t, err)
+	assert.True(t, yarpcerrors.IsUnavailable(err), "unexpected error: %v", err)
+	assert.Equal(t,
+		`failed to look up response to procedure "charge" of service "service" for idempotency key: store unreachable`,
+		yarpcerrors.FromError(err).Message())
+	assert.Equal(t, int32(0), h.calls.Load())
+}
+
+func TestWithIdempotencyKey(t *testing.T) {
+	trans := http.NewTransport()
+	inbound := trans.NewInbound("127.0.0.1:0")
+	server := yarpc.NewDispatcher(yarpc.Config{
+		Name:              "server",
+		Inbounds:          yarpc.Inbounds{inbound},
+		InboundMiddleware: yarpc.InboundMiddleware{Unary: idempotency.NewInboundMiddleware()},
+	})
+	var charges atomic.Int32
+	server.Register(raw.Procedure("charge", func(context.Context, []byte) ([]byte, error) {
+		charges.Inc()
+		return []byte("charged"), nil
+	}))
+	require.NoError(t, server.Start())
+	defer server.Stop()
+
+	client := yarpc.NewDispatcher(yarpc.Config{
+		Name: "client",
+		Outbounds: yarpc.Outbounds{
+			"server": {Unary: trans.NewSingleOutbound("http://" + inbound.Addr().String())},
+		},
+	})
+	require.NoError(t, client.Start())
+	defer client.Stop()
+
+	rawClient := raw.New(client.ClientConfig("server"))
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		res, err := rawClient.Call(ctx, "charge", nil, yarpc.WithIdempotencyKey("charge-1"))
+		cancel()
+		require.NoError(t, err)
+		assert.Equal(t, "charged", string(res))
+	}
+	assert.Equal(t, int32(1), charges.Load())
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/yarpc/api/x/idempotency"
+)
+
+var _ idempotency.Store = (*LRUStore)(nil)
+
+// LRUStore is an in-memory Store that holds up to a fixed number of
+// responses, evicting the least recently used ones first.
+type LRUStore struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // of *lruEntry, most recently used first
+
+	// for tests
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	res     *idempotency.Response
+	expires time.Time
+}
+
+// NewLRUStore builds an LRUStore that holds up to size responses.
+func NewLRUStore(size int) *LRUStore {
+	if size < 1 {
+		size = 1
+	}
+	return &LRUStore{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the response stored for the key, or nil if there is none or it
+// expired.
+func (s *LRUStore) Get(_ context.Context, key string) (*idempotency.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := el.Value.(*lruEntry)
+	if !s.now().Before(entry.expires) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return nil, nil
+	}
+	s.order.MoveToFront(el)
+	return entry.res, nil
+}
+
+// Set stores the response for the key for the given duration, evicting the
+// least recently used response if the store is full.
+func (s *LRUStore) Set(_ context.Context, key string, res *idempotency.Response, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &lruEntry{key: key, res: res, expires: s.now().Add(ttl)}
+	if el, ok := s.entries[key]; ok {
+		el.Value = entry
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
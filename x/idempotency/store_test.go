@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/x/idempotency"
+)
+
+func TestLRUStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewLRUStore(2)
+	now := time.Unix(1000, 0)
+	s.now = func() time.Time { return now }
+
+	get := func(key string) *idempotency.Response {
+		res, err := s.Get(ctx, key)
+		require.NoError(t, err)
+		return res
+	}
+
+	a := &idempotency.Response{Body: []byte("a")}
+	b := &idempotency.Response{Body: []byte("b")}
+	c := &idempotency.Response{Body: []byte("c")}
+
+	require.NoError(t, s.Set(ctx, "a", a, time.Minute))
+	require.NoError(t, s.Set(ctx, "b", b, time.Minute))
+	assert.Equal(t, a, get("a"))
+
+	// "b" is the least recently used response.
+	require.NoError(t, s.Set(ctx, "c", c, time.Minute))
+	assert.Nil(t, get("b"))
+	assert.Equal(t, a, get("a"))
+	assert.Equal(t, c, get("c"))
+
+	require.NoError(t, s.Set(ctx, "a", b, time.Hour))
+	assert.Equal(t, b, get("a"))
+
+	now = now.Add(time.Minute)
+	assert.Nil(t, get("c"), "response should expire")
+	assert.Equal(t, b, get("a"))
+}
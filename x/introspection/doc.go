@@ -0,0 +1,43 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package introspection exposes the state of a dispatcher as YARPC
+// procedures, so that tools and other services may discover what a running
+// dispatcher serves and how its outbounds and peer lists look, over the
+// same transports as any other call.
+//
+// The procedures belong to the "yarpc-introspection" service, and are
+// registered like any other procedures:
+//
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{Name: "myservice", ...})
+// 	dispatcher.Register(introspection.Procedures(dispatcher))
+//
+// Each procedure is available in the JSON and raw encodings. Both take a
+// JSON object as request, which may be empty with the raw encoding, and
+// respond with a JSON object.
+//
+// 	listProcedures  lists the procedures registered on the dispatcher
+// 	outboundStatus  reports the lifecycle state of outbounds
+// 	peerStatus      reports the peers of outbounds and their connection
+// 	                status and pending requests
+//
+// outboundStatus and peerStatus accept an "outboundKey" to report a single
+// outbound.
+package introspection
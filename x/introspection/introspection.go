@@ -0,0 +1,227 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	xintrospection "go.uber.org/yarpc/api/x/introspection"
+	yarpcjson "go.uber.org/yarpc/encoding/json"
+	"go.uber.org/yarpc/encoding/raw"
+	"go.uber.org/yarpc/internal/introspection"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// ServiceName is the name of the service of the introspection procedures.
+const ServiceName = "yarpc-introspection"
+
+// Names of the introspection procedures.
+const (
+	ListProceduresProcedure = "listProcedures"
+	OutboundStatusProcedure = "outboundStatus"
+	PeerStatusProcedure     = "peerStatus"
+)
+
+// ListProceduresRequest is the request of the listProcedures procedure.
+type ListProceduresRequest struct{}
+
+// ListProceduresResponse is the response of the listProcedures procedure.
+type ListProceduresResponse struct {
+	// Service is the name of the dispatcher.
+	Service         string                         `json:"service"`
+	Procedures      []introspection.Procedure      `json:"procedures"`
+	PackageVersions []introspection.PackageVersion `json:"packageVersions"`
+}
+
+// OutboundStatusRequest is the request of the outboundStatus procedure.
+type OutboundStatusRequest struct {
+	// OutboundKey, if set, restricts the response to the outbounds with
+	// this key.
+	OutboundKey string `json:"outboundKey,omitempty"`
+}
+
+// OutboundStatusResponse is the response of the outboundStatus procedure.
+type OutboundStatusResponse struct {
+	Outbounds []xintrospection.OutboundStatus `json:"outbounds"`
+}
+
+// PeerStatusRequest is the request of the peerStatus procedure.
+type PeerStatusRequest struct {
+	// OutboundKey, if set, restricts the response to the outbounds with
+	// this key.
+	OutboundKey string `json:"outboundKey,omitempty"`
+}
+
+// PeerStatusResponse is the response of the peerStatus procedure.
+type PeerStatusResponse struct {
+	Outbounds []OutboundPeers `json:"outbounds"`
+}
+
+// OutboundPeers are the peers of an outbound.
+type OutboundPeers struct {
+	OutboundKey string `json:"outboundKey"`
+	RPCType     string `json:"rpcType"`
+	// Route is the target of the route through which an outbound which
+	// sends requests to other outbounds reaches this one, if any.
+	Route   string                       `json:"route,omitempty"`
+	Chooser xintrospection.ChooserStatus `json:"chooser"`
+}
+
+// Procedures builds the introspection procedures of the given dispatcher,
+// in the JSON and raw encodings.
+func Procedures(d *yarpc.Dispatcher) []transport.Procedure {
+	s := server{d: d}
+
+	var procedures []transport.Procedure
+	procedures = append(procedures, yarpcjson.Procedure(ListProceduresProcedure, s.listProcedures)...)
+	procedures = append(procedures, yarpcjson.Procedure(OutboundStatusProcedure, s.outboundStatus)...)
+	procedures = append(procedures, yarpcjson.Procedure(PeerStatusProcedure, s.peerStatus)...)
+	procedures = append(procedures, rawProcedure(ListProceduresProcedure, func(ctx context.Context, body []byte) (interface{}, error) {
+		var req ListProceduresRequest
+		if err := unmarshalRaw(body, &req); err != nil {
+			return nil, err
+		}
+		return s.listProcedures(ctx, &req)
+	})...)
+	procedures = append(procedures, rawProcedure(OutboundStatusProcedure, func(ctx context.Context, body []byte) (interface{}, error) {
+		var req OutboundStatusRequest
+		if err := unmarshalRaw(body, &req); err != nil {
+			return nil, err
+		}
+		return s.outboundStatus(ctx, &req)
+	})...)
+	procedures = append(procedures, rawProcedure(PeerStatusProcedure, func(ctx context.Context, body []byte) (interface{}, error) {
+		var req PeerStatusRequest
+		if err := unmarshalRaw(body, &req); err != nil {
+			return nil, err
+		}
+		return s.peerStatus(ctx, &req)
+	})...)
+
+	for i := range procedures {
+		procedures[i].Service = ServiceName
+	}
+	return procedures
+}
+
+// rawProcedure builds a raw procedure responding with the JSON encoding of
+// the result of the handler.
+func rawProcedure(name string, handler func(context.Context, []byte) (interface{}, error)) []transport.Procedure {
+	procedures := raw.Procedure(name, func(ctx context.Context, body []byte) ([]byte, error) {
+		res, err := handler(ctx, body)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(res)
+	})
+	// raw.Procedure handles all encodings, which may not share a procedure
+	// with the JSON handlers.
+	for i := range procedures {
+		procedures[i].Encoding = raw.Encoding
+	}
+	return procedures
+}
+
+func unmarshalRaw(body []byte, req interface{}) error {
+	if len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		return yarpcerrors.InvalidArgumentErrorf("failed to decode introspection request: %v", err)
+	}
+	return nil
+}
+
+type server struct {
+	d *yarpc.Dispatcher
+}
+
+func (s server) listProcedures(context.Context, *ListProceduresRequest) (*ListProceduresResponse, error) {
+	status := s.d.Introspect()
+	return &ListProceduresResponse{
+		Service:         status.Name,
+		Procedures:      status.Procedures,
+		PackageVersions: status.PackageVersions,
+	}, nil
+}
+
+func (s server) outboundStatus(_ context.Context, req *OutboundStatusRequest) (*OutboundStatusResponse, error) {
+	outbounds, err := s.outbounds(req.OutboundKey)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboundStatusResponse{Outbounds: outbounds}, nil
+}
+
+func (s server) peerStatus(_ context.Context, req *PeerStatusRequest) (*PeerStatusResponse, error) {
+	outbounds, err := s.outbounds(req.OutboundKey)
+	if err != nil {
+		return nil, err
+	}
+	res := &PeerStatusResponse{Outbounds: []OutboundPeers{}}
+	for _, o := range outbounds {
+		res.Outbounds = appendPeers(res.Outbounds, o, "")
+	}
+	return res, nil
+}
+
+// outbounds returns the status of the outbounds with the given key, or of
+// all outbounds if the key is empty.
+func (s server) outbounds(outboundKey string) ([]xintrospection.OutboundStatus, error) {
+	all := s.d.Introspect().Outbounds
+	if outboundKey == "" {
+		if all == nil {
+			all = []xintrospection.OutboundStatus{}
+		}
+		return all, nil
+	}
+
+	var outbounds []xintrospection.OutboundStatus
+	for _, o := range all {
+		if o.OutboundKey == outboundKey {
+			outbounds = append(outbounds, o)
+		}
+	}
+	if len(outbounds) == 0 {
+		return nil, yarpcerrors.NotFoundErrorf("no outbound with key %q", outboundKey)
+	}
+	return outbounds, nil
+}
+
+func appendPeers(peers []OutboundPeers, o xintrospection.OutboundStatus, route string) []OutboundPeers {
+	if len(o.Routes) == 0 {
+		return append(peers, OutboundPeers{
+			OutboundKey: o.OutboundKey,
+			RPCType:     o.RPCType,
+			Route:       route,
+			Chooser:     o.Chooser,
+		})
+	}
+	for _, r := range o.Routes {
+		r.Outbound.OutboundKey = o.OutboundKey
+		r.Outbound.RPCType = o.RPCType
+		peers = appendPeers(peers, r.Outbound, r.Target)
+	}
+	return peers
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package introspection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc"
+	yarpcjson "go.uber.org/yarpc/encoding/json"
+	"go.uber.org/yarpc/encoding/raw"
+	"go.uber.org/yarpc/transport/http"
+	"go.uber.org/yarpc/x/introspection"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// newDispatchers starts a dispatcher serving the introspection procedures,
+// and a dispatcher calling them.
+func newDispatchers(t *testing.T) (server, client *yarpc.Dispatcher) {
+	transport := http.NewTransport()
+	inbound := transport.NewInbound("127.0.0.1:0")
+	server = yarpc.NewDispatcher(yarpc.Config{
+		Name:     "server",
+		Inbounds: yarpc.Inbounds{inbound},
+		Outbounds: yarpc.Outbounds{
+			"backend": {
+				Unary: transport.NewSingleOutbound("http://127.0.0.1:1"),
+			},
+		},
+	})
+	server.Register(raw.Procedure("echo", func(_ context.Context, body []byte) ([]byte, error) {
+		return body, nil
+	}))
+	server.Register(introspection.Procedures(server))
+	require.NoError(t, server.Start())
+
+	client = yarpc.NewDispatcher(yarpc.Config{
+		Name: "client",
+		Outbounds: yarpc.Outbounds{
+			introspection.ServiceName: {
+				Unary: transport.NewSingleOutbound("http://" + inbound.Addr().String()),
+			},
+		},
+	})
+	require.NoError(t, client.Start())
+	return server, client
+}
+
+func TestListProcedures(t *testing.T) {
+	server, client := newDispatchers(t)
+	defer server.Stop()
+	defer client.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var res introspection.ListProceduresResponse
+	err := yarpcjson.New(client.ClientConfig(introspection.ServiceName)).Call(
+		ctx, introspection.ListProceduresProcedure, &introspection.ListProceduresRequest{}, &res)
+	require.NoError(t, err)
+
+	assert.Equal(t, "server", res.Service)
+	assert.NotEmpty(t, res.PackageVersions)
+	procedures := make(map[string][]string)
+	for _, p := range res.Procedures {
+		procedures[p.Name] = append(procedures[p.Name], p.Encoding)
+	}
+	assert.Equal(t, []string{""}, procedures["echo"])
+	assert.ElementsMatch(t, []string{"json", "raw"}, procedures[introspection.ListProceduresProcedure])
+	assert.ElementsMatch(t, []string{"json", "raw"}, procedures[introspection.PeerStatusProcedure])
+}
+
+func TestOutboundStatus(t *testing.T) {
+	server, client := newDispatchers(t)
+	defer server.Stop()
+	defer client.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The raw encoding accepts an empty request.
+	body, err := raw.New(client.ClientConfig(introspection.ServiceName)).Call(ctx, introspection.OutboundStatusProcedure, nil)
+	require.NoError(t, err)
+	var res introspection.OutboundStatusResponse
+	require.NoError(t, json.Unmarshal(body, &res))
+	require.Len(t, res.Outbounds, 1)
+	assert.Equal(t, "backend", res.Outbounds[0].OutboundKey)
+	assert.Equal(t, "http", res.Outbounds[0].Transport)
+	assert.Equal(t, "Running", res.Outbounds[0].State)
+
+	jsonClient := yarpcjson.New(client.ClientConfig(introspection.ServiceName))
+	err = jsonClient.Call(ctx, introspection.OutboundStatusProcedure, &introspection.OutboundStatusRequest{OutboundKey: "backend"}, &res)
+	require.NoError(t, err)
+	require.Len(t, res.Outbounds, 1)
+
+	err = jsonClient.Call(ctx, introspection.OutboundStatusProcedure, &introspection.OutboundStatusRequest{OutboundKey: "unknown"}, &res)
+	assert.Equal(t, yarpcerrors.CodeNotFound, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+
+	_, err = raw.New(client.ClientConfig(introspection.ServiceName)).Call(ctx, introspection.OutboundStatusProcedure, []byte("{"))
+	assert.Equal(t, yarpcerrors.CodeInvalidArgument, yarpcerrors.FromError(err).Code(), "unexpected error: %v", err)
+}
+
+func TestPeerStatus(t *testing.T) {
+	server, client := newDispatchers(t)
+	defer server.Stop()
+	defer client.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var res introspection.PeerStatusResponse
+	err := yarpcjson.New(client.ClientConfig(introspection.ServiceName)).Call(
+		ctx, introspection.PeerStatusProcedure, &introspection.PeerStatusRequest{}, &res)
+	require.NoError(t, err)
+
+	require.Len(t, res.Outbounds, 1)
+	peers := res.Outbounds[0]
+	assert.Equal(t, "backend", peers.OutboundKey)
+	assert.Equal(t, "unary", peers.RPCType)
+	require.Len(t, peers.Chooser.Peers, 1)
+	assert.Equal(t, "127.0.0.1:1", peers.Chooser.Peers[0].Identifier)
+	assert.NotEmpty(t, peers.Chooser.Peers[0].ConnectionStatus)
+	assert.Equal(t, 0, peers.Chooser.Peers[0].PendingRequests)
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package loadshed provides inbound middleware that sheds load by
+// criticality when a server is overloaded.
+//
+// The middleware handles a bounded number of requests at once. Requests that
+// arrive while all slots are taken wait in a bounded admission queue, and are
+// admitted in order of criticality, then of arrival, as slots free up. When
+// the queue is full, the least critical request is shed, and of equally
+// critical requests, the one whose deadline expires first, since it is the
+// least likely to be served in time.
+//
+// 	dispatcher := yarpc.NewDispatcher(yarpc.Config{
+// 		Name:     "keyvalue",
+// 		Inbounds: inbounds,
+// 		InboundMiddleware: yarpc.InboundMiddleware{
+// 			Unary:  shedder,
+// 			Oneway: shedder,
+// 		},
+// 	})
+//
+// Callers set the criticality of their requests with yarpc.WithCriticality.
+// Requests without a criticality are treated as critical. Shed requests fail
+// with CodeResourceExhausted.
+//
+// Streams are not subject to load shedding.
+package loadshed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	_defaultMaxConcurrency = 1000
+	_defaultMaxQueueSize   = 1000
+
+	_reasonQueueFull = "queue_full"
+	_reasonExpired   = "expired"
+)
+
+var (
+	_ middleware.UnaryInbound  = (*InboundMiddleware)(nil)
+	_ middleware.OnewayInbound = (*InboundMiddleware)(nil)
+)
+
+// Option customizes an InboundMiddleware.
+type Option func(*InboundMiddleware)
+
+// MaxConcurrency specifies the number of requests that are handled at once.
+//
+// Defaults to 1000.
+func MaxConcurrency(n int) Option {
+	return func(m *InboundMiddleware) {
+		m.maxConcurrency = n
+	}
+}
+
+// MaxQueueSize specifies the number of requests that may wait to be handled.
+// Requests are shed when the queue is full. A size of zero sheds all
+// requests that cannot be handled right away.
+//
+// Defaults to 1000.
+func MaxQueueSize(n int) Option {
+	return func(m *InboundMiddleware) {
+		m.maxQueueSize = n
+	}
+}
+
+// Meter specifies the scope in which load shedding metrics are recorded.
+//
+// The "shed_requests" counter counts shed requests by criticality and reason
+// ("queue_full", or "expired" for requests whose deadline passed while they
+// waited in the queue).
+func Meter(meter *metrics.Scope) Option {
+	return func(m *InboundMiddleware) {
+		m.meter = meter
+	}
+}
+
+// Logger specifies the logger for the middleware.
+func Logger(logger *zap.Logger) Option {
+	return func(m *InboundMiddleware) {
+		m.logger = logger
+	}
+}
+
+// InboundMiddleware is a unary and oneway inbound middleware that admits
+// requests by criticality.
+type InboundMiddleware struct {
+	maxConcurrency int
+	maxQueueSize   int
+	meter          *metrics.Scope
+	logger         *zap.Logger
+
+	shed *metrics.CounterVector
+
+	mu      sync.Mutex
+	running int
+	queue   []*waiter
+	seq     uint64
+}
+
+// NewInboundMiddleware builds a load shedding middleware.
+func NewInboundMiddleware(opts ...Option) *InboundMiddleware {
+	m := &InboundMiddleware{
+		maxConcurrency: _defaultMaxConcurrency,
+		maxQueueSize:   _defaultMaxQueueSize,
+		logger:         zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.maxConcurrency < 1 {
+		m.maxConcurrency = 1
+	}
+	if m.maxQueueSize < 0 {
+		m.maxQueueSize = 0
+	}
+
+	var err error
+	m.shed, err = m.meter.CounterVector(metrics.Spec{
+		Name:    "shed_requests",
+		Help:    "Number of requests shed due to overload.",
+		VarTags: []string{"criticality", "reason"},
+	})
+	if err != nil {
+		m.logger.Error("Failed to create shed requests vector.", zap.Error(err))
+	}
+	return m
+}
+
+// Handle admits the request before handling it, or sheds it.
+func (m *InboundMiddleware) Handle(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+	if err := m.admit(ctx, req); err != nil {
+		return err
+	}
+	defer m.release()
+	return h.Handle(ctx, req, resw)
+}
+
+// HandleOneway admits the request before handling it, or sheds it.
+func (m *InboundMiddleware) HandleOneway(ctx context.Context, req *transport.Request, h transport.OnewayHandler) error {
+	if err := m.admit(ctx, req); err != nil {
+		return err
+	}
+	defer m.release()
+	return h.HandleOneway(ctx, req)
+}
+
+// waiter is a request in the admission queue.
+type waiter struct {
+	req         *transport.Request
+	criticality transport.Criticality
+	deadline    time.Time
+	seq         uint64
+
+	// admitted receives nil once the request may be handled, or the error
+	// with which it was shed.
+	admitted chan error
+}
+
+// before reports whether w should be admitted before other.
+func (w *waiter) before(other *waiter) bool {
+	if w.criticality.Rank() != other.criticality.Rank() {
+		return w.criticality.Rank() > other.criticality.Rank()
+	}
+	return w.seq < other.seq
+}
+
+// shedBefore reports whether w should be shed before other.
+func (w *waiter) shedBefore(other *waiter) bool {
+	if w.criticality.Rank() != other.criticality.Rank() {
+		return w.criticality.Rank() < other.criticality.Rank()
+	}
+	if w.deadline.IsZero() || other.deadline.IsZero() {
+		return !w.deadline.IsZero()
+	}
+	return w.deadline.Before(other.deadline)
+}
+
+// admit blocks until the request may be handled, or returns the error with
+// which it was shed.
+func (m *InboundMiddleware) admit(ctx context.Context, req *transport.Request) error {
+	w := &waiter{req: req, criticality: normalize(req.Criticality)}
+	w.deadline, _ = ctx.Deadline()
+
+	m.mu.Lock()
+	if m.running < m.maxConcurrency && len(m.queue) == 0 {
+		m.running++
+		m.mu.Unlock()
+		return nil
+	}
+
+	m.seq++
+	w.seq = m.seq
+	w.admitted = make(chan error, 1)
+	if len(m.queue) >= m.maxQueueSize {
+		victim := w
+		if i := m.shedCandidate(); i >= 0 && m.queue[i].shedBefore(w) {
+			victim = m.queue[i]
+			m.remove(i)
+		}
+		if victim == w {
+			m.mu.Unlock()
+			return m.shedError(w)
+		}
+		victim.admitted <- m.shedError(victim)
+	}
+	m.queue = append(m.queue, w)
+	m.mu.Unlock()
+
+	select {
+	case err := <-w.admitted:
+		return err
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	queued := false
+	for i, q := range m.queue {
+		if q == w {
+			m.remove(i)
+			queued = true
+			break
+		}
+	}
+	m.mu.Unlock()
+	if !queued {
+		// The request was admitted or shed while its context ended.
+		if err := <-w.admitted; err != nil {
+			return err
+		}
+		m.release()
+	}
+
+	m.count(w.criticality, _reasonExpired)
+	if ctx.Err() == context.DeadlineExceeded {
+		return yarpcerrors.DeadlineExceededErrorf(
+			"request to procedure %q of service %q expired while waiting to be handled", req.Procedure, req.Service)
+	}
+	return yarpcerrors.CancelledErrorf(
+		"request to procedure %q of service %q was cancelled while waiting to be handled", req.Procedure, req.Service)
+}
+
+// release frees the slot of a handled request, admitting the next queued
+// request, if any.
+func (m *InboundMiddleware) release() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.queue) == 0 {
+		m.running--
+		return
+	}
+	next := 0
+	for i, w := range m.queue {
+		if w.before(m.queue[next]) {
+			next = i
+		}
+	}
+	w := m.queue[next]
+	m.remove(next)
+	w.admitted <- nil
+}
+
+// shedCandidate returns the index of the queued request to shed first, or -1
+// if the queue is empty. It must be called with the lock held.
+func (m *InboundMiddleware) shedCandidate() int {
+	candidate := -1
+	for i, w := range m.queue {
+		if candidate < 0 || w.shedBefore(m.queue[candidate]) {
+			candidate = i
+		}
+	}
+	return candidate
+}
+
+// remove removes the queued request at index i. It must be called with the
+// lock held.
+func (m *InboundMiddleware) remove(i int) {
+	copy(m.queue[i:], m.queue[i+1:])
+	m.queue[len(m.queue)-1] = nil
+	m.queue = m.queue[:len(m.queue)-1]
+}
+
+// shedError records that the request was shed because the queue is full and
+// returns the error for it.
+func (m *InboundMiddleware) shedError(w *waiter) error {
+	m.count(w.criticality, _reasonQueueFull)
+	m.logger.Debug("Shed request due to overload.",
+		zap.String("procedure", w.req.Procedure),
+		zap.String("caller", w.req.Caller),
+		zap.String("criticality", string(w.criticality)))
+	return yarpcerrors.ResourceExhaustedErrorf(
+		"request to procedure %q of service %q with criticality %q was shed because the server is overloaded",
+		w.req.Procedure, w.req.Service, w.criticality)
+}
+
+func (m *InboundMiddleware) count(c transport.Criticality, reason string) {
+	counter, err := m.shed.Get("criticality", string(c), "reason", reason)
+	if err != nil {
+		m.logger.Error("Failed to get shed requests counter.", zap.Error(err))
+		return
+	}
+	counter.Inc()
+}
+
+// normalize returns the given criticality, or CriticalityCritical if it is
+// empty or unknown.
+func normalize(c transport.Criticality) transport.Criticality {
+	switch c {
+	case transport.CriticalityCriticalPlus, transport.CriticalitySheddablePlus, transport.CriticalitySheddable:
+		return c
+	default:
+		return transport.CriticalityCritical
+	}
+}
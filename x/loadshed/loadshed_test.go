@@ -0,0 +1,194 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package loadshed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// blockingHandler reports the procedures it handles, and blocks until it is
+// unblocked.
+type blockingHandler struct {
+	started chan string
+	unblock chan struct{}
+}
+
+func newBlockingHandler() *blockingHandler {
+	return &blockingHandler{started: make(chan string), unblock: make(chan struct{})}
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, req *transport.Request, _ transport.ResponseWriter) error {
+	return h.HandleOneway(ctx, req)
+}
+
+func (h *blockingHandler) HandleOneway(_ context.Context, req *transport.Request) error {
+	h.started <- req.Procedure
+	<-h.unblock
+	return nil
+}
+
+// call sends a request for the given procedure through the middleware and
+// returns a channel for its result.
+func call(m *InboundMiddleware, h *blockingHandler, procedure string, c transport.Criticality, timeout time.Duration) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req := &transport.Request{Service: "service", Procedure: procedure, Criticality: c}
+		errc <- m.Handle(ctx, req, nil, h)
+	}()
+	return errc
+}
+
+func waitQueued(t *testing.T, m *InboundMiddleware, n int) {
+	for i := 0; i < 1000; i++ {
+		m.mu.Lock()
+		queued := len(m.queue)
+		m.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued requests", n)
+}
+
+func shedCount(root *metrics.Root, criticality, reason string) int64 {
+	for _, c := range root.Snapshot().Counters {
+		if c.Name == "shed_requests" && c.Tags["criticality"] == criticality && c.Tags["reason"] == reason {
+			return c.Value
+		}
+	}
+	return 0
+}
+
+func TestAdmissionOrder(t *testing.T) {
+	m := NewInboundMiddleware(MaxConcurrency(1))
+	h := newBlockingHandler()
+
+	first := call(m, h, "first", "", time.Minute)
+	assert.Equal(t, "first", <-h.started)
+
+	results := []<-chan error{
+		first,
+		call(m, h, "sheddable", transport.CriticalitySheddable, time.Minute),
+	}
+	waitQueued(t, m, 1)
+	results = append(results, call(m, h, "critical", "", time.Minute))
+	waitQueued(t, m, 2)
+	results = append(results, call(m, h, "critical-plus", transport.CriticalityCriticalPlus, time.Minute))
+	waitQueued(t, m, 3)
+
+	for _, want := range []string{"critical-plus", "critical", "sheddable"} {
+		h.unblock <- struct{}{}
+		assert.Equal(t, want, <-h.started)
+	}
+	h.unblock <- struct{}{}
+
+	for _, errc := range results {
+		assert.NoError(t, <-errc)
+	}
+	assert.Equal(t, 0, m.running)
+}
+
+func TestShedWhenQueueFull(t *testing.T) {
+	root := metrics.New()
+	m := NewInboundMiddleware(MaxConcurrency(1), MaxQueueSize(2), Meter(root.Scope()))
+	h := newBlockingHandler()
+
+	first := call(m, h, "first", "", time.Minute)
+	assert.Equal(t, "first", <-h.started)
+
+	later := call(m, h, "later", "", time.Hour)
+	waitQueued(t, m, 1)
+	sooner := call(m, h, "sooner", "", time.Minute)
+	waitQueued(t, m, 2)
+
+	// A new request that is less critical than all queued requests is shed.
+	err := <-call(m, h, "batch", transport.CriticalitySheddable, time.Minute)
+	require.Error(t, err)
+	assert.True(t, yarpcerrors.IsResourceExhausted(err), "unexpected error: %v", err)
+	assert.Equal(t,
+		`request to procedure "batch" of service "service" with criticality "sheddable" was shed because the server is overloaded`,
+		yarpcerrors.FromError(err).Message())
+
+	// A more critical request sheds the queued request that expires first.
+	urgent := call(m, h, "urgent", transport.CriticalityCriticalPlus, time.Minute)
+	err = <-sooner
+	assert.True(t, yarpcerrors.IsResourceExhausted(err), "unexpected error: %v", err)
+
+	for _, want := range []string{"urgent", "later"} {
+		h.unblock <- struct{}{}
+		assert.Equal(t, want, <-h.started)
+	}
+	h.unblock <- struct{}{}
+	for _, errc := range []<-chan error{first, later, urgent} {
+		assert.NoError(t, <-errc)
+	}
+
+	assert.Equal(t, int64(1), shedCount(root, "sheddable", "queue_full"))
+	assert.Equal(t, int64(1), shedCount(root, "critical", "queue_full"))
+	assert.Equal(t, int64(0), shedCount(root, "critical_plus", "queue_full"))
+}
+
+func TestExpiredWhileQueued(t *testing.T) {
+	root := metrics.New()
+	m := NewInboundMiddleware(MaxConcurrency(1), Meter(root.Scope()))
+	h := newBlockingHandler()
+
+	first := call(m, h, "first", "", time.Minute)
+	assert.Equal(t, "first", <-h.started)
+
+	err := <-call(m, h, "expires", transport.CriticalitySheddablePlus, 10*time.Millisecond)
+	require.Error(t, err)
+	assert.True(t, yarpcerrors.IsDeadlineExceeded(err), "unexpected error: %v", err)
+	waitQueued(t, m, 0)
+
+	h.unblock <- struct{}{}
+	assert.NoError(t, <-first)
+	assert.Equal(t, 0, m.running)
+	assert.Equal(t, int64(1), shedCount(root, "sheddable_plus", "expired"))
+}
+
+func TestOneway(t *testing.T) {
+	m := NewInboundMiddleware(MaxConcurrency(1), MaxQueueSize(0))
+	h := newBlockingHandler()
+
+	first := make(chan error, 1)
+	go func() {
+		first <- m.HandleOneway(context.Background(), &transport.Request{Service: "service", Procedure: "first"}, h)
+	}()
+	assert.Equal(t, "first", <-h.started)
+
+	err := m.HandleOneway(context.Background(), &transport.Request{Service: "service", Procedure: "second"}, h)
+	assert.True(t, yarpcerrors.IsResourceExhausted(err), "unexpected error: %v", err)
+
+	h.unblock <- struct{}{}
+	assert.NoError(t, <-first)
+}
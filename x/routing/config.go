@@ -0,0 +1,131 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"fmt"
+
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+// outboundConfig configures an Outbound whose targets are other outbounds
+// of a configuration.
+type outboundConfig struct {
+	Default string `config:"default"`
+	Routes  []struct {
+		Outbound         string            `config:"outbound"`
+		Headers          map[string]string `config:"headers"`
+		RoutingKeys      []string          `config:"routingKeys"`
+		RoutingDelegates []string          `config:"routingDelegates"`
+		ShardKeys        *struct {
+			Start string `config:"start"`
+			End   string `config:"end"`
+		} `config:"shardKeys"`
+		Percent *float64 `config:"percent"`
+	} `config:"routes"`
+}
+
+// OutboundSpec returns a specification that teaches a
+// yarpcconfig.Configurator to build Outbounds configured with the 'routing'
+// attribute. Routes match requests by 'headers', 'routingKeys',
+// 'routingDelegates', 'shardKeys' and 'percent', and send them to one of the
+// other outbounds of the configuration.
+//
+// 	cfg := yarpcconfig.New()
+// 	cfg.MustRegisterCompositeOutbound(routing.OutboundSpec())
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    routing:
+// 	      default: keyvalue-stable
+// 	      routes:
+// 	        - outbound: keyvalue-canary
+// 	          headers: {x-canary: "true"}
+// 	        - outbound: keyvalue-canary
+// 	          percent: 1
+// 	  keyvalue-stable:
+// 	    http: {url: "http://keyvalue/yarpc"}
+// 	  keyvalue-canary:
+// 	    http: {url: "http://keyvalue-canary/yarpc"}
+//
+// The routed outbound supports the RPC types that any of its targets
+// supports.
+func OutboundSpec() yarpcconfig.CompositeOutboundSpec {
+	return yarpcconfig.CompositeOutboundSpec{
+		Name:           "routing",
+		BuildOutbounds: buildOutbounds,
+	}
+}
+
+func buildOutbounds(c outboundConfig, kit *yarpcconfig.Kit) (transport.Outbounds, error) {
+	cfg := Config{
+		Targets: make(map[string]transport.Outbounds),
+		Default: c.Default,
+	}
+	addTarget := func(name string) error {
+		target, ok := kit.Outbounds(name)
+		if !ok {
+			return fmt.Errorf("unknown outbound %q", name)
+		}
+		cfg.Targets[name] = target
+		return nil
+	}
+
+	if err := addTarget(c.Default); err != nil {
+		return transport.Outbounds{}, err
+	}
+	for _, route := range c.Routes {
+		if err := addTarget(route.Outbound); err != nil {
+			return transport.Outbounds{}, err
+		}
+		r := Route{
+			Target:           route.Outbound,
+			Headers:          route.Headers,
+			RoutingKeys:      route.RoutingKeys,
+			RoutingDelegates: route.RoutingDelegates,
+			Percent:          route.Percent,
+		}
+		if route.ShardKeys != nil {
+			r.ShardKeys = &ShardKeyRange{Start: route.ShardKeys.Start, End: route.ShardKeys.End}
+		}
+		cfg.Routes = append(cfg.Routes, r)
+	}
+
+	out, err := NewOutbound(cfg)
+	if err != nil {
+		return transport.Outbounds{}, err
+	}
+
+	var outs transport.Outbounds
+	for _, target := range cfg.Targets {
+		if target.Unary != nil {
+			outs.Unary = out
+		}
+		if target.Oneway != nil {
+			outs.Oneway = out
+		}
+		if target.Stream != nil {
+			outs.Stream = out
+		}
+	}
+	return outs, nil
+}
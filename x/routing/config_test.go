@@ -0,0 +1,182 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/internal/whitespace"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+func TestOutboundSpec(t *testing.T) {
+	type fakeOutboundConfig struct {
+		Name string `config:"name"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbounds := make(map[string]*transporttest.MockUnaryOutbound)
+	newConfigurator := func() *yarpcconfig.Configurator {
+		c := yarpcconfig.New()
+		c.MustRegisterCompositeOutbound(OutboundSpec())
+		require.NoError(t, c.RegisterTransport(yarpcconfig.TransportSpec{
+			Name: "fake",
+			BuildTransport: func(struct{}, *yarpcconfig.Kit) (transport.Transport, error) {
+				return transporttest.NewMockTransport(ctrl), nil
+			},
+			BuildUnaryOutbound: func(cfg fakeOutboundConfig, _ transport.Transport, _ *yarpcconfig.Kit) (transport.UnaryOutbound, error) {
+				o := transporttest.NewMockUnaryOutbound(ctrl)
+				outbounds[cfg.Name] = o
+				return o, nil
+			},
+		}))
+		return c
+	}
+
+	t.Run("routed", func(t *testing.T) {
+		cfg, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					routing:
+						default: myservice-stable
+						routes:
+							- outbound: myservice-canary
+							  headers: {x-canary: "true"}
+							- outbound: myservice-canary
+							  shardKeys: {start: a, end: b}
+				myservice-stable:
+					fake: {name: stable}
+				myservice-canary:
+					fake: {name: canary}
+		`)))
+		require.NoError(t, err)
+
+		outs := cfg.Outbounds["myservice"]
+		assert.Equal(t, "myservice", outs.ServiceName)
+		assert.Nil(t, outs.Oneway)
+		assert.Nil(t, outs.Stream)
+		require.NotNil(t, outs.Unary)
+
+		ctx := context.Background()
+		for _, tt := range []struct {
+			req    *transport.Request
+			target string
+		}{
+			{req: &transport.Request{Headers: transport.NewHeaders().With("x-canary", "true")}, target: "canary"},
+			{req: &transport.Request{ShardKey: "abc"}, target: "canary"},
+			{req: &transport.Request{ShardKey: "bcd"}, target: "stable"},
+		} {
+			outbounds[tt.target].EXPECT().Call(ctx, tt.req).Return(&transport.Response{}, nil)
+			_, err := outs.Unary.Call(ctx, tt.req)
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("zero percent", func(t *testing.T) {
+		cfg, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					routing:
+						default: myservice-stable
+						routes:
+							- outbound: myservice-canary
+							  percent: 0
+				myservice-stable:
+					fake: {name: stable}
+				myservice-canary:
+					fake: {name: canary}
+		`)))
+		require.NoError(t, err)
+
+		outs := cfg.Outbounds["myservice"]
+		ctx := context.Background()
+		for i := 0; i < 100; i++ {
+			req := &transport.Request{ShardKey: fmt.Sprint(i)}
+			if i%2 == 0 {
+				req = &transport.Request{}
+			}
+			outbounds["stable"].EXPECT().Call(ctx, req).Return(&transport.Response{}, nil)
+			_, err := outs.Unary.Call(ctx, req)
+			assert.NoError(t, err)
+		}
+	})
+
+	tests := []struct {
+		desc    string
+		give    string
+		wantErr string
+	}{
+		{
+			desc: "unknown outbound",
+			give: `
+				outbounds:
+					myservice:
+						routing:
+							default: myservice-stable
+			`,
+			wantErr: `failed to configure routing of outbound "myservice": unknown outbound "myservice-stable"`,
+		},
+		{
+			desc: "routed outbound with transport",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: stable}
+						routing:
+							default: myservice-stable
+			`,
+			wantErr: `too many attributes in routing outbound configuration for "myservice"`,
+		},
+		{
+			desc: "invalid route",
+			give: `
+				outbounds:
+					myservice:
+						routing:
+							default: myservice-stable
+							routes:
+								- outbound: myservice-stable
+								  percent: 200
+					myservice-stable:
+						fake: {name: stable}
+			`,
+			wantErr: `failed to configure routing of outbound "myservice": invalid route 0: percent must be between 0 and 100, got 200`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(tt.give)))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package routing provides an outbound that sends each request to one of
+// several outbounds, according to the headers, routing key, routing
+// delegate or shard key of the request, or to a percentage of requests.
+//
+// For example, the following sends requests with the header "x-canary:
+// true", and 1% of all other requests, to a canary cluster.
+//
+// 	out, err := routing.NewOutbound(routing.Config{
+// 		Targets: map[string]transport.Outbounds{
+// 			"stable": {Unary: stable},
+// 			"canary": {Unary: canary},
+// 		},
+// 		Routes: []routing.Route{
+// 			{Target: "canary", Headers: map[string]string{"x-canary": "true"}},
+// 			{Target: "canary", Percent: routing.Percent(1)},
+// 		},
+// 		Default: "stable",
+// 	})
+//
+// The outbound starts and stops its targets.
+package routing
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"go.uber.org/multierr"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/pkg/lifecycle"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+var (
+	_ transport.UnaryOutbound              = (*Outbound)(nil)
+	_ transport.OnewayOutbound             = (*Outbound)(nil)
+	_ transport.StreamOutbound             = (*Outbound)(nil)
+	_ introspection.IntrospectableOutbound = (*Outbound)(nil)
+)
+
+// Config configures an Outbound.
+type Config struct {
+	// Targets are the outbounds that requests may be sent to, by name.
+	Targets map[string]transport.Outbounds
+
+	// Routes are evaluated in order for each request. The request is sent to
+	// the target of the first matching route.
+	Routes []Route
+
+	// Default is the name of the target of requests that match no route.
+	Default string
+}
+
+// Outbound sends requests to one of several outbounds according to a list
+// of routes.
+type Outbound struct {
+	targets    map[string]transport.Outbounds
+	routes     []Route
+	defaultKey string
+	outbounds  []transport.Outbound
+	once       *lifecycle.Once
+
+	// for tests
+	random func() float64
+}
+
+// NewOutbound builds an Outbound from the given configuration.
+func NewOutbound(cfg Config) (*Outbound, error) {
+	if _, ok := cfg.Targets[cfg.Default]; !ok {
+		return nil, fmt.Errorf("unknown default target %q", cfg.Default)
+	}
+	for i, r := range cfg.Routes {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid route %d: %v", i, err)
+		}
+		if _, ok := cfg.Targets[r.Target]; !ok {
+			return nil, fmt.Errorf("invalid route %d: unknown target %q", i, r.Target)
+		}
+	}
+
+	o := &Outbound{
+		targets:    cfg.Targets,
+		routes:     append([]Route(nil), cfg.Routes...),
+		defaultKey: cfg.Default,
+		once:       lifecycle.NewOnce(),
+		random:     rand.Float64,
+	}
+	for _, t := range cfg.Targets {
+		for _, out := range []transport.Outbound{t.Unary, t.Oneway, t.Stream} {
+			if out != nil && !o.hasOutbound(out) {
+				o.outbounds = append(o.outbounds, out)
+			}
+		}
+	}
+	return o, nil
+}
+
+func (o *Outbound) hasOutbound(out transport.Outbound) bool {
+	for _, existing := range o.outbounds {
+		if existing == out {
+			return true
+		}
+	}
+	return false
+}
+
+// target returns the name and outbounds of the target for the request.
+func (o *Outbound) target(req *transport.RequestMeta) (string, transport.Outbounds) {
+	for i := range o.routes {
+		if r := &o.routes[i]; r.matches(req, i, o.random) {
+			return r.Target, o.targets[r.Target]
+		}
+	}
+	return o.defaultKey, o.targets[o.defaultKey]
+}
+
+func unsupportedError(target, rpcType string, req *transport.RequestMeta) error {
+	return yarpcerrors.UnimplementedErrorf(
+		"target %q for procedure %q of service %q does not support %s calls", target, req.Procedure, req.Service, rpcType)
+}
+
+// Call sends a unary request to the outbound of the target for the request.
+func (o *Outbound) Call(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+	name, t := o.target(req.ToRequestMeta())
+	if t.Unary == nil {
+		return nil, unsupportedError(name, "unary", req.ToRequestMeta())
+	}
+	return t.Unary.Call(ctx, req)
+}
+
+// CallOneway sends a oneway request to the outbound of the target for the
+// request.
+func (o *Outbound) CallOneway(ctx context.Context, req *transport.Request) (transport.Ack, error) {
+	name, t := o.target(req.ToRequestMeta())
+	if t.Oneway == nil {
+		return nil, unsupportedError(name, "oneway", req.ToRequestMeta())
+	}
+	return t.Oneway.CallOneway(ctx, req)
+}
+
+// CallStream opens a stream with the outbound of the target for the request.
+func (o *Outbound) CallStream(ctx context.Context, req *transport.StreamRequest) (*transport.ClientStream, error) {
+	name, t := o.target(req.Meta)
+	if t.Stream == nil {
+		return nil, unsupportedError(name, "stream", req.Meta)
+	}
+	return t.Stream.CallStream(ctx, req)
+}
+
+// Transports returns the transports of all targets.
+func (o *Outbound) Transports() []transport.Transport {
+	var transports []transport.Transport
+	for _, out := range o.outbounds {
+		transports = append(transports, out.Transports()...)
+	}
+	return transports
+}
+
+// Start starts the outbounds of all targets.
+func (o *Outbound) Start() error {
+	return o.once.Start(func() error {
+		var err error
+		for _, out := range o.outbounds {
+			err = multierr.Append(err, out.Start())
+		}
+		return err
+	})
+}
+
+// Stop stops the outbounds of all targets.
+func (o *Outbound) Stop() error {
+	return o.once.Stop(func() error {
+		var err error
+		for _, out := range o.outbounds {
+			err = multierr.Append(err, out.Stop())
+		}
+		return err
+	})
+}
+
+// IsRunning returns whether the outbound is running.
+func (o *Outbound) IsRunning() bool {
+	return o.once.IsRunning()
+}
+
+// Introspect returns the routing table of the outbound.
+func (o *Outbound) Introspect() introspection.OutboundStatus {
+	state := "Stopped"
+	if o.IsRunning() {
+		state = "Running"
+	}
+
+	routes := make([]introspection.RouteStatus, 0, len(o.routes)+1)
+	for _, r := range o.routes {
+		routes = append(routes, introspection.RouteStatus{
+			Match:    r.String(),
+			Target:   r.Target,
+			Outbound: introspectTarget(o.targets[r.Target]),
+		})
+	}
+	routes = append(routes, introspection.RouteStatus{
+		Match:    "default",
+		Target:   o.defaultKey,
+		Outbound: introspectTarget(o.targets[o.defaultKey]),
+	})
+
+	return introspection.OutboundStatus{
+		Transport: "routing",
+		State:     state,
+		Routes:    routes,
+	}
+}
+
+func introspectTarget(t transport.Outbounds) introspection.OutboundStatus {
+	for _, out := range []transport.Outbound{t.Unary, t.Oneway, t.Stream} {
+		if i, ok := out.(introspection.IntrospectableOutbound); ok {
+			return i.Introspect()
+		}
+	}
+	return introspection.OutboundStatusNotSupported
+}
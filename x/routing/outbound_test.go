@@ -0,0 +1,186 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/api/x/introspection"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func TestNewOutboundErrors(t *testing.T) {
+	targets := map[string]transport.Outbounds{"stable": {}}
+
+	tests := []struct {
+		desc    string
+		give    Config
+		wantErr string
+	}{
+		{
+			desc:    "unknown default",
+			give:    Config{Targets: targets, Default: "canary"},
+			wantErr: `unknown default target "canary"`,
+		},
+		{
+			desc:    "unknown target",
+			give:    Config{Targets: targets, Default: "stable", Routes: []Route{{Target: "canary"}}},
+			wantErr: `invalid route 0: unknown target "canary"`,
+		},
+		{
+			desc:    "missing target",
+			give:    Config{Targets: targets, Default: "stable", Routes: []Route{{}}},
+			wantErr: `invalid route 0: target is required`,
+		},
+		{
+			desc:    "invalid percent",
+			give:    Config{Targets: targets, Default: "stable", Routes: []Route{{Target: "stable", Percent: Percent(200)}}},
+			wantErr: `invalid route 0: percent must be between 0 and 100, got 200`,
+		},
+		{
+			desc: "empty shard key range",
+			give: Config{Targets: targets, Default: "stable", Routes: []Route{
+				{Target: "stable", ShardKeys: &ShardKeyRange{Start: "m", End: "a"}},
+			}},
+			wantErr: `invalid route 0: shard key range ["m", "a") is empty`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := NewOutbound(tt.give)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestOutbound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	stable := transporttest.NewMockUnaryOutbound(ctrl)
+	canary := transporttest.NewMockUnaryOutbound(ctrl)
+	oneway := transporttest.NewMockOnewayOutbound(ctrl)
+
+	out, err := NewOutbound(Config{
+		Targets: map[string]transport.Outbounds{
+			"stable": {Unary: stable, Oneway: oneway},
+			"canary": {Unary: canary},
+		},
+		Routes: []Route{
+			{Target: "canary", Headers: map[string]string{"x-canary": "true"}},
+		},
+		Default: "stable",
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	canaryReq := &transport.Request{Service: "service", Procedure: "get", Headers: transport.NewHeaders().With("x-canary", "true")}
+	stableReq := &transport.Request{Service: "service", Procedure: "get"}
+
+	t.Run("lifecycle", func(t *testing.T) {
+		stable.EXPECT().Start().Return(nil)
+		canary.EXPECT().Start().Return(nil)
+		oneway.EXPECT().Start().Return(nil)
+		require.NoError(t, out.Start())
+		assert.True(t, out.IsRunning())
+
+		stable.EXPECT().Stop().Return(nil)
+		canary.EXPECT().Stop().Return(errors.New("great sadness"))
+		oneway.EXPECT().Stop().Return(nil)
+		assert.EqualError(t, out.Stop(), "great sadness")
+	})
+
+	t.Run("unary", func(t *testing.T) {
+		canary.EXPECT().Call(ctx, canaryReq).Return(&transport.Response{}, nil)
+		_, err := out.Call(ctx, canaryReq)
+		assert.NoError(t, err)
+
+		stable.EXPECT().Call(ctx, stableReq).Return(&transport.Response{}, nil)
+		_, err = out.Call(ctx, stableReq)
+		assert.NoError(t, err)
+	})
+
+	t.Run("oneway", func(t *testing.T) {
+		oneway.EXPECT().CallOneway(ctx, stableReq).Return(nil, nil)
+		_, err := out.CallOneway(ctx, stableReq)
+		assert.NoError(t, err)
+
+		_, err = out.CallOneway(ctx, canaryReq)
+		assert.Equal(t, yarpcerrors.CodeUnimplemented, yarpcerrors.FromError(err).Code())
+		assert.Equal(t, `target "canary" for procedure "get" of service "service" does not support oneway calls`,
+			yarpcerrors.FromError(err).Message())
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		_, err := out.CallStream(ctx, &transport.StreamRequest{Meta: stableReq.ToRequestMeta()})
+		assert.Equal(t, yarpcerrors.CodeUnimplemented, yarpcerrors.FromError(err).Code())
+	})
+}
+
+type introspectableOutbound struct {
+	transport.UnaryOutbound
+
+	endpoint string
+}
+
+func (o introspectableOutbound) Introspect() introspection.OutboundStatus {
+	return introspection.OutboundStatus{Transport: "fake", Endpoint: o.endpoint}
+}
+
+func TestIntrospect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	out, err := NewOutbound(Config{
+		Targets: map[string]transport.Outbounds{
+			"stable": {Unary: introspectableOutbound{transporttest.NewMockUnaryOutbound(ctrl), "stable:80"}},
+			"canary": {Unary: introspectableOutbound{transporttest.NewMockUnaryOutbound(ctrl), "canary:80"}},
+		},
+		Routes:  []Route{{Target: "canary", Percent: Percent(5)}},
+		Default: "stable",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, introspection.OutboundStatus{
+		Transport: "routing",
+		State:     "Stopped",
+		Routes: []introspection.RouteStatus{
+			{
+				Match:    "5% of requests",
+				Target:   "canary",
+				Outbound: introspection.OutboundStatus{Transport: "fake", Endpoint: "canary:80"},
+			},
+			{
+				Match:    "default",
+				Target:   "stable",
+				Outbound: introspection.OutboundStatus{Transport: "fake", Endpoint: "stable:80"},
+			},
+		},
+	}, out.Introspect())
+}
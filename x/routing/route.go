@@ -0,0 +1,177 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/yarpc/api/transport"
+)
+
+// Route sends matching requests to a target outbound.
+//
+// A route matches requests that satisfy all of its conditions. Conditions
+// that are not set are satisfied by every request.
+type Route struct {
+	// Target is the name of the outbound that matching requests are sent to.
+	Target string
+
+	// Headers matches requests that carry all of the given headers with the
+	// given values.
+	Headers map[string]string
+
+	// RoutingKeys matches requests with one of the given routing keys.
+	RoutingKeys []string
+
+	// RoutingDelegates matches requests with one of the given routing
+	// delegates.
+	RoutingDelegates []string
+
+	// ShardKeys matches requests whose shard key is in the given range.
+	ShardKeys *ShardKeyRange
+
+	// Percent matches the given percentage, between 0 and 100, of requests
+	// that satisfy the other conditions. Requests with the same shard key
+	// are consistently matched or not. If zero, no requests match. If nil,
+	// all requests that satisfy the other conditions match.
+	Percent *float64
+}
+
+// Percent returns a pointer to the given percentage, for use as
+// Route.Percent.
+func Percent(p float64) *float64 {
+	return &p
+}
+
+// ShardKeyRange is a range of shard keys, compared lexicographically.
+type ShardKeyRange struct {
+	// Start is the first shard key in the range. If empty, the range starts
+	// with the lowest shard key.
+	Start string
+
+	// End is the first shard key after the range. If empty, the range
+	// includes all shard keys after Start.
+	End string
+}
+
+// Contains reports whether the shard key is in the range. The empty shard
+// key is not in any range.
+func (r ShardKeyRange) Contains(shardKey string) bool {
+	if shardKey == "" {
+		return false
+	}
+	return shardKey >= r.Start && (r.End == "" || shardKey < r.End)
+}
+
+// String returns a description of the route.
+func (r Route) String() string {
+	var conds []string
+	if len(r.Headers) > 0 {
+		keys := make([]string, 0, len(r.Headers))
+		for k := range r.Headers {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			conds = append(conds, fmt.Sprintf("header %s=%q", k, r.Headers[k]))
+		}
+	}
+	if len(r.RoutingKeys) > 0 {
+		conds = append(conds, fmt.Sprintf("routing key in %q", r.RoutingKeys))
+	}
+	if len(r.RoutingDelegates) > 0 {
+		conds = append(conds, fmt.Sprintf("routing delegate in %q", r.RoutingDelegates))
+	}
+	if r.ShardKeys != nil {
+		conds = append(conds, fmt.Sprintf("shard key in [%q, %q)", r.ShardKeys.Start, r.ShardKeys.End))
+	}
+	if r.Percent != nil {
+		conds = append(conds, fmt.Sprintf("%v%% of requests", *r.Percent))
+	}
+	if len(conds) == 0 {
+		return "all requests"
+	}
+	return strings.Join(conds, " and ")
+}
+
+func (r Route) validate() error {
+	if r.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	if r.Percent != nil && (*r.Percent < 0 || *r.Percent > 100) {
+		return fmt.Errorf("percent must be between 0 and 100, got %v", *r.Percent)
+	}
+	if r.ShardKeys != nil && r.ShardKeys.End != "" && r.ShardKeys.End <= r.ShardKeys.Start {
+		return fmt.Errorf("shard key range [%q, %q) is empty", r.ShardKeys.Start, r.ShardKeys.End)
+	}
+	return nil
+}
+
+// matches reports whether the request matches the route. The index of the
+// route salts the sampling of shard keys, so that consecutive percentage
+// routes each receive their share of sharded requests.
+func (r *Route) matches(req *transport.RequestMeta, index int, random func() float64) bool {
+	for k, v := range r.Headers {
+		if got, ok := req.Headers.Get(k); !ok || got != v {
+			return false
+		}
+	}
+	if len(r.RoutingKeys) > 0 && !contains(r.RoutingKeys, req.RoutingKey) {
+		return false
+	}
+	if len(r.RoutingDelegates) > 0 && !contains(r.RoutingDelegates, req.RoutingDelegate) {
+		return false
+	}
+	if r.ShardKeys != nil && !r.ShardKeys.Contains(req.ShardKey) {
+		return false
+	}
+	if r.Percent != nil {
+		return sample(req.ShardKey, index, random) < *r.Percent
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sample returns a number in [0, 100), derived from the shard key and salt
+// if there is a shard key so that requests for the same shard are routed
+// consistently.
+func sample(shardKey string, salt int, random func() float64) float64 {
+	if shardKey == "" {
+		return random() * 100
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strconv.Itoa(salt)))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(shardKey))
+	return float64(h.Sum32()%10000) / 100
+}
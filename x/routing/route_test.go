@@ -0,0 +1,123 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package routing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/yarpc/api/transport"
+)
+
+func TestRouteMatches(t *testing.T) {
+	req := &transport.RequestMeta{
+		Service:         "service",
+		Procedure:       "get",
+		Headers:         transport.NewHeaders().With("x-canary", "true"),
+		RoutingKey:      "rk",
+		RoutingDelegate: "rd",
+		ShardKey:        "m42",
+	}
+
+	tests := []struct {
+		desc   string
+		route  Route
+		random float64
+		want   bool
+	}{
+		{desc: "all", route: Route{}, want: true},
+		{desc: "header", route: Route{Headers: map[string]string{"X-Canary": "true"}}, want: true},
+		{desc: "other header value", route: Route{Headers: map[string]string{"x-canary": "false"}}},
+		{desc: "missing header", route: Route{Headers: map[string]string{"x-region": "eu"}}},
+		{desc: "routing key", route: Route{RoutingKeys: []string{"other", "rk"}}, want: true},
+		{desc: "other routing key", route: Route{RoutingKeys: []string{"other"}}},
+		{desc: "routing delegate", route: Route{RoutingDelegates: []string{"rd"}}, want: true},
+		{desc: "other routing delegate", route: Route{RoutingDelegates: []string{"other"}}},
+		{desc: "shard key range", route: Route{ShardKeys: &ShardKeyRange{Start: "m", End: "n"}}, want: true},
+		{desc: "unbounded shard key range", route: Route{ShardKeys: &ShardKeyRange{Start: "m"}}, want: true},
+		{desc: "shard key before range", route: Route{ShardKeys: &ShardKeyRange{Start: "n"}}},
+		{desc: "shard key after range", route: Route{ShardKeys: &ShardKeyRange{End: "m4"}}},
+		{desc: "all percent", route: Route{Percent: Percent(100)}, want: true},
+		{desc: "zero percent", route: Route{Percent: Percent(0)}},
+		{
+			desc:  "all conditions",
+			route: Route{Headers: map[string]string{"x-canary": "true"}, RoutingKeys: []string{"other"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.route.matches(req, 0, func() float64 { return tt.random }))
+		})
+	}
+}
+
+func TestRoutePercent(t *testing.T) {
+	route := Route{Percent: Percent(10)}
+
+	t.Run("random", func(t *testing.T) {
+		req := &transport.RequestMeta{}
+		assert.True(t, route.matches(req, 0, func() float64 { return 0.05 }))
+		assert.False(t, route.matches(req, 0, func() float64 { return 0.15 }))
+	})
+
+	t.Run("shard key", func(t *testing.T) {
+		var matched int
+		for i := 0; i < 1000; i++ {
+			req := &transport.RequestMeta{ShardKey: string(rune('a'+i%26)) + string(rune('a'+i/26))}
+			first := route.matches(req, 0, func() float64 { panic("shard keys must not be sampled randomly") })
+			assert.Equal(t, first, route.matches(req, 0, nil), "shard keys must be routed consistently")
+			if first {
+				matched++
+			}
+		}
+		assert.InDelta(t, 100, matched, 50)
+	})
+
+	t.Run("consecutive routes", func(t *testing.T) {
+		var first, second int
+		for i := 0; i < 1000; i++ {
+			req := &transport.RequestMeta{ShardKey: string(rune('a'+i%26)) + string(rune('a'+i/26))}
+			switch {
+			case route.matches(req, 0, nil):
+				first++
+			case route.matches(req, 1, nil):
+				second++
+			}
+		}
+		assert.InDelta(t, 100, first, 50)
+		assert.InDelta(t, 90, second, 50, "second route must receive sharded requests")
+	})
+}
+
+func TestRouteString(t *testing.T) {
+	assert.Equal(t, "all requests", Route{Target: "a"}.String())
+	assert.Equal(t,
+		`header x-canary="true" and header x-region="eu" and routing key in ["rk"] and `+
+			`routing delegate in ["rd"] and shard key in ["a", "m") and 5% of requests`,
+		Route{
+			Headers:          map[string]string{"x-region": "eu", "x-canary": "true"},
+			RoutingKeys:      []string{"rk"},
+			RoutingDelegates: []string{"rd"},
+			ShardKeys:        &ShardKeyRange{Start: "a", End: "m"},
+			Percent:          Percent(5),
+		}.String())
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package shadow
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+// Config configures the shadowing of an outbound.
+type Config struct {
+	// Name of the shadow outbound. It must support unary calls.
+	Outbound string `config:"outbound"`
+
+	// Percentage of requests to shadow. Defaults to 1.
+	Percent *float64 `config:"percent"`
+
+	// Procedures to shadow. Defaults to all of them.
+	Procedures []string `config:"procedures"`
+
+	// Timeout of shadow requests. Defaults to one second.
+	Timeout time.Duration `config:"timeout"`
+
+	// Maximum number of shadow requests in flight. Defaults to 100.
+	MaxConcurrent int `config:"maxConcurrent"`
+
+	// Whether to compare the responses of the shadow outbound with those of
+	// the primary outbound.
+	Compare bool `config:"compare"`
+}
+
+// OutboundMiddlewareSpec returns a specification that teaches a
+// yarpcconfig.Configurator to shadow outbounds configured with the 'shadow'
+// attribute.
+//
+// 	cfg := yarpcconfig.New(yarpcconfig.Meter(meter))
+// 	cfg.MustRegisterOutboundMiddleware(shadow.OutboundMiddlewareSpec())
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    http: {url: "http://keyvalue/yarpc"}
+// 	    shadow:
+// 	      outbound: keyvalue-v2
+// 	      percent: 5
+// 	      procedures: [get]
+// 	      timeout: 500ms
+// 	      maxConcurrent: 50
+// 	      compare: true
+// 	  keyvalue-v2:
+// 	    grpc: {address: "keyvalue-v2:8080"}
+//
+// Metrics are recorded in the scope of the Configurator, tagged with the name
+// of the shadowed outbound. Register the specification with a single
+// Configurator.
+func OutboundMiddlewareSpec() yarpcconfig.OutboundMiddlewareSpec {
+	// The Configurator gives the same scope to an outbound each time a
+	// configuration is loaded, so its vectors are registered only once.
+	var (
+		mu      sync.Mutex
+		byMeter = make(map[*metrics.Scope]*vectors)
+	)
+	vectorsFor := func(kit *yarpcconfig.Kit) *vectors {
+		meter := kit.Meter()
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		v, ok := byMeter[meter]
+		if !ok {
+			v = newVectors(meter, kit.Logger())
+			byMeter[meter] = v
+		}
+		return v
+	}
+
+	return yarpcconfig.OutboundMiddlewareSpec{
+		Name: "shadow",
+		ApplyOutboundMiddleware: func(cfg Config, outs transport.Outbounds, kit *yarpcconfig.Kit) (transport.Outbounds, error) {
+			return applyConfig(cfg, outs, kit, vectorsFor(kit))
+		},
+	}
+}
+
+func applyConfig(cfg Config, outs transport.Outbounds, kit *yarpcconfig.Kit, v *vectors) (transport.Outbounds, error) {
+	name := kit.OutboundName()
+	if outs.Unary == nil {
+		return outs, errors.New("outbound does not support unary calls")
+	}
+	if cfg.Outbound == name {
+		return outs, errors.New("outbound cannot shadow itself")
+	}
+	target, ok := kit.Outbounds(cfg.Outbound)
+	if !ok || target.Unary == nil {
+		return outs, fmt.Errorf("unknown unary outbound %q", cfg.Outbound)
+	}
+
+	opts := []Option{
+		Procedures(cfg.Procedures...),
+		Logger(kit.Logger()),
+		withVectors(v),
+	}
+	if cfg.Percent != nil {
+		if *cfg.Percent < 0 || *cfg.Percent > 100 {
+			return outs, fmt.Errorf("percent must be between 0 and 100, got %v", *cfg.Percent)
+		}
+		opts = append(opts, Percent(*cfg.Percent))
+	}
+	if cfg.Timeout > 0 {
+		opts = append(opts, Timeout(cfg.Timeout))
+	}
+	if cfg.MaxConcurrent > 0 {
+		opts = append(opts, MaxConcurrent(cfg.MaxConcurrent))
+	}
+	if cfg.Compare {
+		opts = append(opts, CompareResponses())
+	}
+
+	outs.Unary = middleware.ApplyUnaryOutbound(outs.Unary, NewOutboundMiddleware(target.Unary, opts...))
+	return outs, nil
+}
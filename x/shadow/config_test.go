@@ -0,0 +1,193 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package shadow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/internal/whitespace"
+	"go.uber.org/yarpc/yarpcconfig"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestOutboundMiddlewareSpec(t *testing.T) {
+	type outboundConfig struct {
+		Name string `config:"name"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbounds := make(map[string]*transporttest.MockUnaryOutbound)
+	newConfigurator := func(opts ...yarpcconfig.Option) *yarpcconfig.Configurator {
+		c := yarpcconfig.New(opts...)
+		c.MustRegisterOutboundMiddleware(OutboundMiddlewareSpec())
+		require.NoError(t, c.RegisterTransport(yarpcconfig.TransportSpec{
+			Name: "fake",
+			BuildTransport: func(struct{}, *yarpcconfig.Kit) (transport.Transport, error) {
+				return transporttest.NewMockTransport(ctrl), nil
+			},
+			BuildUnaryOutbound: func(cfg outboundConfig, _ transport.Transport, _ *yarpcconfig.Kit) (transport.UnaryOutbound, error) {
+				o := transporttest.NewMockUnaryOutbound(ctrl)
+				outbounds[cfg.Name] = o
+				return o, nil
+			},
+		}))
+		return c
+	}
+
+	t.Run("shadowed", func(t *testing.T) {
+		root := metrics.New()
+		cfg, err := newConfigurator(yarpcconfig.Meter(root.Scope())).LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					shadow:
+						outbound: myservice-v2
+						percent: 100
+						procedures: [get]
+				myservice-v2:
+					fake: {name: shadow}
+		`)))
+		require.NoError(t, err)
+
+		shadowed := make(chan struct{})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		outbounds["primary"].EXPECT().Call(gomock.Any(), gomock.Any()).Return(&transport.Response{}, nil)
+		outbounds["shadow"].EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, *transport.Request) (*transport.Response, error) {
+				close(shadowed)
+				return &transport.Response{}, nil
+			})
+
+		_, err = cfg.Outbounds["myservice"].Unary.Call(ctx, &transport.Request{Procedure: "get"})
+		require.NoError(t, err)
+		select {
+		case <-shadowed:
+		case <-time.After(time.Second):
+			t.Fatal("request was not shadowed")
+		}
+		assert.Equal(t, outbounds["shadow"], cfg.Outbounds["myservice-v2"].Unary, "shadow outbound must not be wrapped")
+	})
+
+	t.Run("reloaded", func(t *testing.T) {
+		root := metrics.New()
+		core, logs := observer.New(zap.ErrorLevel)
+		c := newConfigurator(yarpcconfig.Meter(root.Scope()), yarpcconfig.Logger(zap.New(core)))
+		give := whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					shadow: {outbound: myservice-v2, percent: 100}
+				myservice-v2:
+					fake: {name: shadow}
+		`)
+		_, err := c.LoadConfigFromYAML("foo", strings.NewReader(give))
+		require.NoError(t, err)
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(give))
+		require.NoError(t, err)
+		// Metrics of the outbound are registered once.
+		assert.Empty(t, logs.AllUntimed(), "unexpected errors logged")
+
+		shadowed := make(chan struct{})
+		outbounds["primary"].EXPECT().Call(gomock.Any(), gomock.Any()).Return(&transport.Response{}, nil)
+		outbounds["shadow"].EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, *transport.Request) (*transport.Response, error) {
+				defer close(shadowed)
+				return &transport.Response{}, nil
+			})
+
+		_, err = cfg.Outbounds["myservice"].Unary.Call(context.Background(), &transport.Request{Procedure: "get"})
+		require.NoError(t, err)
+		select {
+		case <-shadowed:
+		case <-time.After(time.Second):
+			t.Fatal("request was not shadowed")
+		}
+
+		// The counter is incremented after the shadow request returns.
+		require.Eventually(t, func() bool {
+			return len(root.Snapshot().Counters) == 1
+		}, time.Second, time.Millisecond)
+		counter := root.Snapshot().Counters[0]
+		assert.Equal(t, "shadow_requests", counter.Name)
+		assert.Equal(t, "myservice", counter.Tags["outbound"])
+		assert.Equal(t, int64(1), counter.Value)
+	})
+
+	tests := []struct {
+		desc    string
+		give    string
+		wantErr string
+	}{
+		{
+			desc: "unknown outbound",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: primary}
+						shadow: {outbound: myservice-v2}
+			`,
+			wantErr: `failed to configure shadow of outbound "myservice": unknown unary outbound "myservice-v2"`,
+		},
+		{
+			desc: "self",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: primary}
+						shadow: {outbound: myservice}
+			`,
+			wantErr: `failed to configure shadow of outbound "myservice": outbound cannot shadow itself`,
+		},
+		{
+			desc: "invalid percent",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: primary}
+						shadow: {outbound: myservice-v2, percent: 120}
+					myservice-v2:
+						fake: {name: shadow}
+			`,
+			wantErr: `failed to configure shadow of outbound "myservice": percent must be between 0 and 100, got 120`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(tt.give)))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,361 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package shadow provides outbound middleware that mirrors a sample of live
+// unary requests to a second, shadow outbound.
+//
+// Shadow requests are sent asynchronously with their own deadline, so the
+// shadow outbound never affects the response, the latency or the errors seen
+// by the caller. They carry the values of the caller's context, such as its
+// tracing span, but are not cancelled with it. This may be used to validate
+// a rewrite of a service with real traffic.
+//
+// 	middleware.ApplyUnaryOutbound(primary, shadow.NewOutboundMiddleware(
+// 		rewrite,
+// 		shadow.Percent(10),
+// 		shadow.CompareResponses(),
+// 		shadow.Meter(meter),
+// 	))
+//
+// The shadow outbound is not started by the middleware. Register it with the
+// dispatcher under its own outbound key, or start it separately.
+//
+// Sampled requests are not shadowed while too many shadow requests are in
+// flight, so that a slow shadow outbound does not pile up goroutines.
+//
+// The comparison of responses requires reading the primary response body into
+// memory before returning it to the caller.
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"time"
+
+	"go.uber.org/atomic"
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/detach"
+	"go.uber.org/yarpc/internal/headerutil"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+const (
+	_defaultPercent       = 1
+	_defaultTimeout       = time.Second
+	_defaultMaxConcurrent = 100
+)
+
+var _ middleware.UnaryOutbound = (*OutboundMiddleware)(nil)
+
+// Option customizes an OutboundMiddleware.
+type Option func(*OutboundMiddleware)
+
+// Percent specifies the percentage of requests, between 0 and 100, that are
+// sent to the shadow outbound.
+//
+// Defaults to 1.
+func Percent(percent float64) Option {
+	return func(m *OutboundMiddleware) {
+		m.percent = percent
+	}
+}
+
+// Procedures limits shadowing to requests for the given procedures. All
+// procedures are shadowed by default.
+func Procedures(procedures ...string) Option {
+	return func(m *OutboundMiddleware) {
+		for _, p := range procedures {
+			m.procedures[p] = struct{}{}
+		}
+	}
+}
+
+// Timeout specifies the deadline of shadow requests.
+//
+// Defaults to one second.
+func Timeout(timeout time.Duration) Option {
+	return func(m *OutboundMiddleware) {
+		m.timeout = timeout
+	}
+}
+
+// MaxConcurrent specifies how many shadow requests may be in flight at once.
+// Sampled requests are not shadowed while the limit is reached.
+//
+// Defaults to 100.
+func MaxConcurrent(n int) Option {
+	return func(m *OutboundMiddleware) {
+		m.maxConcurrent = n
+	}
+}
+
+// CompareResponses compares the responses of the shadow outbound with those
+// of the primary outbound and records whether they match. Otherwise, shadow
+// responses are discarded.
+//
+// Responses match if both requests failed with the same error code, or both
+// succeeded with the same body and application error status.
+func CompareResponses() Option {
+	return func(m *OutboundMiddleware) {
+		m.compare = true
+	}
+}
+
+// Meter specifies the scope in which shadowing metrics are recorded.
+//
+// The "shadow_requests" counter counts shadow requests by procedure and
+// result ("success", "error", or "dropped" if too many were in flight). With
+// CompareResponses, the "shadow_comparisons" counter counts them by procedure
+// and result ("match" or "mismatch").
+//
+// The metrics are registered when the middleware is built, so a scope may
+// only be given to one middleware.
+func Meter(meter *metrics.Scope) Option {
+	return func(m *OutboundMiddleware) {
+		m.meter = meter
+	}
+}
+
+// Logger specifies the logger for the middleware.
+func Logger(logger *zap.Logger) Option {
+	return func(m *OutboundMiddleware) {
+		m.logger = logger
+	}
+}
+
+// OutboundMiddleware is a unary outbound middleware that mirrors requests to
+// a shadow outbound.
+type OutboundMiddleware struct {
+	shadow        transport.UnaryOutbound
+	percent       float64
+	procedures    map[string]struct{}
+	timeout       time.Duration
+	maxConcurrent int
+	compare       bool
+	meter         *metrics.Scope
+	logger        *zap.Logger
+
+	*vectors
+
+	inflight atomic.Int32
+
+	// for tests
+	random     func() float64
+	shadowDone func()
+}
+
+// NewOutboundMiddleware builds a middleware that mirrors requests to the
+// given shadow outbound.
+func NewOutboundMiddleware(shadow transport.UnaryOutbound, opts ...Option) *OutboundMiddleware {
+	m := &OutboundMiddleware{
+		shadow:        shadow,
+		percent:       _defaultPercent,
+		procedures:    make(map[string]struct{}),
+		timeout:       _defaultTimeout,
+		maxConcurrent: _defaultMaxConcurrent,
+		logger:        zap.NewNop(),
+		random:        rand.Float64,
+		shadowDone:    func() {},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.vectors == nil {
+		m.vectors = newVectors(m.meter, m.logger)
+	}
+	return m
+}
+
+// withVectors records metrics in already registered vectors, instead of
+// registering them with the scope given to Meter.
+func withVectors(v *vectors) Option {
+	return func(m *OutboundMiddleware) {
+		m.vectors = v
+	}
+}
+
+// vectors are the metrics of the middleware recording into a scope.
+type vectors struct {
+	requests    *metrics.CounterVector
+	comparisons *metrics.CounterVector
+}
+
+func newVectors(meter *metrics.Scope, logger *zap.Logger) *vectors {
+	v := &vectors{}
+	if meter == nil {
+		return v
+	}
+
+	var err error
+	v.requests, err = meter.CounterVector(metrics.Spec{
+		Name:    "shadow_requests",
+		Help:    "Number of requests sent to the shadow outbound.",
+		VarTags: []string{"procedure", "result"},
+	})
+	if err != nil {
+		logger.Error("Failed to create shadow requests vector.", zap.Error(err))
+	}
+	v.comparisons, err = meter.CounterVector(metrics.Spec{
+		Name:    "shadow_comparisons",
+		Help:    "Number of shadow responses compared with the primary response.",
+		VarTags: []string{"procedure", "result"},
+	})
+	if err != nil {
+		logger.Error("Failed to create shadow comparisons vector.", zap.Error(err))
+	}
+	return v
+}
+
+// Call sends the request to the primary outbound and, if the request is
+// sampled, to the shadow outbound.
+func (m *OutboundMiddleware) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	if !m.sample(req) {
+		return out.Call(ctx, req)
+	}
+	if int(m.inflight.Inc()) > m.maxConcurrent {
+		m.inflight.Dec()
+		m.count(m.requests, req.Procedure, "dropped")
+		return out.Call(ctx, req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			m.inflight.Dec()
+			return nil, err
+		}
+	}
+	primaryReq, shadowReq := *req, *req
+	primaryReq.Body = bytes.NewReader(body)
+	shadowReq.Body = bytes.NewReader(body)
+	// The shadow request outlives the call, so it must not share headers
+	// that the caller or other middleware may change.
+	shadowReq.Headers = headerutil.Copy(req.Headers, 0)
+
+	var primary chan result
+	if m.compare {
+		primary = make(chan result, 1)
+	}
+	go m.callShadow(detach.Context(ctx), &shadowReq, primary)
+
+	res, err := out.Call(ctx, &primaryReq)
+	if primary == nil {
+		return res, err
+	}
+
+	r, res, err := readResult(res, err)
+	primary <- r
+	return res, err
+}
+
+func (m *OutboundMiddleware) sample(req *transport.Request) bool {
+	if len(m.procedures) > 0 {
+		if _, ok := m.procedures[req.Procedure]; !ok {
+			return false
+		}
+	}
+	return m.random()*100 < m.percent
+}
+
+func (m *OutboundMiddleware) callShadow(ctx context.Context, req *transport.Request, primary <-chan result) {
+	defer m.shadowDone()
+	defer m.inflight.Dec()
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	shadow, _, err := readResult(m.shadow.Call(ctx, req))
+	if err != nil {
+		m.logger.Debug("Shadow request failed.",
+			zap.String("procedure", req.Procedure), zap.Error(err))
+		m.count(m.requests, req.Procedure, "error")
+	} else {
+		m.count(m.requests, req.Procedure, "success")
+	}
+
+	if primary == nil {
+		return
+	}
+	if (<-primary).equal(shadow) {
+		m.count(m.comparisons, req.Procedure, "match")
+	} else {
+		m.count(m.comparisons, req.Procedure, "mismatch")
+	}
+}
+
+func (m *OutboundMiddleware) count(cv *metrics.CounterVector, procedure, result string) {
+	counter, err := cv.Get("procedure", procedure, "result", result)
+	if err != nil {
+		m.logger.Error("Failed to get shadow counter.", zap.Error(err))
+		return
+	}
+	counter.Inc()
+}
+
+// result is the outcome of a request, as compared between the primary and
+// shadow outbounds.
+type result struct {
+	failed   bool
+	code     yarpcerrors.Code
+	appError bool
+	body     []byte
+}
+
+func (r result) equal(other result) bool {
+	if r.failed || other.failed {
+		return r.failed == other.failed && r.code == other.code
+	}
+	return r.appError == other.appError && bytes.Equal(r.body, other.body)
+}
+
+// readResult reads the response body into memory and returns a response
+// whose body may still be read.
+func readResult(res *transport.Response, err error) (result, *transport.Response, error) {
+	if err != nil {
+		return result{failed: true, code: yarpcerrors.FromError(err).Code()}, res, err
+	}
+	if res == nil {
+		return result{}, res, nil
+	}
+
+	r := result{appError: res.ApplicationError}
+	if res.Body != nil {
+		body, err := ioutil.ReadAll(res.Body)
+		if closeErr := res.Body.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return result{failed: true, code: yarpcerrors.FromError(err).Code()}, nil, err
+		}
+		r.body = body
+
+		copied := *res
+		copied.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res = &copied
+	}
+	return r, res, nil
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package shadow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+func newRequest(procedure string) *transport.Request {
+	return &transport.Request{
+		Caller:    "caller",
+		Service:   "service",
+		Procedure: procedure,
+		Encoding:  "raw",
+		Body:      bytes.NewReader([]byte("hello")),
+	}
+}
+
+func respond(body string) func(context.Context, *transport.Request) (*transport.Response, error) {
+	return func(_ context.Context, req *transport.Request) (*transport.Response, error) {
+		got, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if string(got) != "hello" {
+			return nil, errors.New("unexpected request body")
+		}
+		return &transport.Response{Body: ioutil.NopCloser(bytes.NewReader([]byte(body)))}, nil
+	}
+}
+
+func fail(err error) func(context.Context, *transport.Request) (*transport.Response, error) {
+	return func(context.Context, *transport.Request) (*transport.Response, error) {
+		return nil, err
+	}
+}
+
+// waitForShadow waits for the shadow request of the middleware to complete,
+// since shadow requests are sent asynchronously.
+func waitForShadow(t *testing.T, mw *OutboundMiddleware) func() {
+	done := make(chan struct{})
+	mw.shadowDone = func() { close(done) }
+	return func() {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("shadow request did not complete")
+		}
+	}
+}
+
+func counterValue(root *metrics.Root, name, result string) int64 {
+	for _, c := range root.Snapshot().Counters {
+		if c.Name == name && c.Tags["result"] == result {
+			return c.Value
+		}
+	}
+	return 0
+}
+
+func TestCompareResponses(t *testing.T) {
+	tests := []struct {
+		name          string
+		primary       func(context.Context, *transport.Request) (*transport.Response, error)
+		shadow        func(context.Context, *transport.Request) (*transport.Response, error)
+		wantBody      string
+		wantErr       bool
+		wantRequest   string
+		wantCompareTo string
+	}{
+		{
+			name:          "same response",
+			primary:       respond("world"),
+			shadow:        respond("world"),
+			wantBody:      "world",
+			wantRequest:   "success",
+			wantCompareTo: "match",
+		},
+		{
+			name:          "different response",
+			primary:       respond("world"),
+			shadow:        respond("planet"),
+			wantBody:      "world",
+			wantRequest:   "success",
+			wantCompareTo: "mismatch",
+		},
+		{
+			name:          "shadow error",
+			primary:       respond("world"),
+			shadow:        fail(yarpcerrors.InternalErrorf("great sadness")),
+			wantBody:      "world",
+			wantRequest:   "error",
+			wantCompareTo: "mismatch",
+		},
+		{
+			name:          "same error",
+			primary:       fail(yarpcerrors.NotFoundErrorf("no such key")),
+			shadow:        fail(yarpcerrors.NotFoundErrorf("key not found")),
+			wantErr:       true,
+			wantRequest:   "error",
+			wantCompareTo: "match",
+		},
+		{
+			name:          "different error",
+			primary:       fail(yarpcerrors.NotFoundErrorf("no such key")),
+			shadow:        fail(yarpcerrors.InternalErrorf("great sadness")),
+			wantErr:       true,
+			wantRequest:   "error",
+			wantCompareTo: "mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			primary := transporttest.NewMockUnaryOutbound(ctrl)
+			primary.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(tt.primary)
+			shadow := transporttest.NewMockUnaryOutbound(ctrl)
+			shadow.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(tt.shadow)
+
+			root := metrics.New()
+			mw := NewOutboundMiddleware(shadow, Percent(100), CompareResponses(), Meter(root.Scope()))
+			wait := waitForShadow(t, mw)
+
+			res, err := mw.Call(context.Background(), newRequest("hello"), primary)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				body, err := ioutil.ReadAll(res.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+
+			wait()
+			assert.Equal(t, int64(1), counterValue(root, "shadow_requests", tt.wantRequest))
+			assert.Equal(t, int64(1), counterValue(root, "shadow_comparisons", tt.wantCompareTo))
+		})
+	}
+}
+
+func TestDiscardResponses(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primaryRes := &transport.Response{Body: ioutil.NopCloser(bytes.NewReader([]byte("world")))}
+	primary := transporttest.NewMockUnaryOutbound(ctrl)
+	primary.EXPECT().Call(gomock.Any(), gomock.Any()).Return(primaryRes, nil)
+
+	called := make(chan time.Duration, 1)
+	shadow := transporttest.NewMockUnaryOutbound(ctrl)
+	shadow.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+			deadline, ok := ctx.Deadline()
+			require.True(t, ok, "shadow request must have a deadline")
+			called <- time.Until(deadline)
+			return nil, yarpcerrors.UnavailableErrorf("shadow unavailable")
+		})
+
+	root := metrics.New()
+	mw := NewOutboundMiddleware(shadow, Percent(100), Timeout(time.Minute), Meter(root.Scope()))
+	wait := waitForShadow(t, mw)
+
+	res, err := mw.Call(context.Background(), newRequest("hello"), primary)
+	require.NoError(t, err)
+	assert.Equal(t, primaryRes, res, "response must be returned unchanged")
+
+	wait()
+	ttl := <-called
+	assert.True(t, ttl > 30*time.Second && ttl <= time.Minute, "unexpected shadow timeout %v", ttl)
+	assert.Equal(t, int64(1), counterValue(root, "shadow_requests", "error"))
+	for _, c := range root.Snapshot().Counters {
+		assert.NotEqual(t, "shadow_comparisons", c.Name)
+	}
+}
+
+func TestShadowRequestOutlivesCall(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := transporttest.NewMockUnaryOutbound(ctrl)
+	primary.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(respond("world"))
+
+	type key struct{}
+	returned := make(chan struct{})
+	shadow := transporttest.NewMockUnaryOutbound(ctrl)
+	shadow.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+			<-returned
+			assert.NoError(t, ctx.Err(), "shadow request must not be cancelled with the call")
+			assert.Equal(t, "value", ctx.Value(key{}), "shadow request must carry context values")
+			assert.Equal(t, map[string]string{"foo": "bar"}, req.Headers.Items(),
+				"shadow request must not see changes to the headers of the call")
+			return respond("world")(ctx, req)
+		})
+
+	mw := NewOutboundMiddleware(shadow, Percent(100))
+	wait := waitForShadow(t, mw)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	req := newRequest("hello")
+	req.Headers = transport.NewHeaders().With("foo", "bar")
+	_, err := mw.Call(ctx, req, primary)
+	require.NoError(t, err)
+
+	cancel()
+	req.Headers.With("baz", "qux")
+	close(returned)
+	wait()
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := transporttest.NewMockUnaryOutbound(ctrl)
+	primary.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(respond("world")).Times(2)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	shadow := transporttest.NewMockUnaryOutbound(ctrl)
+	shadow.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+			close(started)
+			<-unblock
+			return respond("world")(ctx, req)
+		})
+
+	root := metrics.New()
+	mw := NewOutboundMiddleware(shadow, Percent(100), MaxConcurrent(1), Meter(root.Scope()))
+	wait := waitForShadow(t, mw)
+
+	_, err := mw.Call(context.Background(), newRequest("hello"), primary)
+	require.NoError(t, err)
+	<-started
+
+	// The shadow outbound is busy, so the second request is not shadowed.
+	_, err = mw.Call(context.Background(), newRequest("hello"), primary)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counterValue(root, "shadow_requests", "dropped"))
+
+	close(unblock)
+	wait()
+	assert.Equal(t, int64(1), counterValue(root, "shadow_requests", "success"))
+}
+
+func TestSampling(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		procedure  string
+		random     float64
+		wantShadow bool
+	}{
+		{
+			name:       "default",
+			procedure:  "hello",
+			random:     0.005,
+			wantShadow: true,
+		},
+		{
+			name:      "default not sampled",
+			procedure: "hello",
+			random:    0.02,
+		},
+		{
+			name:       "sampled",
+			opts:       []Option{Percent(10)},
+			procedure:  "hello",
+			random:     0.05,
+			wantShadow: true,
+		},
+		{
+			name:      "not sampled",
+			opts:      []Option{Percent(10)},
+			procedure: "hello",
+			random:    0.15,
+		},
+		{
+			name:      "disabled",
+			opts:      []Option{Percent(0)},
+			procedure: "hello",
+			random:    0,
+		},
+		{
+			name:       "listed procedure",
+			opts:       []Option{Procedures("hello", "goodbye")},
+			procedure:  "goodbye",
+			wantShadow: true,
+		},
+		{
+			name:      "unlisted procedure",
+			opts:      []Option{Procedures("hello")},
+			procedure: "goodbye",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			primary := transporttest.NewMockUnaryOutbound(ctrl)
+			primary.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(respond("world"))
+
+			shadow := transporttest.NewMockUnaryOutbound(ctrl)
+			if tt.wantShadow {
+				shadow.EXPECT().Call(gomock.Any(), gomock.Any()).DoAndReturn(respond("world"))
+			}
+
+			mw := NewOutboundMiddleware(shadow, tt.opts...)
+			mw.random = func() float64 { return tt.random }
+			wait := waitForShadow(t, mw)
+
+			_, err := mw.Call(context.Background(), newRequest(tt.procedure), primary)
+			require.NoError(t, err)
+
+			if tt.wantShadow {
+				wait()
+			}
+		})
+	}
+}
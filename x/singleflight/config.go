@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package singleflight
+
+import (
+	"errors"
+	"sync"
+
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcconfig"
+)
+
+// Config configures the coalescing of requests of an outbound.
+type Config struct {
+	// Procedures whose requests are coalesced. At least one is required.
+	Procedures []string `config:"procedures"`
+
+	// Request headers whose values are part of the identity of requests.
+	Headers []string `config:"headers"`
+}
+
+// OutboundMiddlewareSpec returns a specification that teaches a
+// yarpcconfig.Configurator to coalesce the requests of outbounds configured
+// with the 'singleflight' attribute.
+//
+// 	cfg := yarpcconfig.New(yarpcconfig.Meter(meter))
+// 	cfg.MustRegisterOutboundMiddleware(singleflight.OutboundMiddlewareSpec())
+//
+// 	outbounds:
+// 	  config:
+// 	    grpc: {address: "config:8080"}
+// 	    singleflight:
+// 	      procedures: [getConfig]
+// 	      headers: [x-tenant]
+//
+// Metrics are recorded in the scope of the Configurator, tagged with the name
+// of the outbound. Register the specification with a single Configurator.
+func OutboundMiddlewareSpec() yarpcconfig.OutboundMiddlewareSpec {
+	// The Configurator gives the same scope to an outbound each time a
+	// configuration is loaded, so its vector is registered only once.
+	var (
+		mu        sync.Mutex
+		coalesced = make(map[*metrics.Scope]*metrics.CounterVector)
+	)
+	coalescedFor := func(kit *yarpcconfig.Kit) *metrics.CounterVector {
+		meter := kit.Meter()
+		if meter == nil {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		v, ok := coalesced[meter]
+		if !ok {
+			v = newCoalesced(meter, kit.Logger())
+			coalesced[meter] = v
+		}
+		return v
+	}
+
+	return yarpcconfig.OutboundMiddlewareSpec{
+		Name: "singleflight",
+		ApplyOutboundMiddleware: func(cfg Config, outs transport.Outbounds, kit *yarpcconfig.Kit) (transport.Outbounds, error) {
+			return applyConfig(cfg, outs, kit, coalescedFor(kit))
+		},
+	}
+}
+
+func applyConfig(cfg Config, outs transport.Outbounds, kit *yarpcconfig.Kit, coalesced *metrics.CounterVector) (transport.Outbounds, error) {
+	if outs.Unary == nil {
+		return outs, errors.New("outbound does not support unary calls")
+	}
+	if len(cfg.Procedures) == 0 {
+		return outs, errors.New("no procedures specified")
+	}
+
+	outs.Unary = middleware.ApplyUnaryOutbound(outs.Unary, NewOutboundMiddleware(
+		Procedures(cfg.Procedures...),
+		Headers(cfg.Headers...),
+		Logger(kit.Logger()),
+		withCoalesced(coalesced),
+	))
+	return outs, nil
+}
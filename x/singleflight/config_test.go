@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package singleflight
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/transport/transporttest"
+	"go.uber.org/yarpc/internal/whitespace"
+	"go.uber.org/yarpc/yarpcconfig"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestOutboundMiddlewareSpec(t *testing.T) {
+	type outboundConfig struct {
+		Name string `config:"name"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbounds := make(map[string]*transporttest.MockUnaryOutbound)
+	newConfigurator := func(opts ...yarpcconfig.Option) *yarpcconfig.Configurator {
+		c := yarpcconfig.New(opts...)
+		c.MustRegisterOutboundMiddleware(OutboundMiddlewareSpec())
+		require.NoError(t, c.RegisterTransport(yarpcconfig.TransportSpec{
+			Name: "fake",
+			BuildTransport: func(struct{}, *yarpcconfig.Kit) (transport.Transport, error) {
+				return transporttest.NewMockTransport(ctrl), nil
+			},
+			BuildUnaryOutbound: func(cfg outboundConfig, _ transport.Transport, _ *yarpcconfig.Kit) (transport.UnaryOutbound, error) {
+				o := transporttest.NewMockUnaryOutbound(ctrl)
+				outbounds[cfg.Name] = o
+				return o, nil
+			},
+		}))
+		return c
+	}
+
+	t.Run("coalesced", func(t *testing.T) {
+		cfg, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					singleflight:
+						procedures: [get]
+						headers: [x-tenant]
+		`)))
+		require.NoError(t, err)
+
+		out := cfg.Outbounds["myservice"].Unary
+		assert.NotEqual(t, outbounds["primary"], out, "outbound must be wrapped")
+
+		outbounds["primary"].EXPECT().Call(gomock.Any(), gomock.Any()).Return(&transport.Response{}, nil)
+		_, err = out.Call(context.Background(), &transport.Request{Procedure: "get", Body: strings.NewReader("key")})
+		assert.NoError(t, err)
+	})
+
+	t.Run("reloaded", func(t *testing.T) {
+		root := metrics.New()
+		core, logs := observer.New(zap.ErrorLevel)
+		c := newConfigurator(yarpcconfig.Meter(root.Scope()), yarpcconfig.Logger(zap.New(core)))
+		give := whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					singleflight: {procedures: [get]}
+		`)
+		for i := 0; i < 2; i++ {
+			_, err := c.LoadConfigFromYAML("foo", strings.NewReader(give))
+			require.NoError(t, err)
+		}
+		// Metrics of the outbound are registered once.
+		assert.Empty(t, logs.AllUntimed(), "unexpected errors logged")
+	})
+
+	tests := []struct {
+		desc    string
+		give    string
+		wantErr string
+	}{
+		{
+			desc: "no procedures",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: primary}
+						singleflight:
+							headers: [x-tenant]
+			`,
+			wantErr: `failed to configure singleflight of outbound "myservice": no procedures specified`,
+		},
+		{
+			desc: "unknown attribute",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: primary}
+						singleflight:
+							procedures: [get]
+							ttl: 1s
+			`,
+			wantErr: `failed to configure singleflight of outbound "myservice": failed to decode singleflight.Config`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(tt.give)))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
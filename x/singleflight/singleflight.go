@@ -0,0 +1,334 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package singleflight provides outbound middleware that coalesces
+// concurrent identical unary requests into a single call.
+//
+// While a request is in flight, identical requests wait for its response
+// instead of being sent. Requests are identical if they have the same
+// service, procedure, encoding, shard key, routing key, routing delegate,
+// body and values for the selected headers. Other headers are ignored, so
+// only select procedures whose responses do not depend on them.
+//
+// 	middleware.ApplyUnaryOutbound(out, singleflight.NewOutboundMiddleware(
+// 		singleflight.Procedures("getConfig"),
+// 		singleflight.Headers("x-tenant"),
+// 	))
+//
+// Only the procedures given with the Procedures option are coalesced. Each
+// caller receives its own copy of the response. Waiting requests share the
+// result of the request that was sent, including its errors, but give up
+// waiting when their own context ends.
+//
+// The request is sent with the values and deadline of the context of the
+// first caller, but is not cancelled with it: it is only cancelled once every
+// caller waiting for it has given up, so that the remaining callers still
+// receive its response.
+package singleflight
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/internal/detach"
+	"go.uber.org/yarpc/internal/digester"
+	"go.uber.org/yarpc/internal/headerutil"
+	"go.uber.org/yarpc/yarpcerrors"
+	"go.uber.org/zap"
+)
+
+var _ middleware.UnaryOutbound = (*OutboundMiddleware)(nil)
+
+// Option customizes an OutboundMiddleware.
+type Option func(*OutboundMiddleware)
+
+// Procedures specifies the procedures whose requests are coalesced. No
+// requests are coalesced by default.
+func Procedures(procedures ...string) Option {
+	return func(m *OutboundMiddleware) {
+		for _, p := range procedures {
+			m.procedures[p] = struct{}{}
+		}
+	}
+}
+
+// Headers specifies the request headers whose values are part of the
+// identity of requests. Requests that only differ in other headers are
+// coalesced.
+func Headers(headers ...string) Option {
+	return func(m *OutboundMiddleware) {
+		for _, h := range headers {
+			m.headers = append(m.headers, transport.CanonicalizeHeaderKey(h))
+		}
+	}
+}
+
+// Meter specifies the scope in which coalescing metrics are recorded.
+//
+// The "coalesced_requests" counter counts requests, by procedure, that
+// received the response of another request instead of being sent. It is
+// registered when the middleware is built, so a scope may only be given to
+// one middleware.
+func Meter(meter *metrics.Scope) Option {
+	return func(m *OutboundMiddleware) {
+		m.meter = meter
+	}
+}
+
+// Logger specifies the logger for the middleware.
+func Logger(logger *zap.Logger) Option {
+	return func(m *OutboundMiddleware) {
+		m.logger = logger
+	}
+}
+
+// OutboundMiddleware is a unary outbound middleware that coalesces identical
+// requests.
+type OutboundMiddleware struct {
+	procedures map[string]struct{}
+	headers    []string
+	meter      *metrics.Scope
+	logger     *zap.Logger
+
+	coalesced *metrics.CounterVector
+
+	mu      sync.Mutex
+	flights map[string]*flight
+
+	// for tests
+	waiting func()
+}
+
+// flight is a request in flight, whose result is shared with identical
+// requests.
+type flight struct {
+	done   chan struct{}
+	cancel context.CancelFunc
+
+	// Number of callers waiting for the result, guarded by the mutex of the
+	// middleware.
+	waiters int
+
+	res  *transport.Response // with a nil body
+	body []byte
+	err  error
+}
+
+// NewOutboundMiddleware builds a middleware that coalesces identical
+// requests.
+func NewOutboundMiddleware(opts ...Option) *OutboundMiddleware {
+	m := &OutboundMiddleware{
+		procedures: make(map[string]struct{}),
+		logger:     zap.NewNop(),
+		flights:    make(map[string]*flight),
+		waiting:    func() {},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.meter != nil {
+		m.coalesced = newCoalesced(m.meter, m.logger)
+	}
+	return m
+}
+
+// withCoalesced records coalesced requests in an already registered vector,
+// instead of registering one with the scope given to Meter.
+func withCoalesced(v *metrics.CounterVector) Option {
+	return func(m *OutboundMiddleware) {
+		m.meter = nil
+		m.coalesced = v
+	}
+}
+
+func newCoalesced(meter *metrics.Scope, logger *zap.Logger) *metrics.CounterVector {
+	v, err := meter.CounterVector(metrics.Spec{
+		Name:    "coalesced_requests",
+		Help:    "Number of requests that received the response of an identical request.",
+		VarTags: []string{"procedure"},
+	})
+	if err != nil {
+		logger.Error("Failed to create coalesced requests vector.", zap.Error(err))
+		return nil
+	}
+	return v
+}
+
+// Call sends the request, or waits for the response of an identical request
+// in flight.
+func (m *OutboundMiddleware) Call(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+	if _, ok := m.procedures[req.Procedure]; !ok {
+		return out.Call(ctx, req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+	}
+	key := m.key(req, body)
+
+	m.mu.Lock()
+	if f, ok := m.flights[key]; ok {
+		f.waiters++
+		m.mu.Unlock()
+		m.count(req.Procedure)
+		m.waiting()
+		return m.wait(ctx, req, key, f)
+	}
+
+	// The request is shared by all waiting callers, so it must not be
+	// cancelled with the context of the caller sending it.
+	sendCtx, cancel := context.WithCancel(detach.Context(ctx))
+	if deadline, ok := ctx.Deadline(); ok {
+		sendCtx, cancel = withDeadline(sendCtx, cancel, deadline)
+	}
+	f := &flight{done: make(chan struct{}), cancel: cancel, waiters: 1}
+	m.flights[key] = f
+	m.mu.Unlock()
+
+	// The caller may reuse the request once it stops waiting.
+	sent := *req
+	sent.Headers = headerutil.Copy(req.Headers, 0)
+	sent.Body = bytes.NewReader(body)
+	go m.send(sendCtx, &sent, out, key, f)
+	return m.wait(ctx, req, key, f)
+}
+
+// withDeadline adds a deadline to the context, cancelling both with the
+// returned function.
+func withDeadline(ctx context.Context, cancel context.CancelFunc, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx, cancelDeadline := context.WithDeadline(ctx, deadline)
+	return ctx, func() {
+		cancelDeadline()
+		cancel()
+	}
+}
+
+// wait waits for the result of the flight, or for the end of the context.
+func (m *OutboundMiddleware) wait(ctx context.Context, req *transport.Request, key string, f *flight) (*transport.Response, error) {
+	select {
+	case <-f.done:
+		return f.response()
+	case <-ctx.Done():
+		m.leave(key, f)
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, yarpcerrors.DeadlineExceededErrorf(
+				"request to procedure %q of service %q expired while waiting for a response",
+				req.Procedure, req.Service)
+		}
+		return nil, yarpcerrors.CancelledErrorf(
+			"request to procedure %q of service %q was cancelled while waiting for a response",
+			req.Procedure, req.Service)
+	}
+}
+
+// leave stops waiting for the flight, cancelling it once nobody waits for its
+// result.
+func (m *OutboundMiddleware) leave(key string, f *flight) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	// Later identical requests must not wait for a cancelled request.
+	if m.flights[key] == f {
+		delete(m.flights, key)
+	}
+	f.cancel()
+}
+
+// send sends the request and records its result in the flight.
+func (m *OutboundMiddleware) send(ctx context.Context, req *transport.Request, out transport.UnaryOutbound, key string, f *flight) {
+	defer func() {
+		m.mu.Lock()
+		if m.flights[key] == f {
+			delete(m.flights, key)
+		}
+		m.mu.Unlock()
+		f.cancel()
+		close(f.done)
+	}()
+
+	f.res, f.err = out.Call(ctx, req)
+	if f.err == nil && f.res.Body != nil {
+		f.body, f.err = ioutil.ReadAll(f.res.Body)
+		if err := f.res.Body.Close(); f.err == nil {
+			f.err = err
+		}
+	}
+}
+
+// key returns the identity of the request.
+func (m *OutboundMiddleware) key(req *transport.Request, body []byte) string {
+	d := digester.New()
+	defer d.Free()
+
+	d.Add(req.Service)
+	d.Add(req.Procedure)
+	d.Add(string(req.Encoding))
+	d.Add(req.ShardKey)
+	d.Add(req.RoutingKey)
+	d.Add(req.RoutingDelegate)
+	for _, h := range m.headers {
+		v, _ := req.Headers.Get(h)
+		d.Add(v)
+	}
+	sum := sha256.Sum256(body)
+	d.Add(string(sum[:]))
+	return string(d.Digest())
+}
+
+func (m *OutboundMiddleware) count(procedure string) {
+	if m.coalesced == nil {
+		return
+	}
+	counter, err := m.coalesced.Get("procedure", procedure)
+	if err != nil {
+		m.logger.Error("Failed to get coalesced requests counter.", zap.Error(err))
+		return
+	}
+	counter.Inc()
+}
+
+// response returns a copy of the result of the flight.
+func (f *flight) response() (*transport.Response, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	res := *f.res
+	res.Headers = headerutil.Copy(f.res.Headers, 0)
+	if f.res.Body != nil {
+		res.Body = ioutil.NopCloser(bytes.NewReader(f.body))
+	}
+	return &res, nil
+}
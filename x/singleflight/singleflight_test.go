@@ -0,0 +1,277 @@
+// Copyright (c) 2020 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package singleflight
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/yarpcerrors"
+)
+
+// blockingOutbound responds with the body of requests after it is released,
+// and reports each call it receives.
+type blockingOutbound struct {
+	transport.UnaryOutbound
+
+	entered chan string
+	release chan struct{}
+	err     error
+}
+
+func newBlockingOutbound() *blockingOutbound {
+	return &blockingOutbound{entered: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (o *blockingOutbound) Call(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	o.entered <- string(body)
+	select {
+	case <-o.release:
+	case <-ctx.Done():
+		// As transports do.
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, yarpcerrors.DeadlineExceededErrorf("request timed out")
+		}
+		return nil, yarpcerrors.CancelledErrorf("request cancelled")
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	tenant, _ := req.Headers.Get("x-tenant")
+	return &transport.Response{
+		Headers: transport.NewHeaders().With("tenant", tenant),
+		Body:    ioutil.NopCloser(bytes.NewBufferString("value of " + string(body))),
+	}, nil
+}
+
+func newRequest(procedure, body string, headers map[string]string) *transport.Request {
+	return &transport.Request{
+		Service:   "config",
+		Procedure: procedure,
+		Headers:   transport.HeadersFromMap(headers),
+		Body:      bytes.NewBufferString(body),
+	}
+}
+
+type result struct {
+	res *transport.Response
+	err error
+}
+
+func call(ctx context.Context, m *OutboundMiddleware, out transport.UnaryOutbound, req *transport.Request) <-chan result {
+	resc := make(chan result, 1)
+	go func() {
+		res, err := m.Call(ctx, req, out)
+		resc <- result{res, err}
+	}()
+	return resc
+}
+
+func readBody(t *testing.T, r result) string {
+	require.NoError(t, r.err)
+	body, err := ioutil.ReadAll(r.res.Body)
+	require.NoError(t, err)
+	require.NoError(t, r.res.Body.Close())
+	return string(body)
+}
+
+func TestCoalescing(t *testing.T) {
+	root := metrics.New()
+	m := NewOutboundMiddleware(Procedures("get"), Headers("X-Tenant"), Meter(root.Scope()))
+	var waiting sync.WaitGroup
+	waiting.Add(2)
+	m.waiting = waiting.Done
+
+	out := newBlockingOutbound()
+	ctx := context.Background()
+
+	leader := call(ctx, m, out, newRequest("get", "a", map[string]string{"x-tenant": "1", "x-trace": "1"}))
+	assert.Equal(t, "a", <-out.entered)
+
+	// Requests that only differ in unselected headers wait for the leader.
+	followers := []<-chan result{
+		call(ctx, m, out, newRequest("get", "a", map[string]string{"x-tenant": "1", "x-trace": "2"})),
+		call(ctx, m, out, newRequest("get", "a", map[string]string{"x-tenant": "1"})),
+	}
+	waiting.Wait()
+
+	// Requests with other bodies or selected headers are sent.
+	otherBody := call(ctx, m, out, newRequest("get", "b", map[string]string{"x-tenant": "1"}))
+	assert.Equal(t, "b", <-out.entered)
+	otherTenant := call(ctx, m, out, newRequest("get", "a", map[string]string{"x-tenant": "2"}))
+	assert.Equal(t, "a", <-out.entered)
+
+	close(out.release)
+
+	first := <-leader
+	assert.Equal(t, "value of a", readBody(t, first))
+	for _, f := range followers {
+		r := <-f
+		assert.Equal(t, "value of a", readBody(t, r))
+		// Each caller gets its own headers.
+		r.res.Headers.Del("tenant")
+	}
+	assert.Equal(t, map[string]string{"tenant": "1"}, first.res.Headers.Items())
+	assert.Equal(t, "value of b", readBody(t, <-otherBody))
+	assert.Equal(t, "value of a", readBody(t, <-otherTenant))
+	assert.Empty(t, out.entered, "unexpected requests sent")
+
+	snapshot := root.Snapshot()
+	require.Len(t, snapshot.Counters, 1)
+	assert.Equal(t, "coalesced_requests", snapshot.Counters[0].Name)
+	assert.Equal(t, metrics.Tags{"procedure": "get"}, snapshot.Counters[0].Tags)
+	assert.Equal(t, int64(2), snapshot.Counters[0].Value)
+}
+
+func TestErrorsAreShared(t *testing.T) {
+	m := NewOutboundMiddleware(Procedures("get"))
+	waiting := make(chan struct{})
+	m.waiting = func() { close(waiting) }
+
+	out := newBlockingOutbound()
+	out.err = yarpcerrors.UnavailableErrorf("great sadness")
+	ctx := context.Background()
+
+	leader := call(ctx, m, out, newRequest("get", "a", nil))
+	<-out.entered
+	follower := call(ctx, m, out, newRequest("get", "a", nil))
+	<-waiting
+	close(out.release)
+
+	assert.Equal(t, out.err, (<-leader).err)
+	assert.Equal(t, out.err, (<-follower).err)
+}
+
+func TestWaitingRequestExpires(t *testing.T) {
+	m := NewOutboundMiddleware(Procedures("get"))
+	out := newBlockingOutbound()
+
+	leader := call(context.Background(), m, out, newRequest("get", "a", nil))
+	<-out.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	r := <-call(ctx, m, out, newRequest("get", "a", nil))
+	assert.True(t, yarpcerrors.IsDeadlineExceeded(r.err), "unexpected error: %v", r.err)
+
+	close(out.release)
+	assert.Equal(t, "value of a", readBody(t, <-leader))
+}
+
+func TestLeaderCancels(t *testing.T) {
+	m := NewOutboundMiddleware(Procedures("get"))
+	waiting := make(chan struct{})
+	m.waiting = func() { close(waiting) }
+	out := newBlockingOutbound()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := call(ctx, m, out, newRequest("get", "a", nil))
+	<-out.entered
+	follower := call(context.Background(), m, out, newRequest("get", "a", nil))
+	<-waiting
+
+	cancel()
+	r := <-leader
+	assert.True(t, yarpcerrors.IsCancelled(r.err), "unexpected error: %v", r.err)
+
+	// The request is still sent for the remaining caller.
+	close(out.release)
+	assert.Equal(t, "value of a", readBody(t, <-follower))
+	assert.Empty(t, out.entered, "unexpected requests sent")
+}
+
+func TestAllCallersCancel(t *testing.T) {
+	m := NewOutboundMiddleware(Procedures("get"))
+	waiting := make(chan struct{})
+	m.waiting = func() { close(waiting) }
+	out := newBlockingOutbound()
+	out.release = nil // only returns when the request is cancelled
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := call(ctx, m, out, newRequest("get", "a", nil))
+	<-out.entered
+	follower := call(ctx, m, out, newRequest("get", "a", nil))
+	<-waiting
+
+	cancel()
+	assert.True(t, yarpcerrors.IsCancelled((<-leader).err))
+	assert.True(t, yarpcerrors.IsCancelled((<-follower).err))
+
+	// Later requests are not coalesced with the cancelled one.
+	m.waiting = func() { t.Error("unexpected coalesced request") }
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	next := call(ctx, m, out, newRequest("get", "a", nil))
+	assert.Equal(t, "a", <-out.entered)
+	r := <-next
+	assert.True(t, yarpcerrors.IsDeadlineExceeded(r.err), "unexpected error: %v", r.err)
+}
+
+func TestSentWithCallerDeadline(t *testing.T) {
+	m := NewOutboundMiddleware(Procedures("get"))
+	deadlines := make(chan time.Time, 1)
+	out := outboundFunc(func(ctx context.Context, _ *transport.Request) (*transport.Response, error) {
+		d, _ := ctx.Deadline()
+		deadlines <- d
+		return &transport.Response{}, nil
+	})
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	_, err := m.Call(ctx, newRequest("get", "a", nil), out)
+	require.NoError(t, err)
+	assert.Equal(t, deadline, <-deadlines)
+}
+
+type outboundFunc func(context.Context, *transport.Request) (*transport.Response, error)
+
+func (f outboundFunc) Call(ctx context.Context, req *transport.Request) (*transport.Response, error) {
+	return f(ctx, req)
+}
+
+func (outboundFunc) Transports() []transport.Transport { return nil }
+func (outboundFunc) Start() error                      { return nil }
+func (outboundFunc) Stop() error                       { return nil }
+func (outboundFunc) IsRunning() bool                   { return true }
+
+func TestUnselectedProcedures(t *testing.T) {
+	m := NewOutboundMiddleware(Procedures("get"))
+	out := newBlockingOutbound()
+	close(out.release)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "value of a", readBody(t, <-call(context.Background(), m, out, newRequest("set", "a", nil))))
+		assert.Equal(t, "a", <-out.entered)
+	}
+}
@@ -26,21 +26,27 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
+	"sync"
 
 	"go.uber.org/multierr"
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/internal/config"
+	"go.uber.org/yarpc/internal/inboundmiddleware"
 	"go.uber.org/yarpc/internal/interpolate"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 )
 
 // Configurator helps build Dispatchers using runtime configuration.
 //
-// A new Configurator does not know about any transports, peer lists, or peer
-// list updaters. Inform it about them by using the RegisterTransport,
-// RegisterPeerList, and RegisterPeerListUpdater functions, or their Must*
-// variants.
+// A new Configurator does not know about any transports, peer lists, peer
+// list updaters, or middleware. Inform it about them by using the
+// RegisterTransport, RegisterPeerList, RegisterPeerListUpdater,
+// RegisterInboundMiddleware, RegisterOutboundMiddleware, and
+// RegisterCompositeOutbound functions, or their Must* variants.
 type Configurator struct {
 	knownTransports       map[string]*compiledTransportSpec
 	knownPeerChoosers     map[string]*compiledPeerChooserSpec
@@ -48,6 +54,17 @@ type Configurator struct {
 	knownPeerListUpdaters map[string]*compiledPeerListUpdaterSpec
 	knownCompressors      map[string]transport.Compressor
 	resolver              interpolate.VariableResolver
+	meter                 *metrics.Scope
+	logger                *zap.Logger
+
+	// Applied in order of registration.
+	knownInboundMiddleware  []*compiledInboundMiddlewareSpec
+	knownOutboundMiddleware []*compiledOutboundMiddlewareSpec
+	knownCompositeOutbounds []*compiledCompositeOutboundSpec
+
+	// Scopes of the outbounds, reused across loaded configurations.
+	outboundMetersMu sync.Mutex
+	outboundMeters   map[string]*metrics.Scope
 }
 
 // New sets up a new empty Configurator. The returned Configurator does not
@@ -60,12 +77,17 @@ func New(opts ...Option) *Configurator {
 		knownPeerListUpdaters: make(map[string]*compiledPeerListUpdaterSpec),
 		knownCompressors:      make(map[string]transport.Compressor),
 		resolver:              os.LookupEnv,
+		outboundMeters:        make(map[string]*metrics.Scope),
 	}
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
+	if c.logger == nil {
+		c.logger = zap.NewNop()
+	}
+
 	return c
 }
 
@@ -207,6 +229,142 @@ func (c *Configurator) MustRegisterPeerListUpdater(s PeerListUpdaterSpec) {
 	}
 }
 
+// RegisterInboundMiddleware registers an InboundMiddlewareSpec with the given
+// Configurator, teaching it how to build inbound middleware from the
+// configuration section with the same name.
+//
+// An error is returned if the InboundMiddlewareSpec is invalid. Use
+// MustRegisterInboundMiddleware to panic in the case of registration failure.
+//
+// The middleware of loaded configurations is applied in the order in which
+// its specs were first registered, after any inbound middleware already in
+// the configuration. If middleware with the same name already exists, it
+// will be replaced.
+//
+// See InboundMiddlewareSpec for details on how to integrate your own
+// middleware with the system.
+func (c *Configurator) RegisterInboundMiddleware(s InboundMiddlewareSpec) error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+
+	spec, err := compileInboundMiddlewareSpec(&s)
+	if err != nil {
+		return fmt.Errorf("invalid InboundMiddlewareSpec for %q: %v", s.Name, err)
+	}
+
+	for i, known := range c.knownInboundMiddleware {
+		if known.Name == s.Name {
+			c.knownInboundMiddleware[i] = spec
+			return nil
+		}
+	}
+	c.knownInboundMiddleware = append(c.knownInboundMiddleware, spec)
+	return nil
+}
+
+// MustRegisterInboundMiddleware registers the given InboundMiddlewareSpec
+// with the Configurator. This function panics if the InboundMiddlewareSpec
+// is invalid.
+func (c *Configurator) MustRegisterInboundMiddleware(s InboundMiddlewareSpec) {
+	if err := c.RegisterInboundMiddleware(s); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterOutboundMiddleware registers an OutboundMiddlewareSpec with the
+// given Configurator, teaching it how to wrap outbounds in middleware built
+// from the attribute with the same name in their configuration.
+//
+// An error is returned if the OutboundMiddlewareSpec is invalid. Use
+// MustRegisterOutboundMiddleware to panic in the case of registration
+// failure.
+//
+// Outbound middleware is applied in the order in which its specs were first
+// registered, so middleware registered later wraps middleware registered
+// earlier. If middleware with the same name already exists, it will be
+// replaced.
+//
+// See OutboundMiddlewareSpec for details on how to integrate your own
+// middleware with the system.
+func (c *Configurator) RegisterOutboundMiddleware(s OutboundMiddlewareSpec) error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+
+	spec, err := compileOutboundMiddlewareSpec(&s)
+	if err != nil {
+		return fmt.Errorf("invalid OutboundMiddlewareSpec for %q: %v", s.Name, err)
+	}
+	if _, ok := c.knownTransports[s.Name]; ok {
+		return fmt.Errorf("invalid OutboundMiddlewareSpec for %q: %q is the name of a transport", s.Name, s.Name)
+	}
+
+	for i, known := range c.knownOutboundMiddleware {
+		if known.Name == s.Name {
+			c.knownOutboundMiddleware[i] = spec
+			return nil
+		}
+	}
+	c.knownOutboundMiddleware = append(c.knownOutboundMiddleware, spec)
+	return nil
+}
+
+// MustRegisterOutboundMiddleware registers the given OutboundMiddlewareSpec
+// with the Configurator. This function panics if the OutboundMiddlewareSpec
+// is invalid.
+func (c *Configurator) MustRegisterOutboundMiddleware(s OutboundMiddlewareSpec) {
+	if err := c.RegisterOutboundMiddleware(s); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterCompositeOutbound registers a CompositeOutboundSpec with the given
+// Configurator, teaching it how to build outbounds configured with the
+// attribute with the same name from the other outbounds of the
+// configuration.
+//
+// An error is returned if the CompositeOutboundSpec is invalid. Use
+// MustRegisterCompositeOutbound to panic in the case of registration
+// failure.
+//
+// If a composite outbound with the same name already exists, it will be
+// replaced.
+//
+// See CompositeOutboundSpec for details on how to integrate your own
+// outbounds with the system.
+func (c *Configurator) RegisterCompositeOutbound(s CompositeOutboundSpec) error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+
+	spec, err := compileCompositeOutboundSpec(&s)
+	if err != nil {
+		return fmt.Errorf("invalid CompositeOutboundSpec for %q: %v", s.Name, err)
+	}
+	if _, ok := c.knownTransports[s.Name]; ok {
+		return fmt.Errorf("invalid CompositeOutboundSpec for %q: %q is the name of a transport", s.Name, s.Name)
+	}
+
+	for i, known := range c.knownCompositeOutbounds {
+		if known.Name == s.Name {
+			c.knownCompositeOutbounds[i] = spec
+			return nil
+		}
+	}
+	c.knownCompositeOutbounds = append(c.knownCompositeOutbounds, spec)
+	return nil
+}
+
+// MustRegisterCompositeOutbound registers the given CompositeOutboundSpec
+// with the Configurator. This function panics if the CompositeOutboundSpec
+// is invalid.
+func (c *Configurator) MustRegisterCompositeOutbound(s CompositeOutboundSpec) {
+	if err := c.RegisterCompositeOutbound(s); err != nil {
+		panic(err)
+	}
+}
+
 // RegisterCompressor registers the given Compressor for the configurator, so
 // any transport can use the given compression strategy.
 func (c *Configurator) RegisterCompressor(z transport.Compressor) error {
@@ -246,11 +404,23 @@ func (c *Configurator) LoadConfigFromYAML(serviceName string, r io.Reader) (yarp
 // See the module documentation for the shape the map[string]interface{} is
 // expected to conform to.
 func (c *Configurator) LoadConfig(serviceName string, data interface{}) (yarpc.Config, error) {
+	var attrs config.AttributeMap
+	if err := config.DecodeInto(&attrs, data); err != nil {
+		return yarpc.Config{}, err
+	}
+
+	// The sections of registered specs are set aside before the rest of the
+	// configuration is decoded.
+	ext, err := c.popExtensions(attrs)
+	if err != nil {
+		return yarpc.Config{}, err
+	}
+
 	var cfg yarpcConfig
-	if err := config.DecodeInto(&cfg, data); err != nil {
+	if err := attrs.Decode(&cfg); err != nil {
 		return yarpc.Config{}, err
 	}
-	return c.load(serviceName, &cfg)
+	return c.load(serviceName, &cfg, ext)
 }
 
 // NewDispatcherFromYAML builds a Dispatcher from the given YAML
@@ -282,7 +452,128 @@ func (c *Configurator) Kit(serviceName string) *Kit {
 	}
 }
 
-func (c *Configurator) load(serviceName string, cfg *yarpcConfig) (_ yarpc.Config, err error) {
+// extensions are the sections of a configuration that are handled by
+// registered specs rather than by YARPC itself.
+type extensions struct {
+	// By middleware name.
+	inboundMiddleware map[string]config.AttributeMap
+
+	// By outbound name and then by middleware name.
+	outboundMiddleware map[string]map[string]config.AttributeMap
+
+	// By outbound name.
+	compositeOutbounds map[string]compositeOutbound
+}
+
+type compositeOutbound struct {
+	Service string
+	Spec    *compiledCompositeOutboundSpec
+	Attrs   config.AttributeMap
+}
+
+// popExtensions removes the sections of registered specs from the
+// configuration.
+func (c *Configurator) popExtensions(attrs config.AttributeMap) (*extensions, error) {
+	ext := extensions{
+		inboundMiddleware:  make(map[string]config.AttributeMap),
+		outboundMiddleware: make(map[string]map[string]config.AttributeMap),
+		compositeOutbounds: make(map[string]compositeOutbound),
+	}
+
+	for _, spec := range c.knownInboundMiddleware {
+		var section config.AttributeMap
+		ok, err := attrs.Pop(spec.Name, &section)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ext.inboundMiddleware[spec.Name] = section
+		}
+	}
+
+	if len(c.knownOutboundMiddleware) == 0 && len(c.knownCompositeOutbounds) == 0 {
+		return &ext, nil
+	}
+
+	var outbounds map[string]config.AttributeMap
+	if _, err := attrs.Get("outbounds", &outbounds); err != nil {
+		return nil, fmt.Errorf("failed to decode outbound items: %v", err)
+	}
+
+	for name, outbound := range outbounds {
+		for _, spec := range c.knownOutboundMiddleware {
+			var section config.AttributeMap
+			ok, err := outbound.Pop(spec.Name, &section)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %v configuration for outbound %q: %v", spec.Name, name, err)
+			}
+			if !ok {
+				continue
+			}
+			if ext.outboundMiddleware[name] == nil {
+				ext.outboundMiddleware[name] = make(map[string]config.AttributeMap)
+			}
+			ext.outboundMiddleware[name][spec.Name] = section
+		}
+
+		composite, ok, err := c.popCompositeOutbound(name, outbound)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ext.compositeOutbounds[name] = composite
+			delete(outbounds, name)
+		}
+	}
+	if outbounds != nil {
+		attrs["outbounds"] = outbounds
+	}
+	return &ext, nil
+}
+
+// popCompositeOutbound reads the configuration of the named outbound if it is
+// a composite outbound.
+func (c *Configurator) popCompositeOutbound(name string, attrs config.AttributeMap) (_ compositeOutbound, ok bool, err error) {
+	var composite compositeOutbound
+	for _, spec := range c.knownCompositeOutbounds {
+		var section config.AttributeMap
+		found, err := attrs.Pop(spec.Name, &section)
+		if err != nil {
+			return composite, false, fmt.Errorf("failed to read %v configuration for outbound %q: %v", spec.Name, name, err)
+		}
+		if !found {
+			continue
+		}
+		if composite.Spec != nil {
+			return composite, false, fmt.Errorf(
+				"outbound %q cannot be both %v and %v", name, composite.Spec.Name, spec.Name)
+		}
+		composite.Spec = spec
+		composite.Attrs = section
+	}
+	if composite.Spec == nil {
+		return composite, false, nil
+	}
+
+	composite.Service, err = attrs.PopString("service")
+	if err != nil {
+		return composite, false, fmt.Errorf("failed to read service name for outbound %q: %v", name, err)
+	}
+	if composite.Service == "" {
+		composite.Service = name
+	}
+
+	// Composite outbounds send requests over other outbounds, so no
+	// transport may be configured for them.
+	var empty struct{}
+	if err := attrs.Decode(&empty); err != nil {
+		return composite, false, fmt.Errorf(
+			"too many attributes in %v outbound configuration for %q: %v", composite.Spec.Name, name, err)
+	}
+	return composite, true, nil
+}
+
+func (c *Configurator) load(serviceName string, cfg *yarpcConfig, ext *extensions) (_ yarpc.Config, err error) {
 	b := newBuilder(serviceName, c.Kit(serviceName))
 
 	for _, inbound := range cfg.Inbounds {
@@ -312,10 +603,180 @@ func (c *Configurator) load(serviceName string, cfg *yarpcConfig) (_ yarpc.Confi
 		return yc, err
 	}
 
+	// Composite outbounds are built from the other outbounds, and may be
+	// wrapped in middleware in turn.
+	if err := c.loadCompositeOutboundsInto(&yc, ext.compositeOutbounds); err != nil {
+		return yarpc.Config{}, err
+	}
+
+	if err := c.loadOutboundMiddlewareInto(&yc, ext.outboundMiddleware); err != nil {
+		return yarpc.Config{}, err
+	}
+
 	cfg.Logging.fill(&yc)
+	if err := cfg.Metrics.fill(&yc); err != nil {
+		return yarpc.Config{}, fmt.Errorf("failed to load metrics configuration: %v", err)
+	}
+	cfg.RequestID.fill(&yc)
+	if err := cfg.Baggage.fill(&yc); err != nil {
+		return yarpc.Config{}, fmt.Errorf("failed to load baggage configuration: %v", err)
+	}
+	for _, spec := range c.knownInboundMiddleware {
+		attrs, ok := ext.inboundMiddleware[spec.Name]
+		if !ok {
+			continue
+		}
+		if err := c.loadInboundMiddlewareInto(&yc, spec, attrs); err != nil {
+			return yarpc.Config{}, err
+		}
+	}
+	if cfg.Restriction != nil {
+		if err := loadRestrictionInto(&yc, *cfg.Restriction); err != nil {
+			return yarpc.Config{}, err
+		}
+	}
 	return yc, nil
 }
 
+func (c *Configurator) loadInboundMiddlewareInto(yc *yarpc.Config, spec *compiledInboundMiddlewareSpec, attrs config.AttributeMap) error {
+	cv, err := spec.InboundMiddleware.Decode(attrs, config.InterpolateWith(c.resolver))
+	if err != nil {
+		return fmt.Errorf("failed to decode %q configuration: %v", spec.Name, err)
+	}
+	result, err := cv.Build(c.Kit(yc.Name))
+	if err != nil {
+		return fmt.Errorf("failed to load %q configuration: %v", spec.Name, err)
+	}
+
+	mw := result.(yarpc.InboundMiddleware)
+	if mw.Unary != nil {
+		yc.InboundMiddleware.Unary = inboundmiddleware.UnaryChain(yc.InboundMiddleware.Unary, mw.Unary)
+	}
+	if mw.Oneway != nil {
+		yc.InboundMiddleware.Oneway = inboundmiddleware.OnewayChain(yc.InboundMiddleware.Oneway, mw.Oneway)
+	}
+	if mw.Stream != nil {
+		yc.InboundMiddleware.Stream = inboundmiddleware.StreamChain(yc.InboundMiddleware.Stream, mw.Stream)
+	}
+	return nil
+}
+
+// loadCompositeOutboundsInto builds the composite outbounds of the
+// configuration from its other outbounds.
+func (c *Configurator) loadCompositeOutboundsInto(yc *yarpc.Config, composites map[string]compositeOutbound) (err error) {
+	names := make([]string, 0, len(composites))
+	for name := range composites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	built := make(yarpc.Outbounds, len(yc.Outbounds)+len(composites))
+	for name, outs := range yc.Outbounds {
+		built[name] = outs
+	}
+
+	for _, name := range names {
+		composite := composites[name]
+		outs, e := c.buildCompositeOutbound(yc.Name, name, composite, built)
+		if e != nil {
+			err = multierr.Append(err, fmt.Errorf("failed to configure %v of outbound %q: %v", composite.Spec.Name, name, e))
+			continue
+		}
+		if yc.Outbounds == nil {
+			yc.Outbounds = make(yarpc.Outbounds, len(composites))
+		}
+		yc.Outbounds[name] = outs
+	}
+	return err
+}
+
+func (c *Configurator) buildCompositeOutbound(serviceName, name string, composite compositeOutbound, built yarpc.Outbounds) (transport.Outbounds, error) {
+	cv, err := composite.Spec.Outbounds.Decode(composite.Attrs, config.InterpolateWith(c.resolver))
+	if err != nil {
+		return transport.Outbounds{}, err
+	}
+	result, err := cv.Build(c.Kit(serviceName).withOutbound(name, built))
+	if err != nil {
+		return transport.Outbounds{}, err
+	}
+	outs := result.(transport.Outbounds)
+	if outs.ServiceName == "" {
+		outs.ServiceName = composite.Service
+	}
+	return outs, nil
+}
+
+// loadOutboundMiddlewareInto wraps the outbounds of the configuration in the
+// middleware configured for them.
+func (c *Configurator) loadOutboundMiddlewareInto(yc *yarpc.Config, sections map[string]map[string]config.AttributeMap) (err error) {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Middleware may use the other outbounds as they were before any
+	// middleware was applied.
+	built := make(yarpc.Outbounds, len(yc.Outbounds))
+	for name, outs := range yc.Outbounds {
+		built[name] = outs
+	}
+
+	for _, spec := range c.knownOutboundMiddleware {
+		for _, name := range names {
+			attrs, ok := sections[name][spec.Name]
+			if !ok {
+				continue
+			}
+			if e := c.applyOutboundMiddleware(yc, built, name, spec, attrs); e != nil {
+				err = multierr.Append(err, fmt.Errorf("failed to configure %v of outbound %q: %v", spec.Name, name, e))
+			}
+		}
+	}
+	return err
+}
+
+func (c *Configurator) applyOutboundMiddleware(yc *yarpc.Config, built yarpc.Outbounds, name string, spec *compiledOutboundMiddlewareSpec, attrs config.AttributeMap) error {
+	cv, err := spec.OutboundMiddleware.Decode(attrs, config.InterpolateWith(c.resolver))
+	if err != nil {
+		return err
+	}
+	result, err := cv.Build(yc.Outbounds[name], c.Kit(yc.Name).withOutbound(name, built))
+	if err != nil {
+		return err
+	}
+	yc.Outbounds[name] = result.(transport.Outbounds)
+	return nil
+}
+
+// outboundMeter returns the scope of the named outbound, creating it the
+// first time it is needed.
+func (c *Configurator) outboundMeter(name string) *metrics.Scope {
+	if c.meter == nil {
+		return nil
+	}
+
+	c.outboundMetersMu.Lock()
+	defer c.outboundMetersMu.Unlock()
+
+	meter, ok := c.outboundMeters[name]
+	if !ok {
+		meter = c.meter.Tagged(metrics.Tags{"outbound": name})
+		c.outboundMeters[name] = meter
+	}
+	return meter
+}
+
+func loadRestrictionInto(yc *yarpc.Config, r transportRestriction) error {
+	checker, err := r.checker()
+	if err != nil {
+		return fmt.Errorf("failed to load restriction: %v", err)
+	}
+
+	yc.Restriction = checker
+	return nil
+}
+
 func (c *Configurator) loadInboundInto(b *builder, i inbound) error {
 	if i.Disabled {
 		return nil
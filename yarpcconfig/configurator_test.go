@@ -21,6 +21,9 @@
 package yarpcconfig
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -29,7 +32,10 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/net/metrics"
 	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/middleware"
+	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/api/transport/transporttest"
 	"go.uber.org/yarpc/internal/interpolate"
 	"go.uber.org/yarpc/internal/whitespace"
@@ -69,6 +75,54 @@ func TestConfiguratorRegisterErrors(t *testing.T) {
 	err = New().RegisterPeerListUpdater(PeerListUpdaterSpec{Name: "test"})
 	require.Error(t, err, "expected failure")
 	assert.Contains(t, err.Error(), "invalid PeerListUpdaterSpec for \"test\":")
+
+	require.Panics(t, func() { New().MustRegisterInboundMiddleware(InboundMiddlewareSpec{}) })
+	err = New().RegisterInboundMiddleware(InboundMiddlewareSpec{})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), "name is required")
+	err = New().RegisterInboundMiddleware(InboundMiddlewareSpec{Name: "test"})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), "invalid InboundMiddlewareSpec for \"test\":")
+	err = New().RegisterInboundMiddleware(InboundMiddlewareSpec{
+		Name: "logging",
+		BuildInboundMiddleware: func(struct{}, *Kit) (yarpc.InboundMiddleware, error) {
+			return yarpc.InboundMiddleware{}, nil
+		},
+	})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), `"logging" is a reserved name`)
+
+	require.Panics(t, func() { New().MustRegisterOutboundMiddleware(OutboundMiddlewareSpec{}) })
+	err = New().RegisterOutboundMiddleware(OutboundMiddlewareSpec{})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), "name is required")
+	err = New().RegisterOutboundMiddleware(OutboundMiddlewareSpec{Name: "test"})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), "invalid OutboundMiddlewareSpec for \"test\":")
+	err = New().RegisterOutboundMiddleware(OutboundMiddlewareSpec{
+		Name: "unary",
+		ApplyOutboundMiddleware: func(_ struct{}, outs transport.Outbounds, _ *Kit) (transport.Outbounds, error) {
+			return outs, nil
+		},
+	})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), `"unary" is a reserved name`)
+
+	require.Panics(t, func() { New().MustRegisterCompositeOutbound(CompositeOutboundSpec{}) })
+	err = New().RegisterCompositeOutbound(CompositeOutboundSpec{})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), "name is required")
+	err = New().RegisterCompositeOutbound(CompositeOutboundSpec{Name: "test"})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), "invalid CompositeOutboundSpec for \"test\":")
+	err = New().RegisterCompositeOutbound(CompositeOutboundSpec{
+		Name: "service",
+		BuildOutbounds: func(struct{}, *Kit) (transport.Outbounds, error) {
+			return transport.Outbounds{}, nil
+		},
+	})
+	require.Error(t, err, "expected failure")
+	assert.Contains(t, err.Error(), `"service" is a reserved name`)
 }
 
 func TestConfigurator(t *testing.T) {
@@ -192,6 +246,220 @@ func TestConfigurator(t *testing.T) {
 				return
 			},
 		},
+		{
+			desc: "header logging",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.serviceName = "foo"
+				tt.give = whitespace.Expand(`
+					logging:
+						headers:
+							inbound:
+								request: true
+								response: true
+								deny: [x-debug]
+								redact: [x-tenant-id]
+								redaction: hash
+							outbound:
+								request: true
+								allow: [x-tenant-id, x-routing]
+				`)
+				tt.wantConfig = yarpc.Config{
+					Name: "foo",
+					Logging: yarpc.LoggingConfig{
+						Headers: yarpc.HeaderLoggingConfig{
+							Inbound: yarpc.DirectionalHeaderLoggingConfig{
+								Request:   true,
+								Response:  true,
+								Deny:      []string{"x-debug"},
+								Redact:    []string{"x-tenant-id"},
+								Redaction: yarpc.RedactHash,
+							},
+							Outbound: yarpc.DirectionalHeaderLoggingConfig{
+								Request: true,
+								Allow:   []string{"x-tenant-id", "x-routing"},
+							},
+						},
+					},
+				}
+				return
+			},
+		},
+		{
+			desc: "header logging, invalid redaction",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					logging:
+						headers:
+							inbound:
+								request: true
+								redaction: shred
+				`)
+				tt.wantErr = []string{
+					"error decoding 'logging.headers.inbound.redaction':",
+					`unknown header redaction "shred": expected "mask", "hash" or "drop"`,
+				}
+				return
+			},
+		},
+		{
+			desc: "metrics",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.serviceName = "foo"
+				tt.give = whitespace.Expand(`
+					metrics:
+						inbound:
+							latencyBuckets: [5ms, 50ms, 500ms]
+						tags: [source, procedure]
+						normalizeUnknownProcedures: true
+						maxEdges: 1000
+						prometheus:
+							path: /metrics
+				`)
+				tt.wantConfig = yarpc.Config{
+					Name: "foo",
+					Metrics: yarpc.MetricsConfig{
+						Inbound: yarpc.DirectionalMetricsConfig{
+							LatencyBuckets: []time.Duration{
+								5 * time.Millisecond,
+								50 * time.Millisecond,
+								500 * time.Millisecond,
+							},
+						},
+						Tags:                       []string{"source", "procedure"},
+						NormalizeUnknownProcedures: true,
+						MaxEdges:                   1000,
+						Prometheus:                 &yarpc.PrometheusConfig{Path: "/metrics"},
+					},
+				}
+				return
+			},
+		},
+		{
+			desc: "request ID",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.serviceName = "foo"
+				tt.give = whitespace.Expand(`
+					requestID:
+						enabled: true
+						header: x-trace-request
+				`)
+				tt.wantConfig = yarpc.Config{
+					Name: "foo",
+					RequestID: yarpc.RequestIDConfig{
+						Enabled: true,
+						Header:  "x-trace-request",
+					},
+				}
+				return
+			},
+		},
+		{
+			desc: "baggage",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.serviceName = "foo"
+				tt.give = whitespace.Expand(`
+					baggage:
+						allow: [tenant, experiment]
+						maxSize: 1024
+				`)
+				tt.wantConfig = yarpc.Config{
+					Name: "foo",
+					Baggage: yarpc.BaggageConfig{
+						Allow:   []string{"tenant", "experiment"},
+						MaxSize: 1024,
+					},
+				}
+				return
+			},
+		},
+		{
+			desc: "baggage, invalid key",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					baggage:
+						allow: ["tenant id"]
+				`)
+				tt.wantErr = []string{
+					"failed to load baggage configuration:",
+					`baggage key "tenant id" may only contain letters, digits, "-", "_" and "."`,
+				}
+				return
+			},
+		},
+		{
+			desc: "metrics, unknown tag",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					metrics:
+						tags: [shard_key]
+				`)
+				tt.wantErr = []string{
+					"failed to load metrics configuration:",
+					`unknown metrics tag "shard_key"`,
+				}
+				return
+			},
+		},
+		{
+			desc: "metrics, relative prometheus path",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					metrics:
+						prometheus:
+							path: metrics
+				`)
+				tt.wantErr = []string{
+					"failed to load metrics configuration:",
+					`prometheus path must start with "/", got "metrics"`,
+				}
+				return
+			},
+		},
+		{
+			desc: "metrics, decreasing latency buckets",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					metrics:
+						outbound:
+							latencyBuckets: [1s, 10ms]
+				`)
+				tt.wantErr = []string{
+					"failed to load metrics configuration:",
+					"latency buckets must be increasing at millisecond precision, got 10ms after 1s",
+				}
+				return
+			},
+		},
+		{
+			desc: "metrics, latency buckets equal in milliseconds",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					metrics:
+						inbound:
+							latencyBuckets: [1.2ms, 1.7ms]
+				`)
+				tt.wantErr = []string{
+					"failed to load metrics configuration:",
+					"latency buckets must be increasing at millisecond precision, got 1.7ms after 1.2ms",
+				}
+				return
+			},
+		},
+		{
+			desc: "metrics, sub-millisecond latency bucket",
+			test: func(*testing.T, *gomock.Controller) (tt testCase) {
+				tt.give = whitespace.Expand(`
+					metrics:
+						inbound:
+							latencyBuckets: [500us, 10ms]
+				`)
+				tt.wantErr = []string{
+					"failed to load metrics configuration:",
+					"latency buckets must be at least 1ms, got 500µs",
+				}
+				return
+			},
+		},
 		{
 			desc: "unknown inbound",
 			test: func(*testing.T, *gomock.Controller) (tt testCase) {
@@ -1389,3 +1657,444 @@ func mapVariableResolver(m map[string]string) interpolate.VariableResolver {
 		return
 	}
 }
+
+func TestConfiguratorRestriction(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		cfg, err := New().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			restriction:
+				allow:
+					- transport: grpc
+					  encoding: proto
+		`)))
+		require.NoError(t, err)
+		require.NotNil(t, cfg.Restriction)
+		assert.NoError(t, cfg.Restriction.Check("proto", "grpc"))
+		assert.Error(t, cfg.Restriction.Check("thrift", "grpc"))
+	})
+
+	t.Run("invalid tuple", func(t *testing.T) {
+		_, err := New().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			restriction:
+				allow:
+					- transport: grpc
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to load restriction: tuple missing must have all fields set")
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		_, err := New().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			restriction:
+				allow: []
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to load restriction")
+	})
+}
+
+func TestConfiguratorInboundMiddleware(t *testing.T) {
+	type tagConfig struct {
+		Tag string `config:"tag"`
+	}
+
+	// tagSpec builds middleware that records the configured tag of every
+	// request it sees.
+	tagSpec := func(name string, tags *[]string) InboundMiddlewareSpec {
+		return InboundMiddlewareSpec{
+			Name: name,
+			BuildInboundMiddleware: func(c tagConfig, _ *Kit) (yarpc.InboundMiddleware, error) {
+				if c.Tag == "" {
+					return yarpc.InboundMiddleware{}, errors.New("tag is required")
+				}
+				return yarpc.InboundMiddleware{
+					Unary: middleware.UnaryInboundFunc(func(ctx context.Context, req *transport.Request, resw transport.ResponseWriter, h transport.UnaryHandler) error {
+						*tags = append(*tags, c.Tag)
+						return h.Handle(ctx, req, resw)
+					}),
+				}, nil
+			},
+		}
+	}
+
+	t.Run("chained in order of registration", func(t *testing.T) {
+		var tags []string
+		c := New()
+		c.MustRegisterInboundMiddleware(tagSpec("first", &tags))
+		c.MustRegisterInboundMiddleware(tagSpec("second", &tags))
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			second:
+				tag: b
+			first:
+				tag: a
+		`)))
+		require.NoError(t, err)
+		require.NotNil(t, cfg.InboundMiddleware.Unary)
+		assert.Nil(t, cfg.InboundMiddleware.Oneway)
+		assert.Nil(t, cfg.InboundMiddleware.Stream)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		h := transporttest.NewMockUnaryHandler(mockCtrl)
+		h.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		require.NoError(t, cfg.InboundMiddleware.Unary.Handle(context.Background(), &transport.Request{}, nil, h))
+		assert.Equal(t, []string{"a", "b"}, tags)
+	})
+
+	t.Run("replaced", func(t *testing.T) {
+		var old, tags []string
+		c := New()
+		c.MustRegisterInboundMiddleware(tagSpec("tagged", &old))
+		c.MustRegisterInboundMiddleware(tagSpec("tagged", &tags))
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			tagged:
+				tag: a
+		`)))
+		require.NoError(t, err)
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		h := transporttest.NewMockUnaryHandler(mockCtrl)
+		h.EXPECT().Handle(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		require.NoError(t, cfg.InboundMiddleware.Unary.Handle(context.Background(), &transport.Request{}, nil, h))
+		assert.Empty(t, old)
+		assert.Equal(t, []string{"a"}, tags)
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		var tags []string
+		c := New()
+		c.MustRegisterInboundMiddleware(tagSpec("tagged", &tags))
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(""))
+		require.NoError(t, err)
+		assert.Nil(t, cfg.InboundMiddleware.Unary)
+	})
+
+	t.Run("not registered", func(t *testing.T) {
+		_, err := New().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			tagged:
+				tag: a
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid keys: tagged")
+	})
+
+	t.Run("decode failure", func(t *testing.T) {
+		var tags []string
+		c := New()
+		c.MustRegisterInboundMiddleware(tagSpec("tagged", &tags))
+
+		_, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			tagged:
+				tag: a
+				color: red
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to decode "tagged" configuration`)
+	})
+
+	t.Run("build failure", func(t *testing.T) {
+		var tags []string
+		c := New()
+		c.MustRegisterInboundMiddleware(tagSpec("tagged", &tags))
+
+		_, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			tagged: {}
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to load "tagged" configuration: tag is required`)
+	})
+}
+
+func TestConfiguratorOutboundMiddleware(t *testing.T) {
+	type outboundConfig struct {
+		Name string `config:"name"`
+	}
+
+	type tagConfig struct {
+		Tag string `config:"tag"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbounds := make(map[string]*transporttest.MockUnaryOutbound)
+	newConfigurator := func(opts ...Option) *Configurator {
+		c := New(opts...)
+		c.MustRegisterTransport(TransportSpec{
+			Name: "fake",
+			BuildTransport: func(struct{}, *Kit) (transport.Transport, error) {
+				return transporttest.NewMockTransport(ctrl), nil
+			},
+			BuildUnaryOutbound: func(cfg outboundConfig, _ transport.Transport, _ *Kit) (transport.UnaryOutbound, error) {
+				o := transporttest.NewMockUnaryOutbound(ctrl)
+				outbounds[cfg.Name] = o
+				return o, nil
+			},
+		})
+		return c
+	}
+
+	// tagSpec builds middleware that records the configured tag of every
+	// request it sees.
+	tagSpec := func(name string, tags *[]string) OutboundMiddlewareSpec {
+		return OutboundMiddlewareSpec{
+			Name: name,
+			ApplyOutboundMiddleware: func(c tagConfig, outs transport.Outbounds, _ *Kit) (transport.Outbounds, error) {
+				if c.Tag == "" {
+					return outs, errors.New("tag is required")
+				}
+				outs.Unary = middleware.ApplyUnaryOutbound(outs.Unary, middleware.UnaryOutboundFunc(
+					func(ctx context.Context, req *transport.Request, out transport.UnaryOutbound) (*transport.Response, error) {
+						*tags = append(*tags, c.Tag)
+						return out.Call(ctx, req)
+					}))
+				return outs, nil
+			},
+		}
+	}
+
+	t.Run("applied in order of registration", func(t *testing.T) {
+		var tags []string
+		c := newConfigurator()
+		c.MustRegisterOutboundMiddleware(tagSpec("first", &tags))
+		c.MustRegisterOutboundMiddleware(tagSpec("second", &tags))
+
+		cfg, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					second: {tag: b}
+					first: {tag: a}
+		`)))
+		require.NoError(t, err)
+
+		outbounds["primary"].EXPECT().Call(gomock.Any(), gomock.Any()).Return(&transport.Response{}, nil)
+		_, err = cfg.Outbounds["myservice"].Unary.Call(context.Background(), &transport.Request{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b", "a"}, tags, "later middleware must wrap earlier middleware")
+	})
+
+	t.Run("kit", func(t *testing.T) {
+		var (
+			names  []string
+			others []transport.Outbounds
+			meters []*metrics.Scope
+		)
+		root := metrics.New()
+		c := newConfigurator(Meter(root.Scope()))
+		var tags []string
+		c.MustRegisterOutboundMiddleware(tagSpec("tagged", &tags))
+		c.MustRegisterOutboundMiddleware(OutboundMiddlewareSpec{
+			Name: "recorded",
+			ApplyOutboundMiddleware: func(_ struct{}, outs transport.Outbounds, kit *Kit) (transport.Outbounds, error) {
+				names = append(names, kit.OutboundName())
+				other, ok := kit.Outbounds("other")
+				require.True(t, ok, "other outbound must be available")
+				others = append(others, other)
+				meters = append(meters, kit.Meter())
+				return outs, nil
+			},
+		})
+
+		give := whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					recorded: {}
+				other:
+					fake: {name: other}
+					tagged: {tag: a}
+		`)
+		for i := 0; i < 2; i++ {
+			_, err := c.LoadConfigFromYAML("foo", strings.NewReader(give))
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{"myservice", "myservice"}, names)
+		assert.Equal(t, outbounds["other"], others[1].Unary, "other outbounds must not be wrapped")
+		assert.True(t, meters[0] == meters[1], "meter must be reused across loads")
+		counter, err := meters[0].Counter(metrics.Spec{Name: "test", Help: "test"})
+		require.NoError(t, err)
+		counter.Inc()
+		require.Len(t, root.Snapshot().Counters, 1)
+		assert.Equal(t, metrics.Tags{"outbound": "myservice"}, root.Snapshot().Counters[0].Tags)
+	})
+
+	t.Run("not registered", func(t *testing.T) {
+		_, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					tagged: {tag: a}
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "at most one outbound type may be specified")
+	})
+
+	t.Run("apply failure", func(t *testing.T) {
+		var tags []string
+		c := newConfigurator()
+		c.MustRegisterOutboundMiddleware(tagSpec("tagged", &tags))
+
+		_, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					fake: {name: primary}
+					tagged: {}
+		`)))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `failed to configure tagged of outbound "myservice": tag is required`)
+	})
+
+	t.Run("transport name", func(t *testing.T) {
+		var tags []string
+		err := newConfigurator().RegisterOutboundMiddleware(tagSpec("fake", &tags))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"fake" is the name of a transport`)
+	})
+}
+
+func TestConfiguratorCompositeOutbound(t *testing.T) {
+	type outboundConfig struct {
+		Name string `config:"name"`
+	}
+
+	type compositeConfig struct {
+		Target string `config:"target"`
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	outbounds := make(map[string]*transporttest.MockUnaryOutbound)
+	newConfigurator := func() *Configurator {
+		c := New()
+		c.MustRegisterTransport(TransportSpec{
+			Name: "fake",
+			BuildTransport: func(struct{}, *Kit) (transport.Transport, error) {
+				return transporttest.NewMockTransport(ctrl), nil
+			},
+			BuildUnaryOutbound: func(cfg outboundConfig, _ transport.Transport, _ *Kit) (transport.UnaryOutbound, error) {
+				o := transporttest.NewMockUnaryOutbound(ctrl)
+				outbounds[cfg.Name] = o
+				return o, nil
+			},
+		})
+		// The alias outbound sends requests over its target.
+		for _, name := range []string{"alias", "other"} {
+			c.MustRegisterCompositeOutbound(CompositeOutboundSpec{
+				Name: name,
+				BuildOutbounds: func(cfg compositeConfig, kit *Kit) (transport.Outbounds, error) {
+					target, ok := kit.Outbounds(cfg.Target)
+					if !ok {
+						return transport.Outbounds{}, fmt.Errorf("unknown outbound %q", cfg.Target)
+					}
+					return transport.Outbounds{Unary: target.Unary}, nil
+				},
+			})
+		}
+		return c
+	}
+
+	t.Run("built", func(t *testing.T) {
+		cfg, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					alias: {target: myservice-v1}
+				renamed:
+					service: myservice
+					alias: {target: myservice-v1}
+				myservice-v1:
+					fake: {name: v1}
+		`)))
+		require.NoError(t, err)
+
+		assert.Equal(t, "myservice", cfg.Outbounds["myservice"].ServiceName)
+		assert.Equal(t, "myservice", cfg.Outbounds["renamed"].ServiceName)
+		assert.Equal(t, outbounds["v1"], cfg.Outbounds["myservice"].Unary)
+	})
+
+	t.Run("wrapped in middleware", func(t *testing.T) {
+		var wrapped []string
+		c := newConfigurator()
+		c.MustRegisterOutboundMiddleware(OutboundMiddlewareSpec{
+			Name: "wrapped",
+			ApplyOutboundMiddleware: func(_ struct{}, outs transport.Outbounds, kit *Kit) (transport.Outbounds, error) {
+				wrapped = append(wrapped, kit.OutboundName())
+				return outs, nil
+			},
+		})
+
+		_, err := c.LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(`
+			outbounds:
+				myservice:
+					alias: {target: myservice-v1}
+					wrapped: {}
+				myservice-v1:
+					fake: {name: v1}
+		`)))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"myservice"}, wrapped)
+	})
+
+	tests := []struct {
+		desc    string
+		give    string
+		wantErr string
+	}{
+		{
+			desc: "build failure",
+			give: `
+				outbounds:
+					myservice:
+						alias: {target: myservice-v1}
+			`,
+			wantErr: `failed to configure alias of outbound "myservice": unknown outbound "myservice-v1"`,
+		},
+		{
+			desc: "other composite outbound",
+			give: `
+				outbounds:
+					myservice:
+						alias: {target: myservice-v1}
+					myservice-v1:
+						alias: {target: myservice-v2}
+					myservice-v2:
+						fake: {name: v2}
+			`,
+			wantErr: `failed to configure alias of outbound "myservice": unknown outbound "myservice-v1"`,
+		},
+		{
+			desc: "transport",
+			give: `
+				outbounds:
+					myservice:
+						fake: {name: v1}
+						alias: {target: myservice-v1}
+			`,
+			wantErr: `too many attributes in alias outbound configuration for "myservice"`,
+		},
+		{
+			desc: "several composite outbounds",
+			give: `
+				outbounds:
+					myservice:
+						alias: {target: myservice-v1}
+						other: {target: myservice-v1}
+			`,
+			wantErr: `outbound "myservice" cannot be both alias and other`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			_, err := newConfigurator().LoadConfigFromYAML("foo", strings.NewReader(whitespace.Expand(tt.give)))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
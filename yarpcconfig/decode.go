@@ -23,10 +23,17 @@ package yarpcconfig
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/uber-go/mapdecode"
 	"go.uber.org/yarpc"
+	"go.uber.org/yarpc/api/transport"
+	"go.uber.org/yarpc/api/x/restriction"
+	internalbaggage "go.uber.org/yarpc/internal/baggage"
 	"go.uber.org/yarpc/internal/config"
+	"go.uber.org/yarpc/internal/observability"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -35,6 +42,44 @@ type yarpcConfig struct {
 	Outbounds  clientConfigs                  `config:"outbounds"`
 	Transports map[string]config.AttributeMap `config:"transports"`
 	Logging    logging                        `config:"logging"`
+	Metrics    metricsConfig                  `config:"metrics"`
+	RequestID  requestID                      `config:"requestID"`
+	Baggage    baggage                        `config:"baggage"`
+
+	Restriction *transportRestriction `config:"restriction"`
+}
+
+// _builtinSections are the top-level keys of the configuration that YARPC
+// itself supports.
+var _builtinSections = configKeys(reflect.TypeOf(yarpcConfig{}))
+
+func configKeys(t reflect.Type) map[string]struct{} {
+	keys := make(map[string]struct{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("config"), ",")[0]
+		keys[name] = struct{}{}
+	}
+	return keys
+}
+
+// transportRestriction allows limiting the transport-encoding combinations
+// used by outbounds from YAML.
+type transportRestriction struct {
+	Allow []struct {
+		Transport string `config:"transport"`
+		Encoding  string `config:"encoding"`
+	} `config:"allow"`
+}
+
+func (r transportRestriction) checker() (restriction.Checker, error) {
+	tuples := make([]restriction.Tuple, 0, len(r.Allow))
+	for _, a := range r.Allow {
+		tuples = append(tuples, restriction.Tuple{
+			Transport: a.Transport,
+			Encoding:  transport.Encoding(a.Encoding),
+		})
+	}
+	return restriction.NewChecker(tuples...)
 }
 
 // logging allows configuring the log levels from YAML.
@@ -49,6 +94,91 @@ type logging struct {
 		Inbound  levels `config:"inbound"`
 		Outbound levels `config:"outbound"`
 	} `config:"levels"`
+
+	Headers struct {
+		Inbound  headerLogging `config:"inbound"`
+		Outbound headerLogging `config:"outbound"`
+	} `config:"headers"`
+}
+
+// metricsConfig allows configuring call metrics from YAML.
+type metricsConfig struct {
+	Inbound                    directionalMetrics `config:"inbound"`
+	Outbound                   directionalMetrics `config:"outbound"`
+	Tags                       []string           `config:"tags"`
+	NormalizeUnknownProcedures bool               `config:"normalizeUnknownProcedures"`
+	MaxEdges                   int                `config:"maxEdges"`
+	Prometheus                 *prometheus        `config:"prometheus"`
+}
+
+type prometheus struct {
+	Path string `config:"path"`
+}
+
+type directionalMetrics struct {
+	LatencyBuckets []time.Duration `config:"latencyBuckets"`
+}
+
+// Fills values from this object into the provided YARPC config.
+func (m *metricsConfig) fill(cfg *yarpc.Config) error {
+	if err := observability.ValidateTags(m.Tags); err != nil {
+		return err
+	}
+	for _, d := range []directionalMetrics{m.Inbound, m.Outbound} {
+		if _, err := observability.LatencyBucketsMs(d.LatencyBuckets); err != nil {
+			return err
+		}
+	}
+	if m.MaxEdges < 0 {
+		return fmt.Errorf("maxEdges must not be negative, got %d", m.MaxEdges)
+	}
+	if p := m.Prometheus; p != nil && p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("prometheus path must start with %q, got %q", "/", p.Path)
+	}
+
+	cfg.Metrics.Inbound.LatencyBuckets = m.Inbound.LatencyBuckets
+	cfg.Metrics.Outbound.LatencyBuckets = m.Outbound.LatencyBuckets
+	cfg.Metrics.Tags = m.Tags
+	cfg.Metrics.NormalizeUnknownProcedures = m.NormalizeUnknownProcedures
+	cfg.Metrics.MaxEdges = m.MaxEdges
+	if m.Prometheus != nil {
+		cfg.Metrics.Prometheus = &yarpc.PrometheusConfig{Path: m.Prometheus.Path}
+	}
+	return nil
+}
+
+// requestID allows configuring request IDs from YAML.
+type requestID struct {
+	Enabled bool   `config:"enabled"`
+	Header  string `config:"header"`
+}
+
+// Fills values from this object into the provided YARPC config.
+func (r *requestID) fill(cfg *yarpc.Config) {
+	cfg.RequestID.Enabled = r.Enabled
+	cfg.RequestID.Header = r.Header
+}
+
+// baggage allows configuring baggage propagation from YAML.
+type baggage struct {
+	Allow   []string `config:"allow"`
+	MaxSize int      `config:"maxSize"`
+}
+
+// Fills values from this object into the provided YARPC config.
+func (b *baggage) fill(cfg *yarpc.Config) error {
+	for _, k := range b.Allow {
+		if err := internalbaggage.ValidateKey(k); err != nil {
+			return err
+		}
+	}
+	if b.MaxSize < 0 {
+		return fmt.Errorf("maxSize must not be negative, got %d", b.MaxSize)
+	}
+
+	cfg.Baggage.Allow = b.Allow
+	cfg.Baggage.MaxSize = b.MaxSize
+	return nil
 }
 
 type levels struct {
@@ -65,6 +195,9 @@ func (l *logging) fill(cfg *yarpc.Config) {
 
 	l.Levels.Inbound.fill(&cfg.Logging.Levels.Inbound)
 	l.Levels.Outbound.fill(&cfg.Logging.Levels.Outbound)
+
+	l.Headers.Inbound.fill(&cfg.Logging.Headers.Inbound)
+	l.Headers.Outbound.fill(&cfg.Logging.Headers.Outbound)
 }
 
 func (l *levels) fill(cfg *yarpc.DirectionalLogLevelConfig) {
@@ -73,6 +206,41 @@ func (l *levels) fill(cfg *yarpc.DirectionalLogLevelConfig) {
 	cfg.ApplicationError = (*zapcore.Level)(l.ApplicationError)
 }
 
+type headerLogging struct {
+	Request   bool            `config:"request"`
+	Response  bool            `config:"response"`
+	Allow     []string        `config:"allow"`
+	Deny      []string        `config:"deny"`
+	Redact    []string        `config:"redact"`
+	Redaction headerRedaction `config:"redaction"`
+}
+
+func (h *headerLogging) fill(cfg *yarpc.DirectionalHeaderLoggingConfig) {
+	cfg.Request = h.Request
+	cfg.Response = h.Response
+	cfg.Allow = h.Allow
+	cfg.Deny = h.Deny
+	cfg.Redact = h.Redact
+	cfg.Redaction = yarpc.HeaderRedaction(h.Redaction)
+}
+
+type headerRedaction yarpc.HeaderRedaction
+
+func (r *headerRedaction) Decode(into mapdecode.Into) error {
+	var s string
+	if err := into(&s); err != nil {
+		return fmt.Errorf("could not decode header redaction: %v", err)
+	}
+
+	switch yarpc.HeaderRedaction(s) {
+	case yarpc.RedactMask, yarpc.RedactHash, yarpc.RedactDrop:
+		*r = headerRedaction(s)
+		return nil
+	}
+	return fmt.Errorf("unknown header redaction %q: expected %q, %q or %q",
+		s, yarpc.RedactMask, yarpc.RedactHash, yarpc.RedactDrop)
+}
+
 type zapLevel zapcore.Level
 
 // mapdecode doesn't suport encoding.TextMarhsaler by default so we have to do
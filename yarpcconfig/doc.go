@@ -88,9 +88,11 @@
 // 	  # ...
 // 	logging:
 // 	  # ...
+// 	authorization:
+// 	  # ...
 //
-// See the following sections for details on the logging, transports,
-// inbounds, and outbounds keys in the configuration.
+// See the following sections for details on the logging, authorization,
+// transports, inbounds, and outbounds keys in the configuration.
 //
 // Inbound Configuration
 //
@@ -293,6 +295,193 @@
 //  panic
 //  fatal
 //
+// The 'headers' key under 'logging' configures which request and response
+// headers are logged, separately for 'inbound' and 'outbound' requests. No
+// headers are logged by default.
+//
+// 	logging:
+// 	  headers:
+// 	    inbound:
+// 	      request: true
+// 	      response: true
+// 	      deny: [x-debug-payload]
+// 	      redact: [x-tenant-id]
+// 	      redaction: hash
+// 	    outbound:
+// 	      request: true
+// 	      allow: [x-tenant-id]
+//
+// The following keys are supported for each direction,
+//
+//  request, response
+//    Enable logging of request and response headers.
+//  allow
+//    If non-empty, lists the only headers which are logged.
+//  deny
+//    Lists headers which are never logged.
+//  redact
+//    Lists headers whose values are redacted. Headers whose names look like
+//    they carry secrets, such as "authorization" or "x-session-token", are
+//    always redacted.
+//  redaction
+//    How redacted headers are logged: "mask" replaces their values with
+//    "[REDACTED]", "hash" with a truncated HMAC-SHA256 keyed with a random
+//    per-process key, and "drop" omits them. Defaults to "mask".
+//
+// Metrics Configuration
+//
+// The 'metrics' attribute configures the call metrics recorded by YARPC's
+// observability middleware.
+//
+// 	metrics:
+// 	  inbound:
+// 	    latencyBuckets: [1ms, 5ms, 10ms, 50ms, 100ms, 500ms, 1s]
+// 	  tags: [source, dest, procedure, encoding, transport]
+// 	  normalizeUnknownProcedures: true
+// 	  maxEdges: 1000
+// 	  prometheus:
+// 	    path: /metrics
+//
+// The following keys are supported under the 'metrics' key,
+//
+//  inbound, outbound
+//    The 'latencyBuckets' key under either lists the upper bounds of the
+//    buckets of latency histograms for calls in that direction, in
+//    increasing order with millisecond precision. Defaults to the RPC
+//    latency buckets of go.uber.org/net/metrics/bucket.
+//  tags
+//    If non-empty, lists the tags of call metrics which are kept, among
+//    source, dest, transport, procedure, encoding, routing_key and
+//    routing_delegate. The direction and rpc_type tags are always kept.
+//  normalizeUnknownProcedures
+//    Records inbound calls to procedures which are not registered with the
+//    procedure tag "__unknown_procedure__".
+//  maxEdges
+//    Caps the number of distinct combinations of tags that call metrics are
+//    recorded for. Calls with further combinations are recorded with the
+//    tags "__overflow__".
+//  prometheus
+//    Serves metrics in the Prometheus exposition format through
+//    Dispatcher.MetricsHandler. If the 'path' key is set, HTTP inbounds also
+//    serve them under that path.
+//
+// Request ID Configuration
+//
+// The 'requestID' attribute gives every inbound request a request ID, taken
+// from a request header or newly generated, and sends it with outbound
+// requests made with the context of the request. Log entries include it
+// under "requestID".
+//
+// 	requestID:
+// 	  enabled: true
+// 	  header: x-request-id
+//
+// The header defaults to "x-request-id".
+//
+// Baggage Configuration
+//
+// The 'baggage' attribute lists the keys of the baggage, set with
+// yarpc.WithBaggage, which is accepted from inbound requests and sent with
+// outbound requests. Without it, no baggage is propagated.
+//
+// 	baggage:
+// 	  allow: [tenant, experiment]
+// 	  maxSize: 4096
+//
+// The maxSize limits the total size of the keys and values of the baggage of
+// a request, in bytes, and defaults to 4096.
+//
+// Inbound Middleware Configuration
+//
+// Inbound middleware that applies to all procedures may be configured under
+// its own top-level attribute once its InboundMiddlewareSpec is registered
+// with the Configurator. For example, the authorization policy of
+// go.uber.org/yarpc/x/auth is loaded from the 'authorization' attribute.
+//
+// 	cfg := yarpcconfig.New()
+// 	cfg.MustRegisterInboundMiddleware(auth.InboundMiddlewareSpec())
+//
+// 	authorization:
+// 	  default: deny
+// 	  rules:
+// 	    - effect: allow
+// 	      callers: [frontend]
+//
+// Configured middleware is chained after the inbound middleware of the loaded
+// configuration, in the order in which the specs were registered.
+//
+// Composite Outbounds
+//
+// Outbounds that send requests over the other outbounds of the
+// configuration, instead of a transport, may be configured under their own
+// attribute once their CompositeOutboundSpec is registered with the
+// Configurator. For example, the outbound of go.uber.org/yarpc/x/routing
+// sends each request to one of the other outbounds, and is configured with
+// the 'routing' attribute.
+//
+// 	cfg := yarpcconfig.New()
+// 	cfg.MustRegisterCompositeOutbound(routing.OutboundSpec())
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    routing:
+// 	      default: keyvalue-stable
+// 	      routes:
+// 	        - outbound: keyvalue-canary
+// 	          headers: {x-canary: "true"}
+// 	        - outbound: keyvalue-canary
+// 	          percent: 1
+// 	  keyvalue-stable:
+// 	    http: {url: "http://keyvalue/yarpc"}
+// 	  keyvalue-canary:
+// 	    http: {url: "http://keyvalue-canary/yarpc"}
+//
+// Composite outbounds may only send requests over outbounds with a
+// transport, but may be wrapped in outbound middleware. Similarly,
+// go.uber.org/yarpc/x/failover provides a 'failover' outbound that sends
+// requests to the first healthy one of several outbounds. Use the Logger
+// option to log when it fails over.
+//
+// Outbound Middleware Configuration
+//
+// Middleware may be configured for individual outbounds under its own
+// attribute once its OutboundMiddlewareSpec is registered with the
+// Configurator. For example, go.uber.org/yarpc/x/shadow mirrors requests to
+// another outbound, configured with the 'shadow' attribute.
+//
+// 	cfg := yarpcconfig.New()
+// 	cfg.MustRegisterOutboundMiddleware(shadow.OutboundMiddlewareSpec())
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    http: {url: "http://keyvalue/yarpc"}
+// 	    shadow:
+// 	      outbound: keyvalue-v2
+// 	      percent: 5
+// 	  keyvalue-v2:
+// 	    grpc: {address: "keyvalue-v2:8080"}
+//
+// Middleware registered later wraps middleware registered earlier, so
+// register go.uber.org/yarpc/x/singleflight after shadow to coalesce
+// identical requests before they are shadowed. Use the Meter option to record
+// the metrics of outbound middleware.
+//
+// Restriction Configuration
+//
+// The 'restriction' attribute lists the transport-encoding combinations that
+// outbounds may use. Requests with any other combination, for example Thrift
+// over gRPC, fail with CodeInvalidArgument regardless of the client that
+// made them. Combinations are checked when requests are made, since the
+// encodings of an outbound are not known before then. Only outbounds using a
+// transport that is not listed at all make the dispatcher fail to start.
+//
+// 	restriction:
+// 	  allow:
+// 	    - transport: grpc
+// 	      encoding: proto
+// 	    - transport: tchannel
+// 	      encoding: thrift
+//
 // Customizing Configuration
 //
 // When building your own TransportSpec, PeerListSpec, or PeerListUpdaterSpec,
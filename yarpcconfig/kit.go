@@ -27,8 +27,11 @@ import (
 	"sort"
 	"strings"
 
+	"go.uber.org/net/metrics"
+	"go.uber.org/yarpc"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/internal/interpolate"
+	"go.uber.org/zap"
 )
 
 // Kit is an opaque object that carries context for the Configurator. Build
@@ -43,6 +46,12 @@ type Kit struct {
 
 	// TransportSpec currently being used. This may or may not be set.
 	transportSpec *compiledTransportSpec
+
+	// Outbound currently being configured and the outbounds it may use.
+	// These are set only while building composite outbounds or applying
+	// outbound middleware.
+	outboundName string
+	outbounds    yarpc.Outbounds
 }
 
 // Returns a shallow copy of this Kit with spec set to the given value.
@@ -52,6 +61,15 @@ func (k *Kit) withTransportSpec(spec *compiledTransportSpec) *Kit {
 	return &newK
 }
 
+// Returns a shallow copy of this Kit for configuring the named outbound with
+// the given outbounds available.
+func (k *Kit) withOutbound(name string, outbounds yarpc.Outbounds) *Kit {
+	newK := *k
+	newK.outboundName = name
+	newK.outbounds = outbounds
+	return &newK
+}
+
 // ServiceName returns the name of the service for which components are being
 // built.
 func (k *Kit) ServiceName() string { return k.name }
@@ -122,6 +140,35 @@ func (k *Kit) peerListUpdaterSpecNames() (names []string) {
 	return
 }
 
+// OutboundName returns the name of the outbound being configured, or an empty
+// string if no outbound is being configured.
+func (k *Kit) OutboundName() string { return k.outboundName }
+
+// Outbounds returns the named outbound of the configuration, before any
+// outbound middleware is applied. It is only available to composite outbounds,
+// which may only use the outbounds built by transports, and to outbound
+// middleware.
+func (k *Kit) Outbounds(name string) (transport.Outbounds, bool) {
+	outs, ok := k.outbounds[name]
+	return outs, ok
+}
+
+// Meter returns the scope in which components built from the configuration
+// record metrics, or nil if metrics are not recorded. While an outbound is
+// being configured, the scope is tagged with the name of the outbound.
+//
+// The same scope is returned each time a configuration is loaded, so metrics
+// must only be registered with it once.
+func (k *Kit) Meter() *metrics.Scope {
+	if k.outboundName == "" {
+		return k.c.meter
+	}
+	return k.c.outboundMeter(k.outboundName)
+}
+
+// Logger returns the logger of components built from the configuration.
+func (k *Kit) Logger() *zap.Logger { return k.c.logger }
+
 // Compressor returns the known compressor for the given name or nil if the
 // named compressor is not known.
 func (k *Kit) Compressor(name string) transport.Compressor {
@@ -20,6 +20,11 @@
 
 package yarpcconfig
 
+import (
+	"go.uber.org/net/metrics"
+	"go.uber.org/zap"
+)
+
 // Option customizes a Configurator.
 type Option func(*Configurator)
 
@@ -44,3 +49,20 @@ func InterpolationResolver(f func(k string) (v string, ok bool)) Option {
 		c.resolver = f
 	}
 }
+
+// Meter specifies the scope in which components built from configuration,
+// such as outbound middleware, record metrics. By default, these metrics are
+// not recorded.
+func Meter(meter *metrics.Scope) Option {
+	return func(c *Configurator) {
+		c.meter = meter
+	}
+}
+
+// Logger specifies the logger of components built from configuration, such
+// as composite outbounds. By default, nothing is logged.
+func Logger(logger *zap.Logger) Option {
+	return func(c *Configurator) {
+		c.logger = logger
+	}
+}
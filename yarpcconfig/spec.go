@@ -28,6 +28,7 @@ import (
 
 	"github.com/uber-go/mapdecode"
 	"go.uber.org/multierr"
+	"go.uber.org/yarpc"
 	"go.uber.org/yarpc/api/peer"
 	"go.uber.org/yarpc/api/transport"
 	"go.uber.org/yarpc/internal/config"
@@ -244,6 +245,109 @@ type PeerListUpdaterSpec struct {
 	BuildPeerListUpdater interface{}
 }
 
+// InboundMiddlewareSpec specifies the configuration parameters of inbound
+// middleware that applies to all procedures of a dispatcher. These
+// specifications are registered against a Configurator to teach it how to
+// parse the top-level configuration section with the same name and build the
+// middleware.
+//
+// For example, the authorization middleware of go.uber.org/yarpc/x/auth is
+// configured under the 'authorization' key.
+//
+// 	authorization:
+// 	  default: deny
+// 	  rules:
+// 	    - effect: allow
+// 	      callers: [frontend]
+type InboundMiddlewareSpec struct {
+	// Name of the configuration section. It may not be the name of a
+	// section that YARPC itself supports, such as 'inbounds' or 'logging'.
+	Name string
+
+	// A function in the shape,
+	//
+	//  func(C, *config.Kit) (yarpc.InboundMiddleware, error)
+	//
+	// Where C is a struct or pointer to a struct defining the configuration
+	// parameters of the middleware.
+	//
+	// BuildInboundMiddleware is required.
+	BuildInboundMiddleware interface{}
+}
+
+// OutboundMiddlewareSpec specifies the configuration parameters of outbound
+// middleware applied to individual outbounds. These specifications are
+// registered against a Configurator to teach it how to parse the attribute
+// with the same name in the configuration of an outbound and wrap the
+// outbound in the middleware.
+//
+// For example, the middleware of go.uber.org/yarpc/x/shadow is configured
+// under the 'shadow' key of the outbounds it mirrors.
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    http: {url: "http://keyvalue/yarpc"}
+// 	    shadow:
+// 	      outbound: keyvalue-v2
+type OutboundMiddlewareSpec struct {
+	// Name of the attribute. It may not be the name of an attribute that
+	// YARPC itself supports, such as 'service' or 'unary', nor the name of a
+	// transport.
+	Name string
+
+	// A function in the shape,
+	//
+	//  func(C, transport.Outbounds, *config.Kit) (transport.Outbounds, error)
+	//
+	// Where C is a struct or pointer to a struct defining the configuration
+	// parameters of the middleware. The function receives the outbounds
+	// configured with the attribute and returns them wrapped in the
+	// middleware. Kit.OutboundName and Kit.Outbounds provide the name of
+	// the outbound and the other outbounds of the configuration.
+	//
+	// ApplyOutboundMiddleware is required.
+	ApplyOutboundMiddleware interface{}
+}
+
+// CompositeOutboundSpec specifies the configuration parameters of outbounds
+// that send requests over the other outbounds of a configuration, instead of
+// a transport. These specifications are registered against a Configurator to
+// teach it how to build outbounds configured with the attribute with the
+// same name.
+//
+// For example, the outbound of go.uber.org/yarpc/x/routing is configured
+// under the 'routing' key.
+//
+// 	outbounds:
+// 	  keyvalue:
+// 	    routing:
+// 	      default: keyvalue-stable
+// 	      routes:
+// 	        - outbound: keyvalue-canary
+// 	          percent: 5
+//
+// No transport may be configured for composite outbounds, but they may be
+// wrapped in outbound middleware.
+type CompositeOutboundSpec struct {
+	// Name of the attribute. It may not be the name of an attribute that
+	// YARPC itself supports, such as 'service' or 'unary', nor the name of a
+	// transport.
+	Name string
+
+	// A function in the shape,
+	//
+	//  func(C, *config.Kit) (transport.Outbounds, error)
+	//
+	// Where C is a struct or pointer to a struct defining the configuration
+	// parameters of the outbound. Kit.OutboundName and Kit.Outbounds provide
+	// the name of the outbound and the other outbounds of the configuration.
+	// The service name of the outbounds defaults to that of the
+	// configuration.
+	//
+	// BuildOutbounds is required.
+	BuildOutbounds interface{}
+}
+
 var (
 	_typeOfError           = reflect.TypeOf((*error)(nil)).Elem()
 	_typeOfTransport       = reflect.TypeOf((*transport.Transport)(nil)).Elem()
@@ -255,6 +359,9 @@ var (
 	_typeOfPeerChooserList = reflect.TypeOf((*peer.ChooserList)(nil)).Elem()
 	_typeOfPeerChooser     = reflect.TypeOf((*peer.Chooser)(nil)).Elem()
 	_typeOfBinder          = reflect.TypeOf((*peer.Binder)(nil)).Elem()
+
+	_typeOfInboundMiddleware = reflect.TypeOf(yarpc.InboundMiddleware{})
+	_typeOfOutbounds         = reflect.TypeOf(transport.Outbounds{})
 )
 
 // Compiled internal representation of a user-specified TransportSpec.
@@ -681,6 +788,191 @@ func compilePeerListUpdaterConfig(name string, build interface{}) (*configSpec,
 	return &configSpec{inputType: t.In(0), factory: v}, nil
 }
 
+type compiledInboundMiddlewareSpec struct {
+	Name              string
+	InboundMiddleware *configSpec
+}
+
+func compileInboundMiddlewareSpec(spec *InboundMiddlewareSpec) (*compiledInboundMiddlewareSpec, error) {
+	out := compiledInboundMiddlewareSpec{Name: spec.Name}
+
+	if spec.Name == "" {
+		return nil, errors.New("field Name is required")
+	}
+
+	if _, ok := _builtinSections[spec.Name]; ok {
+		return nil, fmt.Errorf("inbound middleware name cannot be %q: %q is a reserved name", spec.Name, spec.Name)
+	}
+
+	if spec.BuildInboundMiddleware == nil {
+		return nil, errors.New("field BuildInboundMiddleware is required")
+	}
+
+	buildInboundMiddleware, err := compileInboundMiddlewareConfig(spec.BuildInboundMiddleware)
+	if err != nil {
+		return nil, err
+	}
+	out.InboundMiddleware = buildInboundMiddleware
+
+	return &out, nil
+}
+
+func compileInboundMiddlewareConfig(build interface{}) (*configSpec, error) {
+	v := reflect.ValueOf(build)
+	t := v.Type()
+
+	var err error
+	switch {
+	case t.Kind() != reflect.Func:
+		err = errors.New("must be a function")
+	case t.NumIn() != 2:
+		err = fmt.Errorf("must accept exactly two arguments, found %v", t.NumIn())
+	case !isDecodable(t.In(0)):
+		err = fmt.Errorf("must accept a struct or struct pointer as its first argument, found %v", t.In(0))
+	case t.In(1) != _typeOfKit:
+		err = fmt.Errorf("must accept a %v as its second argument, found %v", _typeOfKit, t.In(1))
+	case t.NumOut() != 2:
+		err = fmt.Errorf("must return exactly two results, found %v", t.NumOut())
+	case t.Out(0) != _typeOfInboundMiddleware:
+		err = fmt.Errorf("must return a yarpc.InboundMiddleware as its first result, found %v", t.Out(0))
+	case t.Out(1) != _typeOfError:
+		err = fmt.Errorf("must return an error as its second result, found %v", t.Out(1))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid BuildInboundMiddleware %v: %v", t, err)
+	}
+
+	return &configSpec{inputType: t.In(0), factory: v}, nil
+}
+
+type compiledCompositeOutboundSpec struct {
+	Name      string
+	Outbounds *configSpec
+}
+
+func compileCompositeOutboundSpec(spec *CompositeOutboundSpec) (*compiledCompositeOutboundSpec, error) {
+	out := compiledCompositeOutboundSpec{Name: spec.Name}
+
+	if spec.Name == "" {
+		return nil, errors.New("field Name is required")
+	}
+
+	if _, ok := _builtinOutboundAttributes[spec.Name]; ok {
+		return nil, fmt.Errorf("composite outbound name cannot be %q: %q is a reserved name", spec.Name, spec.Name)
+	}
+
+	if spec.BuildOutbounds == nil {
+		return nil, errors.New("field BuildOutbounds is required")
+	}
+
+	buildOutbounds, err := compileCompositeOutboundConfig(spec.BuildOutbounds)
+	if err != nil {
+		return nil, err
+	}
+	out.Outbounds = buildOutbounds
+
+	return &out, nil
+}
+
+func compileCompositeOutboundConfig(build interface{}) (*configSpec, error) {
+	v := reflect.ValueOf(build)
+	t := v.Type()
+
+	var err error
+	switch {
+	case t.Kind() != reflect.Func:
+		err = errors.New("must be a function")
+	case t.NumIn() != 2:
+		err = fmt.Errorf("must accept exactly two arguments, found %v", t.NumIn())
+	case !isDecodable(t.In(0)):
+		err = fmt.Errorf("must accept a struct or struct pointer as its first argument, found %v", t.In(0))
+	case t.In(1) != _typeOfKit:
+		err = fmt.Errorf("must accept a %v as its second argument, found %v", _typeOfKit, t.In(1))
+	case t.NumOut() != 2:
+		err = fmt.Errorf("must return exactly two results, found %v", t.NumOut())
+	case t.Out(0) != _typeOfOutbounds:
+		err = fmt.Errorf("must return a transport.Outbounds as its first result, found %v", t.Out(0))
+	case t.Out(1) != _typeOfError:
+		err = fmt.Errorf("must return an error as its second result, found %v", t.Out(1))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid BuildOutbounds %v: %v", t, err)
+	}
+
+	return &configSpec{inputType: t.In(0), factory: v}, nil
+}
+
+type compiledOutboundMiddlewareSpec struct {
+	Name               string
+	OutboundMiddleware *configSpec
+}
+
+// _builtinOutboundAttributes are the attributes of the configuration of an
+// outbound that YARPC itself supports.
+var _builtinOutboundAttributes = map[string]struct{}{
+	"service": {},
+	"unary":   {},
+	"oneway":  {},
+	"stream":  {},
+}
+
+func compileOutboundMiddlewareSpec(spec *OutboundMiddlewareSpec) (*compiledOutboundMiddlewareSpec, error) {
+	out := compiledOutboundMiddlewareSpec{Name: spec.Name}
+
+	if spec.Name == "" {
+		return nil, errors.New("field Name is required")
+	}
+
+	if _, ok := _builtinOutboundAttributes[spec.Name]; ok {
+		return nil, fmt.Errorf("outbound middleware name cannot be %q: %q is a reserved name", spec.Name, spec.Name)
+	}
+
+	if spec.ApplyOutboundMiddleware == nil {
+		return nil, errors.New("field ApplyOutboundMiddleware is required")
+	}
+
+	applyOutboundMiddleware, err := compileOutboundMiddlewareConfig(spec.ApplyOutboundMiddleware)
+	if err != nil {
+		return nil, err
+	}
+	out.OutboundMiddleware = applyOutboundMiddleware
+
+	return &out, nil
+}
+
+func compileOutboundMiddlewareConfig(apply interface{}) (*configSpec, error) {
+	v := reflect.ValueOf(apply)
+	t := v.Type()
+
+	var err error
+	switch {
+	case t.Kind() != reflect.Func:
+		err = errors.New("must be a function")
+	case t.NumIn() != 3:
+		err = fmt.Errorf("must accept exactly three arguments, found %v", t.NumIn())
+	case !isDecodable(t.In(0)):
+		err = fmt.Errorf("must accept a struct or struct pointer as its first argument, found %v", t.In(0))
+	case t.In(1) != _typeOfOutbounds:
+		err = fmt.Errorf("must accept a transport.Outbounds as its second argument, found %v", t.In(1))
+	case t.In(2) != _typeOfKit:
+		err = fmt.Errorf("must accept a %v as its third argument, found %v", _typeOfKit, t.In(2))
+	case t.NumOut() != 2:
+		err = fmt.Errorf("must return exactly two results, found %v", t.NumOut())
+	case t.Out(0) != _typeOfOutbounds:
+		err = fmt.Errorf("must return a transport.Outbounds as its first result, found %v", t.Out(0))
+	case t.Out(1) != _typeOfError:
+		err = fmt.Errorf("must return an error as its second result, found %v", t.Out(1))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid ApplyOutboundMiddleware %v: %v", t, err)
+	}
+
+	return &configSpec{inputType: t.In(0), factory: v}, nil
+}
+
 // Validated representation of a configuration function specified by the user.
 type configSpec struct {
 	// Type of object expected by the factory function
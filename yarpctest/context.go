@@ -38,6 +38,7 @@ type Call struct {
 	ShardKey        string
 	RoutingKey      string
 	RoutingDelegate string
+	Criticality     transport.Criticality
 
 	// If set, this map will be filled with response headers written to
 	// yarpc.Call.
@@ -80,3 +81,5 @@ func (c callMetadata) Headers() transport.Headers {
 func (c callMetadata) ShardKey() string        { return c.c.ShardKey }
 func (c callMetadata) RoutingKey() string      { return c.c.RoutingKey }
 func (c callMetadata) RoutingDelegate() string { return c.c.RoutingDelegate }
+
+func (c callMetadata) Criticality() transport.Criticality { return c.c.Criticality }